@@ -162,7 +162,7 @@ func fetchZoneIDUsingCloudStack(secret *corev1.Secret, zoneName string) (string,
 		return "", err
 	}
 	zone := &v1beta2.CloudStackZoneSpec{Name: zoneName}
-	err = client.ResolveZone(zone)
+	err = client.ResolveZone(context.TODO(), zone)
 	return zone.ID, err
 }
 
@@ -45,6 +45,10 @@ type CloudStackAffinityGroupSpec struct {
 type CloudStackAffinityGroupStatus struct {
 	// Reflects the readiness of the CS Affinity Group.
 	Ready bool `json:"ready"`
+
+	// AppliedTags are the additional tags of the cluster last applied to the affinity group.
+	// +optional
+	AppliedTags map[string]string `json:"appliedTags,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -34,6 +34,12 @@ type CloudStackClusterSpec struct {
 
 	// The kubernetes control plane endpoint.
 	ControlPlaneEndpoint clusterv1.APIEndpoint `json:"controlPlaneEndpoint"`
+
+	// Tags applied to the CloudStack resources CAPC creates for the cluster, which are its isolated networks, their
+	// public IP addresses, its affinity groups and the instances and volumes of its machines. Changes are applied to
+	// existing resources.
+	// +optional
+	AdditionalTags map[string]string `json:"additionalTags,omitempty"`
 }
 
 // The status of the CloudStackCluster object.
@@ -79,6 +79,7 @@ func (r *CloudStackCluster) ValidateCreate() error {
 			}
 		}
 	}
+	errorList = validateAdditionalTags(r.Spec.AdditionalTags, errorList)
 
 	return webhookutil.AggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, errorList)
 }
@@ -108,6 +109,7 @@ func (r *CloudStackCluster) ValidateUpdate(old runtime.Object) error {
 			string(spec.ControlPlaneEndpoint.Port), string(oldSpec.ControlPlaneEndpoint.Port),
 			"controlplaneendpoint.port", errorList)
 	}
+	errorList = validateAdditionalTags(spec.AdditionalTags, errorList)
 
 	return webhookutil.AggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, errorList)
 }
@@ -146,7 +148,8 @@ func FailureDomainsEqual(fd1, fd2 CloudStackFailureDomainSpec) bool {
 		fd1.Zone.ID == fd2.Zone.ID &&
 		fd1.Zone.Network.Name == fd2.Zone.Network.Name &&
 		fd1.Zone.Network.ID == fd2.Zone.Network.ID &&
-		fd1.Zone.Network.Type == fd2.Zone.Network.Type
+		fd1.Zone.Network.Type == fd2.Zone.Network.Type &&
+		fd1.Zone.CloudStackPlacementHints == fd2.Zone.CloudStackPlacementHints
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
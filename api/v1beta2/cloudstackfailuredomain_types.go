@@ -22,6 +22,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
 // FailureDomainHashedMetaName returns an MD5 name generated from the FailureDomain and Cluster name.
@@ -37,6 +38,16 @@ const (
 	FailureDomainLabelName = "cloudstackfailuredomain.infrastructure.cluster.x-k8s.io/name"
 )
 
+const (
+	// EndpointHealthyCondition reports whether the failure domain's ACS endpoint is taking requests. It is False while
+	// the circuit breaker of the endpoint is open or probing it.
+	EndpointHealthyCondition clusterv1.ConditionType = "EndpointHealthy"
+	// EndpointCircuitOpenReason is used while the endpoint's circuit breaker refuses requests after repeated failures.
+	EndpointCircuitOpenReason = "CircuitOpen"
+	// EndpointCircuitHalfOpenReason is used while the endpoint's circuit breaker lets a request through to probe it.
+	EndpointCircuitHalfOpenReason = "CircuitHalfOpen"
+)
+
 const (
 	NetworkTypeIsolated = "Isolated"
 	NetworkTypeShared   = "Shared"
@@ -67,6 +78,9 @@ type CloudStackZoneSpec struct {
 
 	// The network within the Zone to use.
 	Network Network `json:"network"`
+
+	// Placement hints for the machines of the zone, used for those a machine doesn't set.
+	CloudStackPlacementHints `json:",inline"`
 }
 
 // CloudStackFailureDomainSpec defines the desired state of CloudStackFailureDomain
@@ -85,6 +99,11 @@ type CloudStackFailureDomainSpec struct {
 	// +optional
 	Domain string `json:"domain,omitempty"`
 
+	// CloudStack project, by name or ID. When set, the failure domain's resources are created and looked up in the
+	// project.
+	// +optional
+	Project string `json:"project,omitempty"`
+
 	// Apache CloudStack Endpoint secret reference.
 	ACSEndpoint corev1.SecretReference `json:"acsEndpoint"`
 }
@@ -93,6 +112,10 @@ type CloudStackFailureDomainSpec struct {
 type CloudStackFailureDomainStatus struct {
 	// Reflects the readiness of the CloudStack Failure Domain.
 	Ready bool `json:"ready"`
+
+	// Conditions defines current service state of the CloudStackFailureDomain.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -109,6 +132,16 @@ type CloudStackFailureDomain struct {
 	Status CloudStackFailureDomainStatus `json:"status,omitempty"`
 }
 
+// GetConditions returns the conditions of the CloudStackFailureDomain.
+func (r *CloudStackFailureDomain) GetConditions() clusterv1.Conditions {
+	return r.Status.Conditions
+}
+
+// SetConditions sets the conditions of the CloudStackFailureDomain.
+func (r *CloudStackFailureDomain) SetConditions(conditions clusterv1.Conditions) {
+	r.Status.Conditions = conditions
+}
+
 //+kubebuilder:object:root=true
 
 // CloudStackFailureDomainList contains a list of CloudStackFailureDomain
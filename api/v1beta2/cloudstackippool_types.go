@@ -0,0 +1,273 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MaxIPPoolSize is the largest number of addresses an IP pool may have.
+const MaxIPPoolSize = 65536
+
+// CloudStackIPPoolSpec defines the desired state of CloudStackIPPool
+type CloudStackIPPoolSpec struct {
+	// The network the addresses are on, by ID or name. Machines only claim addresses of pools on the network of their
+	// failure domain's zone.
+	Network CloudStackResourceIdentifier `json:"network"`
+
+	// Addresses of the pool, each a single address such as 10.0.0.10, an inclusive range such as
+	// 10.0.0.10-10.0.0.20, or a CIDR such as 10.0.0.0/28 of which the network and broadcast addresses are left out.
+	Addresses []string `json:"addresses"`
+}
+
+// CloudStackIPPoolClaim is an address of the pool claimed by a CloudStackMachine.
+type CloudStackIPPoolClaim struct {
+	// Claimed address.
+	Address string `json:"address"`
+
+	// Name of the CloudStackMachine the address is claimed by.
+	Machine string `json:"machine"`
+}
+
+// CloudStackIPPoolStatus defines the observed state of CloudStackIPPool
+type CloudStackIPPoolStatus struct {
+	// Claims of the pool's addresses, ordered by address.
+	// +optional
+	Claims []CloudStackIPPoolClaim `json:"claims,omitempty"`
+
+	// Number of addresses of the pool that aren't claimed.
+	// +optional
+	Free int `json:"free"`
+}
+
+// ParseAddresses returns the addresses of the pool in the order of its spec.
+func (s *CloudStackIPPoolSpec) ParseAddresses() ([]netip.Addr, error) {
+	var addresses []netip.Addr
+	for _, entry := range s.Addresses {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case strings.Contains(entry, "/"):
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("parsing CIDR %s: %w", entry, err)
+			}
+			if prefix.Addr().BitLen()-prefix.Bits() > 16 {
+				return nil, fmt.Errorf("CIDR %s has more than %d addresses", entry, MaxIPPoolSize)
+			}
+			prefix = prefix.Masked()
+			first, last := prefix.Addr(), prefix.Addr()
+			for next := last.Next(); next.IsValid() && prefix.Contains(next); next = next.Next() {
+				last = next
+			}
+			if prefix.Addr().Is4() && prefix.Bits() < 31 { // Leave out the network and broadcast addresses.
+				first, last = first.Next(), last.Prev()
+			}
+			addresses = appendRange(addresses, first, last)
+		case strings.Contains(entry, "-"):
+			bounds := strings.SplitN(entry, "-", 2)
+			first, err := netip.ParseAddr(strings.TrimSpace(bounds[0]))
+			if err != nil {
+				return nil, fmt.Errorf("parsing range %s: %w", entry, err)
+			}
+			last, err := netip.ParseAddr(strings.TrimSpace(bounds[1]))
+			if err != nil {
+				return nil, fmt.Errorf("parsing range %s: %w", entry, err)
+			}
+			if first.BitLen() != last.BitLen() || last.Less(first) {
+				return nil, fmt.Errorf("invalid range %s", entry)
+			}
+			addresses = appendRange(addresses, first, last)
+		default:
+			address, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("parsing address %s: %w", entry, err)
+			}
+			addresses = append(addresses, address)
+		}
+		if len(addresses) > MaxIPPoolSize {
+			return nil, fmt.Errorf("IP pool has more than %d addresses", MaxIPPoolSize)
+		}
+	}
+	return addresses, nil
+}
+
+// appendRange appends the addresses from first to last inclusive to addresses, stopping past MaxIPPoolSize addresses.
+func appendRange(addresses []netip.Addr, first, last netip.Addr) []netip.Addr {
+	for address := first; address.IsValid() && !last.Less(address); address = address.Next() {
+		if len(addresses) > MaxIPPoolSize {
+			break
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// Claim returns the address claimed by the named machine, claiming the first free address of the pool for it if it
+// has none yet. It reports whether the status of the pool changed.
+func (p *CloudStackIPPool) Claim(machine string) (address string, claimed bool, err error) {
+	for _, claim := range p.Status.Claims {
+		if claim.Machine == machine {
+			return claim.Address, false, nil
+		}
+	}
+
+	addresses, err := p.Spec.ParseAddresses()
+	if err != nil {
+		return "", false, err
+	}
+	taken := map[string]bool{}
+	for _, claim := range p.Status.Claims {
+		taken[claim.Address] = true
+	}
+	for _, candidate := range addresses {
+		if !taken[candidate.String()] {
+			address = candidate.String()
+			break
+		}
+	}
+	if address == "" {
+		return "", false, fmt.Errorf("no free address left in IP pool %s", p.Name)
+	}
+
+	p.Status.Claims = append(p.Status.Claims, CloudStackIPPoolClaim{Address: address, Machine: machine})
+	p.sortClaims()
+	p.Status.Free = countFree(addresses, p.Status.Claims)
+	return address, true, nil
+}
+
+// Release releases the address claimed by the named machine, if any. It reports whether the status of the pool
+// changed.
+func (p *CloudStackIPPool) Release(machine string) bool {
+	for i, claim := range p.Status.Claims {
+		if claim.Machine != machine {
+			continue
+		}
+		p.Status.Claims = append(p.Status.Claims[:i], p.Status.Claims[i+1:]...)
+		if addresses, err := p.Spec.ParseAddresses(); err == nil {
+			p.Status.Free = countFree(addresses, p.Status.Claims)
+		}
+		return true
+	}
+	return false
+}
+
+// RestoreClaims records the claims of the machines that the pool's status lacks, as found on the machines, so claims
+// lost along with the status are rebuilt. Claims of addresses outside the pool or claimed by another machine are left
+// out. It reports whether the status of the pool changed.
+func (p *CloudStackIPPool) RestoreClaims(claims []CloudStackIPPoolClaim) (bool, error) {
+	addresses, err := p.Spec.ParseAddresses()
+	if err != nil {
+		return false, err
+	}
+	inPool := map[string]bool{}
+	for _, address := range addresses {
+		inPool[address.String()] = true
+	}
+	claimed, taken := map[string]bool{}, map[string]bool{}
+	for _, claim := range p.Status.Claims {
+		claimed[claim.Machine], taken[claim.Address] = true, true
+	}
+
+	restored := false
+	for _, claim := range claims {
+		if claimed[claim.Machine] || taken[claim.Address] || !inPool[claim.Address] {
+			continue
+		}
+		p.Status.Claims = append(p.Status.Claims, claim)
+		claimed[claim.Machine], taken[claim.Address] = true, true
+		restored = true
+	}
+	if restored {
+		p.sortClaims()
+		p.Status.Free = countFree(addresses, p.Status.Claims)
+	}
+	return restored, nil
+}
+
+// UpdateFree counts the addresses of the pool that aren't claimed into its status. It reports whether the count
+// changed.
+func (p *CloudStackIPPool) UpdateFree() (bool, error) {
+	addresses, err := p.Spec.ParseAddresses()
+	if err != nil {
+		return false, err
+	}
+	free := countFree(addresses, p.Status.Claims)
+	changed := free != p.Status.Free
+	p.Status.Free = free
+	return changed, nil
+}
+
+// sortClaims orders the claims of the pool by address.
+func (p *CloudStackIPPool) sortClaims() {
+	sort.Slice(p.Status.Claims, func(i, j int) bool {
+		a, errA := netip.ParseAddr(p.Status.Claims[i].Address)
+		b, errB := netip.ParseAddr(p.Status.Claims[j].Address)
+		if errA != nil || errB != nil {
+			return p.Status.Claims[i].Address < p.Status.Claims[j].Address
+		}
+		return a.Less(b)
+	})
+}
+
+// countFree returns the number of addresses that aren't claimed.
+func countFree(addresses []netip.Addr, claims []CloudStackIPPoolClaim) int {
+	taken := map[string]bool{}
+	for _, claim := range claims {
+		taken[claim.Address] = true
+	}
+	free := 0
+	for _, address := range addresses {
+		if !taken[address.String()] {
+			free++
+		}
+	}
+	return free
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:path=cloudstackippools,scope=Namespaced,categories=cluster-api,shortName=csip
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Network",type="string",JSONPath=".spec.network.name",description="Network of the addresses"
+//+kubebuilder:printcolumn:name="Free",type="integer",JSONPath=".status.free",description="Number of addresses that aren't claimed"
+
+// CloudStackIPPool is the Schema for the cloudstackippools API
+type CloudStackIPPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CloudStackIPPoolSpec   `json:"spec,omitempty"`
+	Status CloudStackIPPoolStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CloudStackIPPoolList contains a list of CloudStackIPPool
+type CloudStackIPPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CloudStackIPPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CloudStackIPPool{}, &CloudStackIPPoolList{})
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2_test
+
+import (
+	"net/netip"
+
+	capcv1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CloudStackIPPool", func() {
+	Context("ParseAddresses", func() {
+		It("parses addresses, ranges and CIDRs in order", func() {
+			spec := capcv1.CloudStackIPPoolSpec{Addresses: []string{"10.0.0.5", "10.0.0.10-10.0.0.12", "10.0.1.0/30"}}
+			addresses, err := spec.ParseAddresses()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(addresses).Should(Equal([]netip.Addr{
+				netip.MustParseAddr("10.0.0.5"),
+				netip.MustParseAddr("10.0.0.10"), netip.MustParseAddr("10.0.0.11"), netip.MustParseAddr("10.0.0.12"),
+				netip.MustParseAddr("10.0.1.1"), netip.MustParseAddr("10.0.1.2"),
+			}))
+		})
+
+		It("keeps both addresses of a /31", func() {
+			spec := capcv1.CloudStackIPPoolSpec{Addresses: []string{"10.0.0.0/31"}}
+			Ω(spec.ParseAddresses()).Should(HaveLen(2))
+		})
+
+		It("rejects invalid entries", func() {
+			for _, entry := range []string{"10.0.0", "10.0.0.12-10.0.0.10", "10.0.0.1-fd00::1", "10.0.0.0/33", "10.0.0.0/8"} {
+				spec := capcv1.CloudStackIPPoolSpec{Addresses: []string{entry}}
+				_, err := spec.ParseAddresses()
+				Ω(err).Should(HaveOccurred(), entry)
+			}
+		})
+
+		It("rejects pools larger than the maximum size", func() {
+			spec := capcv1.CloudStackIPPoolSpec{Addresses: []string{"10.0.0.0/16", "10.1.0.0/16"}}
+			_, err := spec.ParseAddresses()
+			Ω(err).Should(MatchError(ContainSubstring("more than")))
+		})
+	})
+
+	Context("Claim and Release", func() {
+		var pool *capcv1.CloudStackIPPool
+
+		BeforeEach(func() {
+			pool = &capcv1.CloudStackIPPool{Spec: capcv1.CloudStackIPPoolSpec{Addresses: []string{"10.0.0.10-10.0.0.12"}}}
+		})
+
+		It("claims the first free address and keeps claims ordered", func() {
+			pool.Status.Claims = []capcv1.CloudStackIPPoolClaim{{Address: "10.0.0.11", Machine: "machine-b"}}
+
+			address, claimed, err := pool.Claim("machine-a")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(claimed).Should(BeTrue())
+			Ω(address).Should(Equal("10.0.0.10"))
+			Ω(pool.Status.Claims).Should(Equal([]capcv1.CloudStackIPPoolClaim{
+				{Address: "10.0.0.10", Machine: "machine-a"},
+				{Address: "10.0.0.11", Machine: "machine-b"},
+			}))
+			Ω(pool.Status.Free).Should(Equal(1))
+		})
+
+		It("returns the existing claim of a machine", func() {
+			_, _, err := pool.Claim("machine-a")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			address, claimed, err := pool.Claim("machine-a")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(claimed).Should(BeFalse())
+			Ω(address).Should(Equal("10.0.0.10"))
+			Ω(pool.Status.Claims).Should(HaveLen(1))
+		})
+
+		It("fails when the pool is exhausted", func() {
+			for _, machine := range []string{"machine-a", "machine-b", "machine-c"} {
+				_, _, err := pool.Claim(machine)
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			_, _, err := pool.Claim("machine-d")
+			Ω(err).Should(MatchError(ContainSubstring("no free address")))
+		})
+
+		It("releases the claim of a machine", func() {
+			_, _, err := pool.Claim("machine-a")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(pool.Release("machine-a")).Should(BeTrue())
+			Ω(pool.Status.Claims).Should(BeEmpty())
+			Ω(pool.Status.Free).Should(Equal(3))
+			Ω(pool.Release("machine-a")).Should(BeFalse())
+		})
+
+		It("restores the claims of machines missing from the pool's status", func() {
+			pool.Status.Claims = []capcv1.CloudStackIPPoolClaim{{Address: "10.0.0.11", Machine: "machine-b"}}
+
+			Ω(pool.RestoreClaims([]capcv1.CloudStackIPPoolClaim{
+				{Address: "10.0.0.12", Machine: "machine-a"},
+				{Address: "10.0.0.10", Machine: "machine-b"}, // Claimed another address.
+				{Address: "10.0.0.11", Machine: "machine-c"}, // Address claimed by another machine.
+				{Address: "10.0.0.20", Machine: "machine-d"}, // Address outside the pool.
+			})).Should(BeTrue())
+			Ω(pool.Status.Claims).Should(Equal([]capcv1.CloudStackIPPoolClaim{
+				{Address: "10.0.0.11", Machine: "machine-b"},
+				{Address: "10.0.0.12", Machine: "machine-a"},
+			}))
+			Ω(pool.Status.Free).Should(Equal(1))
+			Ω(pool.RestoreClaims([]capcv1.CloudStackIPPoolClaim{{Address: "10.0.0.12", Machine: "machine-a"}})).
+				Should(BeFalse())
+		})
+
+		It("counts the free addresses of a pool", func() {
+			pool.Status.Claims = []capcv1.CloudStackIPPoolClaim{{Address: "10.0.0.11", Machine: "machine-b"}}
+
+			Ω(pool.UpdateFree()).Should(BeTrue())
+			Ω(pool.Status.Free).Should(Equal(2))
+			Ω(pool.UpdateFree()).Should(BeFalse())
+		})
+	})
+})
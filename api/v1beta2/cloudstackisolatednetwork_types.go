@@ -50,6 +50,10 @@ type CloudStackIsolatedNetworkStatus struct {
 	// The ID of the lb rule used to assign VMs to the lb.
 	LBRuleID string `json:"loadBalancerRuleID,omitempty"`
 
+	// AppliedTags are the additional tags of the cluster last applied to the network and its public IP address.
+	// +optional
+	AppliedTags map[string]string `json:"appliedTags,omitempty"`
+
 	// Ready indicates the readiness of this provider resource.
 	Ready bool `json:"ready"`
 }
@@ -21,6 +21,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
 // The presence of a finalizer prevents CAPI from deleting the corresponding CAPI data.
@@ -32,6 +33,47 @@ const (
 	NoAffinity   = "no"
 )
 
+const (
+	// InstanceScaledCondition reports whether the machine's instance runs with the compute offering, CPU, memory and
+	// CPU speed of its spec. It is only set on machines with vertical scaling enabled, once their spec changes.
+	InstanceScaledCondition clusterv1.ConditionType = "InstanceScaled"
+	// InstanceScalingReason is used while the instance is being scaled.
+	InstanceScalingReason = "Scaling"
+	// InstanceStoppingForScalingReason is used while the instance is stopped as it can't be scaled while running.
+	InstanceStoppingForScalingReason = "StoppingForScaling"
+	// InstanceStartingAfterScalingReason is used while the instance is started again after it was scaled.
+	InstanceStartingAfterScalingReason = "StartingAfterScaling"
+	// InstanceScalingUnsupportedReason is used when CloudStack refused to scale the instance, which is replaced
+	// instead.
+	InstanceScalingUnsupportedReason = "ScalingUnsupported"
+
+	// InstanceDeployedCondition reports whether the machine's instance is deployed. It is False when CloudStack can't
+	// deploy the instance with the machine's spec.
+	InstanceDeployedCondition clusterv1.ConditionType = "InstanceDeployed"
+	// RootDiskTooSmallReason is used when the machine's rootDiskSize is smaller than the size of its template. The
+	// size of the template is only known to CloudStack, so it's checked on deployment rather than on admission.
+	RootDiskTooSmallReason = "RootDiskTooSmall"
+)
+
+// AsyncJobKind is the operation a CloudStack async job recorded on a machine was submitted for. Each operation only
+// polls its own jobs, so their outcome is attributed to it.
+type AsyncJobKind string
+
+const (
+	// AsyncJobDeploy is the deployment of the machine's instance.
+	AsyncJobDeploy AsyncJobKind = "Deploy"
+	// AsyncJobDataDisks is the creation and attachment of the machine's data disks, and the start of its instance
+	// once they're attached.
+	AsyncJobDataDisks AsyncJobKind = "DataDisks"
+	// AsyncJobAffinityGroups is the stop, affinity groups update and start of the machine's instance.
+	AsyncJobAffinityGroups AsyncJobKind = "AffinityGroups"
+	// AsyncJobScale is the scaling of the machine's instance, along with its stop and start when it can't be scaled
+	// live.
+	AsyncJobScale AsyncJobKind = "Scale"
+	// AsyncJobDestroy is the destruction of the machine's instance.
+	AsyncJobDestroy AsyncJobKind = "Destroy"
+)
+
 // CloudStackMachineSpec defines the desired state of CloudStackMachine
 type CloudStackMachineSpec struct {
 	// Name.
@@ -48,13 +90,53 @@ type CloudStackMachineSpec struct {
 	// CloudStack compute offering.
 	Offering CloudStackResourceIdentifier `json:"offering"`
 
-	// CloudStack template to use.
+	// Number of CPUs of the machine. Requires a customized compute offering.
+	// +optional
+	CPU int64 `json:"cpu,omitempty"`
+
+	// Memory of the machine in MiB. Requires a customized compute offering.
+	// +optional
+	MemoryMiB int64 `json:"memoryMiB,omitempty"`
+
+	// CPU speed of the machine in MHz. Requires a customized compute offering, and is required when the offering
+	// doesn't fix the CPU speed.
+	// +optional
+	CPUSpeedMHz int64 `json:"cpuSpeedMHz,omitempty"`
+
+	// VerticalScaling allows changing the offering, cpu, memoryMiB and cpuSpeedMHz of the machine, which then scales
+	// its instance in place, live if it is dynamically scalable and otherwise by stopping and starting it again. The
+	// machine is replaced when CloudStack can't scale it.
+	// +optional
+	VerticalScaling bool `json:"verticalScaling,omitempty"`
+
+	// CloudStack template to use. Required unless TemplateRef or TemplateSelector is set.
+	// +optional
 	Template CloudStackResourceIdentifier `json:"template"`
 
+	// Name of the CloudStackTemplate in the machine's namespace whose template to use instead of Template. The
+	// machine is deployed once the template is ready in the zone of its failure domain.
+	// +optional
+	TemplateRef string `json:"templateRef,omitempty"`
+
+	// Selects the template to use instead of Template: the newest template of the zone of the machine's failure domain
+	// matching the selector. The template picked is pinned to the machine's status.
+	// +optional
+	TemplateSelector *CloudStackTemplateSelector `json:"templateSelector,omitempty"`
+
 	// CloudStack disk offering to use.
 	// +optional
 	DiskOffering CloudStackResourceDiskOffering `json:"diskOffering,omitempty"`
 
+	// Size in GB of the machine's root disk, overriding the size of its template. Must be at least the template's size,
+	// which is checked on admission when the template can be resolved then, and on deployment otherwise: the
+	// InstanceDeployed condition of the machine is then False with reason RootDiskTooSmall.
+	// +optional
+	RootDiskSize int64 `json:"rootDiskSize,omitempty"`
+
+	// Data disks created and attached to the machine, in order, after it's deployed and before it first starts.
+	// +optional
+	DataDisks []CloudStackResourceDiskOffering `json:"dataDisks,omitempty"`
+
 	// CloudStack ssh key to use.
 	// +optional
 	SSHKey string `json:"sshKey"`
@@ -62,6 +144,11 @@ type CloudStackMachineSpec struct {
 	// Optional details map for deployVirtualMachine
 	Details map[string]string `json:"details,omitempty"`
 
+	// Tags applied to the machine's instance and volumes in addition to the additionalTags of its CloudStackCluster,
+	// whose values they override. Changes are applied to existing machines.
+	// +optional
+	AdditionalTags map[string]string `json:"additionalTags,omitempty"`
+
 	// Optional affinitygroupids for deployVirtualMachine
 	// +optional
 	AffinityGroupIDs []string `json:"affinityGroupIDs,omitempty"`
@@ -76,6 +163,23 @@ type CloudStackMachineSpec struct {
 	// +optional
 	AffinityGroupRef *corev1.ObjectReference `json:"cloudstackAffinityRef,omitempty"`
 
+	// Networks the machine is attached to in addition to the network of its failure domain's zone, which remains the
+	// network of its default NIC.
+	// +optional
+	Networks []CloudStackMachineNetwork `json:"networks,omitempty"`
+
+	// Static IP address of the machine on the network of its failure domain's zone. Claimed from the IP pool when
+	// IPPoolName is set.
+	// +optional
+	IPAddress string `json:"ipAddress,omitempty"`
+
+	// Name of the CloudStackIPPool in the machine's namespace the machine claims its IP address from.
+	// +optional
+	IPPoolName string `json:"ipPoolName,omitempty"`
+
+	// Placement hints CloudStack deploys the machine with. Hints left unset are taken from the failure domain's zone.
+	CloudStackPlacementHints `json:",inline"`
+
 	// The CS specific unique identifier. Of the form: fmt.Sprintf("cloudstack:///%s", CS Machine ID)
 	// +optional
 	ProviderID *string `json:"providerID,omitempty"`
@@ -86,10 +190,23 @@ type CloudStackMachineSpec struct {
 	FailureDomainName string `json:"failureDomainName,omitempty"`
 
 	// UncompressedUserData specifies whether the user data is gzip-compressed.
-	// cloud-init has built-in support for gzip-compressed user data, ignition does not
+	// cloud-init has built-in support for gzip-compressed user data, ignition does not, so Ignition configs are never
+	// compressed.
 	//
 	// +optional
 	UncompressedUserData *bool `json:"uncompressedUserData,omitempty"`
+
+	// RegisterUserData registers the user data with CloudStack and deploys the machine with its ID instead of passing
+	// it inline, which avoids the size limit of inline user data. The registered user data is deleted along with the
+	// instance. It requires CloudStack 4.18 or later, and the user data is passed inline on older versions.
+	// +optional
+	RegisterUserData bool `json:"registerUserData,omitempty"`
+}
+
+// HasCustomCompute reports whether the machine sets its CPU, memory or CPU speed, which customized compute offerings
+// take at deploy time.
+func (c *CloudStackMachine) HasCustomCompute() bool {
+	return c.Spec.CPU > 0 || c.Spec.MemoryMiB > 0 || c.Spec.CPUSpeedMHz > 0
 }
 
 func (c *CloudStackMachine) CompressUserdata() bool {
@@ -106,6 +223,17 @@ type CloudStackResourceIdentifier struct {
 	Name string `json:"name,omitempty"`
 }
 
+// CloudStackTemplateSelector selects a template by its tags, by its name, or both.
+type CloudStackTemplateSelector struct {
+	// Tags the template must have, such as k8s-version: v1.27.3.
+	// +optional
+	MatchTags map[string]string `json:"matchTags,omitempty"`
+
+	// Regular expression the name of the template must match, such as ^ubuntu-2204-kube-v1\.27\.
+	// +optional
+	NameRegex string `json:"nameRegex,omitempty"`
+}
+
 type CloudStackResourceDiskOffering struct {
 	CloudStackResourceIdentifier `json:",inline"`
 	// Desired disk size. Used if disk offering is customizable as indicated by the ACS field 'Custom Disk Size'.
@@ -121,6 +249,48 @@ type CloudStackResourceDiskOffering struct {
 	Label string `json:"label"`
 }
 
+// CloudStackPlacementHints are the hints CloudStack places an instance with when it's deployed.
+type CloudStackPlacementHints struct {
+	// ID of the host to deploy the instance on. Requires root admin credentials.
+	// +optional
+	HostID string `json:"hostID,omitempty"`
+
+	// ID of the CloudStack cluster to deploy the instance in. Requires root admin credentials.
+	// +optional
+	ClusterID string `json:"clusterID,omitempty"`
+
+	// ID of the pod to deploy the instance in. Requires root admin credentials.
+	// +optional
+	PodID string `json:"podID,omitempty"`
+
+	// Deployment planner CloudStack picks the host of the instance with, such as UserDispersingPlanner. Requires root
+	// admin credentials.
+	// +optional
+	DeploymentPlanner string `json:"deploymentPlanner,omitempty"`
+}
+
+// CloudStackMachinePlacement is where CloudStack placed an instance.
+type CloudStackMachinePlacement struct {
+	// Host the instance runs on.
+	// +optional
+	Host CloudStackResourceIdentifier `json:"host,omitempty"`
+
+	// CloudStack cluster of the host.
+	// +optional
+	Cluster CloudStackResourceIdentifier `json:"cluster,omitempty"`
+
+	// Pod of the host.
+	// +optional
+	Pod CloudStackResourceIdentifier `json:"pod,omitempty"`
+}
+
+type CloudStackMachineNetwork struct {
+	CloudStackResourceIdentifier `json:",inline"`
+	// Static IP address of the machine on the network. CloudStack allocates one when not set.
+	// +optional
+	IP string `json:"ip,omitempty"`
+}
+
 // Type pulled mostly from the CloudStack API.
 type CloudStackMachineStatus struct {
 	// Addresses contains a CloudStack VM instance's IP addresses.
@@ -144,6 +314,43 @@ type CloudStackMachineStatus struct {
 	// Reason indicates the reason of status failure
 	// +optional
 	Reason *string `json:"reason,omitempty"`
+
+	// RootDiskSize is the size in GB of the root disk the instance was deployed with, when it overrides the size of
+	// its template.
+	// +optional
+	RootDiskSize int64 `json:"rootDiskSize,omitempty"`
+
+	// Placement is the host, CloudStack cluster and pod the instance runs on. It's only visible to root admins.
+	// +optional
+	Placement *CloudStackMachinePlacement `json:"placement,omitempty"`
+
+	// AppliedTags are the additional tags last applied to the instance and volumes, so the ones removed from the
+	// cluster or machine are removed from them too.
+	// +optional
+	AppliedTags map[string]string `json:"appliedTags,omitempty"`
+
+	// UserDataID is the ID of the user data registered with CloudStack for the instance, when the machine registers
+	// its user data.
+	// +optional
+	UserDataID string `json:"userDataID,omitempty"`
+
+	// TemplateID is the ID of the template the instance is deployed from, when the machine refers to its template
+	// through TemplateRef or TemplateSelector. It's pinned once resolved.
+	// +optional
+	TemplateID string `json:"templateID,omitempty"`
+
+	// AsyncJobID is the ID of the CloudStack async job still running for this machine, such as a VM deployment or
+	// destruction. It is polled on later reconciliations instead of waiting for the job to finish.
+	// +optional
+	AsyncJobID string `json:"asyncJobID,omitempty"`
+
+	// AsyncJobKind is the operation the job of AsyncJobID was submitted for, such as Deploy or Destroy.
+	// +optional
+	AsyncJobKind AsyncJobKind `json:"asyncJobKind,omitempty"`
+
+	// Conditions defines current service state of the CloudStackMachine.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
 }
 
 // TimeSinceLastStateChange returns the amount of time that's elapsed since the state was last updated.  If the state
@@ -174,6 +381,16 @@ type CloudStackMachine struct {
 	Status CloudStackMachineStatus `json:"status,omitempty"`
 }
 
+// GetConditions returns the conditions of the CloudStackMachine.
+func (c *CloudStackMachine) GetConditions() clusterv1.Conditions {
+	return c.Status.Conditions
+}
+
+// SetConditions sets the conditions of the CloudStackMachine.
+func (c *CloudStackMachine) SetConditions(conditions clusterv1.Conditions) {
+	c.Status.Conditions = conditions
+}
+
 //+kubebuilder:object:root=true
 
 // CloudStackMachineList contains a list of CloudStackMachine
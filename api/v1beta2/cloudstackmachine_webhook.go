@@ -18,7 +18,10 @@ package v1beta2
 
 import (
 	"fmt"
+	"net"
 	"reflect"
+	"regexp"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -59,10 +62,18 @@ func (r *CloudStackMachine) ValidateCreate() error {
 	var errorList field.ErrorList
 
 	errorList = webhookutil.EnsureAtLeastOneFieldExists(r.Spec.Offering.ID, r.Spec.Offering.Name, "Offering", errorList)
-	errorList = webhookutil.EnsureAtLeastOneFieldExists(r.Spec.Template.ID, r.Spec.Template.Name, "Template", errorList)
+	errorList = validateTemplate(&r.Spec, errorList)
 	if len(r.Spec.DiskOffering.ID) > 0 || len(r.Spec.DiskOffering.Name) > 0 {
 		errorList = webhookutil.EnsureIntFieldsAreNotNegative(r.Spec.DiskOffering.CustomSize, "customSizeInGB", errorList)
 	}
+	errorList = webhookutil.EnsureIntFieldsAreNotNegative(r.Spec.CPU, "cpu", errorList)
+	errorList = webhookutil.EnsureIntFieldsAreNotNegative(r.Spec.MemoryMiB, "memoryMiB", errorList)
+	errorList = webhookutil.EnsureIntFieldsAreNotNegative(r.Spec.CPUSpeedMHz, "cpuSpeedMHz", errorList)
+	errorList = webhookutil.EnsureIntFieldsAreNotNegative(r.Spec.RootDiskSize, "rootDiskSize", errorList)
+	errorList = validateDataDisks(r.Spec.DataDisks, errorList)
+	errorList = validateNetworks(r.Spec.Networks, errorList)
+	errorList = validateIPAddress(r.Spec.IPAddress, errorList)
+	errorList = validateAdditionalTags(r.Spec.AdditionalTags, errorList)
 
 	return webhookutil.AggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, errorList)
 }
@@ -79,8 +90,13 @@ func (r *CloudStackMachine) ValidateUpdate(old runtime.Object) error {
 	}
 	oldSpec := oldMachine.Spec
 
-	errorList = webhookutil.EnsureEqualStrings(r.Spec.Offering.ID, oldSpec.Offering.ID, "offering", errorList)
-	errorList = webhookutil.EnsureEqualStrings(r.Spec.Offering.Name, oldSpec.Offering.Name, "offering", errorList)
+	if !r.Spec.VerticalScaling { // Machines scaling vertically are scaled in place instead.
+		errorList = webhookutil.EnsureEqualStrings(r.Spec.Offering.ID, oldSpec.Offering.ID, "offering", errorList)
+		errorList = webhookutil.EnsureEqualStrings(r.Spec.Offering.Name, oldSpec.Offering.Name, "offering", errorList)
+		if r.Spec.CPU != oldSpec.CPU || r.Spec.MemoryMiB != oldSpec.MemoryMiB || r.Spec.CPUSpeedMHz != oldSpec.CPUSpeedMHz {
+			errorList = append(errorList, field.Forbidden(field.NewPath("spec", "compute"), "cpu, memoryMiB and cpuSpeedMHz"))
+		}
+	}
 	errorList = webhookutil.EnsureEqualStrings(r.Spec.DiskOffering.ID, oldSpec.DiskOffering.ID, "diskOffering", errorList)
 	errorList = webhookutil.EnsureEqualStrings(r.Spec.DiskOffering.Name, oldSpec.DiskOffering.Name, "diskOffering", errorList)
 	errorList = webhookutil.EnsureIntFieldsAreNotNegative(r.Spec.DiskOffering.CustomSize, "customSizeInGB", errorList)
@@ -91,12 +107,31 @@ func (r *CloudStackMachine) ValidateUpdate(old runtime.Object) error {
 	errorList = webhookutil.EnsureEqualStrings(r.Spec.SSHKey, oldSpec.SSHKey, "sshkey", errorList)
 	errorList = webhookutil.EnsureEqualStrings(r.Spec.Template.ID, oldSpec.Template.ID, "template", errorList)
 	errorList = webhookutil.EnsureEqualStrings(r.Spec.Template.Name, oldSpec.Template.Name, "template", errorList)
+	errorList = webhookutil.EnsureEqualStrings(r.Spec.TemplateRef, oldSpec.TemplateRef, "templateRef", errorList)
+	if !reflect.DeepEqual(r.Spec.TemplateSelector, oldSpec.TemplateSelector) {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "templateSelector"), "templateSelector"))
+	}
 	errorList = webhookutil.EnsureEqualMapStringString(&r.Spec.Details, &oldSpec.Details, "details", errorList)
 	errorList = webhookutil.EnsureEqualStrings(r.Spec.Affinity, oldSpec.Affinity, "affinity", errorList)
+	errorList = webhookutil.EnsureEqualStrings(r.Spec.IPPoolName, oldSpec.IPPoolName, "ipPoolName", errorList)
 
 	if !reflect.DeepEqual(r.Spec.AffinityGroupIDs, oldSpec.AffinityGroupIDs) { // Equivalent to other Ensure funcs.
 		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "AffinityGroupIDs"), "AffinityGroupIDs"))
 	}
+	if r.Spec.RootDiskSize != oldSpec.RootDiskSize {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "rootDiskSize"), "rootDiskSize"))
+	}
+	if r.Spec.CloudStackPlacementHints != oldSpec.CloudStackPlacementHints {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "placement"),
+			"hostID, clusterID, podID and deploymentPlanner"))
+	}
+	if !reflect.DeepEqual(r.Spec.DataDisks, oldSpec.DataDisks) {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "DataDisks"), "DataDisks"))
+	}
+	if !reflect.DeepEqual(r.Spec.Networks, oldSpec.Networks) {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "Networks"), "Networks"))
+	}
+	errorList = validateAdditionalTags(r.Spec.AdditionalTags, errorList)
 
 	return webhookutil.AggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, errorList)
 }
@@ -107,3 +142,79 @@ func (r *CloudStackMachine) ValidateDelete() error {
 	// No deletion validations.  Deletion webhook not enabled.
 	return nil
 }
+
+// validateDataDisks ensures each of a machine's data disks is given a disk offering by ID or name, and a size that
+// isn't negative.
+func validateDataDisks(disks []CloudStackResourceDiskOffering, errorList field.ErrorList) field.ErrorList {
+	for _, disk := range disks {
+		errorList = webhookutil.EnsureAtLeastOneFieldExists(disk.ID, disk.Name, "DataDisks", errorList)
+		errorList = webhookutil.EnsureIntFieldsAreNotNegative(disk.CustomSize, "customSizeInGB", errorList)
+	}
+	return errorList
+}
+
+// validateTemplate ensures a machine is given exactly one of a template by ID or name, a reference to a
+// CloudStackTemplate, or a template selector, which must select by tags or by a valid name regex.
+func validateTemplate(spec *CloudStackMachineSpec, errorList field.ErrorList) field.ErrorList {
+	given := 0
+	for _, set := range []bool{spec.Template.ID != "" || spec.Template.Name != "", spec.TemplateRef != "",
+		spec.TemplateSelector != nil} {
+		if set {
+			given++
+		}
+	}
+	if given == 0 {
+		return webhookutil.EnsureAtLeastOneFieldExists(spec.Template.ID, spec.Template.Name, "Template", errorList)
+	} else if given > 1 {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "template"),
+			"template, templateRef and templateSelector are mutually exclusive"))
+	}
+
+	if selector := spec.TemplateSelector; selector != nil {
+		if len(selector.MatchTags) == 0 && selector.NameRegex == "" {
+			errorList = append(errorList, field.Required(field.NewPath("spec", "templateSelector"),
+				"templateSelector requires matchTags or nameRegex"))
+		}
+		if _, err := regexp.Compile(selector.NameRegex); err != nil {
+			errorList = append(errorList, field.Invalid(field.NewPath("spec", "templateSelector", "nameRegex"),
+				selector.NameRegex, err.Error()))
+		}
+	}
+	return errorList
+}
+
+// validateIPAddress ensures a machine's static IP address, if any, is a valid IP address.
+func validateIPAddress(ipAddress string, errorList field.ErrorList) field.ErrorList {
+	if ipAddress != "" && net.ParseIP(ipAddress) == nil {
+		errorList = append(errorList, field.Invalid(field.NewPath("spec", "IPAddress"), ipAddress,
+			"IPAddress must be a valid IP address"))
+	}
+	return errorList
+}
+
+// validateNetworks ensures each of a machine's additional networks is given by ID or name, with a valid IP if any.
+func validateNetworks(networks []CloudStackMachineNetwork, errorList field.ErrorList) field.ErrorList {
+	for i, network := range networks {
+		errorList = webhookutil.EnsureAtLeastOneFieldExists(network.ID, network.Name, "Networks", errorList)
+		if network.IP != "" && net.ParseIP(network.IP) == nil {
+			errorList = append(errorList, field.Invalid(field.NewPath("spec", "Networks").Index(i).Child("IP"), network.IP,
+				"IP must be a valid IP address"))
+		}
+	}
+	return errorList
+}
+
+// validateAdditionalTags ensures additional tags have keys, which don't clash with the tags CAPC uses to track the
+// resources it creates.
+func validateAdditionalTags(tags map[string]string, errorList field.ErrorList) field.ErrorList {
+	for key := range tags {
+		if key == "" {
+			errorList = append(errorList, field.Invalid(field.NewPath("spec", "additionalTags"), key,
+				"tag keys can't be empty"))
+		} else if key == "created_by_CAPC" || strings.HasPrefix(key, "CAPC_cluster_") {
+			errorList = append(errorList, field.Invalid(field.NewPath("spec", "additionalTags"), key,
+				"created_by_CAPC and CAPC_cluster_ tag keys are reserved"))
+		}
+	}
+	return errorList
+}
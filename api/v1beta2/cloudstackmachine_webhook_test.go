@@ -70,6 +70,84 @@ var _ = Describe("CloudStackMachine webhook", func() {
 			Expect(k8sClient.Create(ctx, dummies.CSMachine1)).
 				Should(MatchError(MatchRegexp(requiredRegex, "Template")))
 		})
+
+		It("should accept a CloudStackMachine referring to a CloudStackTemplate instead of a Template", func() {
+			dummies.CSMachine1.Spec.Template = infrav1.CloudStackResourceIdentifier{}
+			dummies.CSMachine1.Spec.TemplateRef = dummies.CSTemplate1.Name
+			Expect(k8sClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+		})
+
+		It("should reject a CloudStackMachine with both a Template and a CloudStackTemplate", func() {
+			dummies.CSMachine1.Spec.TemplateRef = dummies.CSTemplate1.Name
+			Expect(k8sClient.Create(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp(forbiddenRegex, "template, templateRef and templateSelector are mutually exclusive")))
+		})
+
+		It("should accept a CloudStackMachine selecting its template by tags", func() {
+			dummies.CSMachine1.Spec.Template = infrav1.CloudStackResourceIdentifier{}
+			dummies.CSMachine1.Spec.TemplateSelector = &infrav1.CloudStackTemplateSelector{
+				MatchTags: map[string]string{"k8s-version": "v1.27.3"}}
+			Expect(k8sClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+		})
+
+		It("should reject a CloudStackMachine with an empty template selector", func() {
+			dummies.CSMachine1.Spec.Template = infrav1.CloudStackResourceIdentifier{}
+			dummies.CSMachine1.Spec.TemplateSelector = &infrav1.CloudStackTemplateSelector{}
+			Expect(k8sClient.Create(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp(requiredRegex, "templateSelector requires matchTags or nameRegex")))
+		})
+
+		It("should reject a CloudStackMachine selecting its template by an invalid name regex", func() {
+			dummies.CSMachine1.Spec.Template = infrav1.CloudStackResourceIdentifier{}
+			dummies.CSMachine1.Spec.TemplateSelector = &infrav1.CloudStackTemplateSelector{NameRegex: "ubuntu-(2204"}
+			Expect(k8sClient.Create(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp("admission webhook.*denied the request.*Invalid value\\: \"ubuntu-\\(2204\"")))
+		})
+
+		It("should reject a CloudStackMachine with a negative number of CPUs", func() {
+			dummies.CSMachine1.Spec.CPU = -2
+			Ω(k8sClient.Create(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp(forbiddenRegex, "cpu")))
+		})
+
+		It("should reject a CloudStackMachine with a negative root disk size", func() {
+			dummies.CSMachine1.Spec.RootDiskSize = -1
+			Ω(k8sClient.Create(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp(forbiddenRegex, "rootDiskSize")))
+		})
+
+		It("should reject a CloudStackMachine with a data disk missing its disk offering", func() {
+			dummies.CSMachine1.Spec.DataDisks = []infrav1.CloudStackResourceDiskOffering{{MountPath: "/var/lib/etcd"}}
+			Ω(k8sClient.Create(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp(requiredRegex, "DataDisks")))
+		})
+
+		It("should reject a CloudStackMachine with a network missing its ID and name", func() {
+			dummies.CSMachine1.Spec.Networks = []infrav1.CloudStackMachineNetwork{{IP: "10.0.1.10"}}
+			Expect(k8sClient.Create(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp(requiredRegex, "Networks")))
+		})
+
+		It("should reject a CloudStackMachine with an invalid network IP", func() {
+			dummies.CSMachine1.Spec.Networks = []infrav1.CloudStackMachineNetwork{{
+				CloudStackResourceIdentifier: infrav1.CloudStackResourceIdentifier{Name: "storage-network"},
+				IP:                           "10.0.1",
+			}}
+			Expect(k8sClient.Create(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp("admission webhook.*denied the request.*Invalid value\\: \"10.0.1\"")))
+		})
+
+		It("should reject a CloudStackMachine with an invalid static IP address", func() {
+			dummies.CSMachine1.Spec.IPAddress = "10.0.0.300"
+			Expect(k8sClient.Create(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp("admission webhook.*denied the request.*Invalid value\\: \"10.0.0.300\"")))
+		})
+
+		It("should reject a CloudStackMachine with an additional tag using a reserved key", func() {
+			dummies.CSMachine1.Spec.AdditionalTags = map[string]string{"created_by_CAPC": "1"}
+			Expect(k8sClient.Create(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp("admission webhook.*denied the request.*Invalid value\\: \"created_by_CAPC\"")))
+		})
 	})
 
 	Context("When updating a CloudStackMachine", func() {
@@ -83,6 +161,18 @@ var _ = Describe("CloudStackMachine webhook", func() {
 				Should(MatchError(MatchRegexp(forbiddenRegex, "offering")))
 		})
 
+		It("should accept VM offering and compute updates to a CloudStackMachine scaling vertically", func() {
+			dummies.CSMachine1.Spec.VerticalScaling = true
+			dummies.CSMachine1.Spec.Offering = infrav1.CloudStackResourceIdentifier{Name: "ArbitraryUpdateOffering"}
+			dummies.CSMachine1.Spec.MemoryMiB = 4096
+			Ω(k8sClient.Update(ctx, dummies.CSMachine1)).Should(Succeed())
+		})
+
+		It("should accept updates to the additional tags of the CloudStackMachine", func() {
+			dummies.CSMachine1.Spec.AdditionalTags = map[string]string{"team": "platform"}
+			Ω(k8sClient.Update(ctx, dummies.CSMachine1)).Should(Succeed())
+		})
+
 		It("should reject VM template updates to the CloudStackMachine", func() {
 			dummies.CSMachine1.Spec.Template = infrav1.CloudStackResourceIdentifier{Name: "ArbitraryUpdateTemplate"}
 			Ω(k8sClient.Update(ctx, dummies.CSMachine1)).
@@ -106,5 +196,46 @@ var _ = Describe("CloudStackMachine webhook", func() {
 			Ω(k8sClient.Update(ctx, dummies.CSMachine1)).
 				Should(MatchError(MatchRegexp(forbiddenRegex, "AffinityGroupIDs")))
 		})
+
+		It("should reject updates to the memory of the CloudStackMachine", func() {
+			dummies.CSMachine1.Spec.MemoryMiB = 4096
+			Ω(k8sClient.Update(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp(forbiddenRegex, "cpu, memoryMiB and cpuSpeedMHz")))
+		})
+
+		It("should reject updates to the root disk size of the CloudStackMachine", func() {
+			dummies.CSMachine1.Spec.RootDiskSize = 50
+			Ω(k8sClient.Update(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp(forbiddenRegex, "rootDiskSize")))
+		})
+
+		It("should reject updates to the placement hints of the CloudStackMachine", func() {
+			dummies.CSMachine1.Spec.HostID = "5a2a6c1b-4a3c-4ffb-8a56-2f1f4b4e1c2d"
+			Ω(k8sClient.Update(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp(forbiddenRegex, "hostID, clusterID, podID and deploymentPlanner")))
+		})
+
+		It("should reject updates to the data disks of the CloudStackMachine", func() {
+			dummies.CSMachine1.Spec.DataDisks = []infrav1.CloudStackResourceDiskOffering{{
+				CloudStackResourceIdentifier: infrav1.CloudStackResourceIdentifier{Name: "Small"},
+				MountPath:                    "/var/lib/etcd",
+			}}
+			Ω(k8sClient.Update(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp(forbiddenRegex, "DataDisks")))
+		})
+
+		It("should reject updates to the networks of the CloudStackMachine", func() {
+			dummies.CSMachine1.Spec.Networks = []infrav1.CloudStackMachineNetwork{{
+				CloudStackResourceIdentifier: infrav1.CloudStackResourceIdentifier{Name: "storage-network"},
+			}}
+			Ω(k8sClient.Update(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp(forbiddenRegex, "Networks")))
+		})
+
+		It("should reject updates to the IP pool of the CloudStackMachine", func() {
+			dummies.CSMachine1.Spec.IPPoolName = "control-plane-ips"
+			Ω(k8sClient.Update(ctx, dummies.CSMachine1)).
+				Should(MatchError(MatchRegexp(forbiddenRegex, "ipPoolName")))
+		})
 	})
 })
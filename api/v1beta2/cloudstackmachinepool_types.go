@@ -0,0 +1,130 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MachinePoolFinalizer allows ReconcileCloudStackMachinePool to destroy the instances of the pool before removing it
+// from the apiserver.
+const MachinePoolFinalizer = "cloudstackmachinepool.infrastructure.cluster.x-k8s.io"
+
+// CloudStackMachinePoolSpec defines the desired state of CloudStackMachinePool
+type CloudStackMachinePoolSpec struct {
+	// Template the instances of the pool are all deployed from. Changes only apply to instances deployed afterwards.
+	Template CloudStackMachineTemplateResource `json:"template"`
+
+	// Provider IDs of the running instances of the pool, set by the controller.
+	// +optional
+	ProviderIDList []string `json:"providerIDList,omitempty"`
+}
+
+// CloudStackMachinePoolInstance is an instance of the pool.
+type CloudStackMachinePoolInstance struct {
+	// Name of the instance, which is also its hostname.
+	Name string `json:"name"`
+
+	// Name of the failure domain the instance is deployed in.
+	FailureDomainName string `json:"failureDomainName"`
+
+	// ID of the instance, set once its deployment is submitted.
+	// +optional
+	InstanceID string `json:"instanceID,omitempty"`
+
+	// Provider ID of the instance.
+	// +optional
+	ProviderID string `json:"providerID,omitempty"`
+
+	// State of the instance.
+	// +optional
+	InstanceState string `json:"instanceState,omitempty"`
+
+	// Ready is true once the instance first ran.
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+
+	// Deleting is true once the instance is picked for removal by a scale down.
+	// +optional
+	Deleting bool `json:"deleting,omitempty"`
+
+	// ID of the CloudStack async job submitted for the instance that's still running.
+	// +optional
+	AsyncJobID string `json:"asyncJobID,omitempty"`
+
+	// Operation the job of AsyncJobID was submitted for, such as Deploy or Destroy.
+	// +optional
+	AsyncJobKind AsyncJobKind `json:"asyncJobKind,omitempty"`
+
+	// ID of the user data registered for the instance.
+	// +optional
+	UserDataID string `json:"userDataID,omitempty"`
+
+	// ID of the template the instance is deployed from, pinned when the pool refers to its template through
+	// TemplateRef or TemplateSelector.
+	// +optional
+	TemplateID string `json:"templateID,omitempty"`
+
+	// Additional tags last applied to the instance and its volumes.
+	// +optional
+	AppliedTags map[string]string `json:"appliedTags,omitempty"`
+}
+
+// CloudStackMachinePoolStatus defines the observed state of CloudStackMachinePool
+type CloudStackMachinePoolStatus struct {
+	// Ready is true when the pool runs as many instances as its MachinePool has replicas.
+	// +optional
+	Ready bool `json:"ready"`
+
+	// Number of running instances of the pool.
+	// +optional
+	Replicas int32 `json:"replicas"`
+
+	// Instances of the pool, oldest first.
+	// +optional
+	Instances []CloudStackMachinePoolInstance `json:"instances,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:path=cloudstackmachinepools,scope=Namespaced,categories=cluster-api,shortName=csmp
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".metadata.labels.cluster\\.x-k8s\\.io/cluster-name",description="Cluster to which this CloudStackMachinePool belongs"
+//+kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.replicas",description="Number of running instances"
+//+kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="Pool runs all its replicas"
+
+// CloudStackMachinePool is the Schema for the cloudstackmachinepools API
+type CloudStackMachinePool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CloudStackMachinePoolSpec   `json:"spec,omitempty"`
+	Status CloudStackMachinePoolStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CloudStackMachinePoolList contains a list of CloudStackMachinePool
+type CloudStackMachinePoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CloudStackMachinePool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CloudStackMachinePool{}, &CloudStackMachinePoolList{})
+}
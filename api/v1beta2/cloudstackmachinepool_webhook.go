@@ -0,0 +1,104 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/webhookutil"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var cloudstackmachinepoollog = logf.Log.WithName("cloudstackmachinepool-resource")
+
+func (r *CloudStackMachinePool) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta2-cloudstackmachinepool,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=cloudstackmachinepools,verbs=create;update,versions=v1beta2,name=vcloudstackmachinepool.kb.io,admissionReviewVersions=v1beta1
+var _ webhook.Validator = &CloudStackMachinePool{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *CloudStackMachinePool) ValidateCreate() error {
+	cloudstackmachinepoollog.V(1).Info("entered validate create webhook", "api resource name", r.Name)
+	return webhookutil.AggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, r.validateTemplate())
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *CloudStackMachinePool) ValidateUpdate(old runtime.Object) error {
+	cloudstackmachinepoollog.V(1).Info("entered validate update webhook", "api resource name", r.Name)
+
+	if _, ok := old.(*CloudStackMachinePool); !ok {
+		return errors.NewBadRequest(fmt.Sprintf("expected a CloudStackMachinePool but got a %T", old))
+	}
+	// The template may change, as it only applies to the instances deployed afterwards.
+	return webhookutil.AggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, r.validateTemplate())
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *CloudStackMachinePool) ValidateDelete() error {
+	cloudstackmachinepoollog.V(1).Info("entered validate delete webhook", "api resource name", r.Name)
+	// No deletion validations.  Deletion webhook not enabled.
+	return nil
+}
+
+// validateTemplate validates the machine template of the pool. The instances of a pool are identical, so it can't
+// give them static addresses, and the pool doesn't manage affinity groups for them.
+func (r *CloudStackMachinePool) validateTemplate() field.ErrorList {
+	var errorList field.ErrorList
+	spec := r.Spec.Template.Spec
+
+	affinity := strings.ToLower(spec.Affinity)
+	if affinity != "" && affinity != "no" {
+		errorList = append(errorList, field.Invalid(field.NewPath("spec", "template", "spec", "affinity"), spec.Affinity,
+			`Affinity must be "no" or unspecified, use AffinityGroupIDs instead.`))
+	}
+	if spec.IPAddress != "" {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "template", "spec", "ipAddress"),
+			"instances of a pool can't share a static IP address"))
+	}
+	if spec.IPPoolName != "" {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "template", "spec", "ipPoolName"),
+			"instances of a pool can't claim addresses from an IP pool"))
+	}
+	for i, network := range spec.Networks {
+		if network.IP != "" {
+			errorList = append(errorList, field.Forbidden(field.NewPath("spec", "template", "spec", "networks").Index(i).Child("ip"),
+				"instances of a pool can't share a static IP address"))
+		}
+	}
+
+	errorList = webhookutil.EnsureAtLeastOneFieldExists(spec.Offering.ID, spec.Offering.Name, "Offering", errorList)
+	errorList = validateTemplate(&spec, errorList)
+	errorList = webhookutil.EnsureIntFieldsAreNotNegative(spec.CPU, "cpu", errorList)
+	errorList = webhookutil.EnsureIntFieldsAreNotNegative(spec.MemoryMiB, "memoryMiB", errorList)
+	errorList = webhookutil.EnsureIntFieldsAreNotNegative(spec.CPUSpeedMHz, "cpuSpeedMHz", errorList)
+	errorList = webhookutil.EnsureIntFieldsAreNotNegative(spec.RootDiskSize, "rootDiskSize", errorList)
+	errorList = validateDataDisks(spec.DataDisks, errorList)
+	errorList = validateNetworks(spec.Networks, errorList)
+	errorList = validateAdditionalTags(spec.AdditionalTags, errorList)
+	return errorList
+}
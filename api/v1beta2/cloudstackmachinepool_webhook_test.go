@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2_test
+
+import (
+	"context"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	dummies "sigs.k8s.io/cluster-api-provider-cloudstack/test/dummies/v1beta2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CloudStackMachinePool webhook", func() {
+	var ctx context.Context
+	forbiddenRegex := "admission webhook.*denied the request.*Forbidden\\: %s"
+	requiredRegex := "admission webhook.*denied the request.*Required value\\: %s"
+
+	BeforeEach(func() { // Reset test vars to initial state.
+		dummies.SetDummyVars()
+		ctx = context.Background()
+		_ = k8sClient.Delete(ctx, dummies.CSMachinePool1) // Delete any remnants.
+	})
+
+	Context("When creating a CloudStackMachinePool", func() {
+		It("Should accept a CloudStackMachinePool with all attributes present", func() {
+			Expect(k8sClient.Create(ctx, dummies.CSMachinePool1)).Should(Succeed())
+		})
+
+		It("Should reject a CloudStackMachinePool when missing the VM Offering attribute", func() {
+			dummies.CSMachinePool1.Spec.Template.Spec.Offering = infrav1.CloudStackResourceIdentifier{Name: "", ID: ""}
+			Expect(k8sClient.Create(ctx, dummies.CSMachinePool1)).
+				Should(MatchError(MatchRegexp(requiredRegex, "Offering")))
+		})
+
+		It("Should reject a CloudStackMachinePool with a static IP address", func() {
+			dummies.CSMachinePool1.Spec.Template.Spec.IPAddress = "10.0.0.10"
+			Expect(k8sClient.Create(ctx, dummies.CSMachinePool1)).
+				Should(MatchError(MatchRegexp(forbiddenRegex, "instances of a pool can't share a static IP address")))
+		})
+
+		It("Should reject a CloudStackMachinePool claiming addresses from an IP pool", func() {
+			dummies.CSMachinePool1.Spec.Template.Spec.IPPoolName = "test-ippool"
+			Expect(k8sClient.Create(ctx, dummies.CSMachinePool1)).
+				Should(MatchError(MatchRegexp(forbiddenRegex, "instances of a pool can't claim addresses")))
+		})
+
+		It("Should reject a CloudStackMachinePool with an affinity type", func() {
+			dummies.CSMachinePool1.Spec.Template.Spec.Affinity = "pro"
+			Expect(k8sClient.Create(ctx, dummies.CSMachinePool1)).ShouldNot(Succeed())
+		})
+	})
+
+	Context("When updating a CloudStackMachinePool", func() {
+		BeforeEach(func() {
+			Ω(k8sClient.Create(ctx, dummies.CSMachinePool1)).Should(Succeed())
+		})
+
+		It("Should accept VM offering updates to the CloudStackMachinePool", func() {
+			dummies.CSMachinePool1.Spec.Template.Spec.Offering = infrav1.CloudStackResourceIdentifier{Name: "Offering2"}
+			Ω(k8sClient.Update(ctx, dummies.CSMachinePool1)).Should(Succeed())
+		})
+
+		It("Should reject a static IP address on update of the CloudStackMachinePool", func() {
+			dummies.CSMachinePool1.Spec.Template.Spec.IPAddress = "10.0.0.10"
+			Ω(k8sClient.Update(ctx, dummies.CSMachinePool1)).ShouldNot(Succeed())
+		})
+	})
+})
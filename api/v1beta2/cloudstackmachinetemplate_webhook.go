@@ -70,8 +70,16 @@ func (r *CloudStackMachineTemplate) ValidateCreate() error {
 			"AffinityGroupIDs cannot be specified when Affinity is specified as anything but `no`"))
 	}
 
+	errorList = validateTemplateIPAddress(spec.IPAddress, errorList)
 	errorList = webhookutil.EnsureAtLeastOneFieldExists(spec.Offering.ID, spec.Offering.Name, "Offering", errorList)
-	errorList = webhookutil.EnsureAtLeastOneFieldExists(spec.Template.ID, spec.Template.Name, "Template", errorList)
+	errorList = validateTemplate(&spec, errorList)
+	errorList = webhookutil.EnsureIntFieldsAreNotNegative(spec.CPU, "cpu", errorList)
+	errorList = webhookutil.EnsureIntFieldsAreNotNegative(spec.MemoryMiB, "memoryMiB", errorList)
+	errorList = webhookutil.EnsureIntFieldsAreNotNegative(spec.CPUSpeedMHz, "cpuSpeedMHz", errorList)
+	errorList = webhookutil.EnsureIntFieldsAreNotNegative(spec.RootDiskSize, "rootDiskSize", errorList)
+	errorList = validateDataDisks(spec.DataDisks, errorList)
+	errorList = validateNetworks(spec.Networks, errorList)
+	errorList = validateAdditionalTags(spec.AdditionalTags, errorList)
 
 	return webhookutil.AggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, errorList)
 }
@@ -90,6 +98,7 @@ func (r *CloudStackMachineTemplate) ValidateUpdate(old runtime.Object) error {
 	oldSpec := oldMachineTemplate.Spec.Spec.Spec
 
 	errorList := field.ErrorList(nil)
+	errorList = validateTemplateIPAddress(spec.IPAddress, errorList)
 	errorList = webhookutil.EnsureEqualStrings(spec.Offering.ID, oldSpec.Offering.ID, "offering", errorList)
 	errorList = webhookutil.EnsureEqualStrings(spec.Offering.Name, oldSpec.Offering.Name, "offering", errorList)
 	errorList = webhookutil.EnsureEqualStrings(spec.DiskOffering.ID, oldSpec.DiskOffering.ID, "diskOffering", errorList)
@@ -97,16 +106,45 @@ func (r *CloudStackMachineTemplate) ValidateUpdate(old runtime.Object) error {
 	errorList = webhookutil.EnsureEqualStrings(spec.SSHKey, oldSpec.SSHKey, "sshkey", errorList)
 	errorList = webhookutil.EnsureEqualStrings(spec.Template.ID, oldSpec.Template.ID, "template", errorList)
 	errorList = webhookutil.EnsureEqualStrings(spec.Template.Name, oldSpec.Template.Name, "template", errorList)
+	errorList = webhookutil.EnsureEqualStrings(spec.TemplateRef, oldSpec.TemplateRef, "templateRef", errorList)
+	if !reflect.DeepEqual(spec.TemplateSelector, oldSpec.TemplateSelector) {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "templateSelector"), "templateSelector"))
+	}
 	errorList = webhookutil.EnsureEqualMapStringString(&spec.Details, &oldSpec.Details, "details", errorList)
 	errorList = webhookutil.EnsureEqualStrings(spec.Affinity, oldSpec.Affinity, "affinity", errorList)
 
 	if !reflect.DeepEqual(spec.AffinityGroupIDs, oldSpec.AffinityGroupIDs) { // Equivalent to other Ensure funcs.
 		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "AffinityGroupIDs"), "AffinityGroupIDs"))
 	}
+	if spec.CPU != oldSpec.CPU || spec.MemoryMiB != oldSpec.MemoryMiB || spec.CPUSpeedMHz != oldSpec.CPUSpeedMHz {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "compute"), "cpu, memoryMiB and cpuSpeedMHz"))
+	}
+	if spec.RootDiskSize != oldSpec.RootDiskSize {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "rootDiskSize"), "rootDiskSize"))
+	}
+	if spec.CloudStackPlacementHints != oldSpec.CloudStackPlacementHints {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "placement"),
+			"hostID, clusterID, podID and deploymentPlanner"))
+	}
+	if !reflect.DeepEqual(spec.DataDisks, oldSpec.DataDisks) {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "DataDisks"), "DataDisks"))
+	}
+	if !reflect.DeepEqual(spec.Networks, oldSpec.Networks) {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "Networks"), "Networks"))
+	}
 
 	return webhookutil.AggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, errorList)
 }
 
+// validateTemplateIPAddress forbids a static IP address, which all the machines of the template would share.
+func validateTemplateIPAddress(ipAddress string, errorList field.ErrorList) field.ErrorList {
+	if ipAddress != "" {
+		errorList = append(errorList, field.Forbidden(field.NewPath("spec", "template", "spec", "ipAddress"),
+			"machines of a template can't share a static IP address, use ipPoolName instead"))
+	}
+	return errorList
+}
+
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
 func (r *CloudStackMachineTemplate) ValidateDelete() error {
 	cloudstackmachinetemplatelog.V(1).Info("entered validate delete webhook", "api resource name", r.Name)
@@ -60,6 +60,12 @@ var _ = Describe("CloudStackMachineTemplate webhook", func() {
 			Expect(k8sClient.Create(ctx, dummies.CSMachineTemplate1)).
 				Should(MatchError(MatchRegexp(requiredRegex, "Template")))
 		})
+
+		It("Should reject a CloudStackMachineTemplate with a static IP address", func() {
+			dummies.CSMachineTemplate1.Spec.Spec.Spec.IPAddress = "10.0.0.10"
+			Expect(k8sClient.Create(ctx, dummies.CSMachineTemplate1)).
+				Should(MatchError(MatchRegexp(forbiddenRegex, "machines of a template can't share a static IP address")))
+		})
 	})
 
 	Context("When updating a CloudStackMachineTemplate", func() {
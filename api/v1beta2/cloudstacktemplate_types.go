@@ -0,0 +1,155 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TemplateFinalizer allows ReconcileCloudStackTemplate to delete the templates it registered before removing the
+// CloudStackTemplate from the apiserver.
+const TemplateFinalizer = "cloudstacktemplate.infrastructure.cluster.x-k8s.io"
+
+// TemplateRetainPolicy is what happens to the templates registered for a CloudStackTemplate when it's deleted.
+type TemplateRetainPolicy string
+
+const (
+	// TemplateRetainPolicyDelete deletes the templates from CloudStack along with the CloudStackTemplate.
+	TemplateRetainPolicyDelete TemplateRetainPolicy = "Delete"
+	// TemplateRetainPolicyRetain leaves the templates in CloudStack.
+	TemplateRetainPolicyRetain TemplateRetainPolicy = "Retain"
+)
+
+// CloudStackTemplateSpec defines the desired state of CloudStackTemplate
+type CloudStackTemplateSpec struct {
+	// Name of the template in CloudStack. Defaults to the name of the CloudStackTemplate.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Display text of the template. Defaults to its name.
+	// +optional
+	DisplayText string `json:"displayText,omitempty"`
+
+	// URL CloudStack downloads the template from.
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// Format of the template, such as QCOW2, RAW, VHD or OVA.
+	// +kubebuilder:validation:MinLength=1
+	Format string `json:"format"`
+
+	// Hypervisor the template is for, such as KVM, XenServer or VMware.
+	// +kubebuilder:validation:MinLength=1
+	Hypervisor string `json:"hypervisor"`
+
+	// OS type of the template, by ID or by name such as "Other Linux (64-bit)".
+	OSType CloudStackResourceIdentifier `json:"osType"`
+
+	// Checksum of the template CloudStack verifies the download against, such as {SHA-256}<hash>.
+	// +optional
+	Checksum string `json:"checksum,omitempty"`
+
+	// Names of the failure domains of the cluster to whose zones the template is registered. Defaults to all of them.
+	// +optional
+	FailureDomainNames []string `json:"failureDomainNames,omitempty"`
+
+	// RetainPolicy is Delete to delete the templates from CloudStack when the CloudStackTemplate is deleted, or
+	// Retain to leave them. Defaults to Delete.
+	// +kubebuilder:validation:Enum=Delete;Retain
+	// +optional
+	RetainPolicy TemplateRetainPolicy `json:"retainPolicy,omitempty"`
+}
+
+// CloudStackTemplateFailureDomainStatus is the state of the template registered in the zone of a failure domain.
+type CloudStackTemplateFailureDomainStatus struct {
+	// Name of the failure domain.
+	FailureDomainName string `json:"failureDomainName"`
+
+	// ID of the zone the template is registered in.
+	// +optional
+	ZoneID string `json:"zoneID,omitempty"`
+
+	// ID of the template, set once it's registered.
+	// +optional
+	TemplateID string `json:"templateID,omitempty"`
+
+	// Download status of the template as reported by CloudStack, such as "35% Downloaded" or "Download Complete".
+	// +optional
+	Status string `json:"status,omitempty"`
+
+	// Ready is true once the template is downloaded and machines can be deployed from it.
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+}
+
+// CloudStackTemplateStatus defines the observed state of CloudStackTemplate
+type CloudStackTemplateStatus struct {
+	// Ready is true once the template is ready in the zones of all its failure domains.
+	// +optional
+	Ready bool `json:"ready"`
+
+	// State of the template in the zone of each of its failure domains.
+	// +optional
+	FailureDomains []CloudStackTemplateFailureDomainStatus `json:"failureDomains,omitempty"`
+}
+
+// TemplateName returns the name of the template in CloudStack.
+func (t *CloudStackTemplate) TemplateName() string {
+	if t.Spec.Name != "" {
+		return t.Spec.Name
+	}
+	return t.Name
+}
+
+// FailureDomainStatus returns the status of the template in the named failure domain, or nil if it has none.
+func (t *CloudStackTemplate) FailureDomainStatus(name string) *CloudStackTemplateFailureDomainStatus {
+	for i := range t.Status.FailureDomains {
+		if t.Status.FailureDomains[i].FailureDomainName == name {
+			return &t.Status.FailureDomains[i]
+		}
+	}
+	return nil
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:path=cloudstacktemplates,scope=Namespaced,categories=cluster-api,shortName=cstemplate
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".metadata.labels.cluster\\.x-k8s\\.io/cluster-name",description="Cluster to which this CloudStackTemplate belongs"
+//+kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="Template ready in all its failure domains"
+
+// CloudStackTemplate is the Schema for the cloudstacktemplates API
+type CloudStackTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CloudStackTemplateSpec   `json:"spec,omitempty"`
+	Status CloudStackTemplateStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CloudStackTemplateList contains a list of CloudStackTemplate
+type CloudStackTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CloudStackTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CloudStackTemplate{}, &CloudStackTemplateList{})
+}
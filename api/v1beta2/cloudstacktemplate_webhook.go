@@ -0,0 +1,81 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/webhookutil"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var cloudstacktemplatelog = logf.Log.WithName("cloudstacktemplate-resource")
+
+func (r *CloudStackTemplate) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta2-cloudstacktemplate,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=cloudstacktemplates,verbs=create;update,versions=v1beta2,name=vcloudstacktemplate.kb.io,admissionReviewVersions=v1beta1
+var _ webhook.Validator = &CloudStackTemplate{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *CloudStackTemplate) ValidateCreate() error {
+	cloudstacktemplatelog.V(1).Info("entered validate create webhook", "api resource name", r.Name)
+
+	var errorList field.ErrorList
+	errorList = webhookutil.EnsureAtLeastOneFieldExists(r.Spec.OSType.ID, r.Spec.OSType.Name, "osType", errorList)
+
+	return webhookutil.AggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, errorList)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *CloudStackTemplate) ValidateUpdate(old runtime.Object) error {
+	cloudstacktemplatelog.V(1).Info("entered validate update webhook", "api resource name", r.Name)
+
+	oldTemplate, ok := old.(*CloudStackTemplate)
+	if !ok {
+		return errors.NewBadRequest(fmt.Sprintf("expected a CloudStackTemplate but got a %T", old))
+	}
+
+	// Templates already registered aren't registered again, so what they're registered from and as can't change.
+	spec, oldSpec := r.Spec, oldTemplate.Spec
+	errorList := field.ErrorList(nil)
+	errorList = webhookutil.EnsureEqualStrings(spec.Name, oldSpec.Name, "name", errorList)
+	errorList = webhookutil.EnsureEqualStrings(spec.URL, oldSpec.URL, "url", errorList)
+	errorList = webhookutil.EnsureEqualStrings(spec.Format, oldSpec.Format, "format", errorList)
+	errorList = webhookutil.EnsureEqualStrings(spec.Hypervisor, oldSpec.Hypervisor, "hypervisor", errorList)
+	errorList = webhookutil.EnsureEqualStrings(spec.OSType.ID, oldSpec.OSType.ID, "osType", errorList)
+	errorList = webhookutil.EnsureEqualStrings(spec.OSType.Name, oldSpec.OSType.Name, "osType", errorList)
+	errorList = webhookutil.EnsureEqualStrings(spec.Checksum, oldSpec.Checksum, "checksum", errorList)
+
+	return webhookutil.AggregateObjErrors(r.GroupVersionKind().GroupKind(), r.Name, errorList)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *CloudStackTemplate) ValidateDelete() error {
+	cloudstacktemplatelog.V(1).Info("entered validate delete webhook", "api resource name", r.Name)
+	// No deletion validations.  Deletion webhook not enabled.
+	return nil
+}
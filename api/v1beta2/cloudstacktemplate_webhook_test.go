@@ -0,0 +1,78 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2_test
+
+import (
+	"context"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	dummies "sigs.k8s.io/cluster-api-provider-cloudstack/test/dummies/v1beta2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CloudStackTemplate webhook", func() {
+	var ctx context.Context
+	forbiddenRegex := "admission webhook.*denied the request.*Forbidden\\: %s"
+	requiredRegex := "admission webhook.*denied the request.*Required value\\: %s"
+
+	BeforeEach(func() { // Reset test vars to initial state.
+		dummies.SetDummyVars()
+		ctx = context.Background()
+		_ = k8sClient.Delete(ctx, dummies.CSTemplate1) // Delete any remnants.
+	})
+
+	Context("When creating a CloudStackTemplate", func() {
+		It("Should accept a CloudStackTemplate with all attributes present", func() {
+			Expect(k8sClient.Create(ctx, dummies.CSTemplate1)).Should(Succeed())
+		})
+
+		It("Should reject a CloudStackTemplate when missing the OS type", func() {
+			dummies.CSTemplate1.Spec.OSType = infrav1.CloudStackResourceIdentifier{}
+			Expect(k8sClient.Create(ctx, dummies.CSTemplate1)).
+				Should(MatchError(MatchRegexp(requiredRegex, "osType")))
+		})
+	})
+
+	Context("When updating a CloudStackTemplate", func() {
+		BeforeEach(func() { // Reset test vars to initial state.
+			Ω(k8sClient.Create(ctx, dummies.CSTemplate1)).Should(Succeed())
+		})
+
+		It("Should reject updates to what the template is registered from and as", func() {
+			for field, update := range map[string]func(*infrav1.CloudStackTemplateSpec){
+				"name":       func(spec *infrav1.CloudStackTemplateSpec) { spec.Name = "ubuntu-2204-kube-v1.28.0" },
+				"url":        func(spec *infrav1.CloudStackTemplateSpec) { spec.URL = "https://images.example.com/other.qcow2" },
+				"format":     func(spec *infrav1.CloudStackTemplateSpec) { spec.Format = "RAW" },
+				"hypervisor": func(spec *infrav1.CloudStackTemplateSpec) { spec.Hypervisor = "VMware" },
+				"osType":     func(spec *infrav1.CloudStackTemplateSpec) { spec.OSType.Name = "Other Linux (64-bit)" },
+				"checksum":   func(spec *infrav1.CloudStackTemplateSpec) { spec.Checksum = "{SHA-256}abc" },
+			} {
+				csTemplate := dummies.CSTemplate1.DeepCopy()
+				update(&csTemplate.Spec)
+				Ω(k8sClient.Update(ctx, csTemplate)).Should(MatchError(MatchRegexp(forbiddenRegex, field)))
+			}
+		})
+
+		It("Should accept updates to the failure domains and retain policy", func() {
+			dummies.CSTemplate1.Spec.FailureDomainNames = []string{dummies.CSFailureDomain1.Spec.Name}
+			dummies.CSTemplate1.Spec.RetainPolicy = infrav1.TemplateRetainPolicyRetain
+			Ω(k8sClient.Update(ctx, dummies.CSTemplate1)).Should(Succeed())
+		})
+	})
+})
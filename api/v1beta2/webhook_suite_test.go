@@ -105,6 +105,8 @@ var _ = BeforeSuite(func() {
 	Ω((&infrav1.CloudStackCluster{}).SetupWebhookWithManager(mgr)).Should(Succeed())
 	Ω((&infrav1.CloudStackMachine{}).SetupWebhookWithManager(mgr)).Should(Succeed())
 	Ω((&infrav1.CloudStackMachineTemplate{}).SetupWebhookWithManager(mgr)).Should(Succeed())
+	Ω((&infrav1.CloudStackMachinePool{}).SetupWebhookWithManager(mgr)).Should(Succeed())
+	Ω((&infrav1.CloudStackTemplate{}).SetupWebhookWithManager(mgr)).Should(Succeed())
 
 	//+kubebuilder:scaffold:webhook
 
@@ -33,7 +33,7 @@ func (in *CloudStackAffinityGroup) DeepCopyInto(out *CloudStackAffinityGroup) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackAffinityGroup.
@@ -104,6 +104,13 @@ func (in *CloudStackAffinityGroupSpec) DeepCopy() *CloudStackAffinityGroupSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudStackAffinityGroupStatus) DeepCopyInto(out *CloudStackAffinityGroupStatus) {
 	*out = *in
+	if in.AppliedTags != nil {
+		in, out := &in.AppliedTags, &out.AppliedTags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackAffinityGroupStatus.
@@ -184,6 +191,13 @@ func (in *CloudStackClusterSpec) DeepCopyInto(out *CloudStackClusterSpec) {
 		copy(*out, *in)
 	}
 	out.ControlPlaneEndpoint = in.ControlPlaneEndpoint
+	if in.AdditionalTags != nil {
+		in, out := &in.AdditionalTags, &out.AdditionalTags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackClusterSpec.
@@ -224,7 +238,7 @@ func (in *CloudStackFailureDomain) DeepCopyInto(out *CloudStackFailureDomain) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackFailureDomain.
@@ -297,6 +311,13 @@ func (in *CloudStackFailureDomainSpec) DeepCopy() *CloudStackFailureDomainSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudStackFailureDomainStatus) DeepCopyInto(out *CloudStackFailureDomainStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(v1beta1.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackFailureDomainStatus.
@@ -309,13 +330,128 @@ func (in *CloudStackFailureDomainStatus) DeepCopy() *CloudStackFailureDomainStat
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackIPPool) DeepCopyInto(out *CloudStackIPPool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackIPPool.
+func (in *CloudStackIPPool) DeepCopy() *CloudStackIPPool {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackIPPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CloudStackIPPool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackIPPoolClaim) DeepCopyInto(out *CloudStackIPPoolClaim) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackIPPoolClaim.
+func (in *CloudStackIPPoolClaim) DeepCopy() *CloudStackIPPoolClaim {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackIPPoolClaim)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackIPPoolList) DeepCopyInto(out *CloudStackIPPoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CloudStackIPPool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackIPPoolList.
+func (in *CloudStackIPPoolList) DeepCopy() *CloudStackIPPoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackIPPoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CloudStackIPPoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackIPPoolSpec) DeepCopyInto(out *CloudStackIPPoolSpec) {
+	*out = *in
+	out.Network = in.Network
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackIPPoolSpec.
+func (in *CloudStackIPPoolSpec) DeepCopy() *CloudStackIPPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackIPPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackIPPoolStatus) DeepCopyInto(out *CloudStackIPPoolStatus) {
+	*out = *in
+	if in.Claims != nil {
+		in, out := &in.Claims, &out.Claims
+		*out = make([]CloudStackIPPoolClaim, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackIPPoolStatus.
+func (in *CloudStackIPPoolStatus) DeepCopy() *CloudStackIPPoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackIPPoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudStackIsolatedNetwork) DeepCopyInto(out *CloudStackIsolatedNetwork) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackIsolatedNetwork.
@@ -387,6 +523,13 @@ func (in *CloudStackIsolatedNetworkSpec) DeepCopy() *CloudStackIsolatedNetworkSp
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudStackIsolatedNetworkStatus) DeepCopyInto(out *CloudStackIsolatedNetworkStatus) {
 	*out = *in
+	if in.AppliedTags != nil {
+		in, out := &in.AppliedTags, &out.AppliedTags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackIsolatedNetworkStatus.
@@ -458,6 +601,164 @@ func (in *CloudStackMachineList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackMachineNetwork) DeepCopyInto(out *CloudStackMachineNetwork) {
+	*out = *in
+	out.CloudStackResourceIdentifier = in.CloudStackResourceIdentifier
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackMachineNetwork.
+func (in *CloudStackMachineNetwork) DeepCopy() *CloudStackMachineNetwork {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackMachineNetwork)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackMachinePlacement) DeepCopyInto(out *CloudStackMachinePlacement) {
+	*out = *in
+	out.Host = in.Host
+	out.Cluster = in.Cluster
+	out.Pod = in.Pod
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackMachinePlacement.
+func (in *CloudStackMachinePlacement) DeepCopy() *CloudStackMachinePlacement {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackMachinePlacement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackMachinePool) DeepCopyInto(out *CloudStackMachinePool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackMachinePool.
+func (in *CloudStackMachinePool) DeepCopy() *CloudStackMachinePool {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackMachinePool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CloudStackMachinePool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackMachinePoolInstance) DeepCopyInto(out *CloudStackMachinePoolInstance) {
+	*out = *in
+	if in.AppliedTags != nil {
+		in, out := &in.AppliedTags, &out.AppliedTags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackMachinePoolInstance.
+func (in *CloudStackMachinePoolInstance) DeepCopy() *CloudStackMachinePoolInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackMachinePoolInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackMachinePoolList) DeepCopyInto(out *CloudStackMachinePoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CloudStackMachinePool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackMachinePoolList.
+func (in *CloudStackMachinePoolList) DeepCopy() *CloudStackMachinePoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackMachinePoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CloudStackMachinePoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackMachinePoolSpec) DeepCopyInto(out *CloudStackMachinePoolSpec) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+	if in.ProviderIDList != nil {
+		in, out := &in.ProviderIDList, &out.ProviderIDList
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackMachinePoolSpec.
+func (in *CloudStackMachinePoolSpec) DeepCopy() *CloudStackMachinePoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackMachinePoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackMachinePoolStatus) DeepCopyInto(out *CloudStackMachinePoolStatus) {
+	*out = *in
+	if in.Instances != nil {
+		in, out := &in.Instances, &out.Instances
+		*out = make([]CloudStackMachinePoolInstance, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackMachinePoolStatus.
+func (in *CloudStackMachinePoolStatus) DeepCopy() *CloudStackMachinePoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackMachinePoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudStackMachineSpec) DeepCopyInto(out *CloudStackMachineSpec) {
 	*out = *in
@@ -468,7 +769,17 @@ func (in *CloudStackMachineSpec) DeepCopyInto(out *CloudStackMachineSpec) {
 	}
 	out.Offering = in.Offering
 	out.Template = in.Template
+	if in.TemplateSelector != nil {
+		in, out := &in.TemplateSelector, &out.TemplateSelector
+		*out = new(CloudStackTemplateSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	out.DiskOffering = in.DiskOffering
+	if in.DataDisks != nil {
+		in, out := &in.DataDisks, &out.DataDisks
+		*out = make([]CloudStackResourceDiskOffering, len(*in))
+		copy(*out, *in)
+	}
 	if in.Details != nil {
 		in, out := &in.Details, &out.Details
 		*out = make(map[string]string, len(*in))
@@ -476,6 +787,13 @@ func (in *CloudStackMachineSpec) DeepCopyInto(out *CloudStackMachineSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.AdditionalTags != nil {
+		in, out := &in.AdditionalTags, &out.AdditionalTags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.AffinityGroupIDs != nil {
 		in, out := &in.AffinityGroupIDs, &out.AffinityGroupIDs
 		*out = make([]string, len(*in))
@@ -486,6 +804,12 @@ func (in *CloudStackMachineSpec) DeepCopyInto(out *CloudStackMachineSpec) {
 		*out = new(v1.ObjectReference)
 		**out = **in
 	}
+	if in.Networks != nil {
+		in, out := &in.Networks, &out.Networks
+		*out = make([]CloudStackMachineNetwork, len(*in))
+		copy(*out, *in)
+	}
+	out.CloudStackPlacementHints = in.CloudStackPlacementHints
 	if in.ProviderID != nil {
 		in, out := &in.ProviderID, &out.ProviderID
 		*out = new(string)
@@ -616,6 +940,25 @@ func (in *CloudStackMachineStatus) DeepCopyInto(out *CloudStackMachineStatus) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Placement != nil {
+		in, out := &in.Placement, &out.Placement
+		*out = new(CloudStackMachinePlacement)
+		**out = **in
+	}
+	if in.AppliedTags != nil {
+		in, out := &in.AppliedTags, &out.AppliedTags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(v1beta1.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackMachineStatus.
@@ -719,6 +1062,21 @@ func (in *CloudStackMachineTemplateSpec) DeepCopy() *CloudStackMachineTemplateSp
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackPlacementHints) DeepCopyInto(out *CloudStackPlacementHints) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackPlacementHints.
+func (in *CloudStackPlacementHints) DeepCopy() *CloudStackPlacementHints {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackPlacementHints)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudStackResourceDiskOffering) DeepCopyInto(out *CloudStackResourceDiskOffering) {
 	*out = *in
@@ -750,10 +1108,148 @@ func (in *CloudStackResourceIdentifier) DeepCopy() *CloudStackResourceIdentifier
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackTemplate) DeepCopyInto(out *CloudStackTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackTemplate.
+func (in *CloudStackTemplate) DeepCopy() *CloudStackTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CloudStackTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackTemplateFailureDomainStatus) DeepCopyInto(out *CloudStackTemplateFailureDomainStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackTemplateFailureDomainStatus.
+func (in *CloudStackTemplateFailureDomainStatus) DeepCopy() *CloudStackTemplateFailureDomainStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackTemplateFailureDomainStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackTemplateList) DeepCopyInto(out *CloudStackTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CloudStackTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackTemplateList.
+func (in *CloudStackTemplateList) DeepCopy() *CloudStackTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CloudStackTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackTemplateSelector) DeepCopyInto(out *CloudStackTemplateSelector) {
+	*out = *in
+	if in.MatchTags != nil {
+		in, out := &in.MatchTags, &out.MatchTags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackTemplateSelector.
+func (in *CloudStackTemplateSelector) DeepCopy() *CloudStackTemplateSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackTemplateSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackTemplateSpec) DeepCopyInto(out *CloudStackTemplateSpec) {
+	*out = *in
+	out.OSType = in.OSType
+	if in.FailureDomainNames != nil {
+		in, out := &in.FailureDomainNames, &out.FailureDomainNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackTemplateSpec.
+func (in *CloudStackTemplateSpec) DeepCopy() *CloudStackTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudStackTemplateStatus) DeepCopyInto(out *CloudStackTemplateStatus) {
+	*out = *in
+	if in.FailureDomains != nil {
+		in, out := &in.FailureDomains, &out.FailureDomains
+		*out = make([]CloudStackTemplateFailureDomainStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackTemplateStatus.
+func (in *CloudStackTemplateStatus) DeepCopy() *CloudStackTemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudStackTemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudStackZoneSpec) DeepCopyInto(out *CloudStackZoneSpec) {
 	*out = *in
 	out.Network = in.Network
+	out.CloudStackPlacementHints = in.CloudStackPlacementHints
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudStackZoneSpec.
@@ -20,7 +20,10 @@ import (
 	"context"
 
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
 	csCtrlrUtils "sigs.k8s.io/cluster-api-provider-cloudstack/controllers/utils"
@@ -60,28 +63,32 @@ func (reconciler *CloudStackAffinityGroupReconciler) Reconcile(ctx context.Conte
 	r.UsingBaseReconciler(reconciler.ReconcilerBase).ForRequest(req).WithRequestCtx(ctx)
 	r.WithAdditionalCommonStages(
 		r.GetFailureDomainByName(func() string { return r.ReconciliationSubject.Spec.FailureDomainName }, r.FailureDomain),
-		r.AsFailureDomainUser(&r.FailureDomain.Spec))
+		r.AsFailureDomainUser(&r.FailureDomain.Spec),
+		r.RequeueIfEndpointUnavailable(r.FailureDomain))
 	return r.RunBaseReconciliationStages()
 }
 
 func (r *CloudStackAGReconciliationRunner) Reconcile() (ctrl.Result, error) {
 	controllerutil.AddFinalizer(r.ReconciliationSubject, infrav1.AffinityGroupFinalizer)
 	affinityGroup := &cloud.AffinityGroup{Name: r.ReconciliationSubject.Spec.Name, Type: r.ReconciliationSubject.Spec.Type}
-	if err := r.CSUser.GetOrCreateAffinityGroup(affinityGroup); err != nil {
+	if err := r.CSUser.GetOrCreateAffinityGroup(r.RequestCtx, affinityGroup); err != nil {
 		return ctrl.Result{}, err
 	}
 	r.ReconciliationSubject.Spec.ID = affinityGroup.ID
+	if err := r.CSUser.ReconcileAffinityGroupTags(r.RequestCtx, r.ReconciliationSubject, r.CSCluster); err != nil {
+		return ctrl.Result{}, err
+	}
 	r.ReconciliationSubject.Status.Ready = true
 	return ctrl.Result{}, nil
 }
 
 func (r *CloudStackAGReconciliationRunner) ReconcileDelete() (ctrl.Result, error) {
 	group := &cloud.AffinityGroup{Name: r.ReconciliationSubject.Name}
-	_ = r.CSUser.FetchAffinityGroup(group)
+	_ = r.CSUser.FetchAffinityGroup(r.RequestCtx, group)
 	if group.ID == "" { // Affinity group not found, must have been deleted.
 		return ctrl.Result{}, nil
 	}
-	if err := r.CSUser.DeleteAffinityGroup(group); err != nil {
+	if err := r.CSUser.DeleteAffinityGroup(r.RequestCtx, group); err != nil {
 		return ctrl.Result{}, err
 	}
 	controllerutil.RemoveFinalizer(r.ReconciliationSubject, infrav1.AffinityGroupFinalizer)
@@ -92,5 +99,10 @@ func (r *CloudStackAGReconciliationRunner) ReconcileDelete() (ctrl.Result, error
 func (reconciler *CloudStackAffinityGroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrav1.CloudStackAffinityGroup{}).
+		Watches( // Reconcile the tags of the affinity group when the additional tags of the cluster change.
+			&source.Kind{Type: &infrav1.CloudStackCluster{}},
+			handler.EnqueueRequestsFromMapFunc(
+				csCtrlrUtils.CloudStackClusterToObjectsMapper(reconciler.K8sClient, &infrav1.CloudStackAffinityGroupList{})),
+			builder.WithPredicates(csCtrlrUtils.AdditionalTagsChanged)).
 		Complete(reconciler)
 }
@@ -36,7 +36,7 @@ var _ = Describe("CloudStackClusterReconciler", func() {
 
 		It("Should create a CloudStackFailureDomain.", func() {
 			tempfd := &infrav1.CloudStackFailureDomain{}
-			mockCloudClient.EXPECT().ResolveZone(gomock.Any()).AnyTimes()
+			mockCloudClient.EXPECT().ResolveZone(gomock.Any(), gomock.Any()).AnyTimes()
 			Eventually(func() bool {
 				key := client.ObjectKeyFromObject(dummies.CSFailureDomain1)
 				key.Name = key.Name + "-" + dummies.CSCluster.Name
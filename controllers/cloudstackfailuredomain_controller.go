@@ -19,16 +19,22 @@ package controllers
 import (
 	"context"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	"sort"
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
 	csCtrlrUtils "sigs.k8s.io/cluster-api-provider-cloudstack/controllers/utils"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
 )
 
 const (
@@ -90,12 +96,21 @@ func (r *CloudStackFailureDomainReconciliationRunner) Reconcile() (retRes ctrl.R
 	// Prevent premature deletion.
 	controllerutil.AddFinalizer(r.ReconciliationSubject, infrav1.FailureDomainFinalizer)
 
+	// Don't call the ACS endpoint while its circuit breaker is open, and reflect its health once done with it.
+	defer func() {
+		csCtrlrUtils.SetEndpointHealthyCondition(r.ReconciliationSubject, r.CSUser.EndpointHealth())
+	}()
+	if health := r.CSUser.EndpointHealth(); health.State == cloud.CircuitOpen {
+		r.Log.Info("ACS endpoint circuit breaker is open. Requeuing.", "lastError", health.LastError)
+		return ctrl.Result{RequeueAfter: health.RetryAfter}, nil
+	}
+
 	// Start by purely data fetching information about the zone and specified network.
-	if err := r.CSUser.ResolveZone(&r.ReconciliationSubject.Spec.Zone); err != nil {
+	if err := r.CSUser.ResolveZone(r.RequestCtx, &r.ReconciliationSubject.Spec.Zone); err != nil {
 		return ctrl.Result{}, errors.Wrap(err, "resolving CloudStack zone information")
 	}
-	if err := r.CSUser.ResolveNetworkForZone(&r.ReconciliationSubject.Spec.Zone); err != nil &&
-		!csCtrlrUtils.ContainsNoMatchSubstring(err) {
+	if err := r.CSUser.ResolveNetworkForZone(r.RequestCtx, &r.ReconciliationSubject.Spec.Zone); err != nil &&
+		!cloud.IsNotFound(err) {
 		return ctrl.Result{}, errors.Wrap(err, "resolving Cloudstack network information")
 	}
 
@@ -264,6 +279,19 @@ func (r *CloudStackFailureDomainReconciliationRunner) RemoveFinalizer() (ctrl.Re
 
 // SetupWithManager sets up the controller with the Manager.
 func (reconciler *CloudStackFailureDomainReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	_, err := ctrl.NewControllerManagedBy(mgr).For(&infrav1.CloudStackFailureDomain{}).Build(reconciler)
+	_, err := ctrl.NewControllerManagedBy(mgr).For(&infrav1.CloudStackFailureDomain{}).
+		Watches( // Drop the cached client of an ACS endpoint secret as soon as it's rotated or deleted.
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.Funcs{
+				UpdateFunc: func(e event.UpdateEvent, _ workqueue.RateLimitingInterface) {
+					if e.ObjectOld.GetResourceVersion() != e.ObjectNew.GetResourceVersion() {
+						cloud.EvictSecretClient(e.ObjectNew.GetNamespace(), e.ObjectNew.GetName())
+					}
+				},
+				DeleteFunc: func(e event.DeleteEvent, _ workqueue.RateLimitingInterface) {
+					cloud.EvictSecretClient(e.Object.GetNamespace(), e.Object.GetName())
+				},
+			}).
+		Build(reconciler)
 	return err
 }
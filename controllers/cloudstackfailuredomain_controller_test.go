@@ -42,10 +42,10 @@ var _ = Describe("CloudStackFailureDomainReconciler", func() {
 			Ω(k8sClient.Create(ctx, dummies.ACSEndpointSecret1))
 			Ω(k8sClient.Create(ctx, dummies.CSFailureDomain1))
 
-			mockCloudClient.EXPECT().ResolveZone(gomock.Any()).MinTimes(1)
+			mockCloudClient.EXPECT().ResolveZone(gomock.Any(), gomock.Any()).MinTimes(1)
 
-			mockCloudClient.EXPECT().ResolveNetworkForZone(gomock.Any()).AnyTimes().Do(
-				func(arg1 interface{}) {
+			mockCloudClient.EXPECT().ResolveNetworkForZone(gomock.Any(), gomock.Any()).AnyTimes().Do(
+				func(_, arg1 interface{}) {
 					arg1.(*infrav1.CloudStackZoneSpec).Network.ID = "SomeID"
 					arg1.(*infrav1.CloudStackZoneSpec).Network.Type = cloud.NetworkTypeShared
 				}).MinTimes(1)
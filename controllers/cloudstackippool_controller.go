@@ -0,0 +1,91 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/controllers/utils"
+)
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstackippools,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstackippools/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstackmachines,verbs=get;list;watch
+
+// CloudStackIPPoolReconciler keeps the number of free addresses of a CloudStackIPPool up to date as its addresses
+// change. Addresses are claimed and released by the machines using the pool, and the claims the pool's status lost,
+// such as when moving it to another management cluster, are restored from the addresses of the machines.
+type CloudStackIPPoolReconciler struct {
+	utils.ReconcilerBase
+}
+
+// Reconcile restores the claims of the machines using the pool and counts its free addresses into its status.
+func (reconciler *CloudStackIPPoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	pool := &infrav1.CloudStackIPPool{}
+	if err := reconciler.K8sClient.Get(ctx, req.NamespacedName, pool); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	machines := &infrav1.CloudStackMachineList{}
+	if err := reconciler.K8sClient.List(ctx, machines, client.InNamespace(pool.Namespace)); err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "listing machines of IP pool %s", pool.Name)
+	}
+	var claims []infrav1.CloudStackIPPoolClaim
+	for _, machine := range machines.Items {
+		// Machines being deleted release their claim, which mustn't be restored afterwards.
+		if machine.Spec.IPPoolName == pool.Name && machine.Spec.IPAddress != "" && machine.DeletionTimestamp.IsZero() {
+			claims = append(claims, infrav1.CloudStackIPPoolClaim{Address: machine.Spec.IPAddress, Machine: machine.Name})
+		}
+	}
+	restored, err := pool.RestoreClaims(claims)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "parsing addresses of IP pool %s", pool.Name)
+	}
+	changed, err := pool.UpdateFree()
+	if err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "parsing addresses of IP pool %s", pool.Name)
+	} else if !restored && !changed {
+		return ctrl.Result{}, nil
+	}
+	// Updates conflicting with claims made in the meantime are retried with the new claims.
+	return ctrl.Result{}, reconciler.K8sClient.Status().Update(ctx, pool)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (reconciler *CloudStackIPPoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.CloudStackIPPool{}).
+		Watches( // Restore the claims of machines as they're created or moved.
+			&source.Kind{Type: &infrav1.CloudStackMachine{}},
+			handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+				csMachine, ok := o.(*infrav1.CloudStackMachine)
+				if !ok || csMachine.Spec.IPPoolName == "" {
+					return nil
+				}
+				return []reconcile.Request{{NamespacedName: client.ObjectKey{
+					Namespace: csMachine.Namespace, Name: csMachine.Spec.IPPoolName}}}
+			})).
+		Complete(reconciler)
+}
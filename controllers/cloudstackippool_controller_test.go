@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	dummies "sigs.k8s.io/cluster-api-provider-cloudstack/test/dummies/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("CloudStackIPPoolReconciler", func() {
+	Context("With a fake ctrlRuntimeClient.", func() {
+		BeforeEach(func() {
+			setupFakeTestClient()
+		})
+
+		It("Should count the free addresses of a new pool and of its changed addresses.", func() {
+			ipPool := &infrav1.CloudStackIPPool{
+				ObjectMeta: metav1.ObjectMeta{Name: "control-plane-ips", Namespace: dummies.ClusterNameSpace},
+				Spec: infrav1.CloudStackIPPoolSpec{
+					Network:   infrav1.CloudStackResourceIdentifier{Name: dummies.Zone1.Network.Name},
+					Addresses: []string{"10.0.0.10-10.0.0.12"},
+				},
+			}
+			Ω(fakeCtrlClient.Create(ctx, ipPool)).Should(Succeed())
+			request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(ipPool)}
+
+			_, err := IPPoolReconciler.Reconcile(ctx, request)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeCtrlClient.Get(ctx, request.NamespacedName, ipPool)).Should(Succeed())
+			Ω(ipPool.Status.Free).Should(Equal(3))
+
+			ipPool.Spec.Addresses = append(ipPool.Spec.Addresses, "10.0.0.20")
+			ipPool.Status.Claims = []infrav1.CloudStackIPPoolClaim{{Address: "10.0.0.10", Machine: "machine-a"}}
+			Ω(fakeCtrlClient.Update(ctx, ipPool)).Should(Succeed())
+			_, err = IPPoolReconciler.Reconcile(ctx, request)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeCtrlClient.Get(ctx, request.NamespacedName, ipPool)).Should(Succeed())
+			Ω(ipPool.Status.Free).Should(Equal(3))
+		})
+
+		It("Should restore the claims of the machines using the pool that its status lost.", func() {
+			ipPool := &infrav1.CloudStackIPPool{
+				ObjectMeta: metav1.ObjectMeta{Name: "control-plane-ips", Namespace: dummies.ClusterNameSpace},
+				Spec: infrav1.CloudStackIPPoolSpec{
+					Network:   infrav1.CloudStackResourceIdentifier{Name: dummies.Zone1.Network.Name},
+					Addresses: []string{"10.0.0.10-10.0.0.12"},
+				},
+			}
+			Ω(fakeCtrlClient.Create(ctx, ipPool)).Should(Succeed())
+			dummies.CSMachine1.Spec.IPPoolName = ipPool.Name
+			dummies.CSMachine1.Spec.IPAddress = "10.0.0.11"
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+			deleting := dummies.CSMachine1.DeepCopy()
+			deleting.Name, deleting.ResourceVersion, deleting.Spec.IPAddress = "deleting-machine", "", "10.0.0.12"
+			deleting.Finalizers = []string{infrav1.MachineFinalizer}
+			Ω(fakeCtrlClient.Create(ctx, deleting)).Should(Succeed())
+			Ω(fakeCtrlClient.Delete(ctx, deleting)).Should(Succeed())
+			request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(ipPool)}
+
+			_, err := IPPoolReconciler.Reconcile(ctx, request)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeCtrlClient.Get(ctx, request.NamespacedName, ipPool)).Should(Succeed())
+			Ω(ipPool.Status.Claims).Should(Equal([]infrav1.CloudStackIPPoolClaim{
+				{Address: "10.0.0.11", Machine: dummies.CSMachine1.Name}}))
+			Ω(ipPool.Status.Free).Should(Equal(2))
+
+			// The claim isn't restored twice, and another machine can't claim its address.
+			_, err = IPPoolReconciler.Reconcile(ctx, request)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeCtrlClient.Get(ctx, request.NamespacedName, ipPool)).Should(Succeed())
+			Ω(ipPool.Status.Claims).Should(HaveLen(1))
+			address, _, err := ipPool.Claim("other-machine")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(address).Should(Equal("10.0.0.10"))
+		})
+	})
+})
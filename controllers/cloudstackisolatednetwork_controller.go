@@ -18,11 +18,13 @@ package controllers
 
 import (
 	"context"
-	"strings"
 
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/pkg/errors"
 	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
@@ -62,6 +64,7 @@ func (reconciler *CloudStackIsoNetReconciler) Reconcile(ctx context.Context, req
 	r.WithAdditionalCommonStages(
 		r.GetFailureDomainByName(func() string { return r.ReconciliationSubject.Spec.FailureDomainName }, r.FailureDomain),
 		r.AsFailureDomainUser(&r.FailureDomain.Spec),
+		r.RequeueIfEndpointUnavailable(r.FailureDomain),
 	)
 	return r.RunBaseReconciliationStages()
 }
@@ -75,13 +78,16 @@ func (r *CloudStackIsoNetReconciliationRunner) Reconcile() (retRes ctrl.Result,
 	if err != nil {
 		return r.ReturnWrappedError(retErr, "setting up CloudStackCluster patcher")
 	}
-	if err := r.CSUser.GetOrCreateIsolatedNetwork(r.FailureDomain, r.ReconciliationSubject, r.CSCluster); err != nil {
+	if err := r.CSUser.GetOrCreateIsolatedNetwork(r.RequestCtx, r.FailureDomain, r.ReconciliationSubject, r.CSCluster); err != nil {
 		return ctrl.Result{}, err
 	}
 	// Tag the created network.
-	if err := r.CSUser.AddClusterTag(cloud.ResourceTypeNetwork, r.ReconciliationSubject.Spec.ID, r.CSCluster); err != nil {
+	if err := r.CSUser.AddClusterTag(r.RequestCtx, cloud.ResourceTypeNetwork, r.ReconciliationSubject.Spec.ID, r.CSCluster); err != nil {
 		return ctrl.Result{}, errors.Wrapf(err, "tagging network with id %s", r.ReconciliationSubject.Spec.ID)
 	}
+	if err := r.CSUser.ReconcileIsoNetTags(r.RequestCtx, r.ReconciliationSubject, r.CSCluster); err != nil {
+		return ctrl.Result{}, err
+	}
 	if err := csClusterPatcher.Patch(r.RequestCtx, r.CSCluster); err != nil {
 		return r.ReturnWrappedError(err, "patching endpoint update to CloudStackCluster")
 	}
@@ -92,8 +98,8 @@ func (r *CloudStackIsoNetReconciliationRunner) Reconcile() (retRes ctrl.Result,
 
 func (r *CloudStackIsoNetReconciliationRunner) ReconcileDelete() (retRes ctrl.Result, retErr error) {
 	r.Log.Info("Deleting IsolatedNetwork.")
-	if err := r.CSUser.DisposeIsoNetResources(r.FailureDomain, r.ReconciliationSubject, r.CSCluster); err != nil {
-		if !strings.Contains(strings.ToLower(err.Error()), "no match found") {
+	if err := r.CSUser.DisposeIsoNetResources(r.RequestCtx, r.FailureDomain, r.ReconciliationSubject, r.CSCluster); err != nil {
+		if !cloud.IsNotFound(err) {
 			return ctrl.Result{}, err
 		}
 	}
@@ -105,5 +111,10 @@ func (r *CloudStackIsoNetReconciliationRunner) ReconcileDelete() (retRes ctrl.Re
 func (reconciler *CloudStackIsoNetReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrav1.CloudStackIsolatedNetwork{}).
+		Watches( // Reconcile the tags of the network when the additional tags of the cluster change.
+			&source.Kind{Type: &infrav1.CloudStackCluster{}},
+			handler.EnqueueRequestsFromMapFunc(
+				csCtrlrUtils.CloudStackClusterToObjectsMapper(reconciler.K8sClient, &infrav1.CloudStackIsolatedNetworkList{})),
+			builder.WithPredicates(csCtrlrUtils.AdditionalTagsChanged)).
 		Complete(reconciler)
 }
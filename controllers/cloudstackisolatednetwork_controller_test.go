@@ -33,8 +33,8 @@ var _ = Describe("CloudStackIsolatedNetworkReconciler", func() {
 		})
 
 		It("Should set itself to ready if there are no errors in calls to CloudStack methods.", func() {
-			mockCloudClient.EXPECT().GetOrCreateIsolatedNetwork(g.Any(), g.Any(), g.Any()).AnyTimes()
-			mockCloudClient.EXPECT().AddClusterTag(g.Any(), g.Any(), g.Any()).AnyTimes()
+			mockCloudClient.EXPECT().GetOrCreateIsolatedNetwork(g.Any(), g.Any(), g.Any(), g.Any()).AnyTimes()
+			mockCloudClient.EXPECT().AddClusterTag(g.Any(), g.Any(), g.Any(), g.Any()).AnyTimes()
 
 			Ω(k8sClient.Create(ctx, dummies.CSISONet1)).Should(Succeed())
 			Eventually(func() bool {
@@ -52,8 +52,10 @@ const (
 	BootstrapDataNotReady                      = "Bootstrap DataSecretName not yet available"
 	CSMachineCreationSuccess                   = "CloudStack instance Created"
 	CSMachineCreationFailed                    = "Creating CloudStack machine failed: %s"
+	CSMachineCreationInProgress                = "CloudStack instance deployment in progress"
 	MachineInstanceRunning                     = "Machine instance is Running..."
 	MachineInErrorMessage                      = "CloudStackMachine VM in error state. Deleting associated Machine"
+	MachineScalingUnsupportedMessage           = "CloudStackMachine VM can't be scaled. Deleting associated Machine"
 	MachineNotReadyMessage                     = "Instance not ready, is %s"
 	CSMachineStateCheckerCreationFailed        = "error encountered when creating CloudStackMachineStateChecker"
 	CSMachineStateCheckerCreationSuccess       = "CloudStackMachineStateChecker created"
@@ -64,6 +66,9 @@ const (
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstackmachines,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstackmachines/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstackmachines/finalizers,verbs=update
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstackippools,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstackippools/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstacktemplates,verbs=get;list;watch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machinesets,verbs=get;list;watch
 // +kubebuilder:rbac:groups=controlplane.cluster.x-k8s.io,resources=kubeadmcontrolplanes,verbs=get;list;watch
@@ -109,7 +114,8 @@ func (reconciler *CloudStackMachineReconciler) Reconcile(ctx context.Context, re
 		r.RequeueIfCloudStackClusterNotReady,
 		r.SetFailureDomainOnCSMachine,
 		r.GetFailureDomainByName(func() string { return r.ReconciliationSubject.Spec.FailureDomainName }, r.FailureDomain),
-		r.AsFailureDomainUser(&r.FailureDomain.Spec))
+		r.AsFailureDomainUser(&r.FailureDomain.Spec),
+		r.RequeueIfEndpointUnavailable(r.FailureDomain))
 	return r.RunBaseReconciliationStages()
 }
 
@@ -121,7 +127,12 @@ func (r *CloudStackMachineReconciliationRunner) Reconcile() (retRes ctrl.Result,
 		r.RunIf(func() bool { return r.FailureDomain.Spec.Zone.Network.Type == cloud.NetworkTypeIsolated },
 			r.CheckPresent(map[string]client.Object{"CloudStackIsolatedNetwork": r.IsoNet})),
 		r.ConsiderAffinity,
+		r.ClaimIPAddress(r.ReconciliationSubject, r.FailureDomain),
+		r.ResolveTemplateRef(r.ReconciliationSubject, r.FailureDomain),
 		r.GetOrCreateVMInstance,
+		r.ReconcileDataDisks,
+		r.ReconcileVMInstanceTags,
+		r.RunIf(func() bool { return r.ReconciliationSubject.Spec.VerticalScaling }, r.ScaleVMInstance),
 		r.RequeueIfInstanceNotRunning,
 		r.AddToLBIfNeeded,
 		r.GetOrCreateMachineStateChecker,
@@ -211,15 +222,20 @@ func (r *CloudStackMachineReconciliationRunner) GetOrCreateVMInstance() (retRes
 	if err := r.K8sClient.Get(context.TODO(), key, secret); err != nil {
 		return ctrl.Result{}, err
 	}
-	data, present := secret.Data["value"]
-	if !present {
-		return ctrl.Result{}, errors.New("bootstrap secret data not yet set")
+	userData, err := bootstrapUserData(secret, r.CAPIMachine.Name, r.FailureDomain.Spec.Name)
+	if err != nil {
+		return ctrl.Result{}, err
 	}
+	err = r.CSUser.GetOrCreateVMInstance(r.RequestCtx, r.ReconciliationSubject, r.CAPIMachine, r.CSCluster, r.FailureDomain, r.AffinityGroup, userData)
 
-	userData := processCustomMetadata(data, r)
-	err := r.CSUser.GetOrCreateVMInstance(r.ReconciliationSubject, r.CAPIMachine, r.CSCluster, r.FailureDomain, r.AffinityGroup, userData)
-
-	if err != nil {
+	if errors.Is(err, cloud.ErrAsyncJobPending) {
+		// The VM exists and has an instance ID, so make sure reconcile-delete will destroy it.
+		controllerutil.AddFinalizer(r.ReconciliationSubject, infrav1.MachineFinalizer)
+		return r.RequeueWithMessage(CSMachineCreationInProgress+".", "jobID", r.ReconciliationSubject.Status.AsyncJobID)
+	} else if errors.Is(err, cloud.ErrRootDiskTooSmall) {
+		// Reported by the InstanceDeployed condition too, as admission can only check it if it resolves the template.
+		r.Recorder.Event(r.ReconciliationSubject, "Warning", infrav1.RootDiskTooSmallReason, err.Error())
+	} else if err != nil {
 		r.Recorder.Eventf(r.ReconciliationSubject, "Warning", "Creating", CSMachineCreationFailed, err.Error())
 	}
 	if err == nil && !controllerutil.ContainsFinalizer(r.ReconciliationSubject, infrav1.MachineFinalizer) { // Fetched or Created?
@@ -234,11 +250,56 @@ func (r *CloudStackMachineReconciliationRunner) GetOrCreateVMInstance() (retRes
 	return ctrl.Result{}, err
 }
 
-func processCustomMetadata(data []byte, r *CloudStackMachineReconciliationRunner) string {
+// ReconcileDataDisks creates the machine's data disks and attaches them to its instance, which is then started.
+func (r *CloudStackMachineReconciliationRunner) ReconcileDataDisks() (retRes ctrl.Result, reterr error) {
+	err := r.CSUser.ReconcileDataDisks(r.RequestCtx, r.ReconciliationSubject, r.FailureDomain)
+	if errors.Is(err, cloud.ErrAsyncJobPending) {
+		return r.RequeueWithMessage("Data disks being attached.", "jobID", r.ReconciliationSubject.Status.AsyncJobID)
+	}
+	return ctrl.Result{}, err
+}
+
+// ReconcileVMInstanceTags applies the additional tags of the machine and its cluster to the machine's instance and volumes.
+func (r *CloudStackMachineReconciliationRunner) ReconcileVMInstanceTags() (retRes ctrl.Result, reterr error) {
+	return ctrl.Result{}, r.CSUser.ReconcileVMInstanceTags(r.RequestCtx, r.ReconciliationSubject, r.CSCluster)
+}
+
+// ScaleVMInstance scales the machine's instance to the compute offering of its spec, and deletes the associated Machine
+// to replace it when CloudStack can't scale the instance.
+func (r *CloudStackMachineReconciliationRunner) ScaleVMInstance() (retRes ctrl.Result, reterr error) {
+	err := r.CSUser.ScaleVMInstance(r.RequestCtx, r.ReconciliationSubject, r.FailureDomain)
+	if errors.Is(err, cloud.ErrAsyncJobPending) {
+		return r.RequeueWithMessage("Instance being scaled.", "jobID", r.ReconciliationSubject.Status.AsyncJobID)
+	} else if errors.Is(err, cloud.ErrScalingUnsupported) {
+		r.Recorder.Event(r.ReconciliationSubject, "Warning", "Scaling", MachineScalingUnsupportedMessage)
+		r.Log.Info(MachineScalingUnsupportedMessage, "csMachine", r.ReconciliationSubject.GetName(), "reason", err.Error())
+		if err := r.K8sClient.Delete(r.RequestCtx, r.CAPIMachine); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: utils.RequeueTimeout}, nil
+	}
+	return ctrl.Result{}, err
+}
+
+// bootstrapUserData returns the user data of a machine of the given hostname and failure domain from its bootstrap
+// data secret.
+func bootstrapUserData(secret *corev1.Secret, hostname string, failureDomain string) (string, error) {
+	data, present := secret.Data["value"]
+	if !present {
+		return "", errors.New("bootstrap secret data not yet set")
+	}
+	if utils.IsIgnitionBootstrapData(secret) {
+		// Ignition has no templating, so the placeholders are replaced on the node instead.
+		return utils.InjectIgnitionMetadata(data, hostname, failureDomain)
+	}
+	return processCustomMetadata(data, hostname, failureDomain), nil
+}
+
+func processCustomMetadata(data []byte, hostname string, failureDomain string) string {
 	// since cloudstack metadata does not allow custom data added into meta_data, following line is a workaround to specify a hostname name
 	// {{ ds.meta_data.hostname }} is expected to be used as a node name when kubelet register a node
-	userData := hostnameMatcher.ReplaceAllString(string(data), r.CAPIMachine.Name)
-	userData = failuredomainMatcher.ReplaceAllString(userData, r.FailureDomain.Spec.Name)
+	userData := hostnameMatcher.ReplaceAllString(string(data), hostname)
+	userData = failuredomainMatcher.ReplaceAllString(userData, failureDomain)
 	return userData
 }
 
@@ -270,7 +331,7 @@ func (r *CloudStackMachineReconciliationRunner) AddToLBIfNeeded() (retRes ctrl.R
 		if r.IsoNet.Spec.Name == "" {
 			return r.RequeueWithMessage("Could not get required Isolated Network for VM, requeueing.")
 		}
-		err := r.CSUser.AssignVMToLoadBalancerRule(r.IsoNet, *r.ReconciliationSubject.Spec.InstanceID)
+		err := r.CSUser.AssignVMToLoadBalancerRule(r.RequestCtx, r.IsoNet, *r.ReconciliationSubject.Spec.InstanceID)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
@@ -299,8 +360,12 @@ func (r *CloudStackMachineReconciliationRunner) ReconcileDelete() (retRes ctrl.R
 	if r.ReconciliationSubject.Spec.InstanceID == nil {
 		// InstanceID is not set until deploying VM finishes which can take minutes, and CloudStack Machine can be deleted before VM deployment complete.
 		// ResolveVMInstanceDetails can get InstanceID by CS machine name
-		err := r.CSClient.ResolveVMInstanceDetails(r.ReconciliationSubject)
-		if err != nil {
+		err := r.CSClient.ResolveVMInstanceDetails(r.RequestCtx, r.ReconciliationSubject)
+		if cloud.IsNotFound(err) {
+			// No VM was deployed. The machine has its finalizer for the IP address it claimed before deploying.
+			r.Log.Info("No instance deployed for the machine.")
+			return r.releaseMachineResources()
+		} else if err != nil {
 			r.ReconciliationSubject.Status.Status = pointer.String(metav1.StatusFailure)
 			r.ReconciliationSubject.Status.Reason = pointer.String(err.Error() +
 				fmt.Sprintf(" If this VM has already been deleted, please remove the finalizer named %s from object %s",
@@ -316,16 +381,30 @@ func (r *CloudStackMachineReconciliationRunner) ReconcileDelete() (retRes ctrl.R
 	// Use CSClient instead of CSUser here to expunge as admin.
 	// The CloudStack-Go API does not return an error, but the VM won't delete with Expunge set if requested by
 	// non-domain admin user.
-	if err := r.CSClient.DestroyVMInstance(r.ReconciliationSubject); err != nil {
+	if err := r.CSClient.DestroyVMInstance(r.RequestCtx, r.ReconciliationSubject); err != nil {
 		if err.Error() == "VM deletion in progress" {
 			r.Log.Info(err.Error())
 			return ctrl.Result{RequeueAfter: utils.DestoryVMRequeueInterval}, nil
 		}
 		return ctrl.Result{}, err
 	}
+	r.Log.Info("VM Deleted", "instanceID", r.ReconciliationSubject.Spec.InstanceID)
+	return r.releaseMachineResources()
+}
+
+// releaseMachineResources deletes the user data registered for the machine and releases the IP address it claimed,
+// once its VM is gone, and then removes its finalizer.
+func (r *CloudStackMachineReconciliationRunner) releaseMachineResources() (ctrl.Result, error) {
+	// Delete the registered user data as the failure domain user that registered it.
+	if err := r.CSUser.DeleteVMInstanceUserData(r.RequestCtx, r.ReconciliationSubject); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if res, err := r.ReleaseIPAddress(r.ReconciliationSubject)(); r.ShouldReturn(res, err) {
+		return res, err
+	}
 
 	controllerutil.RemoveFinalizer(r.ReconciliationSubject, infrav1.MachineFinalizer)
-	r.Log.Info("VM Deleted", "instanceID", r.ReconciliationSubject.Spec.InstanceID)
 	return ctrl.Result{}, nil
 }
 
@@ -393,6 +472,16 @@ func (reconciler *CloudStackMachineReconciler) SetupWithManager(mgr ctrl.Manager
 		return err
 	}
 
+	// Reconcile the tags of the machines' instances when the additional tags of their CloudStackCluster change.
+	if err = controller.Watch(
+		&source.Kind{Type: &infrav1.CloudStackCluster{}},
+		handler.EnqueueRequestsFromMapFunc(
+			utils.CloudStackClusterToObjectsMapper(reconciler.K8sClient, &infrav1.CloudStackMachineList{})),
+		utils.AdditionalTagsChanged,
+	); err != nil {
+		return err
+	}
+
 	reconciler.Recorder = mgr.GetEventRecorderFor("capc-machine-controller")
 	// Add a watch on CAPI Cluster objects for unpause and ready events.
 	return controller.Watch(
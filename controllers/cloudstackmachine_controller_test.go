@@ -17,6 +17,8 @@ limitations under the License.
 package controllers_test
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
@@ -26,8 +28,11 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/utils/pointer"
 	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/controllers/utils"
 	dummies "sigs.k8s.io/cluster-api-provider-cloudstack/test/dummies/v1beta2"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/test/fakeacs"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -57,9 +62,9 @@ var _ = Describe("CloudStackMachineReconciler", func() {
 		It("Should call GetOrCreateVMInstance and set Status.Ready to true", func() {
 			// Mock a call to GetOrCreateVMInstance and set the machine to running.
 			mockCloudClient.EXPECT().GetOrCreateVMInstance(
-				gomock.Any(), gomock.Any(), gomock.Any(),
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
 				gomock.Any(), gomock.Any(), gomock.Any()).Do(
-				func(arg1, _, _, _, _, _ interface{}) {
+				func(_, arg1, _, _, _, _, _ interface{}) {
 					arg1.(*infrav1.CloudStackMachine).Status.InstanceState = "Running"
 				}).AnyTimes()
 
@@ -82,14 +87,14 @@ var _ = Describe("CloudStackMachineReconciler", func() {
 		It("Should call DestroyVMInstance when CS machine deleted", func() {
 			// Mock a call to GetOrCreateVMInstance and set the machine to running.
 			mockCloudClient.EXPECT().GetOrCreateVMInstance(
-				gomock.Any(), gomock.Any(), gomock.Any(),
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
 				gomock.Any(), gomock.Any(), gomock.Any()).Do(
-				func(arg1, _, _, _, _, _ interface{}) {
+				func(_, arg1, _, _, _, _, _ interface{}) {
 					arg1.(*infrav1.CloudStackMachine).Status.InstanceState = "Running"
 					controllerutil.AddFinalizer(arg1.(*infrav1.CloudStackMachine), infrav1.MachineFinalizer)
 				}).AnyTimes()
 
-			mockCloudClient.EXPECT().DestroyVMInstance(gomock.Any()).Times(1).Return(nil)
+			mockCloudClient.EXPECT().DestroyVMInstance(gomock.Any(), gomock.Any()).Times(1).Return(nil)
 			// Have to do this here or the reconcile call to GetOrCreateVMInstance may happen too early.
 			setupMachineCRDs()
 
@@ -122,19 +127,19 @@ var _ = Describe("CloudStackMachineReconciler", func() {
 			instanceID := pointer.String("instance-id-123")
 			// Mock a call to GetOrCreateVMInstance and set the machine to running.
 			mockCloudClient.EXPECT().GetOrCreateVMInstance(
-				gomock.Any(), gomock.Any(), gomock.Any(),
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
 				gomock.Any(), gomock.Any(), gomock.Any()).Do(
-				func(arg1, _, _, _, _, _ interface{}) {
+				func(_, arg1, _, _, _, _, _ interface{}) {
 					arg1.(*infrav1.CloudStackMachine).Status.InstanceState = "Running"
 					controllerutil.AddFinalizer(arg1.(*infrav1.CloudStackMachine), infrav1.MachineFinalizer)
 				}).AnyTimes()
 
-			mockCloudClient.EXPECT().ResolveVMInstanceDetails(gomock.Any()).Do(
-				func(arg1 interface{}) {
+			mockCloudClient.EXPECT().ResolveVMInstanceDetails(gomock.Any(), gomock.Any()).Do(
+				func(_, arg1 interface{}) {
 					arg1.(*infrav1.CloudStackMachine).Spec.InstanceID = instanceID
 				}).AnyTimes().Return(nil)
 
-			mockCloudClient.EXPECT().DestroyVMInstance(gomock.Any()).Times(1).Return(nil)
+			mockCloudClient.EXPECT().DestroyVMInstance(gomock.Any(), gomock.Any()).Times(1).Return(nil)
 			// Have to do this here or the reconcile call to GetOrCreateVMInstance may happen too early.
 			setupMachineCRDs()
 
@@ -171,9 +176,9 @@ var _ = Describe("CloudStackMachineReconciler", func() {
 		It("Should replace ds.meta_data.xxx with proper values.", func() {
 			// Mock a call to GetOrCreateVMInstance and set the machine to running.
 			mockCloudClient.EXPECT().GetOrCreateVMInstance(
-				gomock.Any(), gomock.Any(), gomock.Any(),
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
 				gomock.Any(), gomock.Any(), gomock.Any()).Do(
-				func(arg1, _, _, _, _, userdata interface{}) {
+				func(_, arg1, _, _, _, _, userdata interface{}) {
 					expectedUserdata := fmt.Sprintf("%s{{%s}}", dummies.CAPIMachine.Name, dummies.CSMachine1.Spec.FailureDomainName)
 					Ω(userdata == expectedUserdata).Should(BeTrue())
 					arg1.(*infrav1.CloudStackMachine).Status.InstanceState = "Running"
@@ -222,6 +227,15 @@ var _ = Describe("CloudStackMachineReconciler", func() {
 			Ω(res.RequeueAfter).ShouldNot(BeZero())
 		})
 
+		It("Should map a CloudStackCluster to the machines of its cluster when their names differ.", func() {
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+			csCluster := dummies.CSCluster.DeepCopy()
+			csCluster.Name = "differently-named-cloudstack-cluster"
+
+			requests := utils.CloudStackClusterToObjectsMapper(fakeCtrlClient, &infrav1.CloudStackMachineList{})(csCluster)
+			Ω(requests).Should(ConsistOf(ctrl.Request{NamespacedName: client.ObjectKeyFromObject(dummies.CSMachine1)}))
+		})
+
 		It("Should create event Machine instance is Running", func() {
 			key := client.ObjectKeyFromObject(dummies.CSCluster)
 			dummies.CAPIMachine.Name = "someMachine"
@@ -233,9 +247,9 @@ var _ = Describe("CloudStackMachineReconciler", func() {
 				UID:        "uniqueness",
 			})
 			mockCloudClient.EXPECT().GetOrCreateVMInstance(
-				gomock.Any(), gomock.Any(), gomock.Any(),
+				gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
 				gomock.Any(), gomock.Any(), gomock.Any()).Do(
-				func(arg1, _, _, _, _, _ interface{}) {
+				func(_, arg1, _, _, _, _, _ interface{}) {
 					arg1.(*infrav1.CloudStackMachine).Status.InstanceState = "Running"
 				}).AnyTimes()
 			Ω(fakeCtrlClient.Get(ctx, key, dummies.CSCluster)).Should(Succeed())
@@ -263,4 +277,543 @@ var _ = Describe("CloudStackMachineReconciler", func() {
 			}, timeout).Should(BeTrue())
 		})
 	})
+
+	Context("With a fake ctrlRuntimeClient and a fake ACS API server.", func() {
+		BeforeEach(func() {
+			setupFakeACSTestClient()
+			dummies.CSCluster.Spec.FailureDomains = dummies.CSCluster.Spec.FailureDomains[:1]
+			dummies.CSCluster.Spec.FailureDomains[0].Name = dummies.CSFailureDomain1.Spec.Name
+			dummies.CSMachine1.Spec.InstanceID = nil
+		})
+
+		It("Should deploy a VM instance and destroy it when the CloudStackMachine is deleted.", func() {
+			key := client.ObjectKeyFromObject(dummies.CSCluster)
+			dummies.CAPIMachine.Name = "someMachine"
+			dummies.CAPIMachine.Spec.Bootstrap.DataSecretName = &dummies.BootstrapSecret.Name
+			dummies.CSMachine1.OwnerReferences = append(dummies.CSMachine1.OwnerReferences, metav1.OwnerReference{
+				Kind:       "Machine",
+				APIVersion: clusterv1.GroupVersion.String(),
+				Name:       dummies.CAPIMachine.Name,
+				UID:        "uniqueness",
+			})
+			Ω(fakeCtrlClient.Get(ctx, key, dummies.CSCluster)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CAPIMachine)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSFailureDomain1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.BootstrapSecret)).Should(Succeed())
+
+			setClusterReady(fakeCtrlClient)
+
+			requestNamespacedName := types.NamespacedName{Namespace: dummies.ClusterNameSpace, Name: dummies.CSMachine1.Name}
+			res, err := MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(res.RequeueAfter).Should(BeZero())
+
+			csMachine := &infrav1.CloudStackMachine{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			Ω(csMachine.Spec.InstanceID).ShouldNot(BeNil())
+			Ω(csMachine.Finalizers).Should(ContainElement(infrav1.MachineFinalizer))
+			Ω(csMachine.Status.Ready).Should(BeTrue())
+			vm, found := fakeACS.Get(fakeacs.KindVirtualMachine, *csMachine.Spec.InstanceID)
+			Ω(found).Should(BeTrue())
+			Ω(vm["state"]).Should(Equal("Running"))
+			Ω(vm["displayname"]).Should(Equal(dummies.CAPIMachine.Name))
+
+			Ω(fakeCtrlClient.Delete(ctx, csMachine)).Should(Succeed())
+			res, err = MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(res.RequeueAfter).Should(BeZero())
+			Ω(fakeACS.Count(fakeacs.KindVirtualMachine)).Should(BeZero())
+			Ω(fakeACS.Count(fakeacs.KindVolume)).Should(BeZero())
+		})
+
+		It("Should attach the data disks before the instance first starts.", func() {
+			key := client.ObjectKeyFromObject(dummies.CSCluster)
+			dummies.CAPIMachine.Name = "someMachine"
+			dummies.CAPIMachine.Spec.Bootstrap.DataSecretName = &dummies.BootstrapSecret.Name
+			dummies.CSMachine1.OwnerReferences = append(dummies.CSMachine1.OwnerReferences, metav1.OwnerReference{
+				Kind:       "Machine",
+				APIVersion: clusterv1.GroupVersion.String(),
+				Name:       dummies.CAPIMachine.Name,
+				UID:        "uniqueness",
+			})
+			dummies.CSMachine1.Spec.DataDisks = []infrav1.CloudStackResourceDiskOffering{
+				{CloudStackResourceIdentifier: dummies.CSMachine1.Spec.DiskOffering.CloudStackResourceIdentifier,
+					MountPath: "/var/lib/etcd", Device: "/dev/vdc", Filesystem: "ext4", Label: "etcd_disk"},
+			}
+			Ω(fakeCtrlClient.Get(ctx, key, dummies.CSCluster)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CAPIMachine)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSFailureDomain1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.BootstrapSecret)).Should(Succeed())
+
+			setClusterReady(fakeCtrlClient)
+
+			requestNamespacedName := types.NamespacedName{Namespace: dummies.ClusterNameSpace, Name: dummies.CSMachine1.Name}
+			_, err := MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			csMachine := &infrav1.CloudStackMachine{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			Ω(csMachine.Status.Ready).Should(BeTrue())
+			Ω(csMachine.Status.InstanceState).Should(Equal("Running"))
+			Ω(fakeACS.Calls("attachVolume")).Should(Equal(1))
+			Ω(fakeACS.Calls("startVirtualMachine")).Should(Equal(1))
+			Ω(fakeACS.Count(fakeacs.KindVolume)).Should(Equal(3))
+		})
+
+		It("Should scale the instance in place when the offering of a machine scaling vertically changes.", func() {
+			key := client.ObjectKeyFromObject(dummies.CSCluster)
+			dummies.CAPIMachine.Name = "someMachine"
+			dummies.CAPIMachine.Spec.Bootstrap.DataSecretName = &dummies.BootstrapSecret.Name
+			dummies.CSMachine1.OwnerReferences = append(dummies.CSMachine1.OwnerReferences, metav1.OwnerReference{
+				Kind:       "Machine",
+				APIVersion: clusterv1.GroupVersion.String(),
+				Name:       dummies.CAPIMachine.Name,
+				UID:        "uniqueness",
+			})
+			dummies.CSMachine1.Spec.VerticalScaling = true
+			fakeACS.AddServiceOffering("large", 4, 4096)
+			Ω(fakeCtrlClient.Get(ctx, key, dummies.CSCluster)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CAPIMachine)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSFailureDomain1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.BootstrapSecret)).Should(Succeed())
+
+			setClusterReady(fakeCtrlClient)
+
+			requestNamespacedName := types.NamespacedName{Namespace: dummies.ClusterNameSpace, Name: dummies.CSMachine1.Name}
+			_, err := MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeACS.Calls("scaleVirtualMachine")).Should(BeZero())
+
+			csMachine := &infrav1.CloudStackMachine{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			csMachine.Spec.Offering = infrav1.CloudStackResourceIdentifier{Name: "large"}
+			Ω(fakeCtrlClient.Update(ctx, csMachine)).Should(Succeed())
+			_, err = MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			Ω(conditions.IsTrue(csMachine, infrav1.InstanceScaledCondition)).Should(BeTrue())
+			Ω(csMachine.Status.InstanceState).Should(Equal("Running"))
+			vm, found := fakeACS.Get(fakeacs.KindVirtualMachine, *csMachine.Spec.InstanceID)
+			Ω(found).Should(BeTrue())
+			Ω(vm["serviceofferingname"]).Should(Equal("large"))
+			Ω(fakeACS.Calls("stopVirtualMachine")).Should(Equal(1))
+			Ω(fakeACS.Calls("startVirtualMachine")).Should(Equal(1))
+		})
+
+		It("Should scale the instance stopped when its live scaling job fails.", func() {
+			key := client.ObjectKeyFromObject(dummies.CSCluster)
+			dummies.CAPIMachine.Name = "someMachine"
+			dummies.CAPIMachine.Spec.Bootstrap.DataSecretName = &dummies.BootstrapSecret.Name
+			dummies.CSMachine1.OwnerReferences = append(dummies.CSMachine1.OwnerReferences, metav1.OwnerReference{
+				Kind:       "Machine",
+				APIVersion: clusterv1.GroupVersion.String(),
+				Name:       dummies.CAPIMachine.Name,
+				UID:        "uniqueness",
+			})
+			dummies.CSMachine1.Spec.VerticalScaling = true
+			// CloudStack only scales running instances up, so scaling this one down live fails in its job.
+			templateID, found := fakeACS.Find(fakeacs.KindTemplate, dummies.CSMachine1.Spec.Template.Name)
+			Ω(found).Should(BeTrue())
+			fakeACS.Set(fakeacs.KindTemplate, templateID, "isdynamicallyscalable", true)
+			fakeACS.AddServiceOffering("small", 1, 1024)
+			Ω(fakeCtrlClient.Get(ctx, key, dummies.CSCluster)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CAPIMachine)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSFailureDomain1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.BootstrapSecret)).Should(Succeed())
+
+			setClusterReady(fakeCtrlClient)
+
+			var events []string
+			requestNamespacedName := types.NamespacedName{Namespace: dummies.ClusterNameSpace, Name: dummies.CSMachine1.Name}
+			reconcile := func() ctrl.Result {
+				res, err := MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+				Ω(err).ShouldNot(HaveOccurred())
+				for len(fakeRecorder.Events) > 0 {
+					events = append(events, <-fakeRecorder.Events)
+				}
+				return res
+			}
+			reconcile()
+
+			csMachine := &infrav1.CloudStackMachine{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			Ω(csMachine.Status.InstanceState).Should(Equal("Running"))
+			csMachine.Spec.Offering = infrav1.CloudStackResourceIdentifier{Name: "small"}
+			Ω(fakeCtrlClient.Update(ctx, csMachine)).Should(Succeed())
+
+			fakeACS.SetJobPolls(1)
+			Ω(reconcile().RequeueAfter).ShouldNot(BeZero())
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			Ω(csMachine.Status.AsyncJobKind).Should(Equal(infrav1.AsyncJobScale))
+			Ω(fakeACS.Calls("scaleVirtualMachine")).Should(Equal(1))
+			Ω(fakeACS.Calls("stopVirtualMachine")).Should(BeZero())
+
+			for i := 0; i < 10 && !conditions.IsTrue(csMachine, infrav1.InstanceScaledCondition); i++ {
+				reconcile()
+				Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			}
+			Ω(conditions.IsTrue(csMachine, infrav1.InstanceScaledCondition)).Should(BeTrue())
+			Ω(csMachine.Status.InstanceState).Should(Equal("Running"))
+			vm, found := fakeACS.Get(fakeacs.KindVirtualMachine, *csMachine.Spec.InstanceID)
+			Ω(found).Should(BeTrue())
+			Ω(vm["serviceofferingname"]).Should(Equal("small"))
+			Ω(fakeACS.Calls("scaleVirtualMachine")).Should(Equal(2))
+			Ω(fakeACS.Calls("stopVirtualMachine")).Should(Equal(1))
+			Ω(fakeACS.Calls("startVirtualMachine")).Should(Equal(1))
+			Ω(events).ShouldNot(ContainElement(ContainSubstring("Creating CloudStack machine failed")))
+		})
+
+		It("Should delete the Machine of an instance CloudStack can't scale to replace it.", func() {
+			key := client.ObjectKeyFromObject(dummies.CSCluster)
+			dummies.CAPIMachine.Name = "someMachine"
+			dummies.CAPIMachine.Spec.Bootstrap.DataSecretName = &dummies.BootstrapSecret.Name
+			dummies.CSMachine1.OwnerReferences = append(dummies.CSMachine1.OwnerReferences, metav1.OwnerReference{
+				Kind:       "Machine",
+				APIVersion: clusterv1.GroupVersion.String(),
+				Name:       dummies.CAPIMachine.Name,
+				UID:        "uniqueness",
+			})
+			dummies.CSMachine1.Spec.VerticalScaling = true
+			fakeACS.AddServiceOffering("large", 4, 4096)
+			Ω(fakeCtrlClient.Get(ctx, key, dummies.CSCluster)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CAPIMachine)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSFailureDomain1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.BootstrapSecret)).Should(Succeed())
+
+			setClusterReady(fakeCtrlClient)
+
+			requestNamespacedName := types.NamespacedName{Namespace: dummies.ClusterNameSpace, Name: dummies.CSMachine1.Name}
+			_, err := MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			csMachine := &infrav1.CloudStackMachine{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			csMachine.Spec.Offering = infrav1.CloudStackResourceIdentifier{Name: "large"}
+			Ω(fakeCtrlClient.Update(ctx, csMachine)).Should(Succeed())
+			fakeACS.FailNext("scaleVirtualMachine", fakeacs.ErrorCodeParam, fakeacs.CSExceptionInvalidParameter,
+				"Unable to scale VM as the new service offering uses another storage type")
+			_, err = MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			Ω(conditions.GetReason(csMachine, infrav1.InstanceScaledCondition)).Should(
+				Equal(infrav1.InstanceScalingUnsupportedReason))
+			capiMachine := &clusterv1.Machine{}
+			Ω(errors.IsNotFound(fakeCtrlClient.Get(ctx, client.ObjectKeyFromObject(dummies.CAPIMachine), capiMachine))).
+				Should(BeTrue())
+		})
+
+		It("Should deploy with an address claimed from the IP pool and release it on deletion.", func() {
+			key := client.ObjectKeyFromObject(dummies.CSCluster)
+			dummies.CAPIMachine.Name = "someMachine"
+			dummies.CAPIMachine.Spec.Bootstrap.DataSecretName = &dummies.BootstrapSecret.Name
+			dummies.CSMachine1.OwnerReferences = append(dummies.CSMachine1.OwnerReferences, metav1.OwnerReference{
+				Kind:       "Machine",
+				APIVersion: clusterv1.GroupVersion.String(),
+				Name:       dummies.CAPIMachine.Name,
+				UID:        "uniqueness",
+			})
+			ipPool := &infrav1.CloudStackIPPool{
+				ObjectMeta: metav1.ObjectMeta{Name: "control-plane-ips", Namespace: dummies.ClusterNameSpace},
+				Spec: infrav1.CloudStackIPPoolSpec{
+					Network:   infrav1.CloudStackResourceIdentifier{Name: dummies.Zone1.Network.Name},
+					Addresses: []string{"10.0.0.10-10.0.0.12"},
+				},
+				Status: infrav1.CloudStackIPPoolStatus{
+					Claims: []infrav1.CloudStackIPPoolClaim{{Address: "10.0.0.10", Machine: "other-machine"}},
+				},
+			}
+			dummies.CSMachine1.Spec.IPPoolName = ipPool.Name
+			Ω(fakeCtrlClient.Get(ctx, key, dummies.CSCluster)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CAPIMachine)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSFailureDomain1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.BootstrapSecret)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, ipPool)).Should(Succeed())
+
+			setClusterReady(fakeCtrlClient)
+
+			requestNamespacedName := types.NamespacedName{Namespace: dummies.ClusterNameSpace, Name: dummies.CSMachine1.Name}
+			_, err := MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			// The finalizer is persisted before the address is claimed.
+			csMachine := &infrav1.CloudStackMachine{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			Ω(csMachine.Finalizers).Should(ContainElement(infrav1.MachineFinalizer))
+			Ω(csMachine.Spec.IPAddress).Should(BeEmpty())
+
+			_, err = MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			Ω(csMachine.Spec.IPAddress).Should(Equal("10.0.0.11"))
+			vm, found := fakeACS.Get(fakeacs.KindVirtualMachine, *csMachine.Spec.InstanceID)
+			Ω(found).Should(BeTrue())
+			Ω(vm["ipaddress"]).Should(Equal("10.0.0.11"))
+			Ω(fakeCtrlClient.Get(ctx, client.ObjectKeyFromObject(ipPool), ipPool)).Should(Succeed())
+			Ω(ipPool.Status.Claims).Should(ContainElement(
+				infrav1.CloudStackIPPoolClaim{Address: "10.0.0.11", Machine: dummies.CSMachine1.Name}))
+			Ω(ipPool.Status.Free).Should(Equal(1))
+
+			Ω(fakeCtrlClient.Delete(ctx, csMachine)).Should(Succeed())
+			_, err = MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeCtrlClient.Get(ctx, client.ObjectKeyFromObject(ipPool), ipPool)).Should(Succeed())
+			Ω(ipPool.Status.Claims).Should(Equal(
+				[]infrav1.CloudStackIPPoolClaim{{Address: "10.0.0.10", Machine: "other-machine"}}))
+			Ω(ipPool.Status.Free).Should(Equal(2))
+		})
+
+		It("Should release the claimed address of a machine deleted before its VM deployed.", func() {
+			key := client.ObjectKeyFromObject(dummies.CSCluster)
+			dummies.CAPIMachine.Name = "someMachine"
+			dummies.CAPIMachine.Spec.Bootstrap.DataSecretName = &dummies.BootstrapSecret.Name
+			dummies.CSMachine1.OwnerReferences = append(dummies.CSMachine1.OwnerReferences, metav1.OwnerReference{
+				Kind:       "Machine",
+				APIVersion: clusterv1.GroupVersion.String(),
+				Name:       dummies.CAPIMachine.Name,
+				UID:        "uniqueness",
+			})
+			ipPool := &infrav1.CloudStackIPPool{
+				ObjectMeta: metav1.ObjectMeta{Name: "control-plane-ips", Namespace: dummies.ClusterNameSpace},
+				Spec: infrav1.CloudStackIPPoolSpec{
+					Network:   infrav1.CloudStackResourceIdentifier{Name: dummies.Zone1.Network.Name},
+					Addresses: []string{"10.0.0.10-10.0.0.12"},
+				},
+			}
+			dummies.CSMachine1.Spec.IPPoolName = ipPool.Name
+			dummies.CSMachine1.Spec.InstanceID = nil
+			dummies.CSMachine1.Spec.Offering = infrav1.CloudStackResourceIdentifier{Name: "missing-offering"}
+			Ω(fakeCtrlClient.Get(ctx, key, dummies.CSCluster)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CAPIMachine)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSFailureDomain1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.BootstrapSecret)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, ipPool)).Should(Succeed())
+
+			setClusterReady(fakeCtrlClient)
+
+			requestNamespacedName := types.NamespacedName{Namespace: dummies.ClusterNameSpace, Name: dummies.CSMachine1.Name}
+			_, err := MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).Should(HaveOccurred())
+			Ω(fakeCtrlClient.Get(ctx, client.ObjectKeyFromObject(ipPool), ipPool)).Should(Succeed())
+			Ω(ipPool.Status.Claims).Should(HaveLen(1))
+
+			csMachine := &infrav1.CloudStackMachine{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			Ω(csMachine.Spec.InstanceID).Should(BeNil())
+			Ω(fakeCtrlClient.Delete(ctx, csMachine)).Should(Succeed())
+			_, err = MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeCtrlClient.Get(ctx, client.ObjectKeyFromObject(ipPool), ipPool)).Should(Succeed())
+			Ω(ipPool.Status.Claims).Should(BeEmpty())
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).ShouldNot(Succeed())
+		})
+
+		It("Should deploy from the template of its CloudStackTemplate once it's downloaded.", func() {
+			key := client.ObjectKeyFromObject(dummies.CSCluster)
+			dummies.CAPIMachine.Name = "someMachine"
+			dummies.CAPIMachine.Spec.Bootstrap.DataSecretName = &dummies.BootstrapSecret.Name
+			dummies.CSMachine1.OwnerReferences = append(dummies.CSMachine1.OwnerReferences, metav1.OwnerReference{
+				Kind:       "Machine",
+				APIVersion: clusterv1.GroupVersion.String(),
+				Name:       dummies.CAPIMachine.Name,
+				UID:        "uniqueness",
+			})
+			dummies.CSMachine1.Spec.Template = infrav1.CloudStackResourceIdentifier{}
+			dummies.CSMachine1.Spec.TemplateRef = dummies.CSTemplate1.Name
+			templateID := fakeACS.AddTemplate(dummies.CSFailureDomain1.Spec.Zone.ID, dummies.CSTemplate1.Spec.Name)
+			fakeACS.Set(fakeacs.KindTemplate, templateID, "isready", false)
+			dummies.CSTemplate1.Status.FailureDomains = []infrav1.CloudStackTemplateFailureDomainStatus{{
+				FailureDomainName: dummies.CSFailureDomain1.Spec.Name, TemplateID: templateID}}
+			Ω(fakeCtrlClient.Get(ctx, key, dummies.CSCluster)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CAPIMachine)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSFailureDomain1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.BootstrapSecret)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSTemplate1)).Should(Succeed())
+
+			setClusterReady(fakeCtrlClient)
+
+			requestNamespacedName := types.NamespacedName{Namespace: dummies.ClusterNameSpace, Name: dummies.CSMachine1.Name}
+			res, err := MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(res.RequeueAfter).ShouldNot(BeZero())
+			Ω(fakeACS.Calls("deployVirtualMachine")).Should(BeZero())
+
+			fakeACS.Set(fakeacs.KindTemplate, templateID, "isready", true)
+			csTemplate := &infrav1.CloudStackTemplate{}
+			Ω(fakeCtrlClient.Get(ctx, client.ObjectKeyFromObject(dummies.CSTemplate1), csTemplate)).Should(Succeed())
+			csTemplate.Status.FailureDomains[0].Ready = true
+			Ω(fakeCtrlClient.Status().Update(ctx, csTemplate)).Should(Succeed())
+			_, err = MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			csMachine := &infrav1.CloudStackMachine{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			Ω(csMachine.Status.TemplateID).Should(Equal(templateID))
+			vm, found := fakeACS.Get(fakeacs.KindVirtualMachine, *csMachine.Spec.InstanceID)
+			Ω(found).Should(BeTrue())
+			Ω(vm["templateid"]).Should(Equal(templateID))
+		})
+
+		It("Should deploy Ignition bootstrap data uncompressed, with the machine's hostname and metadata drop-in.", func() {
+			key := client.ObjectKeyFromObject(dummies.CSCluster)
+			dummies.CAPIMachine.Name = "someMachine"
+			dummies.CAPIMachine.Spec.Bootstrap.DataSecretName = &dummies.BootstrapSecret.Name
+			dummies.CSMachine1.OwnerReferences = append(dummies.CSMachine1.OwnerReferences, metav1.OwnerReference{
+				Kind:       "Machine",
+				APIVersion: clusterv1.GroupVersion.String(),
+				Name:       dummies.CAPIMachine.Name,
+				UID:        "uniqueness",
+			})
+			dummies.BootstrapSecret.Data = map[string][]byte{
+				"format": []byte("ignition"),
+				"value": []byte(`{"ignition":{"version":"2.3.0"},"systemd":{"units":[` +
+					`{"name":"kubeadm.service","enabled":true,"contents":"[Service]\nExecStart=/etc/kubeadm.sh\n"}]}}`),
+			}
+			Ω(fakeCtrlClient.Get(ctx, key, dummies.CSCluster)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CAPIMachine)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSFailureDomain1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.BootstrapSecret)).Should(Succeed())
+
+			setClusterReady(fakeCtrlClient)
+
+			requestNamespacedName := types.NamespacedName{Namespace: dummies.ClusterNameSpace, Name: dummies.CSMachine1.Name}
+			_, err := MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			csMachine := &infrav1.CloudStackMachine{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			vm, found := fakeACS.Get(fakeacs.KindVirtualMachine, *csMachine.Spec.InstanceID)
+			Ω(found).Should(BeTrue())
+			userData, err := base64.StdEncoding.DecodeString(vm["userdata"].(string))
+			Ω(err).ShouldNot(HaveOccurred())
+			config := struct {
+				Storage struct {
+					Files []struct {
+						Path     string
+						Contents struct{ Source string }
+					}
+				}
+				Systemd struct {
+					Units []struct {
+						Name    string
+						Enabled bool
+						Dropins []struct{ Name, Contents string }
+					}
+				}
+			}{}
+			Ω(json.Unmarshal(userData, &config)).Should(Succeed())
+			Ω(config.Storage.Files).Should(HaveLen(1))
+			Ω(config.Storage.Files[0].Path).Should(Equal("/etc/hostname"))
+			Ω(config.Storage.Files[0].Contents.Source).Should(Equal("data:," + dummies.CAPIMachine.Name))
+			Ω(config.Systemd.Units).Should(HaveLen(1))
+			Ω(config.Systemd.Units[0].Enabled).Should(BeTrue())
+			Ω(config.Systemd.Units[0].Dropins).Should(HaveLen(1))
+			Ω(config.Systemd.Units[0].Dropins[0].Name).Should(Equal(utils.IgnitionKubeadmDropIn))
+			Ω(config.Systemd.Units[0].Dropins[0].Contents).Should(And(
+				ContainSubstring("${COREOS_CLOUDSTACK_INSTANCE_ID}"),
+				ContainSubstring("/"+dummies.CAPIMachine.Name+"/"),
+				ContainSubstring("/"+dummies.CSFailureDomain1.Spec.Name+"/")))
+		})
+
+		It("Should requeue while the deploy job is still running.", func() {
+			key := client.ObjectKeyFromObject(dummies.CSCluster)
+			dummies.CAPIMachine.Name = "someMachine"
+			dummies.CAPIMachine.Spec.Bootstrap.DataSecretName = &dummies.BootstrapSecret.Name
+			dummies.CSMachine1.OwnerReferences = append(dummies.CSMachine1.OwnerReferences, metav1.OwnerReference{
+				Kind:       "Machine",
+				APIVersion: clusterv1.GroupVersion.String(),
+				Name:       dummies.CAPIMachine.Name,
+				UID:        "uniqueness",
+			})
+			Ω(fakeCtrlClient.Get(ctx, key, dummies.CSCluster)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CAPIMachine)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSFailureDomain1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.BootstrapSecret)).Should(Succeed())
+
+			setClusterReady(fakeCtrlClient)
+
+			fakeACS.SetJobPolls(1)
+			requestNamespacedName := types.NamespacedName{Namespace: dummies.ClusterNameSpace, Name: dummies.CSMachine1.Name}
+			res, err := MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(res.RequeueAfter).ShouldNot(BeZero())
+
+			csMachine := &infrav1.CloudStackMachine{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			Ω(csMachine.Status.AsyncJobID).ShouldNot(BeEmpty())
+			Ω(csMachine.Spec.InstanceID).ShouldNot(BeNil())
+			Ω(csMachine.Finalizers).Should(ContainElement(infrav1.MachineFinalizer))
+			Ω(csMachine.Status.Ready).Should(BeFalse())
+
+			fakeACS.CompleteJobs()
+			_, err = MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			Ω(csMachine.Status.AsyncJobID).Should(BeEmpty())
+			Ω(csMachine.Status.Ready).Should(BeTrue())
+		})
+
+		It("Should requeue deletion while the destroy job is still running.", func() {
+			key := client.ObjectKeyFromObject(dummies.CSCluster)
+			dummies.CAPIMachine.Name = "someMachine"
+			dummies.CAPIMachine.Spec.Bootstrap.DataSecretName = &dummies.BootstrapSecret.Name
+			dummies.CSMachine1.OwnerReferences = append(dummies.CSMachine1.OwnerReferences, metav1.OwnerReference{
+				Kind:       "Machine",
+				APIVersion: clusterv1.GroupVersion.String(),
+				Name:       dummies.CAPIMachine.Name,
+				UID:        "uniqueness",
+			})
+			Ω(fakeCtrlClient.Get(ctx, key, dummies.CSCluster)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CAPIMachine)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSFailureDomain1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.BootstrapSecret)).Should(Succeed())
+
+			setClusterReady(fakeCtrlClient)
+
+			requestNamespacedName := types.NamespacedName{Namespace: dummies.ClusterNameSpace, Name: dummies.CSMachine1.Name}
+			_, err := MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			csMachine := &infrav1.CloudStackMachine{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachine)).Should(Succeed())
+			Ω(fakeCtrlClient.Delete(ctx, csMachine)).Should(Succeed())
+
+			fakeACS.SetJobPolls(1)
+			res, err := MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(res.RequeueAfter).ShouldNot(BeZero())
+			Ω(fakeACS.Count(fakeacs.KindVirtualMachine)).Should(Equal(1))
+
+			fakeACS.CompleteJobs()
+			res, err = MachineReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(res.RequeueAfter).Should(BeZero())
+			Ω(fakeACS.Count(fakeacs.KindVirtualMachine)).Should(BeZero())
+		})
+	})
 })
@@ -0,0 +1,149 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/controllers/utils"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/webhookutil"
+)
+
+// rootDiskSizeCheckTimeout bounds the time CloudStack is given to resolve the template of a machine on admission, well
+// within the timeout of the webhook.
+const rootDiskSizeCheckTimeout = 5 * time.Second
+
+var cloudstackmachinewebhooklog = ctrl.Log.WithName("cloudstackmachine-webhook")
+
+// CloudStackMachineValidator validates CloudStackMachines as their own webhook does, and also rejects machines whose
+// rootDiskSize is smaller than the size of their template, which takes asking CloudStack.
+type CloudStackMachineValidator struct {
+	Client client.Client
+}
+
+// SetupWebhookWithManager registers the validator in place of the validating webhook of the CloudStackMachine type.
+func (v *CloudStackMachineValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&infrav1.CloudStackMachine{}).
+		WithValidator(v).
+		Complete()
+}
+
+var _ webhook.CustomValidator = &CloudStackMachineValidator{}
+
+// ValidateCreate implements webhook.CustomValidator.
+func (v *CloudStackMachineValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	csMachine, ok := obj.(*infrav1.CloudStackMachine)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a CloudStackMachine but got a %T", obj))
+	}
+	if err := csMachine.ValidateCreate(); err != nil {
+		return err
+	}
+	return v.validateRootDiskSize(ctx, csMachine)
+}
+
+// ValidateUpdate implements webhook.CustomValidator. The rootDiskSize of a machine can't be updated, so it isn't
+// checked again.
+func (v *CloudStackMachineValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) error {
+	csMachine, ok := newObj.(*infrav1.CloudStackMachine)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a CloudStackMachine but got a %T", newObj))
+	}
+	return csMachine.ValidateUpdate(oldObj)
+}
+
+// ValidateDelete implements webhook.CustomValidator.
+func (v *CloudStackMachineValidator) ValidateDelete(_ context.Context, obj runtime.Object) error {
+	csMachine, ok := obj.(*infrav1.CloudStackMachine)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a CloudStackMachine but got a %T", obj))
+	}
+	return csMachine.ValidateDelete()
+}
+
+// validateRootDiskSize rejects a rootDiskSize smaller than the size of the machine's template in any of the failure
+// domains of its cluster it may be deployed to. The size is left to the machine's controller, which reports it with
+// the InstanceDeployed condition, when the template is a CloudStackTemplate that may not be registered yet, or when the
+// cluster or CloudStack can't tell the template's size.
+func (v *CloudStackMachineValidator) validateRootDiskSize(ctx context.Context, csMachine *infrav1.CloudStackMachine) error {
+	if csMachine.Spec.RootDiskSize <= 0 || csMachine.Spec.TemplateRef != "" {
+		return nil
+	}
+	log := cloudstackmachinewebhooklog.WithValues("name", csMachine.Name, "namespace", csMachine.Namespace)
+
+	name := csMachine.GetLabels()[clusterv1.ClusterLabelName]
+	if name == "" {
+		log.V(1).Info("Machine is missing cluster label, skipping root disk size check.")
+		return nil
+	}
+	csCluster := &infrav1.CloudStackCluster{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Namespace: csMachine.Namespace, Name: name}, csCluster); err != nil {
+		log.V(1).Info("Skipping root disk size check.", "reason", errors.Wrapf(err, "getting CloudStackCluster %s", name).Error())
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rootDiskSizeCheckTimeout)
+	defer cancel()
+	for i := range csCluster.Spec.FailureDomains {
+		fdSpec := &csCluster.Spec.FailureDomains[i]
+		if csMachine.Spec.FailureDomainName != "" && fdSpec.Name != csMachine.Spec.FailureDomainName {
+			continue
+		}
+		if err := v.checkRootDiskSize(ctx, csCluster, csMachine, fdSpec); errors.Is(err, cloud.ErrRootDiskTooSmall) {
+			errorList := field.ErrorList{field.Invalid(field.NewPath("spec", "rootDiskSize"), csMachine.Spec.RootDiskSize,
+				fmt.Sprintf("%s in failure domain %s", err.Error(), fdSpec.Name))}
+			return webhookutil.AggregateObjErrors(csMachine.GroupVersionKind().GroupKind(), csMachine.Name, errorList)
+		} else if err != nil {
+			log.V(1).Info("Skipping root disk size check in failure domain.", "failureDomain", fdSpec.Name,
+				"reason", err.Error())
+		}
+	}
+	return nil
+}
+
+// checkRootDiskSize checks the rootDiskSize of a machine against its template in the zone of a failure domain, as the
+// failure domain's user.
+func (v *CloudStackMachineValidator) checkRootDiskSize(
+	ctx context.Context,
+	csCluster *infrav1.CloudStackCluster,
+	csMachine *infrav1.CloudStackMachine,
+	fdSpec *infrav1.CloudStackFailureDomainSpec,
+) error {
+	_, csUser, err := utils.FailureDomainClients(ctx, v.Client, fdSpec)
+	if err != nil {
+		return err
+	}
+	zone := fdSpec.Zone
+	if err := csUser.ResolveZone(ctx, &zone); err != nil {
+		return errors.Wrap(err, "resolving CloudStack zone information")
+	}
+	return csUser.CheckRootDiskSize(ctx, csCluster, csMachine, zone.ID)
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/errors"
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	csReconcilers "sigs.k8s.io/cluster-api-provider-cloudstack/controllers"
+	dummies "sigs.k8s.io/cluster-api-provider-cloudstack/test/dummies/v1beta2"
+)
+
+var _ = Describe("CloudStackMachineValidator", func() {
+	var validator *csReconcilers.CloudStackMachineValidator
+
+	Context("With a fake ctrlRuntimeClient and a fake ACS API server.", func() {
+		BeforeEach(func() {
+			setupFakeACSTestClient()
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			validator = &csReconcilers.CloudStackMachineValidator{Client: fakeCtrlClient}
+			dummies.CSMachine1.Spec.FailureDomainName = dummies.CSFailureDomain1.Spec.Name
+		})
+
+		It("Should reject a root disk size smaller than the template's size.", func() {
+			dummies.CSMachine1.Spec.RootDiskSize = 4
+
+			err := validator.ValidateCreate(ctx, dummies.CSMachine1)
+			Ω(errors.IsInvalid(err)).Should(BeTrue())
+			Ω(err).Should(MatchError(ContainSubstring("rootDiskSize 4 GB is smaller than the 8 GB")))
+		})
+
+		It("Should admit a root disk size at least the template's size.", func() {
+			dummies.CSMachine1.Spec.RootDiskSize = 8
+
+			Ω(validator.ValidateCreate(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(fakeACS.Calls("listTemplates")).ShouldNot(BeZero())
+		})
+
+		It("Should check the failure domains it can reach when the machine isn't given one.", func() {
+			dummies.CSMachine1.Spec.FailureDomainName = "" // The endpoint secret of the second one doesn't exist.
+			dummies.CSMachine1.Spec.RootDiskSize = 4
+
+			Ω(errors.IsInvalid(validator.ValidateCreate(ctx, dummies.CSMachine1))).Should(BeTrue())
+		})
+
+		It("Should leave the root disk size to the controller when the template can't be resolved.", func() {
+			dummies.CSMachine1.Spec.RootDiskSize = 4
+			dummies.CSMachine1.Spec.Template = infrav1.CloudStackResourceIdentifier{Name: "unregistered"}
+
+			Ω(validator.ValidateCreate(ctx, dummies.CSMachine1)).Should(Succeed())
+		})
+
+		It("Should apply the validations of the machine's own webhook.", func() {
+			dummies.CSMachine1.Spec.Offering = infrav1.CloudStackResourceIdentifier{}
+
+			Ω(errors.IsInvalid(validator.ValidateCreate(ctx, dummies.CSMachine1))).Should(BeTrue())
+			Ω(fakeACS.Calls("listTemplates")).Should(BeZero())
+		})
+	})
+})
@@ -0,0 +1,409 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	exputil "sigs.k8s.io/cluster-api/exp/util"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/controllers/utils"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
+)
+
+const (
+	CSMachinePoolInstanceAdded    = "Adding instance %s in failure domain %s"
+	CSMachinePoolInstanceRemoved  = "Removing instance %s from failure domain %s"
+	CSMachinePoolInstanceReplaced = "Replacing instance %s in error state"
+)
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstackmachinepools,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstackmachinepools/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstackmachinepools/finalizers,verbs=update
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machinepools;machinepools/status,verbs=get;list;watch
+
+// CloudStackMachinePoolReconciliationRunner is a ReconciliationRunner with extensions specific to CloudStack machine
+// pool reconciliation.
+type CloudStackMachinePoolReconciliationRunner struct {
+	*utils.ReconciliationRunner
+	ReconciliationSubject *infrav1.CloudStackMachinePool
+	MachinePool           *expv1.MachinePool
+	BootstrapSecret       *corev1.Secret
+}
+
+// CloudStackMachinePoolReconciler reconciles a CloudStackMachinePool object
+type CloudStackMachinePoolReconciler struct {
+	utils.ReconcilerBase
+}
+
+// Initialize a new CloudStackMachinePool reconciliation runner with concrete types and initialized member fields.
+func NewCSMachinePoolReconciliationRunner() *CloudStackMachinePoolReconciliationRunner {
+	// Set concrete type and init pointers.
+	r := &CloudStackMachinePoolReconciliationRunner{ReconciliationSubject: &infrav1.CloudStackMachinePool{}}
+	r.MachinePool = &expv1.MachinePool{}
+	// Setup the base runner. Initializes pointers and links reconciliation methods.
+	r.ReconciliationRunner = utils.NewRunner(r, r.ReconciliationSubject, "CloudStackMachinePool")
+	return r
+}
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+func (reconciler *CloudStackMachinePoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	r := NewCSMachinePoolReconciliationRunner()
+	r.UsingBaseReconciler(reconciler.ReconcilerBase).ForRequest(req).WithRequestCtx(ctx)
+	return r.RunBaseReconciliationStages()
+}
+
+func (r *CloudStackMachinePoolReconciliationRunner) Reconcile() (ctrl.Result, error) {
+	return r.RunReconciliationStages(
+		r.GetParent(r.ReconciliationSubject, r.MachinePool),
+		r.RequeueIfCloudStackClusterNotReady,
+		r.ScaleInstances,
+		r.ReconcileInstances,
+		r.SetReplicaStatus,
+	)
+}
+
+// ScaleInstances adds instances to the pool, or picks instances for removal, until it has as many as its MachinePool
+// has replicas. Instances in error state are replaced. The pool is requeued after adding instances, to deploy them.
+func (r *CloudStackMachinePoolReconciliationRunner) ScaleInstances() (ctrl.Result, error) {
+	controllerutil.AddFinalizer(r.ReconciliationSubject, infrav1.MachinePoolFinalizer)
+
+	instances := r.ReconciliationSubject.Status.Instances
+	active := 0
+	for i := range instances {
+		if !instances[i].Deleting && instances[i].InstanceState == "Error" {
+			r.Recorder.Eventf(r.ReconciliationSubject, "Warning", "Error", CSMachinePoolInstanceReplaced, instances[i].Name)
+			instances[i].Deleting = true
+		}
+		if !instances[i].Deleting {
+			active++
+		}
+	}
+
+	replicas := 1
+	if r.MachinePool.Spec.Replicas != nil {
+		replicas = int(*r.MachinePool.Spec.Replicas)
+	}
+	for ; active > replicas; active-- {
+		instance := r.nextInstanceToRemove()
+		r.Recorder.Eventf(r.ReconciliationSubject, "Normal", "Scaling", CSMachinePoolInstanceRemoved,
+			instance.Name, instance.FailureDomainName)
+		instance.Deleting = true
+	}
+	added := active < replicas
+	for ; active < replicas; active++ {
+		fdName, err := r.nextFailureDomain()
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		name := fmt.Sprintf("%s-%s", r.ReconciliationSubject.Name, utilrand.String(5))
+		r.Recorder.Eventf(r.ReconciliationSubject, "Normal", "Scaling", CSMachinePoolInstanceAdded, name, fdName)
+		r.ReconciliationSubject.Status.Instances = append(r.ReconciliationSubject.Status.Instances,
+			infrav1.CloudStackMachinePoolInstance{Name: name, FailureDomainName: fdName})
+	}
+	if added {
+		// The names are random, so the instances are only deployed once recorded. Otherwise an instance deployed by a
+		// reconciliation whose status update fails would be orphaned, as its name would be lost.
+		return r.RequeueWithMessage("Instances added to the pool, deploying them once recorded.")
+	}
+	return ctrl.Result{}, nil
+}
+
+// failureDomainNames returns the names of the failure domains the instances of the pool are spread across: those of
+// its MachinePool, or else all those of the cluster.
+func (r *CloudStackMachinePoolReconciliationRunner) failureDomainNames() []string {
+	if len(r.MachinePool.Spec.FailureDomains) > 0 {
+		return r.MachinePool.Spec.FailureDomains
+	}
+	names := make([]string, 0, len(r.CSCluster.Spec.FailureDomains))
+	for _, fd := range r.CSCluster.Spec.FailureDomains {
+		names = append(names, fd.Name)
+	}
+	return names
+}
+
+// activeInstancesPerFailureDomain counts the instances of the pool not picked for removal in each failure domain.
+func (r *CloudStackMachinePoolReconciliationRunner) activeInstancesPerFailureDomain() map[string]int {
+	counts := map[string]int{}
+	for _, instance := range r.ReconciliationSubject.Status.Instances {
+		if !instance.Deleting {
+			counts[instance.FailureDomainName]++
+		}
+	}
+	return counts
+}
+
+// nextFailureDomain returns the failure domain the next instance of the pool goes to, which is the one with the fewest
+// instances.
+func (r *CloudStackMachinePoolReconciliationRunner) nextFailureDomain() (string, error) {
+	names := r.failureDomainNames()
+	if len(names) == 0 {
+		return "", errors.New("no failure domain to deploy the instances of the pool in")
+	}
+	counts := r.activeInstancesPerFailureDomain()
+	next := names[0]
+	for _, name := range names[1:] {
+		if counts[name] < counts[next] {
+			next = name
+		}
+	}
+	return next, nil
+}
+
+// nextInstanceToRemove returns the instance of the pool removed next on scale down. Instances that aren't running go
+// first, then those of the failure domain with the most instances, newest first.
+func (r *CloudStackMachinePoolReconciliationRunner) nextInstanceToRemove() *infrav1.CloudStackMachinePoolInstance {
+	counts := r.activeInstancesPerFailureDomain()
+	var next *infrav1.CloudStackMachinePoolInstance
+	for i := len(r.ReconciliationSubject.Status.Instances) - 1; i >= 0; i-- {
+		instance := &r.ReconciliationSubject.Status.Instances[i]
+		switch {
+		case instance.Deleting:
+			continue
+		case next == nil:
+			next = instance
+		case (instance.InstanceState != "Running") != (next.InstanceState != "Running"):
+			if instance.InstanceState != "Running" {
+				next = instance
+			}
+		case counts[instance.FailureDomainName] > counts[next.FailureDomainName]:
+			next = instance
+		}
+	}
+	return next
+}
+
+// ReconcileInstances deploys the instances of the pool and destroys those picked for removal, as the user of their
+// failure domain. Deployments and destructions run concurrently, and the pool is requeued until they all complete.
+func (r *CloudStackMachinePoolReconciliationRunner) ReconcileInstances() (ctrl.Result, error) {
+	instances := r.ReconciliationSubject.Status.Instances
+	remaining := make([]infrav1.CloudStackMachinePoolInstance, 0, len(instances))
+	pending := false
+	var err error
+	for i := range instances {
+		instance := instances[i]
+		if err == nil { // Keep the instances left once one fails as they are.
+			var removed, instancePending bool
+			removed, instancePending, err = r.reconcileInstance(&instance)
+			pending = pending || instancePending
+			if removed {
+				continue
+			}
+		}
+		remaining = append(remaining, instance)
+	}
+	r.ReconciliationSubject.Status.Instances = remaining
+	if err != nil {
+		return ctrl.Result{}, err
+	} else if pending {
+		return r.RequeueWithMessage("Instances being deployed or destroyed.")
+	}
+	return ctrl.Result{}, nil
+}
+
+// reconcileInstance deploys or destroys an instance of the pool. It reports whether the instance was removed, and
+// whether it's waiting for CloudStack.
+func (r *CloudStackMachinePoolReconciliationRunner) reconcileInstance(
+	instance *infrav1.CloudStackMachinePoolInstance,
+) (removed bool, pending bool, err error) {
+	fd := &infrav1.CloudStackFailureDomain{}
+	if _, err := r.GetFailureDomainByName(func() string { return instance.FailureDomainName }, fd)(); err != nil {
+		return false, false, err
+	}
+	if _, err := r.AsFailureDomainUser(&fd.Spec)(); err != nil {
+		return false, false, err
+	}
+	if res, err := r.RequeueIfEndpointUnavailable(fd)(); r.ShouldReturn(res, err) {
+		return false, err == nil, err
+	}
+
+	csMachine := r.instanceMachine(instance)
+	if instance.Deleting {
+		removed, pending, err = r.destroyInstance(csMachine)
+	} else {
+		pending, err = r.deployInstance(csMachine, fd)
+	}
+	instance.InstanceID = pointer.StringDeref(csMachine.Spec.InstanceID, "")
+	instance.ProviderID = pointer.StringDeref(csMachine.Spec.ProviderID, "")
+	instance.InstanceState = csMachine.Status.InstanceState
+	instance.Ready = instance.Ready || csMachine.Status.InstanceState == "Running"
+	instance.AsyncJobID = csMachine.Status.AsyncJobID
+	instance.AsyncJobKind = csMachine.Status.AsyncJobKind
+	instance.UserDataID = csMachine.Status.UserDataID
+	instance.TemplateID = csMachine.Status.TemplateID
+	instance.AppliedTags = csMachine.Status.AppliedTags
+	return removed, pending, err
+}
+
+// instanceMachine returns a CloudStackMachine of the pool's template standing for the instance, so the instance is
+// deployed and destroyed like the instances of machines are.
+func (r *CloudStackMachinePoolReconciliationRunner) instanceMachine(
+	instance *infrav1.CloudStackMachinePoolInstance,
+) *infrav1.CloudStackMachine {
+	csMachine := &infrav1.CloudStackMachine{
+		// The pool's UID keeps the names the user data of its instances is registered under unique.
+		ObjectMeta: metav1.ObjectMeta{
+			Name: instance.Name, Namespace: r.ReconciliationSubject.Namespace, UID: r.ReconciliationSubject.UID},
+		Spec: *r.ReconciliationSubject.Spec.Template.Spec.DeepCopy(),
+	}
+	csMachine.Spec.FailureDomainName = instance.FailureDomainName
+	if instance.InstanceID != "" {
+		csMachine.Spec.InstanceID = pointer.String(instance.InstanceID)
+	}
+	csMachine.Status.InstanceState = instance.InstanceState
+	csMachine.Status.Ready = instance.Ready
+	csMachine.Status.AsyncJobID = instance.AsyncJobID
+	csMachine.Status.AsyncJobKind = instance.AsyncJobKind
+	csMachine.Status.UserDataID = instance.UserDataID
+	csMachine.Status.TemplateID = instance.TemplateID
+	csMachine.Status.AppliedTags = instance.AppliedTags
+	return csMachine
+}
+
+// deployInstance deploys the instance of a machine of the pool and attaches its data disks. It reports whether the
+// instance isn't running yet.
+func (r *CloudStackMachinePoolReconciliationRunner) deployInstance(
+	csMachine *infrav1.CloudStackMachine,
+	fd *infrav1.CloudStackFailureDomain,
+) (bool, error) {
+	var userData string
+	if csMachine.Spec.InstanceID == nil { // Only fetch the bootstrap data of instances yet to be deployed.
+		if r.MachinePool.Spec.Template.Spec.Bootstrap.DataSecretName == nil {
+			r.Recorder.Event(r.ReconciliationSubject, "Normal", "Creating", BootstrapDataNotReady)
+			return true, nil
+		}
+		if r.BootstrapSecret == nil {
+			secret := &corev1.Secret{}
+			key := client.ObjectKey{Namespace: r.MachinePool.Namespace, Name: *r.MachinePool.Spec.Template.Spec.Bootstrap.DataSecretName}
+			if err := r.K8sClient.Get(r.RequestCtx, key, secret); err != nil {
+				return false, err
+			}
+			r.BootstrapSecret = secret
+		}
+		var err error
+		if userData, err = bootstrapUserData(r.BootstrapSecret, csMachine.Name, fd.Spec.Name); err != nil {
+			return false, err
+		}
+		if res, err := r.ResolveTemplateRef(csMachine, fd)(); r.ShouldReturn(res, err) {
+			return err == nil, err
+		}
+	}
+
+	// The instances have no Machine, and are named after themselves.
+	capiMachine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: csMachine.Name, Namespace: csMachine.Namespace}}
+	err := r.CSUser.GetOrCreateVMInstance(
+		r.RequestCtx, csMachine, capiMachine, r.CSCluster, fd, &infrav1.CloudStackAffinityGroup{}, userData)
+	if err == nil {
+		err = r.CSUser.ReconcileDataDisks(r.RequestCtx, csMachine, fd)
+	}
+	if errors.Is(err, cloud.ErrAsyncJobPending) {
+		return true, nil
+	} else if err != nil {
+		r.Recorder.Eventf(r.ReconciliationSubject, "Warning", "Creating", CSMachineCreationFailed, err.Error())
+		return false, err
+	}
+	if err := r.CSUser.ReconcileVMInstanceTags(r.RequestCtx, csMachine, r.CSCluster); err != nil {
+		return false, err
+	}
+	return csMachine.Status.InstanceState != "Running", nil
+}
+
+// destroyInstance destroys the instance of a machine of the pool along with its registered user data. It reports
+// whether the instance is gone, and whether its destruction is still in progress.
+func (r *CloudStackMachinePoolReconciliationRunner) destroyInstance(csMachine *infrav1.CloudStackMachine) (bool, bool, error) {
+	if csMachine.Spec.InstanceID == nil {
+		// The deployment of the instance may have been submitted without its ID being recorded.
+		if err := r.CSClient.ResolveVMInstanceDetails(r.RequestCtx, csMachine); err != nil && !cloud.IsNotFound(err) {
+			return false, false, err
+		}
+	}
+	if csMachine.Spec.InstanceID != nil {
+		// Use CSClient instead of CSUser here to expunge as admin.
+		if err := r.CSClient.DestroyVMInstance(r.RequestCtx, csMachine); err != nil {
+			if err.Error() == "VM deletion in progress" {
+				return false, true, nil
+			}
+			return false, false, err
+		}
+	}
+	if err := r.CSUser.DeleteVMInstanceUserData(r.RequestCtx, csMachine); err != nil {
+		return false, false, err
+	}
+	return true, false, nil
+}
+
+// SetReplicaStatus sets the provider IDs and number of the running instances of the pool, which is ready once it runs
+// as many of them as its MachinePool has replicas.
+func (r *CloudStackMachinePoolReconciliationRunner) SetReplicaStatus() (ctrl.Result, error) {
+	providerIDs := []string{}
+	for _, instance := range r.ReconciliationSubject.Status.Instances {
+		if !instance.Deleting && instance.Ready && instance.ProviderID != "" {
+			providerIDs = append(providerIDs, instance.ProviderID)
+		}
+	}
+	r.ReconciliationSubject.Spec.ProviderIDList = providerIDs
+	r.ReconciliationSubject.Status.Replicas = int32(len(providerIDs))
+	r.ReconciliationSubject.Status.Ready = len(providerIDs) == len(r.ReconciliationSubject.Status.Instances)
+	return ctrl.Result{}, nil
+}
+
+func (r *CloudStackMachinePoolReconciliationRunner) ReconcileDelete() (ctrl.Result, error) {
+	for i := range r.ReconciliationSubject.Status.Instances {
+		r.ReconciliationSubject.Status.Instances[i].Deleting = true
+	}
+	if res, err := r.ReconcileInstances(); r.ShouldReturn(res, err) {
+		return res, err
+	}
+	controllerutil.RemoveFinalizer(r.ReconciliationSubject, infrav1.MachinePoolFinalizer)
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager registers the machine pool reconciler to the CAPI controller manager. Pools are reconciled when
+// their MachinePool changes, to scale them or deploy once bootstrap data is set, and when the additional tags of
+// their cluster change.
+func (reconciler *CloudStackMachinePoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	reconciler.Recorder = mgr.GetEventRecorderFor("capc-machinepool-controller")
+	machinePoolMapper := exputil.MachinePoolToInfrastructureMapFunc(
+		infrav1.GroupVersion.WithKind("CloudStackMachinePool"), reconciler.BaseLogger)
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.CloudStackMachinePool{}).
+		Watches(
+			&source.Kind{Type: &expv1.MachinePool{}},
+			handler.EnqueueRequestsFromMapFunc(machinePoolMapper)).
+		Watches(
+			&source.Kind{Type: &infrav1.CloudStackCluster{}},
+			handler.EnqueueRequestsFromMapFunc(
+				utils.CloudStackClusterToObjectsMapper(reconciler.K8sClient, &infrav1.CloudStackMachinePoolList{})),
+			builder.WithPredicates(utils.AdditionalTagsChanged)).
+		Complete(reconciler)
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	dummies "sigs.k8s.io/cluster-api-provider-cloudstack/test/dummies/v1beta2"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/test/fakeacs"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("CloudStackMachinePoolReconciler", func() {
+	Context("With a fake ctrlRuntimeClient and a fake ACS API server.", func() {
+		var requestNamespacedName types.NamespacedName
+
+		BeforeEach(func() {
+			setupFakeACSTestClient()
+
+			// A second failure domain in the same zone to spread the instances across.
+			fd2 := dummies.CSFailureDomain1.DeepCopy()
+			fd2.Name = dummies.CSFailureDomain2.Name
+			fd2.Spec.Name = dummies.CSFailureDomain2.Spec.Name
+			dummies.CSCluster.Spec.FailureDomains = []infrav1.CloudStackFailureDomainSpec{
+				dummies.CSFailureDomain1.Spec, fd2.Spec}
+
+			dummies.CAPIMachinePool.Spec.Replicas = pointer.Int32(3)
+			dummies.CAPIMachinePool.Spec.Template.Spec.Bootstrap.DataSecretName = &dummies.BootstrapSecret.Name
+			dummies.CSMachinePool1.OwnerReferences = append(dummies.CSMachinePool1.OwnerReferences, metav1.OwnerReference{
+				Kind:       "MachinePool",
+				APIVersion: expv1.GroupVersion.String(),
+				Name:       dummies.CAPIMachinePool.Name,
+				UID:        "uniqueness",
+			})
+			Ω(fakeCtrlClient.Get(ctx, client.ObjectKeyFromObject(dummies.CSCluster), dummies.CSCluster)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CAPIMachinePool)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSMachinePool1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSFailureDomain1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, fd2)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.BootstrapSecret)).Should(Succeed())
+
+			setClusterReady(fakeCtrlClient)
+			requestNamespacedName = client.ObjectKeyFromObject(dummies.CSMachinePool1)
+		})
+
+		// scaleTo sets the replicas of the MachinePool and reconciles the pool.
+		scaleTo := func(replicas int32) *infrav1.CloudStackMachinePool {
+			machinePool := &expv1.MachinePool{}
+			Ω(fakeCtrlClient.Get(ctx, client.ObjectKeyFromObject(dummies.CAPIMachinePool), machinePool)).Should(Succeed())
+			machinePool.Spec.Replicas = pointer.Int32(replicas)
+			Ω(fakeCtrlClient.Update(ctx, machinePool)).Should(Succeed())
+
+			// Instances added by the first reconciliation are deployed by the second.
+			for i := 0; i < 2; i++ {
+				_, err := MachinePoolReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			csMachinePool := &infrav1.CloudStackMachinePool{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachinePool)).Should(Succeed())
+			return csMachinePool
+		}
+
+		It("Should deploy the replicas across the failure domains and destroy them when the pool is deleted.", func() {
+			res, err := MachinePoolReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(res.RequeueAfter).ShouldNot(BeZero())
+			csMachinePool := &infrav1.CloudStackMachinePool{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachinePool)).Should(Succeed())
+			Ω(csMachinePool.Status.Instances).Should(HaveLen(3))
+			Ω(fakeACS.Count(fakeacs.KindVirtualMachine)).Should(BeZero())
+
+			res, err = MachinePoolReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(res.RequeueAfter).Should(BeZero())
+
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csMachinePool)).Should(Succeed())
+			Ω(csMachinePool.Finalizers).Should(ContainElement(infrav1.MachinePoolFinalizer))
+			Ω(csMachinePool.Status.Ready).Should(BeTrue())
+			Ω(csMachinePool.Status.Replicas).Should(BeEquivalentTo(3))
+			Ω(csMachinePool.Spec.ProviderIDList).Should(HaveLen(3))
+			Ω(fakeACS.Count(fakeacs.KindVirtualMachine)).Should(Equal(3))
+
+			perFailureDomain := map[string]int{}
+			for _, instance := range csMachinePool.Status.Instances {
+				perFailureDomain[instance.FailureDomainName]++
+				Ω(csMachinePool.Spec.ProviderIDList).Should(ContainElement("cloudstack:///" + instance.InstanceID))
+				vm, found := fakeACS.Get(fakeacs.KindVirtualMachine, instance.InstanceID)
+				Ω(found).Should(BeTrue())
+				Ω(vm["name"]).Should(Equal(instance.Name))
+				Ω(vm["state"]).Should(Equal("Running"))
+			}
+			Ω(perFailureDomain).Should(Equal(map[string]int{
+				dummies.CSFailureDomain1.Spec.Name: 2, dummies.CSFailureDomain2.Spec.Name: 1}))
+
+			Ω(fakeCtrlClient.Delete(ctx, csMachinePool)).Should(Succeed())
+			res, err = MachinePoolReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(res.RequeueAfter).Should(BeZero())
+			Ω(fakeACS.Count(fakeacs.KindVirtualMachine)).Should(BeZero())
+		})
+
+		It("Should remove the instances that aren't running first on scale down.", func() {
+			csMachinePool := scaleTo(3)
+			stopped := csMachinePool.Status.Instances[2]
+			Ω(fakeACS.Set(fakeacs.KindVirtualMachine, stopped.InstanceID, "state", "Stopped")).Should(BeTrue())
+			csMachinePool = scaleTo(3) // Observe the stopped instance.
+			Ω(csMachinePool.Status.Instances[2].InstanceState).Should(Equal("Stopped"))
+
+			csMachinePool = scaleTo(2)
+			Ω(csMachinePool.Status.Instances).Should(HaveLen(2))
+			Ω(csMachinePool.Status.Instances).ShouldNot(ContainElement(HaveField("Name", stopped.Name)))
+			Ω(csMachinePool.Status.Ready).Should(BeTrue())
+			_, found := fakeACS.Get(fakeacs.KindVirtualMachine, stopped.InstanceID)
+			Ω(found).Should(BeFalse())
+		})
+
+		It("Should keep the instances spread across the failure domains on scale down, removing the newest first.", func() {
+			csMachinePool := scaleTo(3)
+			oldest := csMachinePool.Status.Instances[0]
+			second := csMachinePool.Status.Instances[1]
+			Ω(oldest.FailureDomainName).ShouldNot(Equal(second.FailureDomainName))
+
+			csMachinePool = scaleTo(2)
+			Ω(csMachinePool.Status.Instances).Should(Equal([]infrav1.CloudStackMachinePoolInstance{oldest, second}))
+			Ω(csMachinePool.Spec.ProviderIDList).Should(HaveLen(2))
+			Ω(fakeACS.Count(fakeacs.KindVirtualMachine)).Should(Equal(2))
+
+			csMachinePool = scaleTo(1)
+			Ω(csMachinePool.Status.Instances).Should(Equal([]infrav1.CloudStackMachinePoolInstance{oldest}))
+			Ω(fakeACS.Count(fakeacs.KindVirtualMachine)).Should(Equal(1))
+		})
+	})
+})
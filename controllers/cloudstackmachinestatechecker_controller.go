@@ -18,7 +18,6 @@ package controllers
 
 import (
 	"context"
-	"strings"
 	"time"
 
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -26,7 +25,9 @@ import (
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
 	csCtrlrUtils "sigs.k8s.io/cluster-api-provider-cloudstack/controllers/utils"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
 )
 
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstackmachinestatecheckers,verbs=get;list;watch;create;update;patch;delete
@@ -76,9 +77,10 @@ func (r *CloudStackMachineStateCheckerReconciliationRunner) Reconcile() (ctrl.Re
 		r.CheckPresent(map[string]client.Object{"CloudStackMachine": r.CSMachine, "Machine": r.CAPIMachine}),
 		r.GetFailureDomainByName(func() string { return r.CSMachine.Spec.FailureDomainName }, r.FailureDomain),
 		r.AsFailureDomainUser(&r.FailureDomain.Spec),
+		r.RequeueIfEndpointUnavailable(r.FailureDomain),
 		func() (ctrl.Result, error) {
-			if err := r.CSClient.ResolveVMInstanceDetails(r.CSMachine); err != nil {
-				if !strings.Contains(strings.ToLower(err.Error()), "no match found") {
+			if err := r.CSClient.ResolveVMInstanceDetails(r.RequestCtx, r.CSMachine); err != nil {
+				if !cloud.IsNotFound(err) {
 					return r.ReturnWrappedError(err, "failed to resolve VM instance details")
 				}
 			}
@@ -89,10 +91,13 @@ func (r *CloudStackMachineStateCheckerReconciliationRunner) Reconcile() (ctrl.Re
 			csTimeInState := r.CSMachine.Status.TimeSinceLastStateChange()
 			capiRunning := r.CAPIMachine.Status.Phase == "Running"
 			capiTimeout := csRunning && !capiRunning && csTimeInState > 5*time.Minute
+			// Instances scaled vertically are stopped and started again when they can't be scaled live.
+			scaling := conditions.IsFalse(r.CSMachine, infrav1.InstanceScaledCondition) &&
+				conditions.GetReason(r.CSMachine, infrav1.InstanceScaledCondition) != infrav1.InstanceScalingUnsupportedReason
 
 			if csRunning && capiRunning {
 				r.ReconciliationSubject.Status.Ready = true
-			} else if !csRunning || capiTimeout {
+			} else if (!csRunning && !scaling) || capiTimeout {
 				r.Log.Info("CloudStack instance in bad state",
 					"name", r.CSMachine.Name,
 					"instance-id", r.CSMachine.Spec.InstanceID,
@@ -0,0 +1,198 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/controllers/utils"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
+)
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstacktemplates,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstacktemplates/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=cloudstacktemplates/finalizers,verbs=update
+
+// CloudStackTemplateReconciliationRunner is a ReconciliationRunner with extensions specific to CloudStack template
+// reconciliation.
+type CloudStackTemplateReconciliationRunner struct {
+	*utils.ReconciliationRunner
+	ReconciliationSubject *infrav1.CloudStackTemplate
+}
+
+// CloudStackTemplateReconciler reconciles a CloudStackTemplate object
+type CloudStackTemplateReconciler struct {
+	utils.ReconcilerBase
+}
+
+// Initialize a new CloudStackTemplate reconciliation runner with concrete types and initialized member fields.
+func NewCSTemplateReconciliationRunner() *CloudStackTemplateReconciliationRunner {
+	// Set concrete type and init pointers.
+	r := &CloudStackTemplateReconciliationRunner{ReconciliationSubject: &infrav1.CloudStackTemplate{}}
+	// Setup the base runner. Initializes pointers and links reconciliation methods.
+	r.ReconciliationRunner = utils.NewRunner(r, r.ReconciliationSubject, "CloudStackTemplate")
+	return r
+}
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+func (reconciler *CloudStackTemplateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	r := NewCSTemplateReconciliationRunner()
+	r.UsingBaseReconciler(reconciler.ReconcilerBase).ForRequest(req).WithRequestCtx(ctx)
+	return r.RunBaseReconciliationStages()
+}
+
+func (r *CloudStackTemplateReconciliationRunner) Reconcile() (ctrl.Result, error) {
+	return r.RunReconciliationStages(
+		r.RegisterTemplates,
+		r.RemoveExtraneousTemplates,
+		r.SetReadyStatus,
+	)
+}
+
+// failureDomainNames returns the names of the failure domains the template is registered in: those listed in its spec,
+// or else all those of the cluster.
+func (r *CloudStackTemplateReconciliationRunner) failureDomainNames() []string {
+	if len(r.ReconciliationSubject.Spec.FailureDomainNames) > 0 {
+		return r.ReconciliationSubject.Spec.FailureDomainNames
+	}
+	names := make([]string, 0, len(r.CSCluster.Spec.FailureDomains))
+	for _, fd := range r.CSCluster.Spec.FailureDomains {
+		names = append(names, fd.Name)
+	}
+	return names
+}
+
+// RegisterTemplates registers the template in the zone of each of its failure domains, as the user of the failure
+// domain, and records the download progress of each.
+func (r *CloudStackTemplateReconciliationRunner) RegisterTemplates() (ctrl.Result, error) {
+	controllerutil.AddFinalizer(r.ReconciliationSubject, infrav1.TemplateFinalizer)
+
+	for _, fdName := range r.failureDomainNames() {
+		name := fdName
+		fd := &infrav1.CloudStackFailureDomain{}
+		if res, err := r.GetFailureDomainByName(func() string { return name }, fd)(); r.ShouldReturn(res, err) {
+			return res, err
+		} else if fd.Spec.Zone.ID == "" {
+			return r.RequeueWithMessage("Zone of failure domain not resolved.", "failureDomain", name)
+		}
+		if res, err := r.AsFailureDomainUser(&fd.Spec)(); r.ShouldReturn(res, err) {
+			return res, err
+		}
+		if res, err := r.RequeueIfEndpointUnavailable(fd)(); r.ShouldReturn(res, err) {
+			return res, err
+		}
+
+		fdStatus := r.ReconciliationSubject.FailureDomainStatus(name)
+		if fdStatus == nil {
+			r.ReconciliationSubject.Status.FailureDomains = append(r.ReconciliationSubject.Status.FailureDomains,
+				infrav1.CloudStackTemplateFailureDomainStatus{FailureDomainName: name, ZoneID: fd.Spec.Zone.ID})
+			fdStatus = r.ReconciliationSubject.FailureDomainStatus(name)
+		}
+		if err := r.CSUser.GetOrRegisterTemplate(r.RequestCtx, r.ReconciliationSubject, fdStatus); err != nil {
+			if errors.Is(err, cloud.ErrTemplateConflict) {
+				r.Recorder.Event(r.ReconciliationSubject, "Warning", "Conflict", err.Error())
+			}
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// RemoveExtraneousTemplates deletes the templates registered in failure domains no longer listed for the template,
+// unless they're retained.
+func (r *CloudStackTemplateReconciliationRunner) RemoveExtraneousTemplates() (ctrl.Result, error) {
+	listed := map[string]bool{}
+	for _, name := range r.failureDomainNames() {
+		listed[name] = true
+	}
+	remaining := make([]infrav1.CloudStackTemplateFailureDomainStatus, 0, len(r.ReconciliationSubject.Status.FailureDomains))
+	for i := range r.ReconciliationSubject.Status.FailureDomains {
+		fdStatus := &r.ReconciliationSubject.Status.FailureDomains[i]
+		if listed[fdStatus.FailureDomainName] {
+			remaining = append(remaining, *fdStatus)
+			continue
+		}
+		if res, err := r.deleteTemplate(fdStatus); r.ShouldReturn(res, err) {
+			return res, err
+		}
+	}
+	r.ReconciliationSubject.Status.FailureDomains = remaining
+	return ctrl.Result{}, nil
+}
+
+// SetReadyStatus sets the template ready once it's downloaded in the zones of all its failure domains, and requeues
+// until then to track the download.
+func (r *CloudStackTemplateReconciliationRunner) SetReadyStatus() (ctrl.Result, error) {
+	ready := true
+	for _, fdStatus := range r.ReconciliationSubject.Status.FailureDomains {
+		ready = ready && fdStatus.Ready
+	}
+	r.ReconciliationSubject.Status.Ready = ready
+	if !ready {
+		return r.RequeueWithMessage("Templates downloading.")
+	}
+	return ctrl.Result{}, nil
+}
+
+// deleteTemplate deletes the template registered in a failure domain as the user of the failure domain, unless the
+// template is retained. Templates of failure domains that are gone are left as they are.
+func (r *CloudStackTemplateReconciliationRunner) deleteTemplate(
+	fdStatus *infrav1.CloudStackTemplateFailureDomainStatus,
+) (ctrl.Result, error) {
+	if r.ReconciliationSubject.Spec.RetainPolicy == infrav1.TemplateRetainPolicyRetain || fdStatus.TemplateID == "" {
+		return ctrl.Result{}, nil
+	}
+	fd := &infrav1.CloudStackFailureDomain{}
+	if _, err := r.GetFailureDomainByName(func() string { return fdStatus.FailureDomainName }, fd)(); apierrors.IsNotFound(err) {
+		r.Log.Info("Failure domain gone, leaving template.", "failureDomain", fdStatus.FailureDomainName,
+			"templateID", fdStatus.TemplateID)
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+	if res, err := r.AsFailureDomainUser(&fd.Spec)(); r.ShouldReturn(res, err) {
+		return res, err
+	}
+	if res, err := r.RequeueIfEndpointUnavailable(fd)(); r.ShouldReturn(res, err) {
+		return res, err
+	}
+	return ctrl.Result{}, r.CSUser.DeleteTemplate(r.RequestCtx, fdStatus)
+}
+
+func (r *CloudStackTemplateReconciliationRunner) ReconcileDelete() (ctrl.Result, error) {
+	for i := range r.ReconciliationSubject.Status.FailureDomains {
+		if res, err := r.deleteTemplate(&r.ReconciliationSubject.Status.FailureDomains[i]); r.ShouldReturn(res, err) {
+			return res, err
+		}
+	}
+	controllerutil.RemoveFinalizer(r.ReconciliationSubject, infrav1.TemplateFinalizer)
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (reconciler *CloudStackTemplateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.CloudStackTemplate{}).
+		Complete(reconciler)
+}
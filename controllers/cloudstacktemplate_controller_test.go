@@ -0,0 +1,120 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	dummies "sigs.k8s.io/cluster-api-provider-cloudstack/test/dummies/v1beta2"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/test/fakeacs"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("CloudStackTemplateReconciler", func() {
+	Context("With a fake ctrlRuntimeClient and a fake ACS API server.", func() {
+		var requestNamespacedName types.NamespacedName
+
+		BeforeEach(func() {
+			setupFakeACSTestClient()
+			fakeACS.AddOsType(dummies.CSTemplate1.Spec.OSType.Name)
+
+			// The template is registered in the failure domains of the cluster.
+			Ω(fakeCtrlClient.Get(ctx, client.ObjectKeyFromObject(dummies.CSCluster), dummies.CSCluster)).Should(Succeed())
+			dummies.CSCluster.Spec.FailureDomains = []infrav1.CloudStackFailureDomainSpec{dummies.CSFailureDomain1.Spec}
+			Ω(fakeCtrlClient.Update(ctx, dummies.CSCluster)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSFailureDomain1)).Should(Succeed())
+			Ω(fakeCtrlClient.Create(ctx, dummies.ACSEndpointSecret1)).Should(Succeed())
+			requestNamespacedName = client.ObjectKeyFromObject(dummies.CSTemplate1)
+		})
+
+		// reconcile reconciles the CloudStackTemplate and returns it as it's left.
+		reconcile := func() (*infrav1.CloudStackTemplate, ctrl.Result) {
+			res, err := TemplateReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).ShouldNot(HaveOccurred())
+			csTemplate := &infrav1.CloudStackTemplate{}
+			if err := fakeCtrlClient.Get(ctx, requestNamespacedName, csTemplate); !apierrors.IsNotFound(err) {
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			return csTemplate, res
+		}
+
+		It("Should register the template, track its download, and delete it with the CloudStackTemplate.", func() {
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSTemplate1)).Should(Succeed())
+
+			csTemplate, res := reconcile()
+			Ω(res.RequeueAfter).ShouldNot(BeZero())
+			Ω(csTemplate.Finalizers).Should(ContainElement(infrav1.TemplateFinalizer))
+			Ω(csTemplate.Status.Ready).Should(BeFalse())
+			Ω(csTemplate.Status.FailureDomains).Should(HaveLen(1))
+			fdStatus := csTemplate.Status.FailureDomains[0]
+			Ω(fdStatus.FailureDomainName).Should(Equal(dummies.CSFailureDomain1.Spec.Name))
+			Ω(fdStatus.ZoneID).Should(Equal(dummies.CSFailureDomain1.Spec.Zone.ID))
+			Ω(fdStatus.TemplateID).ShouldNot(BeEmpty())
+
+			fakeACS.Set(fakeacs.KindTemplate, fdStatus.TemplateID, "status", "Download Complete")
+			fakeACS.Set(fakeacs.KindTemplate, fdStatus.TemplateID, "isready", true)
+			csTemplate, res = reconcile()
+			Ω(res.RequeueAfter).Should(BeZero())
+			Ω(csTemplate.Status.Ready).Should(BeTrue())
+			Ω(csTemplate.Status.FailureDomains[0].Status).Should(Equal("Download Complete"))
+			Ω(fakeACS.Calls("registerTemplate")).Should(Equal(1))
+
+			Ω(fakeCtrlClient.Delete(ctx, csTemplate)).Should(Succeed())
+			csTemplate, _ = reconcile()
+			Ω(csTemplate.Finalizers).ShouldNot(ContainElement(infrav1.TemplateFinalizer))
+			_, found := fakeACS.Get(fakeacs.KindTemplate, fdStatus.TemplateID)
+			Ω(found).Should(BeFalse())
+		})
+
+		It("Should leave the template in CloudStack when it's retained.", func() {
+			dummies.CSTemplate1.Spec.RetainPolicy = infrav1.TemplateRetainPolicyRetain
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSTemplate1)).Should(Succeed())
+
+			csTemplate, _ := reconcile()
+			templateID := csTemplate.Status.FailureDomains[0].TemplateID
+			Ω(templateID).ShouldNot(BeEmpty())
+
+			Ω(fakeCtrlClient.Delete(ctx, csTemplate)).Should(Succeed())
+			csTemplate, _ = reconcile()
+			Ω(csTemplate.Finalizers).ShouldNot(ContainElement(infrav1.TemplateFinalizer))
+			_, found := fakeACS.Get(fakeacs.KindTemplate, templateID)
+			Ω(found).Should(BeTrue())
+			Ω(fakeACS.Calls("deleteTemplate")).Should(BeZero())
+		})
+
+		It("Should report a conflict with a template of the same name it didn't register, and leave it.", func() {
+			templateID := fakeACS.AddTemplate(dummies.CSFailureDomain1.Spec.Zone.ID, dummies.CSTemplate1.Spec.Name)
+			Ω(fakeCtrlClient.Create(ctx, dummies.CSTemplate1)).Should(Succeed())
+
+			_, err := TemplateReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: requestNamespacedName})
+			Ω(err).Should(MatchError(ContainSubstring(templateID)))
+			Ω(fakeRecorder.Events).Should(Receive(HavePrefix("Warning Conflict")))
+			Ω(fakeACS.Calls("registerTemplate")).Should(BeZero())
+
+			csTemplate := &infrav1.CloudStackTemplate{}
+			Ω(fakeCtrlClient.Get(ctx, requestNamespacedName, csTemplate)).Should(Succeed())
+			Ω(fakeCtrlClient.Delete(ctx, csTemplate)).Should(Succeed())
+			reconcile()
+			_, found := fakeACS.Get(fakeacs.KindTemplate, templateID)
+			Ω(found).Should(BeTrue())
+		})
+	})
+})
@@ -52,10 +52,13 @@ import (
 	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
 	csReconcilers "sigs.k8s.io/cluster-api-provider-cloudstack/controllers"
 	csCtrlrUtils "sigs.k8s.io/cluster-api-provider-cloudstack/controllers/utils"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
 	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/mocks"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/test/fakeacs"
 
 	dummies "sigs.k8s.io/cluster-api-provider-cloudstack/test/dummies/v1beta2"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/patch"
 	//+kubebuilder:scaffold:imports
 )
@@ -123,8 +126,14 @@ var (
 	mockCloudClient *mocks.MockClient
 	mockCSAPIClient *cloudstack.CloudStackClient
 
+	// Fake ACS server used by tests that run real cloud clients end to end.
+	fakeACS *fakeacs.Server
+
 	// Reconcilers
 	MachineReconciler       *csReconcilers.CloudStackMachineReconciler
+	MachinePoolReconciler   *csReconcilers.CloudStackMachinePoolReconciler
+	TemplateReconciler      *csReconcilers.CloudStackTemplateReconciler
+	IPPoolReconciler        *csReconcilers.CloudStackIPPoolReconciler
 	ClusterReconciler       *csReconcilers.CloudStackClusterReconciler
 	FailureDomainReconciler *csReconcilers.CloudStackFailureDomainReconciler
 	IsoNetReconciler        *csReconcilers.CloudStackIsoNetReconciler
@@ -146,6 +155,7 @@ var _ = BeforeSuite(func() {
 
 	Ω(infrav1.AddToScheme(scheme.Scheme)).Should(Succeed())
 	Ω(clusterv1.AddToScheme(scheme.Scheme)).Should(Succeed())
+	Ω(expv1.AddToScheme(scheme.Scheme)).Should(Succeed())
 	Ω(fakes.AddToScheme(scheme.Scheme)).Should(Succeed())
 
 	// Increase log verbosity.
@@ -220,6 +230,9 @@ func SetupTestEnvironment() {
 	// Setup each specific reconciler.
 	ClusterReconciler = &csReconcilers.CloudStackClusterReconciler{ReconcilerBase: base}
 	MachineReconciler = &csReconcilers.CloudStackMachineReconciler{ReconcilerBase: base}
+	MachinePoolReconciler = &csReconcilers.CloudStackMachinePoolReconciler{ReconcilerBase: base}
+	TemplateReconciler = &csReconcilers.CloudStackTemplateReconciler{ReconcilerBase: base}
+	IPPoolReconciler = &csReconcilers.CloudStackIPPoolReconciler{ReconcilerBase: base}
 	FailureDomainReconciler = &csReconcilers.CloudStackFailureDomainReconciler{ReconcilerBase: base}
 	IsoNetReconciler = &csReconcilers.CloudStackIsoNetReconciler{ReconcilerBase: base}
 	AffinityGReconciler = &csReconcilers.CloudStackAffinityGroupReconciler{ReconcilerBase: base}
@@ -229,11 +242,20 @@ func SetupTestEnvironment() {
 	// Setup mock clients.
 	mockCSAPIClient = cloudstack.NewMockClient(mockCtrl)
 	mockCloudClient = mocks.NewMockClient(mockCtrl)
+	mockCloudClient.EXPECT().EndpointHealth().Return(cloud.EndpointHealth{State: cloud.CircuitClosed}).AnyTimes()
+	mockCloudClient.EXPECT().ReconcileDataDisks(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockCloudClient.EXPECT().ScaleVMInstance(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockCloudClient.EXPECT().DeleteVMInstanceUserData(gomock.Any(), gomock.Any()).AnyTimes()
+	mockCloudClient.EXPECT().ReconcileVMInstanceTags(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockCloudClient.EXPECT().ReconcileIsoNetTags(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockCloudClient.EXPECT().ReconcileAffinityGroupTags(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 
 	// Set on reconcilers. The mock client wasn't available at suite startup, so set it now.
 	ClusterReconciler.CSClient = mockCloudClient
 	IsoNetReconciler.CSClient = mockCloudClient
 	MachineReconciler.CSClient = mockCloudClient
+	MachinePoolReconciler.CSClient = mockCloudClient
+	TemplateReconciler.CSClient = mockCloudClient
 	AffinityGReconciler.CSClient = mockCloudClient
 	FailureDomainReconciler.CSClient = mockCloudClient
 
@@ -261,6 +283,13 @@ func setupFakeTestClient() {
 	// Setup mock clients.
 	mockCSAPIClient = cloudstack.NewMockClient(mockCtrl)
 	mockCloudClient = mocks.NewMockClient(mockCtrl)
+	mockCloudClient.EXPECT().EndpointHealth().Return(cloud.EndpointHealth{State: cloud.CircuitClosed}).AnyTimes()
+	mockCloudClient.EXPECT().ReconcileDataDisks(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockCloudClient.EXPECT().ScaleVMInstance(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockCloudClient.EXPECT().DeleteVMInstanceUserData(gomock.Any(), gomock.Any()).AnyTimes()
+	mockCloudClient.EXPECT().ReconcileVMInstanceTags(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockCloudClient.EXPECT().ReconcileIsoNetTags(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockCloudClient.EXPECT().ReconcileAffinityGroupTags(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 
 	// Base reconciler shared across reconcilers.
 	base := csCtrlrUtils.ReconcilerBase{
@@ -277,6 +306,9 @@ func setupFakeTestClient() {
 	// Setup each specific reconciler.
 	ClusterReconciler = &csReconcilers.CloudStackClusterReconciler{ReconcilerBase: base}
 	MachineReconciler = &csReconcilers.CloudStackMachineReconciler{ReconcilerBase: base}
+	MachinePoolReconciler = &csReconcilers.CloudStackMachinePoolReconciler{ReconcilerBase: base}
+	TemplateReconciler = &csReconcilers.CloudStackTemplateReconciler{ReconcilerBase: base}
+	IPPoolReconciler = &csReconcilers.CloudStackIPPoolReconciler{ReconcilerBase: base}
 	FailureDomainReconciler = &csReconcilers.CloudStackFailureDomainReconciler{ReconcilerBase: base}
 	IsoNetReconciler = &csReconcilers.CloudStackIsoNetReconciler{ReconcilerBase: base}
 	AffinityGReconciler = &csReconcilers.CloudStackAffinityGroupReconciler{ReconcilerBase: base}
@@ -285,6 +317,8 @@ func setupFakeTestClient() {
 	ClusterReconciler.CSClient = mockCloudClient
 	IsoNetReconciler.CSClient = mockCloudClient
 	MachineReconciler.CSClient = mockCloudClient
+	MachinePoolReconciler.CSClient = mockCloudClient
+	TemplateReconciler.CSClient = mockCloudClient
 	FailureDomainReconciler.CSClient = mockCloudClient
 	AffinityGReconciler.CSClient = mockCloudClient
 
@@ -293,6 +327,38 @@ func setupFakeTestClient() {
 	})
 }
 
+// Sets up a fake k8s controller runtime client like setupFakeTestClient, but with reconcilers using the real cloud
+// client extension. The ACS endpoint secret points at an in-process fake CloudStack API server seeded with the zone,
+// network, offerings and template the dummy machines reference.
+func setupFakeACSTestClient() {
+	setupFakeTestClient()
+
+	fakeACS = fakeacs.NewServer()
+	DeferCleanup(fakeACS.Close)
+	zoneID := fakeACS.AddZone(dummies.Zone1.Name)
+	dummies.CSFailureDomain1.Spec.Zone.Network.ID = fakeACS.AddNetwork(zoneID, dummies.Zone1.Network.Name, cloud.NetworkTypeShared)
+	fakeACS.AddServiceOffering(dummies.CSMachine1.Spec.Offering.Name, 2, 2048)
+	fakeACS.AddTemplate(zoneID, dummies.CSMachine1.Spec.Template.Name)
+	fakeACS.AddDiskOffering(dummies.CSMachine1.Spec.DiskOffering.Name, 10, false)
+
+	dummies.ACSEndpointSecret1.Data = map[string][]byte{
+		"api-url":    []byte(fakeACS.APIURL()),
+		"api-key":    []byte(fakeACS.APIKey),
+		"secret-key": []byte(fakeACS.SecretKey),
+		"verify-ssl": []byte("false"),
+	}
+	csClient, err := cloud.NewClientFromK8sSecret(dummies.ACSEndpointSecret1, nil)
+	Ω(err).ShouldNot(HaveOccurred())
+	Ω(csClient.ResolveZone(ctx, &dummies.CSFailureDomain1.Spec.Zone)).Should(Succeed())
+
+	for _, base := range []*csCtrlrUtils.ReconcilerBase{&ClusterReconciler.ReconcilerBase, &MachineReconciler.ReconcilerBase,
+		&MachinePoolReconciler.ReconcilerBase, &TemplateReconciler.ReconcilerBase, &FailureDomainReconciler.ReconcilerBase,
+		&IsoNetReconciler.ReconcilerBase, &AffinityGReconciler.ReconcilerBase} {
+		base.CSClient = csClient
+		base.CloudClientExtension = nil // Use the real extension, which reads the ACS endpoint secret.
+	}
+}
+
 // Setup and teardown on a per test basis.
 var _ = BeforeEach(func() {
 	dummies.SetDummyVars()
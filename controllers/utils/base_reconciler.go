@@ -26,10 +26,12 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
 	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
@@ -387,7 +389,12 @@ func (r *ReconciliationRunner) RunBaseReconciliationStages() (res ctrl.Result, r
 	defer func() {
 		if r.Patcher != nil {
 			if err := r.Patcher.Patch(r.RequestCtx, r.ReconciliationSubject); err != nil {
-				if !strings.Contains(err.Error(), "is invalid: status.ready") {
+				if !r.ReconciliationSubject.GetDeletionTimestamp().IsZero() &&
+					len(r.ReconciliationSubject.GetFinalizers()) == 0 {
+					// Removing the last finalizer of a deleted subject removes it before its status gets patched.
+					err = kerrors.FilterOut(err, apierrors.IsNotFound)
+				}
+				if err != nil && !strings.Contains(err.Error(), "is invalid: status.ready") {
 					err = errors.Wrapf(err, "error patching reconciliation subject")
 					retErr = multierror.Append(retErr, err)
 				}
@@ -17,6 +17,7 @@ limitations under the License.
 package utils
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -26,6 +27,7 @@ import (
 
 	"github.com/pkg/errors"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -118,6 +120,45 @@ func (r *ReconciliationRunner) GetFailureDomainsAndRequeueIfMissing(fds *infrav1
 	}
 }
 
+// RequeueIfEndpointUnavailable requeues without calling the ACS API while the circuit breaker of the CSUser's endpoint
+// is open. The state of the breaker is reflected in the failure domain's EndpointHealthy condition.
+func (r *ReconciliationRunner) RequeueIfEndpointUnavailable(fd *infrav1.CloudStackFailureDomain) CloudStackReconcilerMethod {
+	return func() (ctrl.Result, error) {
+		health := r.CSUser.EndpointHealth()
+		original := fd.DeepCopy()
+		if SetEndpointHealthyCondition(fd, health) {
+			if err := r.K8sClient.Status().Patch(r.RequestCtx, fd, client.MergeFrom(original)); err != nil {
+				return ctrl.Result{}, errors.Wrapf(err, "updating endpoint condition of failure domain %s", fd.Spec.Name)
+			}
+		}
+		if health.State == cloud.CircuitOpen {
+			r.Log.Info("ACS endpoint circuit breaker is open. Requeuing.",
+				"failureDomain", fd.Spec.Name, "lastError", health.LastError)
+			return ctrl.Result{RequeueAfter: health.RetryAfter}, nil
+		}
+		return ctrl.Result{}, nil
+	}
+}
+
+// SetEndpointHealthyCondition sets the EndpointHealthy condition of a failure domain from the health of its ACS
+// endpoint, and returns true if the condition changed.
+func SetEndpointHealthyCondition(fd *infrav1.CloudStackFailureDomain, health cloud.EndpointHealth) bool {
+	previous := conditions.Get(fd, infrav1.EndpointHealthyCondition)
+	switch health.State {
+	case cloud.CircuitOpen:
+		conditions.MarkFalse(fd, infrav1.EndpointHealthyCondition, infrav1.EndpointCircuitOpenReason,
+			clusterv1.ConditionSeverityError, "Requests are refused after repeated failures: %s", health.LastError)
+	case cloud.CircuitHalfOpen:
+		conditions.MarkFalse(fd, infrav1.EndpointHealthyCondition, infrav1.EndpointCircuitHalfOpenReason,
+			clusterv1.ConditionSeverityWarning, "Probing the endpoint after repeated failures: %s", health.LastError)
+	default:
+		conditions.MarkTrue(fd, infrav1.EndpointHealthyCondition)
+	}
+	current := conditions.Get(fd, infrav1.EndpointHealthyCondition)
+	return previous == nil || previous.Status != current.Status || previous.Reason != current.Reason ||
+		previous.Message != current.Message
+}
+
 type CloudClientExtension interface {
 	RegisterExtension(*ReconciliationRunner) CloudClientExtension
 	AsFailureDomainUser(*infrav1.CloudStackFailureDomainSpec) CloudStackReconcilerMethod
@@ -136,31 +177,49 @@ func (c *CloudClientImplementation) RegisterExtension(r *ReconciliationRunner) C
 // AsFailureDomainUser uses the credentials specified in the failure domain to set the ReconciliationSubject's CSUser client.
 func (c *CloudClientImplementation) AsFailureDomainUser(fdSpec *infrav1.CloudStackFailureDomainSpec) CloudStackReconcilerMethod {
 	return func() (ctrl.Result, error) {
-		endpointCredentials := &corev1.Secret{}
-		key := client.ObjectKey{Name: fdSpec.ACSEndpoint.Name, Namespace: fdSpec.ACSEndpoint.Namespace}
-		if err := c.K8sClient.Get(c.RequestCtx, key, endpointCredentials); err != nil {
-			return ctrl.Result{}, errors.Wrapf(err, "getting ACSEndpoint secret with ref: %v", fdSpec.ACSEndpoint)
+		csClient, csUser, err := FailureDomainClients(c.RequestCtx, c.K8sClient, fdSpec)
+		if err != nil {
+			return ctrl.Result{}, err
 		}
+		c.CSClient, c.CSUser = csClient, csUser
+		return ctrl.Result{}, nil
+	}
+}
 
-		clientConfig := &corev1.ConfigMap{}
-		key = client.ObjectKey{Name: cloud.ClientConfigMapName, Namespace: cloud.ClientConfigMapNamespace}
-		_ = c.K8sClient.Get(c.RequestCtx, key, clientConfig)
+// FailureDomainClients returns the CloudStack client of the failure domain's ACS endpoint, and that of its user: the
+// client in its domain and account, scoped to its project, if any.
+func FailureDomainClients(
+	ctx context.Context,
+	k8sClient client.Client,
+	fdSpec *infrav1.CloudStackFailureDomainSpec,
+) (csClient cloud.Client, csUser cloud.Client, err error) {
+	endpointCredentials := &corev1.Secret{}
+	key := client.ObjectKey{Name: fdSpec.ACSEndpoint.Name, Namespace: fdSpec.ACSEndpoint.Namespace}
+	if err = k8sClient.Get(ctx, key, endpointCredentials); err != nil {
+		return nil, nil, errors.Wrapf(err, "getting ACSEndpoint secret with ref: %v", fdSpec.ACSEndpoint)
+	}
 
-		var err error
-		if c.CSClient, err = cloud.NewClientFromK8sSecret(endpointCredentials, clientConfig); err != nil {
-			return ctrl.Result{}, errors.Wrapf(err, "parsing ACSEndpoint secret with ref: %v", fdSpec.ACSEndpoint)
-		}
+	clientConfig := &corev1.ConfigMap{}
+	key = client.ObjectKey{Name: cloud.ClientConfigMapName, Namespace: cloud.ClientConfigMapNamespace}
+	_ = k8sClient.Get(ctx, key, clientConfig)
 
-		if fdSpec.Account != "" { // Set r.CSUser CloudStack Client per Account and Domain.
-			client, err := c.CSClient.NewClientInDomainAndAccount(fdSpec.Domain, fdSpec.Account)
-			if err != nil {
-				return ctrl.Result{}, err
-			}
-			c.CSUser = client
-		} else { // Set r.CSUser CloudStack Client to r.CSClient since Account & Domain weren't provided.
-			c.CSUser = c.CSClient
+	if csClient, err = cloud.NewClientFromK8sSecret(endpointCredentials, clientConfig); err != nil {
+		return nil, nil, errors.Wrapf(err, "parsing ACSEndpoint secret with ref: %v", fdSpec.ACSEndpoint)
+	}
+
+	if fdSpec.Account != "" { // Set the user's client per Account and Domain.
+		if csUser, err = csClient.NewClientInDomainAndAccount(ctx, fdSpec.Domain, fdSpec.Account); err != nil {
+			return nil, nil, err
 		}
+	} else { // Use the endpoint's client since Account & Domain weren't provided.
+		csUser = csClient
+	}
 
-		return ctrl.Result{}, nil
+	if fdSpec.Project != "" { // Scope the user's client to the failure domain's Project.
+		if csUser, err = csUser.NewClientInProject(ctx, fdSpec.Project); err != nil {
+			return nil, nil, errors.Wrapf(err, "resolving project %s", fdSpec.Project)
+		}
 	}
+
+	return csClient, csUser, nil
 }
@@ -0,0 +1,129 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1beta1"
+)
+
+const (
+	// IgnitionKubeadmDropIn is the name of the kubeadm.service drop-in added to Ignition configs.
+	IgnitionKubeadmDropIn = "10-cloudstack.conf"
+
+	// kubeadmDropInContents makes on the node the substitutions cloud-init and the machine controller make in
+	// cloud-init user data, as Ignition has no templating. The instance ID comes from Flatcar's coreos-metadata
+	// service, which reads it from CloudStack, while the hostname and failure domain are filled in by
+	// InjectIgnitionMetadata.
+	kubeadmDropInContents = `[Unit]
+Requires=coreos-metadata.service
+After=coreos-metadata.service
+
+[Service]
+EnvironmentFile=/run/metadata/flatcar
+ExecStartPre=/usr/bin/sed -i \
+  -e "s/{{ *ds[.]meta_data[.]instance_id *}}/${COREOS_CLOUDSTACK_INSTANCE_ID}/g" \
+  -e "s/{{ *ds[.]meta_data[.]hostname *}}/%s/g" \
+  -e "s/ds[.]meta_data[.]failuredomain/%s/g" \
+  /etc/kubeadm.yml
+`
+)
+
+// IsIgnitionBootstrapData reports whether a CAPI bootstrap data secret holds an Ignition config rather than cloud-init
+// user data.
+func IsIgnitionBootstrapData(secret *corev1.Secret) bool {
+	return string(secret.Data["format"]) == string(bootstrapv1.Ignition)
+}
+
+// InjectIgnitionMetadata adds the hostname of a machine to its Ignition config, along with a kubeadm.service drop-in
+// replacing the ds.meta_data placeholders of the kubeadm config with the machine's hostname, failure domain and
+// instance ID, from which its provider ID is built. Both version 2 and 3 configs are supported.
+func InjectIgnitionMetadata(data []byte, hostname string, failureDomain string) (string, error) {
+	config := map[string]interface{}{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", errors.Wrap(err, "parsing Ignition config")
+	}
+	ignition, _ := config["ignition"].(map[string]interface{})
+	version, _ := ignition["version"].(string)
+	if version == "" {
+		return "", errors.New("Ignition config has no version")
+	}
+
+	hostnameFile := map[string]interface{}{
+		"path":     "/etc/hostname",
+		"mode":     0644,
+		"contents": map[string]interface{}{"source": "data:," + url.PathEscape(hostname)},
+	}
+	if strings.HasPrefix(version, "2.") {
+		hostnameFile["filesystem"] = "root"
+	} else {
+		hostnameFile["overwrite"] = true
+	}
+	storage := ignitionObject(config, "storage")
+	storage["files"] = ignitionUpsert(storage["files"], "path", hostnameFile)
+
+	systemd := ignitionObject(config, "systemd")
+	var kubeadm map[string]interface{}
+	units, _ := systemd["units"].([]interface{})
+	for _, unit := range units {
+		if u, ok := unit.(map[string]interface{}); ok && u["name"] == "kubeadm.service" {
+			kubeadm = u
+		}
+	}
+	if kubeadm == nil {
+		kubeadm = map[string]interface{}{"name": "kubeadm.service"}
+		systemd["units"] = append(units, kubeadm)
+	}
+	kubeadm["dropins"] = ignitionUpsert(kubeadm["dropins"], "name", map[string]interface{}{
+		"name":     IgnitionKubeadmDropIn,
+		"contents": fmt.Sprintf(kubeadmDropInContents, hostname, failureDomain),
+	})
+
+	out, err := json.Marshal(config)
+	if err != nil {
+		return "", errors.Wrap(err, "serializing Ignition config")
+	}
+	return string(out), nil
+}
+
+// ignitionObject returns the object under key in parent, adding an empty one if there's none.
+func ignitionObject(parent map[string]interface{}, key string) map[string]interface{} {
+	object, ok := parent[key].(map[string]interface{})
+	if !ok {
+		object = map[string]interface{}{}
+		parent[key] = object
+	}
+	return object
+}
+
+// ignitionUpsert returns the list with item added, replacing the entries with the same value for the key.
+func ignitionUpsert(list interface{}, key string, item map[string]interface{}) []interface{} {
+	entries, _ := list.([]interface{})
+	result := make([]interface{}, 0, len(entries)+1)
+	for _, entry := range entries {
+		if e, ok := entry.(map[string]interface{}); !ok || e[key] != item[key] {
+			result = append(result, entry)
+		}
+	}
+	return append(result, item)
+}
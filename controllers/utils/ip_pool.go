@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// ClaimIPAddress claims an address of the machine's IP pool for the machine and sets it as the machine's static IP
+// address. Claims are written to the pool's status, so machines racing for an address conflict and are requeued. The
+// machine gets its finalizer first.
+func (r *ReconciliationRunner) ClaimIPAddress(
+	csMachine *infrav1.CloudStackMachine,
+	fd *infrav1.CloudStackFailureDomain) CloudStackReconcilerMethod {
+
+	return func() (ctrl.Result, error) {
+		if csMachine.Spec.IPPoolName == "" || csMachine.Spec.IPAddress != "" {
+			return ctrl.Result{}, nil
+		}
+
+		// Persist the finalizer before claiming, so reconcile-delete releases the claim even if the VM never deploys.
+		if !controllerutil.ContainsFinalizer(csMachine, infrav1.MachineFinalizer) {
+			controllerutil.AddFinalizer(csMachine, infrav1.MachineFinalizer)
+			return r.RequeueWithMessage("Added finalizer before claiming an IP address.")
+		}
+
+		pool := &infrav1.CloudStackIPPool{}
+		objKey := client.ObjectKey{Namespace: csMachine.Namespace, Name: csMachine.Spec.IPPoolName}
+		if err := r.K8sClient.Get(r.RequestCtx, objKey, pool); apierrors.IsNotFound(err) {
+			return r.RequeueWithMessage("IP pool not found.", "ipPool", csMachine.Spec.IPPoolName)
+		} else if err != nil {
+			return r.ReturnWrappedError(err, "getting IP pool")
+		}
+
+		network := fd.Spec.Zone.Network
+		if !(pool.Spec.Network.ID != "" && pool.Spec.Network.ID == network.ID) &&
+			!(pool.Spec.Network.Name != "" && pool.Spec.Network.Name == network.Name) {
+			return ctrl.Result{}, errors.Errorf("IP pool %s isn't on network %s of failure domain %s",
+				pool.Name, network.Name, fd.Spec.Name)
+		}
+
+		address, claimed, err := pool.Claim(csMachine.Name)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if claimed {
+			if err := r.K8sClient.Status().Update(r.RequestCtx, pool); err != nil {
+				return r.ReturnWrappedError(err, "claiming IP address")
+			}
+			r.Log.Info("Claimed IP address.", "address", address, "ipPool", pool.Name)
+		}
+		csMachine.Spec.IPAddress = address
+		return ctrl.Result{}, nil
+	}
+}
+
+// ReleaseIPAddress releases the address the machine claimed from its IP pool, if any.
+func (r *ReconciliationRunner) ReleaseIPAddress(csMachine *infrav1.CloudStackMachine) CloudStackReconcilerMethod {
+	return func() (ctrl.Result, error) {
+		if csMachine.Spec.IPPoolName == "" {
+			return ctrl.Result{}, nil
+		}
+
+		pool := &infrav1.CloudStackIPPool{}
+		objKey := client.ObjectKey{Namespace: csMachine.Namespace, Name: csMachine.Spec.IPPoolName}
+		if err := r.K8sClient.Get(r.RequestCtx, objKey, pool); err != nil {
+			return r.ReturnWrappedError(client.IgnoreNotFound(err), "getting IP pool")
+		}
+		if pool.Release(csMachine.Name) {
+			if err := r.K8sClient.Status().Update(r.RequestCtx, pool); err != nil {
+				return r.ReturnWrappedError(err, "releasing IP address")
+			}
+			r.Log.Info("Released IP address.", "ipPool", pool.Name)
+		}
+		return ctrl.Result{}, nil
+	}
+}
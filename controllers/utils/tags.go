@@ -0,0 +1,76 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	clientPkg "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+)
+
+// CloudStackClusterToObjectsMapper returns a mapper enqueuing the objects of the list's kind that belong to the cluster
+// of a CloudStackCluster, as named by the CloudStackCluster's cluster name label.
+func CloudStackClusterToObjectsMapper(client clientPkg.Client, list clientPkg.ObjectList) handler.MapFunc {
+	return func(o clientPkg.Object) []ctrl.Request {
+		csCluster, ok := o.(*infrav1.CloudStackCluster)
+		if !ok {
+			return nil
+		}
+		clusterName := csCluster.GetLabels()[clusterv1.ClusterLabelName]
+		if clusterName == "" {
+			return nil
+		}
+		objects, _ := list.DeepCopyObject().(clientPkg.ObjectList)
+		if err := client.List(context.TODO(), objects, clientPkg.InNamespace(csCluster.Namespace),
+			clientPkg.MatchingLabels{clusterv1.ClusterLabelName: clusterName}); err != nil {
+			return nil
+		}
+		items, err := meta.ExtractList(objects)
+		if err != nil {
+			return nil
+		}
+		requests := make([]ctrl.Request, 0, len(items))
+		for _, item := range items {
+			if obj, ok := item.(clientPkg.Object); ok {
+				requests = append(requests, ctrl.Request{NamespacedName: clientPkg.ObjectKeyFromObject(obj)})
+			}
+		}
+		return requests
+	}
+}
+
+// AdditionalTagsChanged only passes updates of CloudStackClusters changing their additional tags, which are applied to
+// the CloudStack resources of the cluster's other objects.
+var AdditionalTagsChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldCluster, ok := e.ObjectOld.(*infrav1.CloudStackCluster)
+		newCluster, newOk := e.ObjectNew.(*infrav1.CloudStackCluster)
+		return ok && newOk && !reflect.DeepEqual(oldCluster.Spec.AdditionalTags, newCluster.Spec.AdditionalTags)
+	},
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+}
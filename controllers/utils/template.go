@@ -0,0 +1,53 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ResolveTemplateRef pins the ID of the template the machine's CloudStackTemplate registered in the zone of the
+// machine's failure domain to the machine's status. The machine is requeued until the template is downloaded there.
+func (r *ReconciliationRunner) ResolveTemplateRef(
+	csMachine *infrav1.CloudStackMachine,
+	fd *infrav1.CloudStackFailureDomain) CloudStackReconcilerMethod {
+
+	return func() (ctrl.Result, error) {
+		if csMachine.Spec.TemplateRef == "" || csMachine.Status.TemplateID != "" || csMachine.Spec.InstanceID != nil {
+			return ctrl.Result{}, nil
+		}
+
+		csTemplate := &infrav1.CloudStackTemplate{}
+		objKey := client.ObjectKey{Namespace: csMachine.Namespace, Name: csMachine.Spec.TemplateRef}
+		if err := r.K8sClient.Get(r.RequestCtx, objKey, csTemplate); apierrors.IsNotFound(err) {
+			return r.RequeueWithMessage("CloudStackTemplate not found.", "templateRef", csMachine.Spec.TemplateRef)
+		} else if err != nil {
+			return r.ReturnWrappedError(err, "getting CloudStackTemplate")
+		}
+
+		fdStatus := csTemplate.FailureDomainStatus(fd.Spec.Name)
+		if fdStatus == nil || !fdStatus.Ready || fdStatus.TemplateID == "" {
+			return r.RequeueWithMessage("Template not ready in failure domain.",
+				"templateRef", csTemplate.Name, "failureDomain", fd.Spec.Name)
+		}
+		csMachine.Status.TemplateID = fdStatus.TemplateID
+		return ctrl.Result{}, nil
+	}
+}
@@ -159,10 +159,6 @@ func GetOwnerOfKind(ctx context.Context, c clientPkg.Client, owned clientPkg.Obj
 	return errors.Errorf("couldn't find owner of kind %s in namespace %s", gvk.Kind, owned.GetNamespace())
 }
 
-func ContainsNoMatchSubstring(err error) bool {
-	return strings.Contains(strings.ToLower(err.Error()), "no match")
-}
-
 func ContainsAlreadyExistsSubstring(err error) bool {
 	return strings.Contains(strings.ToLower(err.Error()), "already exists")
 }
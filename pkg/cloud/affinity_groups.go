@@ -17,6 +17,8 @@ limitations under the License.
 package cloud
 
 import (
+	"context"
+
 	"github.com/pkg/errors"
 	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
 )
@@ -33,16 +35,18 @@ type AffinityGroup struct {
 }
 
 type AffinityGroupIface interface {
-	FetchAffinityGroup(*AffinityGroup) error
-	GetOrCreateAffinityGroup(*AffinityGroup) error
-	DeleteAffinityGroup(*AffinityGroup) error
-	AssociateAffinityGroup(*infrav1.CloudStackMachine, AffinityGroup) error
-	DisassociateAffinityGroup(*infrav1.CloudStackMachine, AffinityGroup) error
+	FetchAffinityGroup(context.Context, *AffinityGroup) error
+	GetOrCreateAffinityGroup(context.Context, *AffinityGroup) error
+	DeleteAffinityGroup(context.Context, *AffinityGroup) error
+	AssociateAffinityGroup(context.Context, *infrav1.CloudStackMachine, AffinityGroup) error
+	DisassociateAffinityGroup(context.Context, *infrav1.CloudStackMachine, AffinityGroup) error
+	ReconcileAffinityGroupTags(context.Context, *infrav1.CloudStackAffinityGroup, *infrav1.CloudStackCluster) error
 }
 
-func (c *client) FetchAffinityGroup(group *AffinityGroup) (reterr error) {
+func (c *client) FetchAffinityGroup(ctx context.Context, group *AffinityGroup) (reterr error) {
+	c = c.withContext(ctx)
 	if group.ID != "" {
-		affinityGroup, count, err := c.cs.AffinityGroup.GetAffinityGroupByID(group.ID)
+		affinityGroup, count, err := c.cs.AffinityGroup.GetAffinityGroupByID(group.ID, c.projectOpts()...)
 		if err != nil {
 			// handle via multierr
 			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
@@ -57,7 +61,7 @@ func (c *client) FetchAffinityGroup(group *AffinityGroup) (reterr error) {
 		}
 	}
 	if group.Name != "" {
-		affinityGroup, count, err := c.cs.AffinityGroup.GetAffinityGroupByName(group.Name)
+		affinityGroup, count, err := c.cs.AffinityGroup.GetAffinityGroupByName(group.Name, c.projectOpts()...)
 		if err != nil {
 			// handle via multierr
 			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
@@ -74,10 +78,12 @@ func (c *client) FetchAffinityGroup(group *AffinityGroup) (reterr error) {
 	return errors.Errorf(`could not fetch AffinityGroup by name "%s" or id "%s"`, group.Name, group.ID)
 }
 
-func (c *client) GetOrCreateAffinityGroup(group *AffinityGroup) (retErr error) {
-	if err := c.FetchAffinityGroup(group); err != nil { // Group not found?
+func (c *client) GetOrCreateAffinityGroup(ctx context.Context, group *AffinityGroup) (retErr error) {
+	c = c.withContext(ctx)
+	if err := c.FetchAffinityGroup(ctx, group); err != nil { // Group not found?
 		p := c.cs.AffinityGroup.NewCreateAffinityGroupParams(group.Name, group.Type)
 		p.SetName(group.Name)
+		setIfNotEmpty(c.projectID, p.SetProjectid)
 		resp, err := c.cs.AffinityGroup.CreateAffinityGroup(p)
 		if err != nil {
 			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
@@ -88,30 +94,51 @@ func (c *client) GetOrCreateAffinityGroup(group *AffinityGroup) (retErr error) {
 	return nil
 }
 
-func (c *client) DeleteAffinityGroup(group *AffinityGroup) (retErr error) {
+func (c *client) DeleteAffinityGroup(ctx context.Context, group *AffinityGroup) (retErr error) {
+	c = c.withContext(ctx)
 	p := c.cs.AffinityGroup.NewDeleteAffinityGroupParams()
 	setIfNotEmpty(group.ID, p.SetId)
 	setIfNotEmpty(group.Name, p.SetName)
+	setIfNotEmpty(c.projectID, p.SetProjectid)
 	_, retErr = c.cs.AffinityGroup.DeleteAffinityGroup(p)
 	c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(retErr)
 	return retErr
 }
 
+// ReconcileAffinityGroupTags applies the additional tags of the cluster to the affinity group, removing the ones applied
+// before that were since removed from the cluster. Affinity groups are shared by the machines of a machine set or
+// control plane, so they only carry the tags of the cluster.
+func (c *client) ReconcileAffinityGroupTags(
+	ctx context.Context,
+	ag *infrav1.CloudStackAffinityGroup,
+	csCluster *infrav1.CloudStackCluster,
+) error {
+	tags := mergeTags(csCluster.Spec.AdditionalTags)
+	if tagsEqual(tags, ag.Status.AppliedTags) {
+		return nil
+	}
+	if err := c.ReconcileTags(ctx, ResourceTypeAffinityGroup, ag.Spec.ID, tags, ag.Status.AppliedTags); err != nil {
+		return err
+	}
+	ag.Status.AppliedTags = tags
+	return nil
+}
+
 type affinityGroups []AffinityGroup
 
-func (c *client) getCurrentAffinityGroups(csMachine *infrav1.CloudStackMachine) (affinityGroups, error) {
+func (c *client) getCurrentAffinityGroups(csMachine *infrav1.CloudStackMachine) (affinityGroups, string, error) {
 	// Start by fetching VM details which includes an array of currently associated affinity groups.
-	if virtM, count, err := c.cs.VirtualMachine.GetVirtualMachineByID(*csMachine.Spec.InstanceID); err != nil {
+	if virtM, count, err := c.cs.VirtualMachine.GetVirtualMachineByID(*csMachine.Spec.InstanceID, c.projectOpts()...); err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
-		return nil, err
+		return nil, "", err
 	} else if count > 1 {
-		return nil, errors.Errorf("found more than one VM for ID: %s", *csMachine.Spec.InstanceID)
+		return nil, "", errors.Errorf("found more than one VM for ID: %s", *csMachine.Spec.InstanceID)
 	} else {
 		groups := make([]AffinityGroup, 0, len(virtM.Affinitygroup))
 		for _, v := range virtM.Affinitygroup {
 			groups = append(groups, AffinityGroup{Name: v.Name, Type: v.Type, ID: v.Id})
 		}
-		return groups, nil
+		return groups, virtM.State, nil
 	}
 }
 
@@ -123,6 +150,22 @@ func (ags *affinityGroups) toArrayOfIDs() []string {
 	return groupIDs
 }
 
+func (ags *affinityGroups) equals(other affinityGroups) bool {
+	if len(*ags) != len(other) {
+		return false
+	}
+	groupIDs := map[string]bool{}
+	for _, group := range *ags {
+		groupIDs[group.ID] = true
+	}
+	for _, group := range other {
+		if !groupIDs[group.ID] {
+			return false
+		}
+	}
+	return true
+}
+
 func (ags *affinityGroups) addGroup(addGroup AffinityGroup) {
 	// This is essentially adding to a set followed by array conversion.
 	groupSet := map[string]AffinityGroup{addGroup.ID: addGroup}
@@ -148,41 +191,71 @@ func (ags *affinityGroups) removeGroup(removeGroup AffinityGroup) {
 	}
 }
 
-func (c *client) stopAndModifyAffinityGroups(csMachine *infrav1.CloudStackMachine, groups affinityGroups) (retErr error) {
-	agp := c.cs.AffinityGroup.NewUpdateVMAffinityGroupParams(*csMachine.Spec.InstanceID)
-	agp.SetAffinitygroupids(groups.toArrayOfIDs())
+// stopAndModifyAffinityGroups moves the VM into the given groups, which CloudStack only allows while the VM is stopped.
+// Each step is submitted as an async job without waiting for it. While a job is pending, ErrAsyncJobPending is returned
+// and calling again resumes from the VM's current state and groups.
+func (c *client) stopAndModifyAffinityGroups(
+	csMachine *infrav1.CloudStackMachine, current affinityGroups, state string, groups affinityGroups,
+) (retErr error) {
+	if !current.equals(groups) {
+		if state != "Stopped" {
+			p1 := c.csAsync.VirtualMachine.NewStopVirtualMachineParams(string(*csMachine.Spec.InstanceID))
+			resp, err := c.csAsync.VirtualMachine.StopVirtualMachine(p1)
+			if err != nil {
+				c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+				return err
+			} else if err := c.trackMachineJob(csMachine, infrav1.AsyncJobAffinityGroups, resp.JobID); err != nil {
+				return err
+			}
+		}
 
-	p1 := c.cs.VirtualMachine.NewStopVirtualMachineParams(string(*csMachine.Spec.InstanceID))
-	if _, err := c.cs.VirtualMachine.StopVirtualMachine(p1); err != nil {
-		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
-		return err
+		agp := c.csAsync.AffinityGroup.NewUpdateVMAffinityGroupParams(*csMachine.Spec.InstanceID)
+		agp.SetAffinitygroupids(groups.toArrayOfIDs())
+		resp, err := c.csAsync.AffinityGroup.UpdateVMAffinityGroup(agp)
+		if err != nil {
+			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+			return err
+		} else if err := c.trackMachineJob(csMachine, infrav1.AsyncJobAffinityGroups, resp.JobID); err != nil {
+			return err
+		}
+	} else if state != "Stopped" {
+		// Already in the desired groups and not left stopped by an earlier attempt.
+		return nil
 	}
 
-	if _, err := c.cs.AffinityGroup.UpdateVMAffinityGroup(agp); err != nil {
+	p2 := c.csAsync.VirtualMachine.NewStartVirtualMachineParams(string(*csMachine.Spec.InstanceID))
+	resp, err := c.csAsync.VirtualMachine.StartVirtualMachine(p2)
+	if err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 		return err
 	}
-
-	p2 := c.cs.VirtualMachine.NewStartVirtualMachineParams(string(*csMachine.Spec.InstanceID))
-	_, err := c.cs.VirtualMachine.StartVirtualMachine(p2)
-	c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
-	return err
+	return c.trackMachineJob(csMachine, infrav1.AsyncJobAffinityGroups, resp.JobID)
 }
 
-func (c *client) AssociateAffinityGroup(csMachine *infrav1.CloudStackMachine, group AffinityGroup) (retErr error) {
-	groups, err := c.getCurrentAffinityGroups(csMachine)
+func (c *client) AssociateAffinityGroup(ctx context.Context, csMachine *infrav1.CloudStackMachine, group AffinityGroup) (retErr error) {
+	c = c.withContext(ctx)
+	if err := c.pollMachineJob(csMachine, infrav1.AsyncJobAffinityGroups); err != nil {
+		return err
+	}
+	current, state, err := c.getCurrentAffinityGroups(csMachine)
 	if err != nil {
 		return err
 	}
+	groups := append(affinityGroups{}, current...)
 	groups.addGroup(group)
-	return c.stopAndModifyAffinityGroups(csMachine, groups)
+	return c.stopAndModifyAffinityGroups(csMachine, current, state, groups)
 }
 
-func (c *client) DisassociateAffinityGroup(csMachine *infrav1.CloudStackMachine, group AffinityGroup) (retErr error) {
-	groups, err := c.getCurrentAffinityGroups(csMachine)
+func (c *client) DisassociateAffinityGroup(ctx context.Context, csMachine *infrav1.CloudStackMachine, group AffinityGroup) (retErr error) {
+	c = c.withContext(ctx)
+	if err := c.pollMachineJob(csMachine, infrav1.AsyncJobAffinityGroups); err != nil {
+		return err
+	}
+	current, state, err := c.getCurrentAffinityGroups(csMachine)
 	if err != nil {
 		return err
 	}
+	groups := append(affinityGroups{}, current...)
 	groups.removeGroup(group)
-	return c.stopAndModifyAffinityGroups(csMachine, groups)
+	return c.stopAndModifyAffinityGroups(csMachine, current, state, groups)
 }
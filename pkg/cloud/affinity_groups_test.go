@@ -23,6 +23,7 @@ import (
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
 	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
 	dummies "sigs.k8s.io/cluster-api-provider-cloudstack/test/dummies/v1beta2"
 )
@@ -60,13 +61,13 @@ var _ = Describe("AffinityGroup Unit Tests", func() {
 			dummies.AffinityGroup.ID = "" // Force name fetching.
 			ags.EXPECT().GetAffinityGroupByName(dummies.AffinityGroup.Name).Return(&cloudstack.AffinityGroup{}, 1, nil)
 
-			Ω(client.GetOrCreateAffinityGroup(dummies.AffinityGroup)).Should(Succeed())
+			Ω(client.GetOrCreateAffinityGroup(ctx, dummies.AffinityGroup)).Should(Succeed())
 		})
 
 		It("fetches an affinity group by ID", func() {
 			ags.EXPECT().GetAffinityGroupByID(dummies.AffinityGroup.ID).Return(&cloudstack.AffinityGroup{}, 1, nil)
 
-			Ω(client.GetOrCreateAffinityGroup(dummies.AffinityGroup)).Should(Succeed())
+			Ω(client.GetOrCreateAffinityGroup(ctx, dummies.AffinityGroup)).Should(Succeed())
 		})
 
 		It("creates an affinity group", func() {
@@ -78,7 +79,7 @@ var _ = Describe("AffinityGroup Unit Tests", func() {
 			ags.EXPECT().CreateAffinityGroup(ParamMatch(And(NameEquals(dummies.AffinityGroup.Name)))).
 				Return(&cloudstack.CreateAffinityGroupResponse{}, nil)
 
-			Ω(client.GetOrCreateAffinityGroup(dummies.AffinityGroup)).Should(Succeed())
+			Ω(client.GetOrCreateAffinityGroup(ctx, dummies.AffinityGroup)).Should(Succeed())
 		})
 
 		It("creates an affinity group if Name provided returns more than one affinity group", func() {
@@ -88,7 +89,7 @@ var _ = Describe("AffinityGroup Unit Tests", func() {
 			ags.EXPECT().NewCreateAffinityGroupParams(gomock.Any(), gomock.Any()).Return(agp)
 			ags.EXPECT().CreateAffinityGroup(agp).Return(&cloudstack.CreateAffinityGroupResponse{}, nil)
 
-			Ω(client.GetOrCreateAffinityGroup(dummies.AffinityGroup)).Should(Succeed())
+			Ω(client.GetOrCreateAffinityGroup(ctx, dummies.AffinityGroup)).Should(Succeed())
 		})
 
 		It("creates an affinity group if getting affinity group by name fails", func() {
@@ -98,7 +99,7 @@ var _ = Describe("AffinityGroup Unit Tests", func() {
 			ags.EXPECT().NewCreateAffinityGroupParams(gomock.Any(), gomock.Any()).Return(agp)
 			ags.EXPECT().CreateAffinityGroup(agp).Return(&cloudstack.CreateAffinityGroupResponse{}, nil)
 
-			Ω(client.GetOrCreateAffinityGroup(dummies.AffinityGroup)).Should(Succeed())
+			Ω(client.GetOrCreateAffinityGroup(ctx, dummies.AffinityGroup)).Should(Succeed())
 		})
 
 		It("creates an affinity group if ID provided returns more than one affinity group", func() {
@@ -107,7 +108,7 @@ var _ = Describe("AffinityGroup Unit Tests", func() {
 			ags.EXPECT().NewCreateAffinityGroupParams(gomock.Any(), gomock.Any()).Return(agp)
 			ags.EXPECT().CreateAffinityGroup(agp).Return(&cloudstack.CreateAffinityGroupResponse{}, nil)
 
-			Ω(client.GetOrCreateAffinityGroup(dummies.AffinityGroup)).Should(Succeed())
+			Ω(client.GetOrCreateAffinityGroup(ctx, dummies.AffinityGroup)).Should(Succeed())
 		})
 
 		It("creates an affinity group if getting affinity group by ID fails", func() {
@@ -116,7 +117,7 @@ var _ = Describe("AffinityGroup Unit Tests", func() {
 			ags.EXPECT().NewCreateAffinityGroupParams(gomock.Any(), gomock.Any()).Return(agp)
 			ags.EXPECT().CreateAffinityGroup(agp).Return(&cloudstack.CreateAffinityGroupResponse{}, nil)
 
-			Ω(client.GetOrCreateAffinityGroup(dummies.AffinityGroup)).Should(Succeed())
+			Ω(client.GetOrCreateAffinityGroup(ctx, dummies.AffinityGroup)).Should(Succeed())
 		})
 	})
 
@@ -126,7 +127,7 @@ var _ = Describe("AffinityGroup Unit Tests", func() {
 			ags.EXPECT().NewDeleteAffinityGroupParams().Return(agp)
 			ags.EXPECT().DeleteAffinityGroup(agp).Return(&cloudstack.DeleteAffinityGroupResponse{}, nil)
 
-			Ω(client.DeleteAffinityGroup(dummies.AffinityGroup)).Should(Succeed())
+			Ω(client.DeleteAffinityGroup(ctx, dummies.AffinityGroup)).Should(Succeed())
 		})
 	})
 
@@ -138,15 +139,15 @@ var _ = Describe("AffinityGroup Unit Tests", func() {
 		})
 
 		It("Associates an affinity group.", func() {
-			Ω(client.ResolveZone(&dummies.CSFailureDomain1.Spec.Zone)).Should(Succeed())
+			Ω(client.ResolveZone(ctx, &dummies.CSFailureDomain1.Spec.Zone)).Should(Succeed())
 			dummies.CSMachine1.Spec.DiskOffering.Name = ""
 
 			Ω(client.GetOrCreateVMInstance(
-				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "",
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "",
 			)).Should(Succeed())
 
-			Ω(client.GetOrCreateAffinityGroup(dummies.AffinityGroup)).Should(Succeed())
-			Ω(client.AssociateAffinityGroup(dummies.CSMachine1, *dummies.AffinityGroup)).Should(Succeed())
+			Ω(client.GetOrCreateAffinityGroup(ctx, dummies.AffinityGroup)).Should(Succeed())
+			Ω(client.AssociateAffinityGroup(ctx, dummies.CSMachine1, *dummies.AffinityGroup)).Should(Succeed())
 
 			// Make the created VM go away quickly by force stopping it.
 			p := realCSClient.VirtualMachine.NewStopVirtualMachineParams(*dummies.CSMachine1.Spec.InstanceID)
@@ -156,8 +157,8 @@ var _ = Describe("AffinityGroup Unit Tests", func() {
 		})
 
 		It("Creates and deletes an affinity group.", func() {
-			Ω(client.DeleteAffinityGroup(dummies.AffinityGroup)).Should(Succeed())
-			Ω(client.FetchAffinityGroup(dummies.AffinityGroup)).ShouldNot(Succeed())
+			Ω(client.DeleteAffinityGroup(ctx, dummies.AffinityGroup)).Should(Succeed())
+			Ω(client.FetchAffinityGroup(ctx, dummies.AffinityGroup)).ShouldNot(Succeed())
 		})
 	})
 
@@ -171,19 +172,48 @@ var _ = Describe("AffinityGroup Unit Tests", func() {
 		ags.EXPECT().UpdateVMAffinityGroup(uagp).Return(&cloudstack.UpdateVMAffinityGroupResponse{}, nil)
 		vms.EXPECT().NewStartVirtualMachineParams(*dummies.CSMachine1.Spec.InstanceID).Return(vmp)
 		vms.EXPECT().StartVirtualMachine(vmp).Return(&cloudstack.StartVirtualMachineResponse{}, nil)
-		Ω(client.AssociateAffinityGroup(dummies.CSMachine1, *dummies.AffinityGroup)).Should(Succeed())
+		Ω(client.AssociateAffinityGroup(ctx, dummies.CSMachine1, *dummies.AffinityGroup)).Should(Succeed())
 	})
 
 	It("Disassociate affinity group", func() {
 		uagp := &cloudstack.UpdateVMAffinityGroupParams{}
 		vmp := &cloudstack.StartVirtualMachineParams{}
-		vms.EXPECT().GetVirtualMachineByID(*dummies.CSMachine1.Spec.InstanceID).Return(&cloudstack.VirtualMachine{}, 1, nil)
+		vms.EXPECT().GetVirtualMachineByID(*dummies.CSMachine1.Spec.InstanceID).Return(&cloudstack.VirtualMachine{
+			Affinitygroup: []cloudstack.VirtualMachineAffinitygroup{{Id: dummies.AffinityGroup.ID}},
+		}, 1, nil)
 		ags.EXPECT().NewUpdateVMAffinityGroupParams(*dummies.CSMachine1.Spec.InstanceID).Return(uagp)
 		vms.EXPECT().NewStopVirtualMachineParams(*dummies.CSMachine1.Spec.InstanceID).Return(&cloudstack.StopVirtualMachineParams{})
 		vms.EXPECT().StopVirtualMachine(&cloudstack.StopVirtualMachineParams{}).Return(&cloudstack.StopVirtualMachineResponse{State: "Stopping"}, nil)
 		ags.EXPECT().UpdateVMAffinityGroup(uagp).Return(&cloudstack.UpdateVMAffinityGroupResponse{}, nil)
 		vms.EXPECT().NewStartVirtualMachineParams(*dummies.CSMachine1.Spec.InstanceID).Return(vmp)
 		vms.EXPECT().StartVirtualMachine(vmp).Return(&cloudstack.StartVirtualMachineResponse{}, nil)
-		Ω(client.DisassociateAffinityGroup(dummies.CSMachine1, *dummies.AffinityGroup)).Should(Succeed())
+		Ω(client.DisassociateAffinityGroup(ctx, dummies.CSMachine1, *dummies.AffinityGroup)).Should(Succeed())
+	})
+
+	It("Returns a pending error while the VM is being stopped and resumes afterwards", func() {
+		ajs := mockClient.Asyncjob.(*cloudstack.MockAsyncjobServiceIface)
+		uagp := &cloudstack.UpdateVMAffinityGroupParams{}
+		vmp := &cloudstack.StartVirtualMachineParams{}
+		qp := &cloudstack.QueryAsyncJobResultParams{}
+		vms.EXPECT().GetVirtualMachineByID(*dummies.CSMachine1.Spec.InstanceID).Return(&cloudstack.VirtualMachine{State: "Running"}, 1, nil)
+		vms.EXPECT().NewStopVirtualMachineParams(*dummies.CSMachine1.Spec.InstanceID).Return(&cloudstack.StopVirtualMachineParams{})
+		vms.EXPECT().StopVirtualMachine(&cloudstack.StopVirtualMachineParams{}).Return(&cloudstack.StopVirtualMachineResponse{JobID: "stop-job"}, nil)
+		ajs.EXPECT().NewQueryAsyncJobResultParams("stop-job").Return(qp).Times(2)
+		gomock.InOrder(
+			ajs.EXPECT().QueryAsyncJobResult(qp).Return(&cloudstack.QueryAsyncJobResultResponse{Jobstatus: 0}, nil),
+			ajs.EXPECT().QueryAsyncJobResult(qp).Return(&cloudstack.QueryAsyncJobResultResponse{Jobstatus: 1}, nil))
+
+		Ω(client.AssociateAffinityGroup(ctx, dummies.CSMachine1, *dummies.AffinityGroup)).Should(MatchError(cloud.ErrAsyncJobPending))
+		Ω(dummies.CSMachine1.Status.AsyncJobID).Should(Equal("stop-job"))
+		Ω(dummies.CSMachine1.Status.AsyncJobKind).Should(Equal(infrav1.AsyncJobAffinityGroups))
+
+		vms.EXPECT().GetVirtualMachineByID(*dummies.CSMachine1.Spec.InstanceID).Return(&cloudstack.VirtualMachine{State: "Stopped"}, 1, nil)
+		ags.EXPECT().NewUpdateVMAffinityGroupParams(*dummies.CSMachine1.Spec.InstanceID).Return(uagp)
+		ags.EXPECT().UpdateVMAffinityGroup(uagp).Return(&cloudstack.UpdateVMAffinityGroupResponse{}, nil)
+		vms.EXPECT().NewStartVirtualMachineParams(*dummies.CSMachine1.Spec.InstanceID).Return(vmp)
+		vms.EXPECT().StartVirtualMachine(vmp).Return(&cloudstack.StartVirtualMachineResponse{}, nil)
+
+		Ω(client.AssociateAffinityGroup(ctx, dummies.CSMachine1, *dummies.AffinityGroup)).Should(Succeed())
+		Ω(dummies.CSMachine1.Status.AsyncJobID).Should(BeEmpty())
 	})
 })
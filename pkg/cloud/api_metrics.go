@@ -0,0 +1,82 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/metrics"
+)
+
+// Outcomes an ACS API request is labelled with in the API request metrics.
+const (
+	APIOutcomeSuccess        = "success"
+	APIOutcomeAPIError       = "api_error"
+	APIOutcomeTransportError = "transport_error"
+)
+
+const unknownAPICommand = "unknown"
+
+// instrumentedTransport is an http.RoundTripper that records the latency and outcome of every ACS API request.
+type instrumentedTransport struct {
+	endpoint      string
+	customMetrics metrics.ACSCustomMetrics
+	next          http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	command := apiCommand(req)
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	outcome := APIOutcomeSuccess
+	if err != nil {
+		outcome = APIOutcomeTransportError
+	} else if resp.StatusCode != http.StatusOK {
+		outcome = APIOutcomeAPIError
+	}
+	t.customMetrics.ObserveAcsAPIRequest(command, t.endpoint, outcome, time.Since(start))
+	return resp, err
+}
+
+// apiCommand returns the ACS API command of a request. CloudStack-Go passes it in the query string, or in the form
+// body for requests sent as POST.
+func apiCommand(req *http.Request) string {
+	if command := req.URL.Query().Get("command"); command != "" {
+		return command
+	}
+	if req.GetBody == nil {
+		return unknownAPICommand
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return unknownAPICommand
+	}
+	defer body.Close()
+	form, err := io.ReadAll(body)
+	if err != nil {
+		return unknownAPICommand
+	}
+	values, err := url.ParseQuery(string(form))
+	if err != nil || values.Get("command") == "" {
+		return unknownAPICommand
+	}
+	return values.Get("command")
+}
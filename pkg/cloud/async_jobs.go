@@ -0,0 +1,92 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"encoding/json"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	"github.com/pkg/errors"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+)
+
+// CloudStack async job statuses as reported by queryAsyncJobResult.
+const (
+	asyncJobPending   = 0
+	asyncJobSucceeded = 1
+)
+
+// ErrAsyncJobPending is returned when an operation was submitted as a CloudStack async job that has not completed yet.
+// The job ID and kind are kept in the CloudStackMachine status, and calling the operation again polls the job.
+var ErrAsyncJobPending = errors.New("CloudStack async job pending")
+
+// pollMachineJob queries the async job of the given kind recorded on csMachine, if any. It returns ErrAsyncJobPending
+// while the job is running, and the job's error if it failed. The job ID is cleared once the job completes. Jobs of
+// other kinds are left to the operations that submitted them, except those recorded before jobs had a kind.
+func (c *client) pollMachineJob(csMachine *infrav1.CloudStackMachine, kind infrav1.AsyncJobKind) error {
+	if !hasMachineJob(csMachine, kind) {
+		return nil
+	}
+	jobID := csMachine.Status.AsyncJobID
+
+	resp, err := c.csAsync.Asyncjob.QueryAsyncJobResult(c.csAsync.Asyncjob.NewQueryAsyncJobResultParams(jobID))
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return errors.Wrapf(err, "querying async job %s", jobID)
+	}
+	switch resp.Jobstatus {
+	case asyncJobPending:
+		return ErrAsyncJobPending
+	case asyncJobSucceeded:
+		csMachine.Status.AsyncJobID, csMachine.Status.AsyncJobKind = "", ""
+		return nil
+	}
+	csMachine.Status.AsyncJobID, csMachine.Status.AsyncJobKind = "", ""
+	err = asyncJobError(resp)
+	c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+	return err
+}
+
+// hasMachineJob reports whether a job of the given kind is recorded on csMachine. Jobs recorded before jobs had a
+// kind are of any kind.
+func hasMachineJob(csMachine *infrav1.CloudStackMachine, kind infrav1.AsyncJobKind) bool {
+	return csMachine.Status.AsyncJobID != "" &&
+		(csMachine.Status.AsyncJobKind == "" || csMachine.Status.AsyncJobKind == kind)
+}
+
+// trackMachineJob records a job of the given kind submitted for csMachine and polls it once, so jobs that finish
+// quickly don't take another reconciliation. An empty job ID means the operation already completed.
+func (c *client) trackMachineJob(csMachine *infrav1.CloudStackMachine, kind infrav1.AsyncJobKind, jobID string) error {
+	if jobID == "" {
+		return nil
+	}
+	csMachine.Status.AsyncJobID, csMachine.Status.AsyncJobKind = jobID, kind
+	return c.pollMachineJob(csMachine, kind)
+}
+
+// asyncJobError converts the result of a failed async job into an APIError formatted like CloudStack-Go's API errors.
+func asyncJobError(resp *cloudstack.QueryAsyncJobResultResponse) error {
+	var csErr cloudstack.CSError
+	if err := json.Unmarshal(resp.Jobresult, &csErr); err == nil && csErr.ErrorText != "" {
+		if csErr.ErrorCode == 0 {
+			csErr.ErrorCode = resp.Jobresultcode
+		}
+		return NewAPIError(csErr.Error())
+	}
+	return NewAPIError(errors.Errorf("async job %s (%s) failed: %s", resp.JobID, resp.Cmd, string(resp.Jobresult)))
+}
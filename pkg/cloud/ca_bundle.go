@@ -0,0 +1,65 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// loadCABundle returns the PEM encoded certificates the endpoint's certificate is verified against, if any. The
+// ca-bundle of the config takes precedence over its ca-file.
+func (conf Config) loadCABundle() ([]byte, error) {
+	switch {
+	case conf.CABundle != "":
+		return []byte(conf.CABundle), nil
+	case conf.CAFile != "":
+		bundle, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading CA file %s", conf.CAFile)
+		}
+		return bundle, nil
+	}
+	return nil, nil
+}
+
+// newCertPool returns a pool of the certificates in caBundle, or nil to use the system roots when caBundle is empty.
+func newCertPool(caBundle []byte) (*x509.CertPool, error) {
+	if len(caBundle) == 0 {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caBundle) {
+		return nil, errors.New("no PEM encoded certificates found in CA bundle")
+	}
+	return pool, nil
+}
+
+// caBundleCacheKey returns the part of a client cache key derived from a CA bundle, so clients trusting different
+// bundles are cached separately. Bundles read from a ca-file aren't covered by the secret or config the key is
+// otherwise generated from.
+func caBundleCacheKey(caBundle []byte) string {
+	if len(caBundle) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(caBundle)
+	return "-ca-" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CircuitState is the state of an ACS endpoint's circuit breaker.
+type CircuitState string
+
+const (
+	// CircuitClosed means requests are sent to the endpoint.
+	CircuitClosed CircuitState = "Closed"
+	// CircuitOpen means the endpoint failed repeatedly, and requests are refused without being sent.
+	CircuitOpen CircuitState = "Open"
+	// CircuitHalfOpen means the breaker was open long enough, and a single request is let through to probe the
+	// endpoint. The breaker closes if it succeeds, and opens again otherwise.
+	CircuitHalfOpen CircuitState = "HalfOpen"
+)
+
+// ErrCircuitOpen is returned for requests refused because the circuit breaker of their endpoint is open.
+var ErrCircuitOpen = errors.New("ACS endpoint circuit breaker is open")
+
+// CircuitBreakerConfig holds when an ACS endpoint's circuit breaker opens: after FailureThreshold consecutive failed
+// requests, for OpenDuration.
+type CircuitBreakerConfig struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
+}
+
+// GetCircuitBreakerConfig returns the circuit breaker settings from the passed config map. Missing or invalid values
+// fall back to their defaults.
+func GetCircuitBreakerConfig(clientConfig *corev1.ConfigMap) CircuitBreakerConfig {
+	config := CircuitBreakerConfig{
+		FailureThreshold: DefaultCircuitBreakerFailureThreshold,
+		OpenDuration:     DefaultCircuitBreakerOpenDuration,
+	}
+	if clientConfig == nil {
+		return config
+	}
+	if threshold, err := strconv.Atoi(clientConfig.Data[CircuitBreakerFailureThresholdKey]); err == nil && threshold > 0 {
+		config.FailureThreshold = threshold
+	}
+	if d, err := time.ParseDuration(clientConfig.Data[CircuitBreakerOpenDurationKey]); err == nil && d > 0 {
+		config.OpenDuration = d
+	}
+	return config
+}
+
+// EndpointHealth is the state of an ACS endpoint as seen by its circuit breaker.
+type EndpointHealth struct {
+	State CircuitState
+	// LastError describes the last failed request, when the breaker isn't closed.
+	LastError string
+	// RetryAfter is how long an open breaker keeps refusing requests.
+	RetryAfter time.Duration
+}
+
+// endpointBreaker is the circuit breaker of one ACS endpoint. Like the endpoint's throttle, it is shared by every
+// client talking to that endpoint.
+type endpointBreaker struct {
+	endpoint string
+
+	mu        sync.Mutex
+	config    CircuitBreakerConfig
+	state     CircuitState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastError string
+}
+
+var endpointBreakers = map[string]*endpointBreaker{}
+var endpointBreakersMutex sync.Mutex
+
+// getEndpointBreaker returns the circuit breaker shared by all clients of the endpoint serving apiURL. Its settings
+// are updated from clientConfig when it is passed.
+func getEndpointBreaker(apiURL string, clientConfig *corev1.ConfigMap) *endpointBreaker {
+	endpointBreakersMutex.Lock()
+	defer endpointBreakersMutex.Unlock()
+
+	endpoint := endpointName(apiURL)
+	b, exists := endpointBreakers[endpoint]
+	if !exists {
+		b = &endpointBreaker{endpoint: endpoint, state: CircuitClosed, config: GetCircuitBreakerConfig(clientConfig)}
+		endpointBreakers[endpoint] = b
+	} else if clientConfig != nil {
+		b.mu.Lock()
+		b.config = GetCircuitBreakerConfig(clientConfig)
+		b.mu.Unlock()
+	}
+	return b
+}
+
+// health returns the current state of the breaker.
+func (b *endpointBreaker) health() EndpointHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.state == CircuitClosed:
+		return EndpointHealth{State: CircuitClosed}
+	case b.state == CircuitOpen && time.Since(b.openedAt) < b.config.OpenDuration:
+		return EndpointHealth{
+			State:      CircuitOpen,
+			LastError:  b.lastError,
+			RetryAfter: b.config.OpenDuration - time.Since(b.openedAt),
+		}
+	}
+	return EndpointHealth{State: CircuitHalfOpen, LastError: b.lastError}
+}
+
+// allow returns ErrCircuitOpen if a request may not be sent to the endpoint. Once the breaker was open long enough, a
+// single request is allowed at a time until one goes through.
+func (b *endpointBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitClosed:
+		return nil
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.config.OpenDuration {
+			return errors.Wrapf(ErrCircuitOpen, "refusing request to %s after %s", b.endpoint, b.lastError)
+		}
+		b.state = CircuitHalfOpen
+	}
+	if b.probing {
+		return errors.Wrapf(ErrCircuitOpen, "probing %s after %s", b.endpoint, b.lastError)
+	}
+	b.probing = true
+	return nil
+}
+
+// record updates the breaker with the outcome of a request. A nil failure means the endpoint answered.
+func (b *endpointBreaker) record(failure error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if failure == nil {
+		b.state, b.failures, b.lastError = CircuitClosed, 0, ""
+		return
+	}
+
+	b.failures++
+	b.lastError = failure.Error()
+	if b.state == CircuitHalfOpen || b.failures >= b.config.FailureThreshold {
+		b.state, b.openedAt = CircuitOpen, time.Now()
+	}
+}
+
+// release ends a request that says nothing about the endpoint, so another one can probe it.
+func (b *endpointBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// breakerTransport is an http.RoundTripper that refuses requests while the endpoint's circuit breaker is open, and
+// feeds the breaker with the outcome of the requests it sends.
+type breakerTransport struct {
+	breaker *endpointBreaker
+	next    http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if errors.Is(req.Context().Err(), context.Canceled) {
+		// Requests cancelled by their caller say nothing about the endpoint.
+		t.breaker.release()
+	} else {
+		t.breaker.record(endpointFailure(resp, err))
+	}
+	return resp, err
+}
+
+// endpointFailure returns an error if a request failed because the endpoint is down, unreachable or too slow to
+// answer. API errors mean the endpoint is up.
+func endpointFailure(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return errors.Errorf("HTTP status %s", resp.Status)
+	}
+	return nil
+}
@@ -18,9 +18,18 @@ package cloud
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -44,7 +53,10 @@ type Client interface {
 	ZoneIFace
 	IsoNetworkIface
 	UserCredIFace
-	NewClientInDomainAndAccount(string, string) (Client, error)
+	ProjectIface
+	TemplateIface
+	NewClientInDomainAndAccount(context.Context, string, string) (Client, error)
+	EndpointHealth() EndpointHealth
 }
 
 // cloud-config ini structure.
@@ -53,13 +65,48 @@ type Config struct {
 	APIKey    string `yaml:"api-key"`
 	SecretKey string `yaml:"secret-key"`
 	VerifySSL string `yaml:"verify-ssl"`
+	// CAFile is the path of a PEM encoded bundle of the certificates the endpoint's certificate is verified against.
+	CAFile string `yaml:"ca-file"`
+	// CABundle is a PEM encoded bundle of the certificates the endpoint's certificate is verified against. It takes
+	// precedence over CAFile.
+	CABundle string `yaml:"ca-bundle"`
+	// HTTPProxy is the URL of the proxy requests to the endpoint go through. The proxy is taken from the environment
+	// when unset.
+	HTTPProxy string `yaml:"http-proxy"`
+	// NoProxy is a comma separated list of hosts, domains and CIDRs reached without going through HTTPProxy.
+	NoProxy string `yaml:"no-proxy"`
 }
 
 type client struct {
 	cs            *cloudstack.CloudStackClient
 	csAsync       *cloudstack.CloudStackClient
 	config        Config
+	clientConfig  *corev1.ConfigMap
+	transport     transportOptions
 	customMetrics metrics.ACSCustomMetrics
+	breaker       *endpointBreaker
+	// projectID is the ID of the project the client's resources are created and looked up in, if any.
+	projectID string
+
+	// ctx is the context the requests of cs and csAsync are sent with.
+	ctx context.Context
+	// newCSClients creates CloudStack-Go clients sending their requests with ctx. It is nil for clients wrapping a
+	// passed CloudStack-Go client.
+	newCSClients func(ctx context.Context) (cs *cloudstack.CloudStackClient, csAsync *cloudstack.CloudStackClient)
+	accounts     *accountClients
+}
+
+// accountClients holds the clients created by NewClientInDomainAndAccount and NewClientInProject, by domain and
+// account or by project.
+type accountClients struct {
+	mu      sync.Mutex
+	clients map[string]*client
+}
+
+// transportOptions holds the endpoint specific settings of a client's HTTP transport.
+type transportOptions struct {
+	rootCAs *x509.CertPool
+	proxy   func(*http.Request) (*url.URL, error)
 }
 
 type SecretConfig struct {
@@ -73,10 +120,36 @@ type SecretConfig struct {
 var clientCache *ttlcache.Cache
 var cacheMutex sync.Mutex
 
+// secretClientCacheKeys maps endpoint secrets, by namespace/name, to the cache key of their current client. Entries are
+// dropped by EvictSecretClient when the secret changes or is deleted.
+var secretClientCacheKeys = map[string]string{}
+
 const ClientConfigMapName = "capc-client-config"
 const ClientConfigMapNamespace = "capc-system"
 const ClientCacheTTLKey = "client-cache-ttl"
 const DefaultClientCacheTTL = time.Duration(1 * time.Hour)
+const APIRateLimitQPSKey = "api-rate-limit-qps"
+const APIRateLimitBurstKey = "api-rate-limit-burst"
+const APIMaxConcurrentRequestsKey = "api-max-concurrent-requests"
+const DefaultAPIRateLimitQPS = 10.0
+const DefaultAPIRateLimitBurst = 20
+const DefaultAPIMaxConcurrentRequests = 10
+const APITimeoutReadKey = "api-timeout-read"
+const APITimeoutWriteKey = "api-timeout-write"
+const APITimeoutAsyncJobKey = "api-timeout-async-job"
+const DefaultAPITimeoutRead = time.Duration(60 * time.Second)
+const DefaultAPITimeoutWrite = time.Duration(60 * time.Second)
+const DefaultAPITimeoutAsyncJob = time.Duration(5 * time.Minute)
+const APIRetryMaxRetriesKey = "api-retry-max-retries"
+const APIRetryInitialBackoffKey = "api-retry-initial-backoff"
+const APIRetryMaxBackoffKey = "api-retry-max-backoff"
+const DefaultAPIRetryMaxRetries = 3
+const DefaultAPIRetryInitialBackoff = time.Duration(500 * time.Millisecond)
+const DefaultAPIRetryMaxBackoff = time.Duration(8 * time.Second)
+const CircuitBreakerFailureThresholdKey = "circuit-breaker-failure-threshold"
+const CircuitBreakerOpenDurationKey = "circuit-breaker-open-duration"
+const DefaultCircuitBreakerFailureThreshold = 5
+const DefaultCircuitBreakerOpenDuration = time.Duration(30 * time.Second)
 
 // UnmarshalAllSecretConfigs parses a yaml document for each secret.
 func UnmarshalAllSecretConfigs(in []byte, out *[]SecretConfig) error {
@@ -96,7 +169,8 @@ func UnmarshalAllSecretConfigs(in []byte, out *[]SecretConfig) error {
 	return nil
 }
 
-// NewClientFromK8sSecret returns a client from a k8s secret
+// NewClientFromK8sSecret returns a client from a k8s secret. The client is cached by the secret's content and
+// resourceVersion, and clients built from a previous version of the secret are dropped from the cache.
 func NewClientFromK8sSecret(endpointSecret *corev1.Secret, clientConfig *corev1.ConfigMap) (Client, error) {
 	endpointSecretStrings := map[string]string{}
 	for k, v := range endpointSecret.Data {
@@ -106,21 +180,48 @@ func NewClientFromK8sSecret(endpointSecret *corev1.Secret, clientConfig *corev1.
 	if err != nil {
 		return nil, err
 	}
-	return NewClientFromBytesConfig(bytes, clientConfig)
+	config, err := unmarshalConfig(bytes)
+	if err != nil {
+		return nil, err
+	}
+	secretName := endpointSecret.Namespace + "/" + endpointSecret.Name
+	return newCachedClient(config, clientConfig, generateSecretCacheKey(endpointSecret), secretName)
+}
+
+// EvictSecretClient drops the client cached for an endpoint secret, so a rotated secret takes effect on the next call
+// instead of on the next NewClientFromK8sSecret with its new version, and the client of a deleted secret doesn't
+// outlive it.
+func EvictSecretClient(namespace, name string) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	secretName := namespace + "/" + name
+	if key, exists := secretClientCacheKeys[secretName]; exists {
+		if clientCache != nil {
+			clientCache.Remove(key)
+		}
+		delete(secretClientCacheKeys, secretName)
+	}
 }
 
 // NewClientFromBytesConfig returns a client from a bytes array that unmarshals to a yaml config.
 func NewClientFromBytesConfig(conf []byte, clientConfig *corev1.ConfigMap) (Client, error) {
-	r := bytes.NewReader(conf)
-	dec := yaml.NewDecoder(r)
-	var config Config
-	if err := dec.Decode(&config); err != nil {
+	config, err := unmarshalConfig(conf)
+	if err != nil {
 		return nil, err
 	}
-
 	return NewClientFromConf(config, clientConfig)
 }
 
+// unmarshalConfig decodes a yaml config.
+func unmarshalConfig(conf []byte) (Config, error) {
+	r := bytes.NewReader(conf)
+	dec := yaml.NewDecoder(r)
+	var config Config
+	err := dec.Decode(&config)
+	return config, err
+}
+
 // NewClientFromYamlPath returns a client from a yaml config at path.
 func NewClientFromYamlPath(confPath string, secretName string) (Client, error) {
 	content, err := os.ReadFile(confPath)
@@ -147,6 +248,13 @@ func NewClientFromYamlPath(confPath string, secretName string) (Client, error) {
 
 // NewClientFromConf creates a new Cloud Client form a map of strings to strings.
 func NewClientFromConf(conf Config, clientConfig *corev1.ConfigMap) (Client, error) {
+	return newCachedClient(conf, clientConfig, generateClientCacheKey(conf), "")
+}
+
+// newCachedClient returns the client cached under clientCacheKey, creating it if missing. When secretName is set, the
+// client previously cached for that secret under another key is dropped. Clients evict themselves from the cache when
+// CloudStack rejects their credentials, so the next call picks up fresh ones.
+func newCachedClient(conf Config, clientConfig *corev1.ConfigMap, clientCacheKey string, secretName string) (Client, error) {
 	cacheMutex.Lock()
 	defer cacheMutex.Unlock()
 
@@ -154,54 +262,213 @@ func NewClientFromConf(conf Config, clientConfig *corev1.ConfigMap) (Client, err
 		clientCache = newClientCache(clientConfig)
 	}
 
-	clientCacheKey := generateClientCacheKey(conf)
+	caBundle, err := conf.loadCABundle()
+	if err != nil {
+		return nil, err
+	}
+	options := transportOptions{}
+	if options.rootCAs, err = newCertPool(caBundle); err != nil {
+		return nil, err
+	}
+	if options.proxy, err = conf.proxyFunc(); err != nil {
+		return nil, err
+	}
+	clientCacheKey += caBundleCacheKey(caBundle)
+
+	if secretName != "" {
+		if previousKey, exists := secretClientCacheKeys[secretName]; exists && previousKey != clientCacheKey {
+			clientCache.Remove(previousKey)
+		}
+		secretClientCacheKeys[secretName] = clientCacheKey
+	}
+
 	if client, exists := clientCache.Get(clientCacheKey); exists {
+		if clientConfig != nil {
+			// Pick up any change to the endpoint's throttling settings.
+			getEndpointThrottle(conf.APIUrl, clientConfig)
+		}
 		return client.(Client), nil
 	}
 
+	c := newClient(conf, clientConfig, options, func() { clientCache.Remove(clientCacheKey) })
+	clientCache.Set(clientCacheKey, c)
+
+	return c, nil
+}
+
+// newClient creates a client from conf, reaching the endpoint with the passed transport options. onAuthFailure is
+// called whenever CloudStack rejects the client's credentials.
+func newClient(conf Config, clientConfig *corev1.ConfigMap, options transportOptions, onAuthFailure func()) *client {
 	verifySSL := true
 	if conf.VerifySSL == "false" {
 		verifySSL = false
 	}
+	timeouts := GetAPITimeoutConfig(clientConfig)
+
+	// Requests from all clients of an endpoint share the same rate limiter, concurrency cap and circuit breaker. Each
+	// attempt of a retried request goes through them.
+	throttle := getEndpointThrottle(conf.APIUrl, clientConfig)
+	breaker := getEndpointBreaker(conf.APIUrl, clientConfig)
+	transport := &retryTransport{
+		endpoint:      throttle.endpoint,
+		config:        GetAPIRetryConfig(clientConfig),
+		customMetrics: metrics.NewCustomMetrics(),
+		next:          newTransport(verifySSL, options, throttle, breaker, onAuthFailure),
+	}
 
-	// The client returned from NewAsyncClient works in a synchronous way. On the other hand,
-	// a client returned from NewClient works in an asynchronous way. Dive into the constructor definition
-	// comments for more details
-	c := &client{config: conf}
-	c.cs = cloudstack.NewAsyncClient(conf.APIUrl, conf.APIKey, conf.SecretKey, verifySSL)
-	c.csAsync = cloudstack.NewClient(conf.APIUrl, conf.APIKey, conf.SecretKey, verifySSL)
-	c.customMetrics = metrics.NewCustomMetrics()
-	clientCache.Set(clientCacheKey, c)
+	c := &client{config: conf, clientConfig: clientConfig, transport: options, customMetrics: metrics.NewCustomMetrics()}
+	c.breaker = breaker
+	c.accounts = &accountClients{}
+	c.newCSClients = func(ctx context.Context) (*cloudstack.CloudStackClient, *cloudstack.CloudStackClient) {
+		httpClient := &http.Client{Transport: &contextTransport{ctx: ctx, timeouts: timeouts, next: transport}}
+
+		// The client returned from NewAsyncClient works in a synchronous way. On the other hand,
+		// a client returned from NewClient works in an asynchronous way. Dive into the constructor definition
+		// comments for more details
+		cs := cloudstack.NewAsyncClient(conf.APIUrl, conf.APIKey, conf.SecretKey, verifySSL,
+			cloudstack.WithHTTPClient(httpClient), cloudstack.WithAsyncTimeout(int64(timeouts.AsyncJob.Seconds())))
+		csAsync := cloudstack.NewClient(conf.APIUrl, conf.APIKey, conf.SecretKey, verifySSL,
+			cloudstack.WithHTTPClient(httpClient))
+		return cs, csAsync
+	}
+	c.ctx = context.Background()
+	c.cs, c.csAsync = c.newCSClients(c.ctx)
+	return c
+}
 
-	return c, nil
+// withContext returns a copy of c whose requests are sent with ctx, so they are cancelled along with it.
+func (c *client) withContext(ctx context.Context) *client {
+	if c.newCSClients == nil || ctx == nil || ctx == c.ctx {
+		return c
+	}
+	withCtx := *c
+	withCtx.ctx = ctx
+	withCtx.cs, withCtx.csAsync = c.newCSClients(ctx)
+	return &withCtx
 }
 
-// NewClientInDomainAndAccount returns a new client in the specified domain and account.
-func (c *client) NewClientInDomainAndAccount(domain string, account string) (Client, error) {
+// NewClientInDomainAndAccount returns a client in the specified domain and account. The client is kept with c, so it is
+// dropped along with c, and is evicted when CloudStack rejects the user's keys so they get fetched again.
+func (c *client) NewClientInDomainAndAccount(ctx context.Context, domain string, account string) (Client, error) {
+	accountKey := domain + "/" + account
+	c.accounts.mu.Lock()
+	defer c.accounts.mu.Unlock()
+	if accountClient, exists := c.accounts.clients[accountKey]; exists {
+		return accountClient, nil
+	}
+
 	user := &User{}
 	user.Account.Domain.Path = domain
 	user.Account.Name = account
-	if found, err := c.GetUserWithKeys(user); err != nil {
+	if found, err := c.GetUserWithKeys(ctx, user); err != nil {
 		return nil, err
 	} else if !found {
 		return nil, errors.Errorf(
 			"could not find sufficient user (with API keys) in domain/account %s/%s", domain, account)
 	}
-	c.config.APIKey = user.APIKey
-	c.config.SecretKey = user.SecretKey
+	conf := c.config
+	conf.APIKey = user.APIKey
+	conf.SecretKey = user.SecretKey
+
+	accountClient := newClient(conf, c.clientConfig, c.transport, func() { c.accounts.remove(accountKey) })
+	if c.accounts.clients == nil {
+		c.accounts.clients = map[string]*client{}
+	}
+	c.accounts.clients[accountKey] = accountClient
+	return accountClient, nil
+}
 
-	return NewClientFromConf(c.config, nil)
+// remove drops the client of a domain and account.
+func (a *accountClients) remove(accountKey string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.clients, accountKey)
+}
+
+// EndpointHealth returns the state of the circuit breaker of the client's ACS endpoint.
+func (c *client) EndpointHealth() EndpointHealth {
+	if c.breaker == nil {
+		return EndpointHealth{State: CircuitClosed}
+	}
+	return c.breaker.health()
 }
 
 // NewClientFromCSAPIClient creates a client from a CloudStack-Go API client. Mostly used for testing.
 func NewClientFromCSAPIClient(cs *cloudstack.CloudStackClient) Client {
-	c := &client{cs: cs, csAsync: cs, customMetrics: metrics.NewCustomMetrics()}
+	c := &client{cs: cs, csAsync: cs, customMetrics: metrics.NewCustomMetrics(), accounts: &accountClients{}}
 	return c
 }
 
-// generateClientCacheKey generates a cache key from a Config
+// newTransport returns an HTTP transport equivalent to the CloudStack-Go default whose requests pass through throttle
+// and breaker, and are recorded in the API request metrics. Certificates are verified against the root CAs of options
+// when set, and the system roots otherwise. Requests go through the proxy of options. onAuthFailure is called for
+// requests rejected because of the credentials used.
+func newTransport(
+	verifySSL bool,
+	options transportOptions,
+	throttle *endpointThrottle,
+	breaker *endpointBreaker,
+	onAuthFailure func(),
+) http.RoundTripper {
+	transport := &http.Transport{
+		Proxy: options.proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: !verifySSL, RootCAs: options.rootCAs}, // #nosec G402 -- verify-ssl is user configured.
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &throttledTransport{
+		throttle: throttle,
+		next: &breakerTransport{
+			breaker: breaker,
+			next: &instrumentedTransport{
+				endpoint:      throttle.endpoint,
+				customMetrics: metrics.NewCustomMetrics(),
+				next:          &authFailureTransport{onAuthFailure: onAuthFailure, next: transport},
+			},
+		},
+	}
+}
+
+// authFailureTransport is an http.RoundTripper that reports requests CloudStack rejected because of their credentials.
+type authFailureTransport struct {
+	onAuthFailure func()
+	next          http.RoundTripper
+}
+
+func (t *authFailureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && isAuthFailureStatus(resp.StatusCode) && t.onAuthFailure != nil {
+		t.onAuthFailure()
+	}
+	return resp, err
+}
+
+// generateClientCacheKey generates a cache key from a hash of a Config, so the key doesn't hold the credentials.
 func generateClientCacheKey(conf Config) string {
-	return fmt.Sprintf("%+v", conf)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%+v", conf)))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateSecretCacheKey generates a cache key from a hash of an endpoint secret's content and its resourceVersion.
+func generateSecretCacheKey(secret *corev1.Secret) string {
+	keys := make([]string, 0, len(secret.Data))
+	for k := range secret.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s/%s@%s\n", secret.Namespace, secret.Name, secret.ResourceVersion)
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%x\n", k, secret.Data[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 // newClientCache returns a new instance of client cache
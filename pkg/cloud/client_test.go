@@ -17,14 +17,35 @@ limitations under the License.
 package cloud_test
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	crtlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
 	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/test/fakeacs"
 	"sigs.k8s.io/cluster-api-provider-cloudstack/test/helpers"
 )
 
@@ -98,6 +119,112 @@ var _ = Describe("Client", func() {
 		})
 	})
 
+	Context("GetAPIThrottleConfig", func() {
+		defaults := cloud.APIThrottleConfig{
+			QPS:                   cloud.DefaultAPIRateLimitQPS,
+			Burst:                 cloud.DefaultAPIRateLimitBurst,
+			MaxConcurrentRequests: cloud.DefaultAPIMaxConcurrentRequests,
+		}
+
+		It("Returns the defaults when a nil is passed", func() {
+			Ω(cloud.GetAPIThrottleConfig(nil)).Should(Equal(defaults))
+		})
+
+		It("Returns the defaults when an empty config map is passed", func() {
+			Ω(cloud.GetAPIThrottleConfig(&corev1.ConfigMap{})).Should(Equal(defaults))
+		})
+
+		It("Returns the defaults when the values are invalid", func() {
+			clientConfig := &corev1.ConfigMap{}
+			clientConfig.Data = map[string]string{}
+			clientConfig.Data[cloud.APIRateLimitQPSKey] = "-1"
+			clientConfig.Data[cloud.APIRateLimitBurstKey] = "0"
+			clientConfig.Data[cloud.APIMaxConcurrentRequestsKey] = "tenXXX"
+			Ω(cloud.GetAPIThrottleConfig(clientConfig)).Should(Equal(defaults))
+		})
+
+		It("Returns the limits from the input clientConfig map", func() {
+			clientConfig := &corev1.ConfigMap{}
+			clientConfig.Data = map[string]string{}
+			clientConfig.Data[cloud.APIRateLimitQPSKey] = "2.5"
+			clientConfig.Data[cloud.APIRateLimitBurstKey] = "5"
+			clientConfig.Data[cloud.APIMaxConcurrentRequestsKey] = "0"
+			Ω(cloud.GetAPIThrottleConfig(clientConfig)).Should(Equal(cloud.APIThrottleConfig{
+				QPS:                   2.5,
+				Burst:                 5,
+				MaxConcurrentRequests: 0,
+			}))
+		})
+	})
+
+	Context("GetAPITimeoutConfig", func() {
+		defaults := cloud.APITimeoutConfig{
+			Read:     cloud.DefaultAPITimeoutRead,
+			Write:    cloud.DefaultAPITimeoutWrite,
+			AsyncJob: cloud.DefaultAPITimeoutAsyncJob,
+		}
+
+		It("Returns the defaults when a nil is passed", func() {
+			Ω(cloud.GetAPITimeoutConfig(nil)).Should(Equal(defaults))
+		})
+
+		It("Returns the defaults when the values are invalid", func() {
+			clientConfig := &corev1.ConfigMap{}
+			clientConfig.Data = map[string]string{}
+			clientConfig.Data[cloud.APITimeoutReadKey] = "-1s"
+			clientConfig.Data[cloud.APITimeoutWriteKey] = "0s"
+			clientConfig.Data[cloud.APITimeoutAsyncJobKey] = "tenXXX"
+			Ω(cloud.GetAPITimeoutConfig(clientConfig)).Should(Equal(defaults))
+		})
+
+		It("Returns the timeouts from the input clientConfig map", func() {
+			clientConfig := &corev1.ConfigMap{}
+			clientConfig.Data = map[string]string{}
+			clientConfig.Data[cloud.APITimeoutReadKey] = "10s"
+			clientConfig.Data[cloud.APITimeoutWriteKey] = "2m"
+			clientConfig.Data[cloud.APITimeoutAsyncJobKey] = "30m"
+			Ω(cloud.GetAPITimeoutConfig(clientConfig)).Should(Equal(cloud.APITimeoutConfig{
+				Read:     10 * time.Second,
+				Write:    2 * time.Minute,
+				AsyncJob: 30 * time.Minute,
+			}))
+		})
+	})
+
+	Context("GetAPIRetryConfig", func() {
+		defaults := cloud.APIRetryConfig{
+			MaxRetries:     cloud.DefaultAPIRetryMaxRetries,
+			InitialBackoff: cloud.DefaultAPIRetryInitialBackoff,
+			MaxBackoff:     cloud.DefaultAPIRetryMaxBackoff,
+		}
+
+		It("Returns the defaults when a nil is passed", func() {
+			Ω(cloud.GetAPIRetryConfig(nil)).Should(Equal(defaults))
+		})
+
+		It("Returns the defaults when the values are invalid", func() {
+			clientConfig := &corev1.ConfigMap{}
+			clientConfig.Data = map[string]string{}
+			clientConfig.Data[cloud.APIRetryMaxRetriesKey] = "-1"
+			clientConfig.Data[cloud.APIRetryInitialBackoffKey] = "0s"
+			clientConfig.Data[cloud.APIRetryMaxBackoffKey] = "tenXXX"
+			Ω(cloud.GetAPIRetryConfig(clientConfig)).Should(Equal(defaults))
+		})
+
+		It("Returns the retry settings from the input clientConfig map", func() {
+			clientConfig := &corev1.ConfigMap{}
+			clientConfig.Data = map[string]string{}
+			clientConfig.Data[cloud.APIRetryMaxRetriesKey] = "0"
+			clientConfig.Data[cloud.APIRetryInitialBackoffKey] = "1s"
+			clientConfig.Data[cloud.APIRetryMaxBackoffKey] = "30s"
+			Ω(cloud.GetAPIRetryConfig(clientConfig)).Should(Equal(cloud.APIRetryConfig{
+				MaxRetries:     0,
+				InitialBackoff: time.Second,
+				MaxBackoff:     30 * time.Second,
+			}))
+		})
+	})
+
 	Context("NewClientFromConf", func() {
 		clientConfig := &corev1.ConfigMap{}
 
@@ -151,5 +278,421 @@ var _ = Describe("Client", func() {
 			result2, _ := cloud.NewClientFromConf(config2, clientConfig)
 			Ω(result1).ShouldNot(Equal(result2))
 		})
+
+		It("Rate limits the requests sent to an endpoint", func() {
+			server := fakeacs.NewServer()
+			defer server.Close()
+			clientConfig.Data[cloud.APIRateLimitQPSKey] = "5"
+			clientConfig.Data[cloud.APIRateLimitBurstKey] = "1"
+
+			client, err := cloud.NewClientFromConf(cloud.Config{
+				APIUrl:    server.APIURL(),
+				APIKey:    server.APIKey,
+				SecretKey: server.SecretKey,
+			}, clientConfig)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			start := time.Now()
+			for i := 0; i < 3; i++ {
+				_, err := client.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			Ω(time.Since(start)).Should(BeNumerically(">=", 350*time.Millisecond))
+			Ω(server.Calls("listTags")).Should(Equal(3))
+		})
+
+		It("Limits the requests in flight to an endpoint until their responses are read", func() {
+			server := fakeacs.NewServer()
+			defer server.Close()
+			clientConfig.Data[cloud.APIMaxConcurrentRequestsKey] = "1"
+
+			// Sends the headers of the fake server's responses right away, and their bodies only later.
+			var mu sync.Mutex
+			inFlight, maxInFlight := 0, 0
+			slowBodies := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				inFlight++
+				if inFlight > maxInFlight {
+					maxInFlight = inFlight
+				}
+				mu.Unlock()
+				defer func() {
+					mu.Lock()
+					inFlight--
+					mu.Unlock()
+				}()
+
+				resp, err := http.Get(server.APIURL() + "?" + r.URL.RawQuery)
+				if err != nil {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				defer resp.Body.Close()
+				w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+				w.WriteHeader(resp.StatusCode)
+				w.(http.Flusher).Flush()
+				time.Sleep(50 * time.Millisecond)
+				_, _ = io.Copy(w, resp.Body)
+			}))
+			defer slowBodies.Close()
+
+			client, err := cloud.NewClientFromConf(cloud.Config{
+				APIUrl:    slowBodies.URL,
+				APIKey:    server.APIKey,
+				SecretKey: server.SecretKey,
+			}, clientConfig)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					_, err := client.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+					Ω(err).ShouldNot(HaveOccurred())
+				}()
+			}
+			wg.Wait()
+			Ω(server.Calls("listTags")).Should(Equal(3))
+			Ω(maxInFlight).Should(Equal(1))
+		})
+
+		It("Records the outcome of the requests sent to an endpoint", func() {
+			server := fakeacs.NewServer()
+			defer server.Close()
+			serverURL, err := url.Parse(server.APIURL())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			client, err := cloud.NewClientFromConf(cloud.Config{
+				APIUrl:    server.APIURL(),
+				APIKey:    server.APIKey,
+				SecretKey: server.SecretKey,
+			}, clientConfig)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = client.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+			Ω(err).ShouldNot(HaveOccurred())
+			server.FailNext("listTags", fakeacs.ErrorCodeInternal, fakeacs.CSExceptionCloudRuntime, "internal error")
+			_, err = client.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+			Ω(err).Should(HaveOccurred())
+
+			Ω(apiRequestCount("listTags", serverURL.Host, cloud.APIOutcomeSuccess)).Should(Equal(1.0))
+			Ω(apiRequestCount("listTags", serverURL.Host, cloud.APIOutcomeAPIError)).Should(Equal(1.0))
+		})
+
+		It("Retries reads failing for a transient reason", func() {
+			server := fakeacs.NewServer()
+			defer server.Close()
+			serverURL, err := url.Parse(server.APIURL())
+			Ω(err).ShouldNot(HaveOccurred())
+			clientConfig.Data[cloud.APIRetryInitialBackoffKey] = "1ms"
+
+			client, err := cloud.NewClientFromConf(cloud.Config{
+				APIUrl:    server.APIURL(),
+				APIKey:    server.APIKey,
+				SecretKey: server.SecretKey,
+			}, clientConfig)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			server.FailNext("listTags", fakeacs.ErrorCodeInternal, fakeacs.CSExceptionConcurrentOperation, "lock wait timeout")
+			server.FailNext("listTags", fakeacs.ErrorCodeResourceUnavailable, fakeacs.CSExceptionCloudRuntime, "unavailable")
+			_, err = client.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(server.Calls("listTags")).Should(Equal(3))
+			Ω(counterValue("acs_api_request_retries_total",
+				map[string]string{"command": "listTags", "endpoint": serverURL.Host})).Should(Equal(2.0))
+		})
+
+		It("Gives up retrying once the retry budget is spent", func() {
+			server := fakeacs.NewServer()
+			defer server.Close()
+			clientConfig.Data[cloud.APIRetryInitialBackoffKey] = "1ms"
+			clientConfig.Data[cloud.APIRetryMaxRetriesKey] = "1"
+
+			client, err := cloud.NewClientFromConf(cloud.Config{
+				APIUrl:    server.APIURL(),
+				APIKey:    server.APIKey,
+				SecretKey: server.SecretKey,
+			}, clientConfig)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			for i := 0; i < 3; i++ {
+				server.FailNext("listTags", fakeacs.ErrorCodeInternal, fakeacs.CSExceptionConcurrentOperation, "lock")
+			}
+			_, err = client.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+			Ω(cloud.IsTransient(err)).Should(BeTrue())
+			Ω(server.Calls("listTags")).Should(Equal(2))
+		})
+
+		It("Doesn't retry writes that aren't safe to send again", func() {
+			server := fakeacs.NewServer()
+			defer server.Close()
+			clientConfig.Data[cloud.APIRetryInitialBackoffKey] = "1ms"
+
+			client, err := cloud.NewClientFromConf(cloud.Config{
+				APIUrl:    server.APIURL(),
+				APIKey:    server.APIKey,
+				SecretKey: server.SecretKey,
+			}, clientConfig)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			server.FailNext("deleteNetwork", fakeacs.ErrorCodeInternal, fakeacs.CSExceptionConcurrentOperation, "lock")
+			Ω(client.DeleteNetwork(ctx, infrav1.Network{ID: "network-id"})).ShouldNot(Succeed())
+			Ω(server.Calls("deleteNetwork")).Should(Equal(1))
+		})
+
+		It("Opens the circuit breaker of an endpoint that keeps failing", func() {
+			server := fakeacs.NewServer()
+			config := cloud.Config{
+				APIUrl:    server.APIURL(),
+				APIKey:    server.APIKey,
+				SecretKey: server.SecretKey,
+			}
+			server.Close()
+			clientConfig.Data[cloud.APIRetryMaxRetriesKey] = "0"
+			clientConfig.Data[cloud.CircuitBreakerFailureThresholdKey] = "2"
+			clientConfig.Data[cloud.CircuitBreakerOpenDurationKey] = "100ms"
+
+			client, err := cloud.NewClientFromConf(config, clientConfig)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(client.EndpointHealth().State).Should(Equal(cloud.CircuitClosed))
+
+			for i := 0; i < 2; i++ {
+				_, err = client.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+				Ω(err).Should(HaveOccurred())
+				Ω(errors.Is(err, cloud.ErrCircuitOpen)).Should(BeFalse())
+			}
+			health := client.EndpointHealth()
+			Ω(health.State).Should(Equal(cloud.CircuitOpen))
+			Ω(health.LastError).ShouldNot(BeEmpty())
+			Ω(health.RetryAfter).Should(BeNumerically(">", 0))
+
+			_, err = client.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+			Ω(errors.Is(err, cloud.ErrCircuitOpen)).Should(BeTrue())
+
+			time.Sleep(150 * time.Millisecond)
+			Ω(client.EndpointHealth().State).Should(Equal(cloud.CircuitHalfOpen))
+			_, err = client.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+			Ω(errors.Is(err, cloud.ErrCircuitOpen)).Should(BeFalse())
+			Ω(client.EndpointHealth().State).Should(Equal(cloud.CircuitOpen))
+		})
+
+		It("Evicts a client whose credentials are rejected", func() {
+			server := fakeacs.NewServer()
+			defer server.Close()
+			config := cloud.Config{
+				APIUrl:    server.APIURL(),
+				APIKey:    server.APIKey,
+				SecretKey: "revoked-secret-key",
+			}
+
+			result1, err := cloud.NewClientFromConf(config, clientConfig)
+			Ω(err).ShouldNot(HaveOccurred())
+			result2, _ := cloud.NewClientFromConf(config, clientConfig)
+			Ω(result2).Should(BeIdenticalTo(result1))
+
+			_, err = result1.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+			Ω(cloud.IsAuth(err)).Should(BeTrue())
+			result3, _ := cloud.NewClientFromConf(config, clientConfig)
+			Ω(result3).ShouldNot(BeIdenticalTo(result1))
+		})
+
+		It("Sends requests with the context of the call", func() {
+			server := fakeacs.NewServer()
+			defer server.Close()
+			config := cloud.Config{
+				APIUrl:    server.APIURL(),
+				APIKey:    server.APIKey,
+				SecretKey: server.SecretKey,
+			}
+			result, err := cloud.NewClientFromConf(config, clientConfig)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			canceledCtx, cancel := context.WithCancel(ctx)
+			cancel()
+			_, err = result.GetTags(canceledCtx, cloud.ResourceTypeNetwork, "network-id")
+			Ω(errors.Is(err, context.Canceled)).Should(BeTrue())
+
+			_, err = result.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+			Ω(errors.Is(err, context.Canceled)).Should(BeFalse())
+		})
+	})
+
+	Context("NewClientFromK8sSecret", func() {
+		var secret *corev1.Secret
+
+		BeforeEach(func() {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "acs-endpoint", Namespace: "default", ResourceVersion: "1"},
+				Data: map[string][]byte{
+					"api-url":    []byte("http://6.6.6.6"),
+					"api-key":    []byte("api-key"),
+					"secret-key": []byte("secret-key"),
+				},
+			}
+		})
+
+		It("Returns a cached client for the same secret", func() {
+			result1, err := cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			result2, _ := cloud.NewClientFromK8sSecret(secret.DeepCopy(), nil)
+			Ω(result2).Should(BeIdenticalTo(result1))
+		})
+
+		It("Returns a new client when the secret changes", func() {
+			result1, _ := cloud.NewClientFromK8sSecret(secret, nil)
+
+			secret.ResourceVersion = "2"
+			secret.Data["secret-key"] = []byte("rotated-secret-key")
+			result2, _ := cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(result2).ShouldNot(BeIdenticalTo(result1))
+
+			result3, _ := cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(result3).Should(BeIdenticalTo(result2))
+		})
+
+		It("Returns a new client once the client of the secret is evicted", func() {
+			result1, _ := cloud.NewClientFromK8sSecret(secret, nil)
+
+			cloud.EvictSecretClient(secret.Namespace, secret.Name)
+			result2, _ := cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(result2).ShouldNot(BeIdenticalTo(result1))
+		})
+
+		It("Trusts the CA bundle of the secret", func() {
+			server := fakeacs.NewTLSServer()
+			defer server.Close()
+			secret.Data = map[string][]byte{
+				"api-url":    []byte(server.APIURL()),
+				"api-key":    []byte(server.APIKey),
+				"secret-key": []byte(server.SecretKey),
+			}
+
+			client, err := cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = client.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+			Ω(err).Should(HaveOccurred())
+
+			secret.ResourceVersion = "2"
+			secret.Data["ca-bundle"] = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+			client, err = cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = client.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Caches clients of CA files with different contents separately", func() {
+			caFile := filepath.Join(GinkgoT().TempDir(), "ca.pem")
+			secret.Data["ca-file"] = []byte(caFile)
+			Ω(os.WriteFile(caFile, testCertificatePEM(1), 0600)).Should(Succeed())
+			result1, err := cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(os.WriteFile(caFile, testCertificatePEM(2), 0600)).Should(Succeed())
+			result2, err := cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(result2).ShouldNot(BeIdenticalTo(result1))
+		})
+
+		It("Returns an error for a CA bundle without certificates", func() {
+			secret.Data["ca-bundle"] = []byte("not a certificate")
+			_, err := cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Sends requests through the proxy of the secret", func() {
+			server := fakeacs.NewServer()
+			defer server.Close()
+			serverURL, err := url.Parse(server.APIURL())
+			Ω(err).ShouldNot(HaveOccurred())
+			proxied := 0
+			forward := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: serverURL.Scheme, Host: serverURL.Host})
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				proxied++
+				forward.ServeHTTP(w, r)
+			}))
+			defer proxy.Close()
+
+			// Loopback hosts are never proxied, so the endpoint is given a name only the proxy can reach.
+			secret.Data = map[string][]byte{
+				"api-url":    []byte("http://acs.example.com" + serverURL.Path),
+				"api-key":    []byte(server.APIKey),
+				"secret-key": []byte(server.SecretKey),
+				"http-proxy": []byte(proxy.URL),
+			}
+			client, err := cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = client.GetTags(ctx, cloud.ResourceTypeNetwork, "network-id")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(proxied).Should(Equal(1))
+		})
+
+		It("Caches clients of different proxies separately", func() {
+			secret.Data["http-proxy"] = []byte("http://proxy1.example.com:3128")
+			result1, err := cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			secret.ResourceVersion = "2"
+			secret.Data["http-proxy"] = []byte("http://proxy2.example.com:3128")
+			result2, err := cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(result2).ShouldNot(BeIdenticalTo(result1))
+
+			secret.ResourceVersion = "3"
+			secret.Data["no-proxy"] = []byte("6.6.6.6")
+			result3, err := cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(result3).ShouldNot(BeIdenticalTo(result2))
+		})
+
+		It("Returns an error for an invalid proxy", func() {
+			secret.Data["http-proxy"] = []byte("not a proxy")
+			_, err := cloud.NewClientFromK8sSecret(secret, nil)
+			Ω(err).Should(HaveOccurred())
+		})
 	})
 })
+
+// apiRequestCount returns the value of the ACS API request counter for the passed labels.
+func apiRequestCount(command, endpoint, outcome string) float64 {
+	return counterValue("acs_api_requests_total",
+		map[string]string{"command": command, "endpoint": endpoint, "outcome": outcome})
+}
+
+// counterValue returns the value of the named counter for the passed labels.
+func counterValue(name string, wantedLabels map[string]string) float64 {
+	families, err := crtlmetrics.Registry.Gather()
+	Ω(err).ShouldNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if reflect.DeepEqual(labels, wantedLabels) {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+// testCertificatePEM returns a PEM encoded self-signed certificate with the passed serial number.
+func testCertificatePEM(serial int64) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Ω(err).ShouldNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test-ca"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Ω(err).ShouldNot(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
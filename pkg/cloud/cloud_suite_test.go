@@ -17,6 +17,7 @@ limitations under the License.
 package cloud_test
 
 import (
+	"context"
 	"os"
 	"strings"
 	"testing"
@@ -31,6 +32,8 @@ import (
 )
 
 var (
+	ctx = context.TODO() // ctx is the context passed to the cloud client calls under test.
+
 	// cloud.Client is our cloud package used to interact with ACS.
 	realCloudClient cloud.Client // Real cloud client is a cloud client connected to a real Apache CloudStack instance.
 	client          cloud.Client // client is simply a pointer to a cloud client object intended to be swapped per test.
@@ -70,7 +73,7 @@ func TestCloud(t *testing.T) {
 
 			// Switch to test account user.
 			realCloudClient, connectionErr = realCloudClient.NewClientInDomainAndAccount(
-				newAccount.Domain.Name, newAccount.Name)
+				ctx, newAccount.Domain.Name, newAccount.Name)
 			Ω(connectionErr).ShouldNot(HaveOccurred())
 		}
 	})
@@ -88,10 +91,10 @@ func TestCloud(t *testing.T) {
 
 // FetchIntegTestResources runs through basic CloudStack Client setup methods needed to test others.
 func FetchIntegTestResources() {
-	Ω(realCloudClient.ResolveZone(&dummies.CSFailureDomain1.Spec.Zone)).Should(Succeed())
+	Ω(realCloudClient.ResolveZone(ctx, &dummies.CSFailureDomain1.Spec.Zone)).Should(Succeed())
 	Ω(dummies.CSFailureDomain1.Spec.Zone.ID).ShouldNot(BeEmpty())
 	dummies.CSMachine1.Spec.DiskOffering.Name = ""
 	dummies.CSCluster.Spec.ControlPlaneEndpoint.Host = ""
 	Ω(realCloudClient.GetOrCreateIsolatedNetwork(
-		dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+		ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
 }
@@ -0,0 +1,191 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	"github.com/pkg/errors"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+)
+
+// dataDiskNamePrefix returns the prefix of the names of the data disk volumes of a machine's instance.
+func dataDiskNamePrefix(instanceID string) string {
+	return fmt.Sprintf("DATA-%s-", instanceID)
+}
+
+// dataDiskName returns the name of the volume of the data disk at index i of a machine's instance.
+func dataDiskName(instanceID string, i int) string {
+	return fmt.Sprintf("%s%d", dataDiskNamePrefix(instanceID), i+1)
+}
+
+// ReconcileDataDisks creates the machine's data disks and attaches them to its instance in order, then starts the
+// instance if it was deployed stopped for them. Each step is submitted as an async job tracked on the machine, so
+// ErrAsyncJobPending is returned until all of them complete. Once attached, the disks are destroyed along with the
+// instance, and DestroyVMInstance deletes those that aren't attached yet.
+func (c *client) ReconcileDataDisks(
+	ctx context.Context,
+	csMachine *infrav1.CloudStackMachine,
+	fd *infrav1.CloudStackFailureDomain,
+) error {
+	if len(csMachine.Spec.DataDisks) == 0 {
+		return nil
+	}
+	c = c.withContext(ctx)
+	if err := c.pollMachineJob(csMachine, infrav1.AsyncJobDataDisks); err != nil {
+		return err
+	}
+
+	instanceID := *csMachine.Spec.InstanceID
+	for i := range csMachine.Spec.DataDisks {
+		name := dataDiskName(instanceID, i)
+		volume, err := c.findDataDiskVolume(name, fd.Spec.Zone.ID)
+		if err != nil {
+			return err
+		}
+		if volume == nil {
+			if err := c.createDataDiskVolume(csMachine, &csMachine.Spec.DataDisks[i], name, fd.Spec.Zone.ID); err != nil {
+				return err
+			}
+			if volume, err = c.findDataDiskVolume(name, fd.Spec.Zone.ID); err != nil {
+				return err
+			} else if volume == nil {
+				return errors.Errorf("data disk volume %s not found after its creation", name)
+			}
+		}
+
+		switch volume.Virtualmachineid {
+		case instanceID:
+			continue
+		case "":
+			p := c.csAsync.Volume.NewAttachVolumeParams(volume.Id, instanceID)
+			resp, err := c.csAsync.Volume.AttachVolume(p)
+			if err != nil {
+				c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+				return errors.Wrapf(err, "attaching data disk volume %s", name)
+			}
+			if err := c.trackMachineJob(csMachine, infrav1.AsyncJobDataDisks, resp.JobID); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("data disk volume %s is attached to VM %s", name, volume.Virtualmachineid)
+		}
+	}
+
+	// The instance is only deployed stopped when it has data disks, and it isn't ready until it first runs.
+	if csMachine.Status.InstanceState == "Stopped" && !csMachine.Status.Ready {
+		// Refresh the state, which is stale when the start submitted by a previous call just completed.
+		if err := c.ResolveVMInstanceDetails(ctx, csMachine); err != nil || csMachine.Status.InstanceState != "Stopped" {
+			return err
+		}
+		resp, err := c.csAsync.VirtualMachine.StartVirtualMachine(
+			c.csAsync.VirtualMachine.NewStartVirtualMachineParams(instanceID))
+		if err != nil {
+			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+			return errors.Wrapf(err, "starting VM %s", instanceID)
+		}
+		if err := c.trackMachineJob(csMachine, infrav1.AsyncJobDataDisks, resp.JobID); err != nil {
+			return err
+		}
+		return c.ResolveVMInstanceDetails(ctx, csMachine)
+	}
+	return nil
+}
+
+// findDataDiskVolume returns the data disk volume of the given name in the zone, or nil if there's none.
+func (c *client) findDataDiskVolume(name string, zoneID string) (*cloudstack.Volume, error) {
+	p := c.cs.Volume.NewListVolumesParams()
+	p.SetName(name)
+	p.SetZoneid(zoneID)
+	p.SetType("DATADISK")
+	setIfNotEmpty(c.projectID, p.SetProjectid)
+	resp, err := c.cs.Volume.ListVolumes(p)
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return nil, errors.Wrapf(err, "listing data disk volume %s", name)
+	}
+	for _, volume := range resp.Volumes {
+		if volume.Name == name {
+			return volume, nil
+		}
+	}
+	return nil, nil
+}
+
+// createDataDiskVolume creates the volume of a data disk.
+func (c *client) createDataDiskVolume(
+	csMachine *infrav1.CloudStackMachine,
+	disk *infrav1.CloudStackResourceDiskOffering,
+	name string,
+	zoneID string,
+) error {
+	diskOfferingID, err := c.resolveDiskOffering(disk, zoneID)
+	if err != nil {
+		return err
+	} else if diskOfferingID == "" {
+		return errors.Errorf("data disk %s has no disk offering", name)
+	}
+
+	p := c.csAsync.Volume.NewCreateVolumeParams()
+	p.SetName(name)
+	p.SetZoneid(zoneID)
+	p.SetDiskofferingid(diskOfferingID)
+	setIntIfPositive(disk.CustomSize, p.SetSize)
+	setIfNotEmpty(c.projectID, p.SetProjectid)
+	resp, err := c.csAsync.Volume.CreateVolume(p)
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return errors.Wrapf(err, "creating data disk volume %s", name)
+	}
+	return c.trackMachineJob(csMachine, infrav1.AsyncJobDataDisks, resp.JobID)
+}
+
+// deleteUnattachedDataDisks deletes the data disk volumes created for the machine's instance that aren't attached to
+// it yet, which destroying the instance leaves behind.
+func (c *client) deleteUnattachedDataDisks(csMachine *infrav1.CloudStackMachine) error {
+	if len(csMachine.Spec.DataDisks) == 0 {
+		return nil
+	}
+	prefix := dataDiskNamePrefix(*csMachine.Spec.InstanceID)
+	p := c.cs.Volume.NewListVolumesParams()
+	p.SetKeyword(prefix)
+	p.SetType("DATADISK")
+	p.SetListall(true)
+	setIfNotEmpty(c.projectID, p.SetProjectid)
+	resp, err := c.cs.Volume.ListVolumes(p)
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return errors.Wrapf(err, "listing data disk volumes of VM %s", *csMachine.Spec.InstanceID)
+	}
+	for _, volume := range resp.Volumes {
+		if !strings.HasPrefix(volume.Name, prefix) || volume.Virtualmachineid != "" {
+			continue
+		}
+		if _, err := c.cs.Volume.DeleteVolume(c.cs.Volume.NewDeleteVolumeParams(volume.Id)); err != nil {
+			if err = NewAPIError(err); IsNotFound(err) {
+				continue
+			}
+			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+			return errors.Wrapf(err, "deleting data disk volume %s", volume.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	"github.com/pkg/errors"
+)
+
+// ErrorReason categorizes an error returned by the CloudStack API.
+type ErrorReason string
+
+const (
+	// ErrorReasonNotFound means the requested resource does not exist.
+	ErrorReasonNotFound ErrorReason = "NotFound"
+	// ErrorReasonAlreadyExists means the resource to create, or the change to apply, is already present.
+	ErrorReasonAlreadyExists ErrorReason = "AlreadyExists"
+	// ErrorReasonConflict means the request conflicts with the current state of another resource.
+	ErrorReasonConflict ErrorReason = "Conflict"
+	// ErrorReasonQuotaExceeded means an account or domain resource limit was reached.
+	ErrorReasonQuotaExceeded ErrorReason = "QuotaExceeded"
+	// ErrorReasonTransient means the request failed for a reason expected to go away, and can be retried as is.
+	ErrorReasonTransient ErrorReason = "Transient"
+	// ErrorReasonAuth means the request was rejected because of the credentials or permissions used.
+	ErrorReasonAuth ErrorReason = "Auth"
+	// ErrorReasonUnsupported means the API command doesn't exist in the CloudStack version used, or isn't available to
+	// the account.
+	ErrorReasonUnsupported ErrorReason = "Unsupported"
+	// ErrorReasonUnknown is used for errors that don't fall in any of the categories above.
+	ErrorReasonUnknown ErrorReason = "Unknown"
+)
+
+// CloudStack HTTP status codes and exception codes, as defined by ApiErrorCode and CSExceptionErrorCode in CloudStack.
+const (
+	httpStatusUnauthorized                = 401
+	httpStatusParamError                  = 431
+	httpStatusUnsupportedAction           = 432
+	httpStatusAPILimitExceeded            = 429
+	httpStatusTwoFactorAuthRequired       = 511
+	httpStatusAccountError                = 531
+	httpStatusAccountResourceLimitError   = 532
+	httpStatusInsufficientCapacityError   = 533
+	httpStatusResourceUnavailableError    = 534
+	httpStatusResourceAllocationError     = 535
+	httpStatusResourceInUseError          = 536
+	httpStatusNetworkRuleConflictError    = 537
+	httpStatusBadGateway                  = 502
+	httpStatusServiceUnavailable          = 503
+	httpStatusGatewayTimeout              = 504
+	csExceptionCloudAuthentication        = 4290
+	csExceptionAccountLimit               = 4280
+	csExceptionAgentUnavailable           = 4285
+	csExceptionConcurrentOperation        = 4300
+	csExceptionConflictingNetworkSettings = 4305
+	csExceptionInsufficientCapacityMin    = 4320
+	csExceptionInsufficientCapacityMax    = 4340
+	csExceptionNetworkRuleConflict        = 4360
+	csExceptionPermissionDenied           = 4365
+	csExceptionResourceAllocation         = 4370
+	csExceptionResourceInUse              = 4375
+	csExceptionResourceUnavailable        = 4380
+	csExceptionStorageUnavailable         = 4385
+	csExceptionAsyncCommandQueued         = 4540
+	csExceptionRequestLimit               = 4545
+)
+
+// APIError is an error returned by the CloudStack API, classified by the HTTP status and CSExceptionErrorCode it came
+// with. Use errors.As, or the Is* helpers below, to check for one.
+type APIError struct {
+	Reason      ErrorReason
+	HTTPStatus  int
+	CSErrorCode int
+	Err         error
+}
+
+// Error returns the message of the underlying error unchanged.
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	csErrorRegexp        = regexp.MustCompile(`CloudStack API error (\d+) \(CSExceptionErrorCode: (\d+)\)`)
+	undefinedErrorRegexp = regexp.MustCompile(`^Undefined error: (\{.*\})$`)
+)
+
+// Message patterns for failures CloudStack doesn't give a distinctive error code for. CloudStack-Go reports lookups
+// matching no resource with a plain "No match found" error that has no code at all, which is the only message errors
+// are found to be NotFound by: CloudStack reports missing resources with the codes of any invalid parameter.
+var (
+	noMatchFoundRegexp  = regexp.MustCompile(`(?i)^no match found`)
+	alreadyExistsRegexp = regexp.MustCompile(`(?i)already exists|there is already|already on \S+ with id`)
+)
+
+// NewAPIError classifies err and wraps it in an *APIError. Nil errors and errors that already carry an *APIError are
+// returned unchanged.
+func NewAPIError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return err
+	}
+
+	apiErr = &APIError{Err: err}
+	msg := err.Error()
+	if m := csErrorRegexp.FindStringSubmatch(msg); m != nil {
+		apiErr.HTTPStatus, _ = strconv.Atoi(m[1])
+		apiErr.CSErrorCode, _ = strconv.Atoi(m[2])
+	} else if m := undefinedErrorRegexp.FindStringSubmatch(msg); m != nil {
+		// The waiting CloudStack-Go client reports failed async jobs with their raw JSON result.
+		var csErr cloudstack.CSError
+		if json.Unmarshal([]byte(m[1]), &csErr) == nil {
+			apiErr.HTTPStatus, apiErr.CSErrorCode = csErr.ErrorCode, csErr.CSErrorCode
+		}
+	}
+	apiErr.Reason = classify(apiErr.HTTPStatus, apiErr.CSErrorCode, msg, err)
+	return apiErr
+}
+
+// newNotFoundError returns an APIError for a lookup that matched nothing.
+func newNotFoundError(err error) error {
+	return &APIError{Reason: ErrorReasonNotFound, Err: err}
+}
+
+// classify determines the reason of an error from its codes, falling back to its message. Messages take precedence
+// for AlreadyExists as CloudStack reports those with the same codes as other conflicts and internal errors, and only
+// the code-less errors of CloudStack-Go's lookups are NotFound.
+func classify(httpStatus, csErrorCode int, msg string, err error) ErrorReason {
+	if alreadyExistsRegexp.MatchString(msg) {
+		return ErrorReasonAlreadyExists
+	}
+
+	switch {
+	case httpStatus == httpStatusUnsupportedAction:
+		return ErrorReasonUnsupported
+	case isAuthFailureStatus(httpStatus) ||
+		csErrorCode == csExceptionCloudAuthentication ||
+		csErrorCode == csExceptionPermissionDenied:
+		return ErrorReasonAuth
+	case httpStatus == httpStatusAccountResourceLimitError ||
+		httpStatus == httpStatusResourceAllocationError ||
+		csErrorCode == csExceptionAccountLimit ||
+		csErrorCode == csExceptionResourceAllocation:
+		return ErrorReasonQuotaExceeded
+	case httpStatus == httpStatusResourceInUseError ||
+		httpStatus == httpStatusNetworkRuleConflictError ||
+		csErrorCode == csExceptionConflictingNetworkSettings ||
+		csErrorCode == csExceptionNetworkRuleConflict ||
+		csErrorCode == csExceptionResourceInUse:
+		return ErrorReasonConflict
+	case httpStatus == httpStatusAPILimitExceeded ||
+		httpStatus == httpStatusBadGateway ||
+		httpStatus == httpStatusServiceUnavailable ||
+		httpStatus == httpStatusGatewayTimeout ||
+		httpStatus == httpStatusInsufficientCapacityError ||
+		httpStatus == httpStatusResourceUnavailableError ||
+		csErrorCode == csExceptionAgentUnavailable ||
+		csErrorCode == csExceptionConcurrentOperation ||
+		(csErrorCode >= csExceptionInsufficientCapacityMin && csErrorCode <= csExceptionInsufficientCapacityMax) ||
+		csErrorCode == csExceptionResourceUnavailable ||
+		csErrorCode == csExceptionStorageUnavailable ||
+		csErrorCode == csExceptionAsyncCommandQueued ||
+		csErrorCode == csExceptionRequestLimit:
+		return ErrorReasonTransient
+	}
+
+	if httpStatus == 0 && csErrorCode == 0 && noMatchFoundRegexp.MatchString(msg) {
+		return ErrorReasonNotFound
+	}
+
+	// url.Error implements net.Error whatever the failure, so look at the error it wraps.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, cloudstack.AsyncTimeoutErr) {
+		return ErrorReasonTransient
+	}
+	return ErrorReasonUnknown
+}
+
+// isAuthFailureStatus returns true for the HTTP statuses CloudStack rejects requests with because of the credentials
+// or permissions used.
+func isAuthFailureStatus(httpStatus int) bool {
+	return httpStatus == httpStatusUnauthorized ||
+		httpStatus == httpStatusTwoFactorAuthRequired ||
+		httpStatus == httpStatusAccountError
+}
+
+// isParamError returns true if err is a CloudStack API error rejecting a parameter of the request. CloudStack rejects
+// the IDs of resources that don't exist this way, among other invalid values.
+func isParamError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.HTTPStatus == httpStatusParamError
+}
+
+func hasReason(err error, reason ErrorReason) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Reason == reason
+}
+
+// IsNotFound returns true if err is a CloudStack API error reporting a missing resource.
+func IsNotFound(err error) bool {
+	return hasReason(err, ErrorReasonNotFound)
+}
+
+// IsAlreadyExists returns true if err is a CloudStack API error reporting that the resource is already present.
+func IsAlreadyExists(err error) bool {
+	return hasReason(err, ErrorReasonAlreadyExists)
+}
+
+// IsConflict returns true if err is a CloudStack API error reporting a conflict with another resource.
+func IsConflict(err error) bool {
+	return hasReason(err, ErrorReasonConflict)
+}
+
+// IsQuotaExceeded returns true if err is a CloudStack API error reporting that a resource limit was reached.
+func IsQuotaExceeded(err error) bool {
+	return hasReason(err, ErrorReasonQuotaExceeded)
+}
+
+// IsTransient returns true if err is a CloudStack API error that is expected to go away when retried.
+func IsTransient(err error) bool {
+	return hasReason(err, ErrorReasonTransient)
+}
+
+// IsAuth returns true if err is a CloudStack API error caused by the credentials or permissions used.
+func IsAuth(err error) bool {
+	return hasReason(err, ErrorReasonAuth)
+}
+
+// IsUnsupported returns true if err is a CloudStack API error reporting an API command the CloudStack version used
+// doesn't have.
+func IsUnsupported(err error) bool {
+	return hasReason(err, ErrorReasonUnsupported)
+}
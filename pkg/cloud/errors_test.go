@@ -0,0 +1,90 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud_test
+
+import (
+	"fmt"
+
+	csapi "github.com/apache/cloudstack-go/v2/cloudstack"
+	"github.com/hashicorp/go-multierror"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
+)
+
+var _ = Describe("API Error Unit Tests", func() {
+	csError := func(httpStatus, csErrorCode int, text string) error {
+		return fmt.Errorf("CloudStack API error %d (CSExceptionErrorCode: %d): %s", httpStatus, csErrorCode, text)
+	}
+
+	DescribeTable("Classifies CloudStack errors",
+		func(err error, expected cloud.ErrorReason) {
+			var apiErr *cloud.APIError
+			Ω(errors.As(cloud.NewAPIError(err), &apiErr)).Should(BeTrue())
+			Ω(apiErr.Reason).Should(Equal(expected))
+		},
+		Entry("no match found", errors.New("No match found for vm-1: &{Count:0 VirtualMachines:[]}"),
+			cloud.ErrorReasonNotFound),
+		Entry("invalid parameter naming a missing entity",
+			csError(431, 4350, "Unable to execute API command deployvirtualmachine due to invalid value. "+
+				"Invalid parameter networkids value=net-1 due to incorrect long value format, or entity does not exist"),
+			cloud.ErrorReasonUnknown),
+		Entry("unknown UUID", csError(431, 4350, "Unable to find UUID for id vm-1"), cloud.ErrorReasonUnknown),
+		Entry("already present tag", csError(530, 4250, "tag key already on UserVm with id vm-1"),
+			cloud.ErrorReasonAlreadyExists),
+		Entry("duplicate firewall rule", csError(537, 4360, "There is already a firewall rule specified"),
+			cloud.ErrorReasonAlreadyExists),
+		Entry("resource in use", csError(536, 4375, "Network is in use"), cloud.ErrorReasonConflict),
+		Entry("account limit", csError(532, 4280, "Maximum number of resources of type 'user_vm' exceeded"),
+			cloud.ErrorReasonQuotaExceeded),
+		Entry("insufficient capacity", csError(533, 4250, "Unable to create a deployment for VM"),
+			cloud.ErrorReasonTransient),
+		Entry("concurrent operation", csError(530, 4300, "Unable to acquire lock"), cloud.ErrorReasonTransient),
+		Entry("API limit", csError(429, 4545, "There are too many API calls"), cloud.ErrorReasonTransient),
+		Entry("async job timeout", csapi.AsyncTimeoutErr, cloud.ErrorReasonTransient),
+		Entry("bad credentials", csError(401, 0, "unable to verify user credentials"), cloud.ErrorReasonAuth),
+		Entry("permission denied", csError(531, 4365, "Account does not have permission"), cloud.ErrorReasonAuth),
+		Entry("failed async job", errors.New(`Undefined error: {"errorcode":532,"errortext":"limit reached"}`),
+			cloud.ErrorReasonQuotaExceeded),
+		Entry("unknown command",
+			csError(432, 9999, "The given command:registerUserData does not exist or it is not available for user"),
+			cloud.ErrorReasonUnsupported),
+		Entry("unclassified", csError(530, 4250, "Internal error executing command"), cloud.ErrorReasonUnknown),
+	)
+
+	It("Keeps the codes and message of the original error", func() {
+		err := cloud.NewAPIError(csError(536, 4375, "Network is in use"))
+		var apiErr *cloud.APIError
+		Ω(errors.As(err, &apiErr)).Should(BeTrue())
+		Ω(apiErr.HTTPStatus).Should(Equal(536))
+		Ω(apiErr.CSErrorCode).Should(Equal(4375))
+		Ω(err.Error()).Should(Equal("CloudStack API error 536 (CSExceptionErrorCode: 4375): Network is in use"))
+	})
+
+	It("Returns nil for nil errors", func() {
+		Ω(cloud.NewAPIError(nil)).Should(BeNil())
+	})
+
+	It("Finds API errors through wrapped errors", func() {
+		err := multierror.Append(errors.Wrap(cloud.NewAPIError(errors.New("No match found for net")), "resolving network"),
+			errors.New("expected 1 Network with UUID , but got 0"))
+		Ω(cloud.IsNotFound(err)).Should(BeTrue())
+		Ω(cloud.IsAlreadyExists(err)).Should(BeFalse())
+		Ω(cloud.IsNotFound(errors.New("no match found"))).Should(BeFalse())
+	})
+})
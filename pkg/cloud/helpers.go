@@ -19,6 +19,7 @@ package cloud
 import (
 	"bytes"
 	cgzip "compress/gzip"
+	"encoding/json"
 )
 
 type set func(string)
@@ -54,3 +55,13 @@ func compress(str string) (string, error) {
 	}
 	return buf.String(), nil
 }
+
+// isIgnitionConfig reports whether user data is an Ignition config, which Ignition can't read gzip-compressed.
+func isIgnitionConfig(userData string) bool {
+	config := struct {
+		Ignition struct {
+			Version string `json:"version"`
+		} `json:"ignition"`
+	}{}
+	return json.Unmarshal([]byte(userData), &config) == nil && config.Ignition.Version != ""
+}
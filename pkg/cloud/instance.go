@@ -17,13 +17,18 @@ limitations under the License.
 package cloud
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
 
 	"github.com/apache/cloudstack-go/v2/cloudstack"
 	"github.com/hashicorp/go-multierror"
@@ -33,10 +38,18 @@ import (
 	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
 )
 
+// templateCreatedLayout is the layout of the creation time CloudStack reports for templates.
+const templateCreatedLayout = "2006-01-02T15:04:05-0700"
+
 type VMIface interface {
-	GetOrCreateVMInstance(*infrav1.CloudStackMachine, *clusterv1.Machine, *infrav1.CloudStackCluster, *infrav1.CloudStackFailureDomain, *infrav1.CloudStackAffinityGroup, string) error
-	ResolveVMInstanceDetails(*infrav1.CloudStackMachine) error
-	DestroyVMInstance(*infrav1.CloudStackMachine) error
+	GetOrCreateVMInstance(context.Context, *infrav1.CloudStackMachine, *clusterv1.Machine, *infrav1.CloudStackCluster, *infrav1.CloudStackFailureDomain, *infrav1.CloudStackAffinityGroup, string) error
+	ResolveVMInstanceDetails(context.Context, *infrav1.CloudStackMachine) error
+	DestroyVMInstance(context.Context, *infrav1.CloudStackMachine) error
+	CheckRootDiskSize(context.Context, *infrav1.CloudStackCluster, *infrav1.CloudStackMachine, string) error
+	ReconcileDataDisks(context.Context, *infrav1.CloudStackMachine, *infrav1.CloudStackFailureDomain) error
+	ScaleVMInstance(context.Context, *infrav1.CloudStackMachine, *infrav1.CloudStackFailureDomain) error
+	ReconcileVMInstanceTags(context.Context, *infrav1.CloudStackMachine, *infrav1.CloudStackCluster) error
+	DeleteVMInstanceUserData(context.Context, *infrav1.CloudStackMachine) error
 }
 
 // Set infrastructure spec and status from the CloudStack API's virtual machine metrics type.
@@ -44,7 +57,7 @@ func setMachineDataFromVMMetrics(vmResponse *cloudstack.VirtualMachinesMetric, c
 	csMachine.Spec.ProviderID = pointer.String(fmt.Sprintf("cloudstack:///%s", vmResponse.Id))
 	// InstanceID is later used as required parameter to destroy VM.
 	csMachine.Spec.InstanceID = pointer.String(vmResponse.Id)
-	csMachine.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: vmResponse.Ipaddress}}
+	csMachine.Status.Addresses = machineAddresses(vmResponse)
 	newInstanceState := vmResponse.State
 	if newInstanceState != csMachine.Status.InstanceState || (newInstanceState != "" && csMachine.Status.InstanceStateLastUpdated.IsZero()) {
 		csMachine.Status.InstanceState = newInstanceState
@@ -52,40 +65,110 @@ func setMachineDataFromVMMetrics(vmResponse *cloudstack.VirtualMachinesMetric, c
 	}
 }
 
+// machineAddresses returns the addresses of a VM: the IP of its default NIC first, the IPs of its other NICs as
+// internal addresses, and its public IP, if any, as an external address.
+func machineAddresses(vmResponse *cloudstack.VirtualMachinesMetric) []corev1.NodeAddress {
+	addresses := []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: vmResponse.Ipaddress}}
+	for _, nic := range vmResponse.Nic {
+		if !nic.Isdefault && nic.Ipaddress != "" {
+			addresses = append(addresses, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: nic.Ipaddress})
+		}
+		if nic.Ip6address != "" {
+			addresses = append(addresses, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: nic.Ip6address})
+		}
+	}
+	if vmResponse.Publicip != "" {
+		addresses = append(addresses, corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: vmResponse.Publicip})
+	}
+	return addresses
+}
+
 // ResolveVMInstanceDetails Retrieves VM instance details by csMachine.Spec.InstanceID or csMachine.Name, and
 // sets infrastructure machine spec and status if VM instance is found.
-func (c *client) ResolveVMInstanceDetails(csMachine *infrav1.CloudStackMachine) error {
+func (c *client) ResolveVMInstanceDetails(ctx context.Context, csMachine *infrav1.CloudStackMachine) error {
+	c = c.withContext(ctx)
 	// Attempt to fetch by ID.
 	if csMachine.Spec.InstanceID != nil {
-		vmResp, count, err := c.cs.VirtualMachine.GetVirtualMachinesMetricByID(*csMachine.Spec.InstanceID)
-		if err != nil && !strings.Contains(strings.ToLower(err.Error()), "no match found") {
+		vmResp, count, err := c.cs.VirtualMachine.GetVirtualMachinesMetricByID(*csMachine.Spec.InstanceID, c.projectOpts()...)
+		if err = NewAPIError(err); err != nil && !IsNotFound(err) {
 			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 			return err
 		} else if count > 1 {
 			return fmt.Errorf("found more than one VM Instance with ID %s", *csMachine.Spec.InstanceID)
 		} else if err == nil {
 			setMachineDataFromVMMetrics(vmResp, csMachine)
-			return nil
+			if err := c.resolvePlacement(vmResp, csMachine); err != nil {
+				return err
+			}
+			return c.resolveRootDiskSize(csMachine)
 		}
 	}
 
 	// Attempt fetch by name.
 	if csMachine.Name != "" {
-		vmResp, count, err := c.cs.VirtualMachine.GetVirtualMachinesMetricByName(csMachine.Name) // add opts usage
-		if err != nil && !strings.Contains(strings.ToLower(err.Error()), "no match") {
+		vmResp, count, err := c.cs.VirtualMachine.GetVirtualMachinesMetricByName(csMachine.Name, c.projectOpts()...)
+		if err = NewAPIError(err); err != nil && !IsNotFound(err) {
 			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 			return err
 		} else if count > 1 {
 			return fmt.Errorf("found more than one VM Instance with name %s", csMachine.Name)
 		} else if err == nil {
 			setMachineDataFromVMMetrics(vmResp, csMachine)
-			return nil
+			if err := c.resolvePlacement(vmResp, csMachine); err != nil {
+				return err
+			}
+			return c.resolveRootDiskSize(csMachine)
 		}
 	}
-	return errors.New("no match found")
+	return newNotFoundError(errors.New("no match found"))
 }
 
-func (c *client) ResolveServiceOffering(csMachine *infrav1.CloudStackMachine, zoneID string) (offeringID string, retErr error) {
+// resolvePlacement sets the host the VM runs on in the machine status, along with the pod and cluster of the host. The
+// host is only listed when the VM moves to another one, and only visible to root admins.
+func (c *client) resolvePlacement(vmResponse *cloudstack.VirtualMachinesMetric, csMachine *infrav1.CloudStackMachine) error {
+	if vmResponse.Hostid == "" {
+		return nil
+	} else if csMachine.Status.Placement != nil && csMachine.Status.Placement.Host.ID == vmResponse.Hostid {
+		return nil
+	}
+	host, count, err := c.cs.Host.GetHostByID(vmResponse.Hostid)
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return errors.Wrapf(err, "getting host %s", vmResponse.Hostid)
+	} else if count != 1 {
+		return errors.Errorf("expected 1 host with ID %s, but got %d", vmResponse.Hostid, count)
+	}
+	csMachine.Status.Placement = &infrav1.CloudStackMachinePlacement{
+		Host:    infrav1.CloudStackResourceIdentifier{ID: host.Id, Name: host.Name},
+		Cluster: infrav1.CloudStackResourceIdentifier{ID: host.Clusterid, Name: host.Clustername},
+		Pod:     infrav1.CloudStackResourceIdentifier{ID: host.Podid, Name: host.Podname},
+	}
+	return nil
+}
+
+// resolveRootDiskSize sets the size of the root disk of the machine's instance in the machine status, once, for
+// machines overriding the size of their template. It's left unset until the instance has a root volume.
+func (c *client) resolveRootDiskSize(csMachine *infrav1.CloudStackMachine) error {
+	if csMachine.Spec.RootDiskSize == 0 || csMachine.Status.RootDiskSize != 0 {
+		return nil
+	}
+	p := c.cs.Volume.NewListVolumesParams()
+	p.SetVirtualmachineid(*csMachine.Spec.InstanceID)
+	p.SetType("ROOT")
+	setIfNotEmpty(c.projectID, p.SetProjectid)
+	resp, err := c.cs.Volume.ListVolumes(p)
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return errors.Wrap(err, "listing root volume")
+	}
+	if resp.Count > 0 {
+		csMachine.Status.RootDiskSize = resp.Volumes[0].Size >> 30
+	}
+	return nil
+}
+
+func (c *client) ResolveServiceOffering(ctx context.Context, csMachine *infrav1.CloudStackMachine, zoneID string) (offeringID string, retErr error) {
+	c = c.withContext(ctx)
 	if len(csMachine.Spec.Offering.ID) > 0 {
 		csOffering, count, err := c.cs.ServiceOffering.GetServiceOfferingByID(csMachine.Spec.Offering.ID)
 		if err != nil {
@@ -101,6 +184,9 @@ func (c *client) ResolveServiceOffering(csMachine *infrav1.CloudStackMachine, zo
 			return "", multierror.Append(retErr, errors.Errorf(
 				"offering name %s does not match name %s returned using UUID %s", csMachine.Spec.Offering.Name, csOffering.Name, csMachine.Spec.Offering.ID))
 		}
+		if csMachine.HasCustomCompute() {
+			return verifyServiceOffering(csMachine, csOffering, retErr)
+		}
 		return csMachine.Spec.Offering.ID, nil
 	}
 	offeringID, count, err := c.cs.ServiceOffering.GetServiceOfferingID(csMachine.Spec.Offering.Name, cloudstack.WithZone(zoneID))
@@ -112,16 +198,103 @@ func (c *client) ResolveServiceOffering(csMachine *infrav1.CloudStackMachine, zo
 		return "", multierror.Append(retErr, errors.Errorf(
 			"expected 1 Service Offering with name %s in zone %s, but got %d", csMachine.Spec.Offering.Name, zoneID, count))
 	}
+	if csMachine.HasCustomCompute() {
+		csOffering, count, err := c.cs.ServiceOffering.GetServiceOfferingByID(offeringID)
+		if err != nil {
+			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+			return "", multierror.Append(retErr, errors.Wrapf(
+				err, "could not get Service Offering by ID %s", offeringID))
+		} else if count != 1 {
+			return "", multierror.Append(retErr, errors.Errorf(
+				"expected 1 Service Offering with UUID %s, but got %d", offeringID, count))
+		}
+		return verifyServiceOffering(csMachine, csOffering, retErr)
+	}
 	return offeringID, nil
 }
 
+// verifyServiceOffering checks the CPU, memory and CPU speed of a machine against its customized compute offering and
+// the offering's limits.
+func verifyServiceOffering(csMachine *infrav1.CloudStackMachine, csOffering *cloudstack.ServiceOffering, retErr error) (string, error) {
+	if !csOffering.Iscustomized {
+		return "", multierror.Append(retErr, errors.Errorf(
+			"service offering with UUID %s is not customized, cpu, memoryMiB and cpuSpeedMHz can not be specified",
+			csOffering.Id))
+	}
+	if csMachine.Spec.CPU == 0 && csOffering.Cpunumber == 0 {
+		return "", multierror.Append(retErr, errors.Errorf(
+			"service offering with UUID %s is customized, cpu can not be 0", csOffering.Id))
+	}
+	if csMachine.Spec.MemoryMiB == 0 && csOffering.Memory == 0 {
+		return "", multierror.Append(retErr, errors.Errorf(
+			"service offering with UUID %s is customized, memoryMiB can not be 0", csOffering.Id))
+	}
+	if csMachine.Spec.CPUSpeedMHz == 0 && csOffering.Cpuspeed == 0 {
+		return "", multierror.Append(retErr, errors.Errorf(
+			"service offering with UUID %s is customized without a CPU speed, cpuSpeedMHz can not be 0", csOffering.Id))
+	}
+
+	for _, limit := range []struct {
+		field      string
+		value      int64
+		minDetail  string
+		maxDetail  string
+		fixedValue int
+	}{
+		{"cpu", csMachine.Spec.CPU, "mincpunumber", "maxcpunumber", csOffering.Cpunumber},
+		{"memoryMiB", csMachine.Spec.MemoryMiB, "minmemory", "maxmemory", csOffering.Memory},
+	} {
+		if limit.value == 0 {
+			continue
+		}
+		if limit.fixedValue > 0 && limit.value != int64(limit.fixedValue) {
+			return "", multierror.Append(retErr, errors.Errorf(
+				"service offering with UUID %s fixes %s to %d, but got %d",
+				csOffering.Id, limit.field, limit.fixedValue, limit.value))
+		}
+		if min, err := strconv.ParseInt(csOffering.Serviceofferingdetails[limit.minDetail], 10, 64); err == nil && limit.value < min {
+			return "", multierror.Append(retErr, errors.Errorf(
+				"%s %d is below the minimum %d of service offering with UUID %s", limit.field, limit.value, min, csOffering.Id))
+		}
+		if max, err := strconv.ParseInt(csOffering.Serviceofferingdetails[limit.maxDetail], 10, 64); err == nil && limit.value > max {
+			return "", multierror.Append(retErr, errors.Errorf(
+				"%s %d is above the maximum %d of service offering with UUID %s", limit.field, limit.value, max, csOffering.Id))
+		}
+	}
+	if csOffering.Cpuspeed > 0 && csMachine.Spec.CPUSpeedMHz > 0 && csMachine.Spec.CPUSpeedMHz != int64(csOffering.Cpuspeed) {
+		return "", multierror.Append(retErr, errors.Errorf(
+			"service offering with UUID %s fixes cpuSpeedMHz to %d, but got %d",
+			csOffering.Id, csOffering.Cpuspeed, csMachine.Spec.CPUSpeedMHz))
+	}
+	return csOffering.Id, nil
+}
+
+// ResolveTemplate returns the ID of the machine's template, given by ID or name, resolved from the
+// CloudStackTemplate its TemplateRef refers to, or selected by its TemplateSelector. A selected template is pinned to
+// the machine's status, so the machine keeps its template when newer ones match.
 func (c *client) ResolveTemplate(
+	ctx context.Context,
 	csCluster *infrav1.CloudStackCluster,
 	csMachine *infrav1.CloudStackMachine,
 	zoneID string,
 ) (templateID string, retErr error) {
+	c = c.withContext(ctx)
+	if csMachine.Spec.TemplateRef != "" { // Resolved from the CloudStackTemplate by the machine's controller.
+		if csMachine.Status.TemplateID == "" {
+			return "", errors.Errorf("template of CloudStackTemplate %s not resolved", csMachine.Spec.TemplateRef)
+		}
+		return csMachine.Status.TemplateID, nil
+	}
+	if csMachine.Spec.TemplateSelector != nil {
+		if csMachine.Status.TemplateID == "" {
+			if csMachine.Status.TemplateID, retErr = c.selectTemplate(csMachine.Spec.TemplateSelector, zoneID); retErr != nil {
+				return "", retErr
+			}
+		}
+		return csMachine.Status.TemplateID, nil
+	}
 	if len(csMachine.Spec.Template.ID) > 0 {
-		csTemplate, count, err := c.cs.Template.GetTemplateByID(csMachine.Spec.Template.ID, "executable")
+		csTemplate, count, err := c.cs.Template.GetTemplateByID(csMachine.Spec.Template.ID, "executable", c.projectOpts()...)
 		if err != nil {
 			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 			return "", multierror.Append(retErr, errors.Wrapf(
@@ -137,7 +310,7 @@ func (c *client) ResolveTemplate(
 		}
 		return csMachine.Spec.Template.ID, nil
 	}
-	templateID, count, err := c.cs.Template.GetTemplateID(csMachine.Spec.Template.Name, "executable", zoneID)
+	templateID, count, err := c.cs.Template.GetTemplateID(csMachine.Spec.Template.Name, "executable", zoneID, c.projectOpts()...)
 	if err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 		return "", multierror.Append(retErr, errors.Wrapf(
@@ -149,28 +322,116 @@ func (c *client) ResolveTemplate(
 	return templateID, nil
 }
 
+// selectTemplate returns the ID of the newest ready template of the zone matching the selector.
+func (c *client) selectTemplate(selector *infrav1.CloudStackTemplateSelector, zoneID string) (string, error) {
+	nameRegex, err := regexp.Compile(selector.NameRegex)
+	if err != nil {
+		return "", errors.Wrapf(err, "parsing template name regex %s", selector.NameRegex)
+	}
+	p := c.cs.Template.NewListTemplatesParams("executable")
+	p.SetZoneid(zoneID)
+	if len(selector.MatchTags) > 0 {
+		p.SetTags(selector.MatchTags)
+	}
+	setIfNotEmpty(c.projectID, p.SetProjectid)
+	resp, err := c.cs.Template.ListTemplates(p)
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return "", errors.Wrap(err, "listing templates to select from")
+	}
+
+	var newest *cloudstack.Template
+	var newestCreated time.Time
+	for _, template := range resp.Templates {
+		if !template.Isready || !nameRegex.MatchString(template.Name) {
+			continue
+		}
+		created, err := time.Parse(templateCreatedLayout, template.Created)
+		if err != nil {
+			return "", errors.Wrapf(err, "parsing creation time of template %s", template.Name)
+		}
+		// Templates created at the same time are told apart by name, so the same template is always selected.
+		if newest == nil || created.After(newestCreated) || created.Equal(newestCreated) && template.Name > newest.Name {
+			newest, newestCreated = template, created
+		}
+	}
+	if newest == nil {
+		return "", errors.Errorf("no ready template in zone %s matches tags %v and name regex %q",
+			zoneID, selector.MatchTags, selector.NameRegex)
+	}
+	return newest.Id, nil
+}
+
+// ErrRootDiskTooSmall is returned when a machine's rootDiskSize is smaller than the size of its template. The machine's
+// admission webhook rejects it when it can resolve the template, and the InstanceDeployed condition reports it otherwise.
+var ErrRootDiskTooSmall = errors.New("root disk too small for template")
+
+// CheckRootDiskSize ensures the root disk size of a machine, if set, isn't smaller than the size of the template it
+// resolves to in the zone. The machine is left untouched, so it can be checked before it's created.
+func (c *client) CheckRootDiskSize(
+	ctx context.Context,
+	csCluster *infrav1.CloudStackCluster,
+	csMachine *infrav1.CloudStackMachine,
+	zoneID string,
+) error {
+	if csMachine.Spec.RootDiskSize == 0 {
+		return nil
+	}
+	csMachine = csMachine.DeepCopy() // Resolving a template selector pins the template in the status.
+	templateID, err := c.ResolveTemplate(ctx, csCluster, csMachine, zoneID)
+	if err != nil {
+		return err
+	}
+	return c.withContext(ctx).checkRootDiskSize(csMachine, templateID)
+}
+
+// checkRootDiskSize ensures the root disk size of a machine, if set, isn't smaller than the size of its template.
+func (c *client) checkRootDiskSize(csMachine *infrav1.CloudStackMachine, templateID string) error {
+	if csMachine.Spec.RootDiskSize == 0 {
+		return nil
+	}
+	csTemplate, count, err := c.cs.Template.GetTemplateByID(templateID, "executable", c.projectOpts()...)
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return errors.Wrapf(err, "could not get Template by ID %s", templateID)
+	} else if count != 1 {
+		return errors.Errorf("expected 1 Template with UUID %s, but got %d", templateID, count)
+	}
+	if csMachine.Spec.RootDiskSize<<30 < csTemplate.Size {
+		return fmt.Errorf("%w: rootDiskSize %d GB is smaller than the %d GB of template %s", ErrRootDiskTooSmall,
+			csMachine.Spec.RootDiskSize, (csTemplate.Size+1<<30-1)>>30, csTemplate.Name)
+	}
+	return nil
+}
+
 // ResolveDiskOffering Retrieves diskOffering by using disk offering ID if ID is provided and confirm returned
 // disk offering name matches name provided in spec.
 // If disk offering ID is not provided, the disk offering name is used to retrieve disk offering ID.
-func (c *client) ResolveDiskOffering(csMachine *infrav1.CloudStackMachine, zoneID string) (diskOfferingID string, retErr error) {
-	diskOfferingID = csMachine.Spec.DiskOffering.ID
-	if len(csMachine.Spec.DiskOffering.Name) > 0 {
-		diskID, count, err := c.cs.DiskOffering.GetDiskOfferingID(csMachine.Spec.DiskOffering.Name, cloudstack.WithZone(zoneID))
+func (c *client) ResolveDiskOffering(ctx context.Context, csMachine *infrav1.CloudStackMachine, zoneID string) (diskOfferingID string, retErr error) {
+	return c.withContext(ctx).resolveDiskOffering(&csMachine.Spec.DiskOffering, zoneID)
+}
+
+// resolveDiskOffering resolves the ID of one of a machine's disk offerings: the one it's deployed with or that of a
+// data disk.
+func (c *client) resolveDiskOffering(offering *infrav1.CloudStackResourceDiskOffering, zoneID string) (diskOfferingID string, retErr error) {
+	diskOfferingID = offering.ID
+	if len(offering.Name) > 0 {
+		diskID, count, err := c.cs.DiskOffering.GetDiskOfferingID(offering.Name, cloudstack.WithZone(zoneID))
 		if err != nil {
 			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 			return "", multierror.Append(retErr, errors.Wrapf(
-				err, "could not get DiskOffering ID from %s", csMachine.Spec.DiskOffering.Name))
+				err, "could not get DiskOffering ID from %s", offering.Name))
 		} else if count != 1 {
 			return "", multierror.Append(retErr, errors.Errorf(
-				"expected 1 DiskOffering with name %s in zone %s, but got %d", csMachine.Spec.DiskOffering.Name, zoneID, count))
-		} else if len(csMachine.Spec.DiskOffering.ID) > 0 && diskID != csMachine.Spec.DiskOffering.ID {
+				"expected 1 DiskOffering with name %s in zone %s, but got %d", offering.Name, zoneID, count))
+		} else if len(offering.ID) > 0 && diskID != offering.ID {
 			return "", multierror.Append(retErr, errors.Errorf(
 				"diskOffering ID %s does not match ID %s returned using name %s in zone %s",
-				csMachine.Spec.DiskOffering.ID, diskID, csMachine.Spec.DiskOffering.Name, zoneID))
+				offering.ID, diskID, offering.Name, zoneID))
 		} else if len(diskID) == 0 {
 			return "", multierror.Append(retErr, errors.Errorf(
 				"empty diskOffering ID %s returned using name %s in zone %s",
-				diskID, csMachine.Spec.DiskOffering.Name, zoneID))
+				diskID, offering.Name, zoneID))
 		}
 		diskOfferingID = diskID
 	}
@@ -178,10 +439,10 @@ func (c *client) ResolveDiskOffering(csMachine *infrav1.CloudStackMachine, zoneI
 		return "", nil
 	}
 
-	return verifyDiskoffering(csMachine, c, diskOfferingID, retErr)
+	return verifyDiskoffering(offering, c, diskOfferingID, retErr)
 }
 
-func verifyDiskoffering(csMachine *infrav1.CloudStackMachine, c *client, diskOfferingID string, retErr error) (string, error) {
+func verifyDiskoffering(offering *infrav1.CloudStackResourceDiskOffering, c *client, diskOfferingID string, retErr error) (string, error) {
 	csDiskOffering, count, err := c.cs.DiskOffering.GetDiskOfferingByID(diskOfferingID)
 	if err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
@@ -192,13 +453,13 @@ func verifyDiskoffering(csMachine *infrav1.CloudStackMachine, c *client, diskOff
 			"expected 1 DiskOffering with UUID %s, but got %d", diskOfferingID, count))
 	}
 
-	if csDiskOffering.Iscustomized && csMachine.Spec.DiskOffering.CustomSize == 0 {
+	if csDiskOffering.Iscustomized && offering.CustomSize == 0 {
 		return "", multierror.Append(retErr, errors.Errorf(
 			"diskOffering with UUID %s is customized, disk size can not be 0 GB",
 			diskOfferingID))
 	}
 
-	if !csDiskOffering.Iscustomized && csMachine.Spec.DiskOffering.CustomSize > 0 {
+	if !csDiskOffering.Iscustomized && offering.CustomSize > 0 {
 		return "", multierror.Append(retErr, errors.Errorf(
 			"diskOffering with UUID %s is not customized, disk size can not be specified",
 			diskOfferingID))
@@ -209,6 +470,7 @@ func verifyDiskoffering(csMachine *infrav1.CloudStackMachine, c *client, diskOff
 // GetOrCreateVMInstance CreateVMInstance will fetch or create a VM instance, and
 // sets the infrastructure machine spec and status accordingly.
 func (c *client) GetOrCreateVMInstance(
+	ctx context.Context,
 	csMachine *infrav1.CloudStackMachine,
 	capiMachine *clusterv1.Machine,
 	csCluster *infrav1.CloudStackCluster,
@@ -216,44 +478,88 @@ func (c *client) GetOrCreateVMInstance(
 	affinity *infrav1.CloudStackAffinityGroup,
 	userData string,
 ) error {
+	c = c.withContext(ctx)
+
+	// Poll the deployment submitted by a previous reconciliation.
+	if hasMachineJob(csMachine, infrav1.AsyncJobDeploy) {
+		if err := c.pollMachineJob(csMachine, infrav1.AsyncJobDeploy); err != nil {
+			return err
+		}
+		csMachine.Status.Status = pointer.String(metav1.StatusSuccess)
+		conditions.MarkTrue(csMachine, infrav1.InstanceDeployedCondition)
+	}
 
 	// Check if VM instance already exists.
-	if err := c.ResolveVMInstanceDetails(csMachine); err == nil ||
-		!strings.Contains(strings.ToLower(err.Error()), "no match") {
+	if err := c.ResolveVMInstanceDetails(ctx, csMachine); err == nil || !IsNotFound(err) {
 		return err
 	}
 
-	offeringID, err := c.ResolveServiceOffering(csMachine, fd.Spec.Zone.ID)
+	offeringID, err := c.ResolveServiceOffering(ctx, csMachine, fd.Spec.Zone.ID)
 	if err != nil {
 		return err
 	}
-	templateID, err := c.ResolveTemplate(csCluster, csMachine, fd.Spec.Zone.ID)
+	templateID, err := c.ResolveTemplate(ctx, csCluster, csMachine, fd.Spec.Zone.ID)
 	if err != nil {
 		return err
 	}
-	diskOfferingID, err := c.ResolveDiskOffering(csMachine, fd.Spec.Zone.ID)
+	if err := c.checkRootDiskSize(csMachine, templateID); errors.Is(err, ErrRootDiskTooSmall) {
+		conditions.MarkFalse(csMachine, infrav1.InstanceDeployedCondition, infrav1.RootDiskTooSmallReason,
+			clusterv1.ConditionSeverityError, err.Error())
+		return err
+	} else if err != nil {
+		return err
+	}
+	diskOfferingID, err := c.ResolveDiskOffering(ctx, csMachine, fd.Spec.Zone.ID)
 	if err != nil {
 		return err
 	}
 
 	// Create VM instance.
 	p := c.cs.VirtualMachine.NewDeployVirtualMachineParams(offeringID, templateID, fd.Spec.Zone.ID)
-	p.SetNetworkids([]string{fd.Spec.Zone.Network.ID})
+	if len(csMachine.Spec.Networks) > 0 {
+		ipToNetworkList, err := c.resolveIPToNetworkList(ctx, csMachine, fd)
+		if err != nil {
+			return err
+		}
+		p.SetIptonetworklist(ipToNetworkList)
+	} else {
+		p.SetNetworkids([]string{fd.Spec.Zone.Network.ID})
+		setIfNotEmpty(csMachine.Spec.IPAddress, p.SetIpaddress)
+	}
+	setIfNotEmpty(c.projectID, p.SetProjectid)
 	setIfNotEmpty(csMachine.Name, p.SetName)
 	setIfNotEmpty(capiMachine.Name, p.SetDisplayname)
 	setIfNotEmpty(diskOfferingID, p.SetDiskofferingid)
 	setIntIfPositive(csMachine.Spec.DiskOffering.CustomSize, p.SetSize)
+	setIntIfPositive(csMachine.Spec.RootDiskSize, p.SetRootdisksize)
+
+	if len(csMachine.Spec.DataDisks) > 0 {
+		// Data disks are attached before the VM first starts, so cloud-init finds them.
+		p.SetStartvm(false)
+	}
 
 	setIfNotEmpty(csMachine.Spec.SSHKey, p.SetKeypair)
 
-	if csMachine.CompressUserdata() {
+	hints := placementHints(csMachine, fd)
+	setIfNotEmpty(hints.HostID, p.SetHostid)
+	setIfNotEmpty(hints.ClusterID, p.SetClusterid)
+	setIfNotEmpty(hints.PodID, p.SetPodid)
+	setIfNotEmpty(hints.DeploymentPlanner, p.SetDeploymentplanner)
+
+	if csMachine.CompressUserdata() && !isIgnitionConfig(userData) {
 		userData, err = compress(userData)
 		if err != nil {
 			return err
 		}
 	}
 	userData = base64.StdEncoding.EncodeToString([]byte(userData))
-	setIfNotEmpty(userData, p.SetUserdata)
+	userDataID, err := c.registerUserData(csMachine, userData)
+	if err != nil {
+		return err
+	}
+	if userDataID == "" {
+		setIfNotEmpty(userData, p.SetUserdata)
+	}
 
 	if len(csMachine.Spec.AffinityGroupIDs) > 0 {
 		p.SetAffinitygroupids(csMachine.Spec.AffinityGroupIDs)
@@ -261,18 +567,25 @@ func (c *client) GetOrCreateVMInstance(
 		p.SetAffinitygroupids([]string{affinity.Spec.ID})
 	}
 
-	if csMachine.Spec.Details != nil {
-		p.SetDetails(csMachine.Spec.Details)
+	if details := deployDetails(csMachine); len(details) > 0 {
+		p.SetDetails(details)
 	}
 
-	deployVMResp, err := c.cs.VirtualMachine.DeployVirtualMachine(p)
+	// Submit the deployment without waiting for it. Deployments can take minutes, and the job is polled on later
+	// reconciliations instead.
+	var deployVMResp *cloudstack.DeployVirtualMachineResponse
+	if userDataID != "" {
+		deployVMResp, err = c.deployVirtualMachineWithUserDataID(p, userDataID)
+	} else {
+		deployVMResp, err = c.csAsync.VirtualMachine.DeployVirtualMachine(p)
+	}
 	if err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 
 		// CloudStack may have created the VM even though it reported an error. We attempt to
 		// retrieve the VM so we can populate the CloudStackMachine for the user to manually
 		// clean up.
-		vm, findErr := findVirtualMachine(c.cs.VirtualMachine, templateID, fd, csMachine)
+		vm, findErr := findVirtualMachine(c.cs.VirtualMachine, c.projectID, templateID, fd, csMachine)
 		if findErr != nil {
 			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(findErr)
 			return fmt.Errorf("%v; find virtual machine: %v", err, findErr)
@@ -287,17 +600,106 @@ func (c *client) GetOrCreateVMInstance(
 		csMachine.Status.InstanceState = vm.State
 	} else {
 		csMachine.Spec.InstanceID = pointer.String(deployVMResp.Id)
+		// The deployment only succeeded once its job completes, possibly on a later reconciliation.
+		if err := c.trackMachineJob(csMachine, infrav1.AsyncJobDeploy, deployVMResp.JobID); err != nil {
+			return err
+		}
 		csMachine.Status.Status = pointer.String(metav1.StatusSuccess)
+		conditions.MarkTrue(csMachine, infrav1.InstanceDeployedCondition)
 	}
 	// Resolve uses a VM metrics request response to fill cloudstack machine status.
 	// The deployment response is insufficient.
-	return c.ResolveVMInstanceDetails(csMachine)
+	return c.ResolveVMInstanceDetails(ctx, csMachine)
+}
+
+// placementHints returns the placement hints a machine is deployed with: those of its spec, and those of its failure
+// domain's zone it doesn't set.
+func placementHints(csMachine *infrav1.CloudStackMachine, fd *infrav1.CloudStackFailureDomain) infrav1.CloudStackPlacementHints {
+	hints := csMachine.Spec.CloudStackPlacementHints
+	zoneHints := fd.Spec.Zone.CloudStackPlacementHints
+	if hints.HostID == "" {
+		hints.HostID = zoneHints.HostID
+	}
+	if hints.ClusterID == "" {
+		hints.ClusterID = zoneHints.ClusterID
+	}
+	if hints.PodID == "" {
+		hints.PodID = zoneHints.PodID
+	}
+	if hints.DeploymentPlanner == "" {
+		hints.DeploymentPlanner = zoneHints.DeploymentPlanner
+	}
+	return hints
+}
+
+// deployDetails returns the details a machine is deployed with: the details of its spec, with its CPU, memory and CPU
+// speed for customized compute offerings.
+func deployDetails(csMachine *infrav1.CloudStackMachine) map[string]string {
+	if !csMachine.HasCustomCompute() {
+		return csMachine.Spec.Details
+	}
+	details := make(map[string]string, len(csMachine.Spec.Details)+3)
+	for k, v := range csMachine.Spec.Details {
+		details[k] = v
+	}
+	for k, v := range computeDetails(csMachine) {
+		details[k] = v
+	}
+	return details
+}
+
+// computeDetails returns the CPU, memory and CPU speed a machine sets for its customized compute offering, as the
+// details CloudStack takes them from.
+func computeDetails(csMachine *infrav1.CloudStackMachine) map[string]string {
+	details := make(map[string]string, 3)
+	for key, value := range map[string]int64{
+		"cpuNumber": csMachine.Spec.CPU,
+		"memory":    csMachine.Spec.MemoryMiB,
+		"cpuSpeed":  csMachine.Spec.CPUSpeedMHz,
+	} {
+		if value > 0 {
+			details[key] = strconv.FormatInt(value, 10)
+		}
+	}
+	return details
+}
+
+// resolveIPToNetworkList returns the networks a machine is deployed on, with their static IPs: the network of the
+// failure domain's zone, which makes the default NIC, followed by the machine's additional networks. Networks given
+// by name are resolved to their ID.
+func (c *client) resolveIPToNetworkList(
+	ctx context.Context,
+	csMachine *infrav1.CloudStackMachine,
+	fd *infrav1.CloudStackFailureDomain,
+) ([]map[string]string, error) {
+	ipToNetworkList := []map[string]string{{"networkid": fd.Spec.Zone.Network.ID}}
+	if csMachine.Spec.IPAddress != "" {
+		ipToNetworkList[0]["ip"] = csMachine.Spec.IPAddress
+	}
+	for _, network := range csMachine.Spec.Networks {
+		networkID := network.ID
+		if networkID == "" {
+			resolved := &infrav1.Network{Name: network.Name}
+			if err := c.ResolveNetwork(ctx, resolved); err != nil {
+				return nil, errors.Wrapf(err, "resolving network %s", network.Name)
+			}
+			networkID = resolved.ID
+		}
+		entry := map[string]string{"networkid": networkID}
+		if network.IP != "" {
+			entry["ip"] = network.IP
+		}
+		ipToNetworkList = append(ipToNetworkList, entry)
+	}
+	return ipToNetworkList, nil
 }
 
 // findVirtualMachine retrieves a virtual machine by matching its expected name, template, failure
-// domain zone and failure domain network. If no virtual machine is found it returns nil, nil.
+// domain zone and failure domain network within the passed project, if any. If no virtual machine is found it returns
+// nil, nil.
 func findVirtualMachine(
 	client cloudstack.VirtualMachineServiceIface,
+	projectID string,
 	templateID string,
 	failureDomain *infrav1.CloudStackFailureDomain,
 	machine *infrav1.CloudStackMachine,
@@ -307,6 +709,7 @@ func findVirtualMachine(
 	params.SetZoneid(failureDomain.Spec.Zone.ID)
 	params.SetNetworkid(failureDomain.Spec.Zone.Network.ID)
 	params.SetName(machine.Name)
+	setIfNotEmpty(projectID, params.SetProjectid)
 
 	response, err := client.ListVirtualMachines(params)
 	if err != nil {
@@ -321,7 +724,26 @@ func findVirtualMachine(
 }
 
 // DestroyVMInstance Destroys a VM instance. Assumes machine has been fetched prior and has an instance ID.
-func (c *client) DestroyVMInstance(csMachine *infrav1.CloudStackMachine) error {
+func (c *client) DestroyVMInstance(ctx context.Context, csMachine *infrav1.CloudStackMachine) error {
+	c = c.withContext(ctx)
+	// Wait for the destruction submitted by a previous reconciliation, or any other job still running for the VM. Only
+	// the failure of a destruction matters here.
+	if kind := csMachine.Status.AsyncJobKind; csMachine.Status.AsyncJobID != "" {
+		if err := c.pollMachineJob(csMachine, kind); errors.Is(err, ErrAsyncJobPending) {
+			return errors.New("VM deletion in progress")
+		} else if err != nil && (kind == infrav1.AsyncJobDestroy || kind == "") {
+			return err
+		}
+		if destroyed, err := c.isVMInstanceDestroyed(ctx, csMachine); err != nil || destroyed {
+			return err
+		}
+	}
+
+	// Data disks that aren't attached yet aren't destroyed along with the VM.
+	if err := c.deleteUnattachedDataDisks(csMachine); err != nil {
+		return err
+	}
+
 	// Attempt deletion regardless of machine state.
 	p := c.csAsync.VirtualMachine.NewDestroyVirtualMachineParams(*csMachine.Spec.InstanceID)
 	volIDs, err := c.listVMInstanceDatadiskVolumeIDs(*csMachine.Spec.InstanceID)
@@ -330,33 +752,51 @@ func (c *client) DestroyVMInstance(csMachine *infrav1.CloudStackMachine) error {
 	}
 	p.SetExpunge(true)
 	setArrayIfNotEmpty(volIDs, p.SetVolumeids)
-	if _, err := c.csAsync.VirtualMachine.DestroyVirtualMachine(p); err != nil &&
-		strings.Contains(strings.ToLower(err.Error()), "unable to find uuid for id") {
-		// VM doesn't exist. Success...
-		return nil
-	} else if err != nil {
+	destroyVMResp, err := c.csAsync.VirtualMachine.DestroyVirtualMachine(p)
+	if err = NewAPIError(err); isParamError(err) {
+		// CloudStack rejects the IDs of VMs expunged meanwhile as invalid.
+		if destroyed, checkErr := c.isVMInstanceDestroyed(ctx, csMachine); checkErr == nil && destroyed {
+			return nil
+		}
+	}
+	if err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 		return err
 	}
+	if destroyVMResp != nil {
+		if err := c.trackMachineJob(csMachine, infrav1.AsyncJobDestroy, destroyVMResp.JobID); errors.Is(err, ErrAsyncJobPending) {
+			return errors.New("VM deletion in progress")
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if destroyed, err := c.isVMInstanceDestroyed(ctx, csMachine); err != nil || destroyed {
+		return err
+	}
+	return errors.New("VM deletion in progress")
+}
 
-	if err := c.ResolveVMInstanceDetails(csMachine); err == nil && (csMachine.Status.InstanceState == "Expunging" ||
+// isVMInstanceDestroyed reports whether the machine's VM instance no longer exists or is being expunged.
+func (c *client) isVMInstanceDestroyed(ctx context.Context, csMachine *infrav1.CloudStackMachine) (bool, error) {
+	if err := c.ResolveVMInstanceDetails(ctx, csMachine); err == nil && (csMachine.Status.InstanceState == "Expunging" ||
 		csMachine.Status.InstanceState == "Expunged") {
 		// VM is stopped and getting expunged.  So the desired state is getting satisfied.  Let's move on.
-		return nil
+		return true, nil
 	} else if err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "no match found") {
+		if IsNotFound(err) {
 			// VM doesn't exist.  So the desired state is in effect.  Our work is done here.
-			return nil
+			return true, nil
 		}
-		return err
+		return false, err
 	}
-
-	return errors.New("VM deletion in progress")
+	return false, nil
 }
 
 func (c *client) listVMInstanceDatadiskVolumeIDs(instanceID string) ([]string, error) {
 	p := c.cs.Volume.NewListVolumesParams()
 	p.SetVirtualmachineid(instanceID)
+	setIfNotEmpty(c.projectID, p.SetProjectid)
 	// VM root volumes are destroyed automatically, no need to explicitly include
 	p.SetType("DATADISK")
 
@@ -374,3 +814,37 @@ func (c *client) listVMInstanceDatadiskVolumeIDs(instanceID string) ([]string, e
 	return ret, nil
 
 }
+
+// ReconcileVMInstanceTags applies the additional tags of the machine and its cluster to the machine's instance and the
+// volumes attached to it, removing the ones applied before that were since removed from the machine or cluster.
+func (c *client) ReconcileVMInstanceTags(
+	ctx context.Context,
+	csMachine *infrav1.CloudStackMachine,
+	csCluster *infrav1.CloudStackCluster,
+) error {
+	tags := mergeTags(csCluster.Spec.AdditionalTags, csMachine.Spec.AdditionalTags)
+	if tagsEqual(tags, csMachine.Status.AppliedTags) {
+		return nil
+	}
+	c = c.withContext(ctx)
+
+	instanceID := *csMachine.Spec.InstanceID
+	if err := c.ReconcileTags(ctx, ResourceTypeVM, instanceID, tags, csMachine.Status.AppliedTags); err != nil {
+		return err
+	}
+	p := c.cs.Volume.NewListVolumesParams()
+	p.SetVirtualmachineid(instanceID)
+	setIfNotEmpty(c.projectID, p.SetProjectid)
+	resp, err := c.cs.Volume.ListVolumes(p)
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return errors.Wrapf(err, "listing volumes of VM %s", instanceID)
+	}
+	for _, volume := range resp.Volumes {
+		if err := c.ReconcileTags(ctx, ResourceTypeVolume, volume.Id, tags, csMachine.Status.AppliedTags); err != nil {
+			return err
+		}
+	}
+	csMachine.Status.AppliedTags = tags
+	return nil
+}
@@ -19,6 +19,7 @@ package cloud_test
 import (
 	"encoding/base64"
 	"fmt"
+	"net/url"
 
 	"github.com/apache/cloudstack-go/v2/cloudstack"
 	"github.com/golang/mock/gomock"
@@ -30,7 +31,11 @@ import (
 
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/pointer"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/test/fakeacs"
+	"sigs.k8s.io/cluster-api/util/conditions"
 )
 
 var _ = Describe("Instance", func() {
@@ -53,6 +58,7 @@ var _ = Describe("Instance", func() {
 		dos        *cloudstack.MockDiskOfferingServiceIface
 		ts         *cloudstack.MockTemplateServiceIface
 		vs         *cloudstack.MockVolumeServiceIface
+		ajs        *cloudstack.MockAsyncjobServiceIface
 		client     cloud.Client
 	)
 
@@ -64,6 +70,7 @@ var _ = Describe("Instance", func() {
 		dos = mockClient.DiskOffering.(*cloudstack.MockDiskOfferingServiceIface)
 		ts = mockClient.Template.(*cloudstack.MockTemplateServiceIface)
 		vs = mockClient.Volume.(*cloudstack.MockVolumeServiceIface)
+		ajs = mockClient.Asyncjob.(*cloudstack.MockAsyncjobServiceIface)
 		client = cloud.NewClientFromCSAPIClient(mockClient)
 
 		dummies.SetDummyVars()
@@ -76,19 +83,19 @@ var _ = Describe("Instance", func() {
 	Context("when fetching a VM instance", func() {
 		It("Handles an unknown error when fetching by ID", func() {
 			vms.EXPECT().GetVirtualMachinesMetricByID(*dummies.CSMachine1.Spec.InstanceID).Return(nil, -1, unknownError)
-			Ω(client.ResolveVMInstanceDetails(dummies.CSMachine1)).To(MatchError(unknownErrorMessage))
+			Ω(client.ResolveVMInstanceDetails(ctx, dummies.CSMachine1)).To(MatchError(unknownErrorMessage))
 		})
 
 		It("Handles finding more than one VM instance by ID", func() {
 			vms.EXPECT().GetVirtualMachinesMetricByID(*dummies.CSMachine1.Spec.InstanceID).Return(nil, 2, nil)
-			Ω(client.ResolveVMInstanceDetails(dummies.CSMachine1)).
+			Ω(client.ResolveVMInstanceDetails(ctx, dummies.CSMachine1)).
 				Should(MatchError("found more than one VM Instance with ID " + *dummies.CSMachine1.Spec.InstanceID))
 		})
 
 		It("sets dummies.CSMachine1 spec and status values when VM instance found by ID", func() {
 			vmsResp := &cloudstack.VirtualMachinesMetric{Id: *dummies.CSMachine1.Spec.InstanceID}
 			vms.EXPECT().GetVirtualMachinesMetricByID(*dummies.CSMachine1.Spec.InstanceID).Return(vmsResp, 1, nil)
-			Ω(client.ResolveVMInstanceDetails(dummies.CSMachine1)).Should(Succeed())
+			Ω(client.ResolveVMInstanceDetails(ctx, dummies.CSMachine1)).Should(Succeed())
 			Ω(dummies.CSMachine1.Spec.ProviderID).Should(Equal(pointer.String("cloudstack:///" + vmsResp.Id)))
 			Ω(dummies.CSMachine1.Spec.InstanceID).Should(Equal(pointer.String(vmsResp.Id)))
 		})
@@ -97,14 +104,14 @@ var _ = Describe("Instance", func() {
 			vms.EXPECT().GetVirtualMachinesMetricByID(*dummies.CSMachine1.Spec.InstanceID).Return(nil, -1, notFoundError)
 			vms.EXPECT().GetVirtualMachinesMetricByName(dummies.CSMachine1.Name).Return(nil, -1, unknownError)
 
-			Ω(client.ResolveVMInstanceDetails(dummies.CSMachine1)).Should(MatchError(unknownErrorMessage))
+			Ω(client.ResolveVMInstanceDetails(ctx, dummies.CSMachine1)).Should(MatchError(unknownErrorMessage))
 		})
 
 		It("handles finding more than one VM instance by Name", func() {
 			vms.EXPECT().GetVirtualMachinesMetricByID(*dummies.CSMachine1.Spec.InstanceID).Return(nil, -1, notFoundError)
 			vms.EXPECT().GetVirtualMachinesMetricByName(dummies.CSMachine1.Name).Return(nil, 2, nil)
 
-			Ω(client.ResolveVMInstanceDetails(dummies.CSMachine1)).Should(
+			Ω(client.ResolveVMInstanceDetails(ctx, dummies.CSMachine1)).Should(
 				MatchError("found more than one VM Instance with name " + dummies.CSMachine1.Name))
 		})
 
@@ -113,7 +120,7 @@ var _ = Describe("Instance", func() {
 			vms.EXPECT().GetVirtualMachinesMetricByName(dummies.CSMachine1.Name).
 				Return(&cloudstack.VirtualMachinesMetric{Id: *dummies.CSMachine1.Spec.InstanceID}, -1, nil)
 
-			Ω(client.ResolveVMInstanceDetails(dummies.CSMachine1)).Should(Succeed())
+			Ω(client.ResolveVMInstanceDetails(ctx, dummies.CSMachine1)).Should(Succeed())
 			Ω(dummies.CSMachine1.Spec.ProviderID).Should(Equal(
 				pointer.String(fmt.Sprintf("cloudstack:///%s", *dummies.CSMachine1.Spec.InstanceID))))
 			Ω(dummies.CSMachine1.Spec.InstanceID).Should(Equal(pointer.String(*dummies.CSMachine1.Spec.InstanceID)))
@@ -131,14 +138,14 @@ var _ = Describe("Instance", func() {
 		It("doesn't re-create if one already exists.", func() {
 			vms.EXPECT().GetVirtualMachinesMetricByID(*dummies.CSMachine1.Spec.InstanceID).Return(vmMetricResp, -1, nil)
 			Ω(client.GetOrCreateVMInstance(
-				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 				Should(Succeed())
 		})
 
 		It("returns unknown error while fetching VM instance", func() {
 			vms.EXPECT().GetVirtualMachinesMetricByID(*dummies.CSMachine1.Spec.InstanceID).Return(nil, -1, unknownError)
 			Ω(client.GetOrCreateVMInstance(
-				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 				Should(MatchError(unknownErrorMessage))
 		})
 
@@ -146,7 +153,7 @@ var _ = Describe("Instance", func() {
 			expectVMNotFound()
 			sos.EXPECT().GetServiceOfferingID(dummies.CSMachine1.Spec.Offering.Name, gomock.Any()).Return("", -1, unknownError)
 			Ω(client.GetOrCreateVMInstance(
-				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 				ShouldNot(Succeed())
 		})
 
@@ -154,7 +161,7 @@ var _ = Describe("Instance", func() {
 			expectVMNotFound()
 			sos.EXPECT().GetServiceOfferingID(dummies.CSMachine1.Spec.Offering.Name, gomock.Any()).Return("", 2, nil)
 			Ω(client.GetOrCreateVMInstance(
-				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 				ShouldNot(Succeed())
 		})
 
@@ -165,7 +172,7 @@ var _ = Describe("Instance", func() {
 			ts.EXPECT().GetTemplateID(dummies.CSMachine1.Spec.Template.Name, executableFilter, dummies.Zone1.ID).
 				Return("", -1, unknownError)
 			Ω(client.GetOrCreateVMInstance(
-				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 				ShouldNot(Succeed())
 		})
 
@@ -175,7 +182,7 @@ var _ = Describe("Instance", func() {
 				Return(dummies.CSMachine1.Spec.Offering.ID, 1, nil)
 			ts.EXPECT().GetTemplateID(dummies.CSMachine1.Spec.Template.Name, executableFilter, dummies.Zone1.ID).Return("", 2, nil)
 			Ω(client.GetOrCreateVMInstance(
-				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 				ShouldNot(Succeed())
 		})
 
@@ -186,7 +193,7 @@ var _ = Describe("Instance", func() {
 			ts.EXPECT().GetTemplateID(dummies.CSMachine1.Spec.Template.Name, executableFilter, dummies.Zone1.ID).Return(dummies.CSMachine1.Spec.Template.ID, 1, nil)
 			dos.EXPECT().GetDiskOfferingID(dummies.CSMachine1.Spec.DiskOffering.Name, gomock.Any()).Return(diskOfferingFakeID, 2, nil)
 			Ω(client.GetOrCreateVMInstance(
-				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 				ShouldNot(Succeed())
 		})
 
@@ -198,7 +205,7 @@ var _ = Describe("Instance", func() {
 			dos.EXPECT().GetDiskOfferingID(dummies.CSMachine1.Spec.DiskOffering.Name, gomock.Any()).Return(diskOfferingFakeID, 1, nil)
 			dos.EXPECT().GetDiskOfferingByID(diskOfferingFakeID).Return(&cloudstack.DiskOffering{Iscustomized: false}, 1, unknownError)
 			Ω(client.GetOrCreateVMInstance(
-				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 				ShouldNot(Succeed())
 		})
 
@@ -211,7 +218,7 @@ var _ = Describe("Instance", func() {
 			dos.EXPECT().GetDiskOfferingID(dummies.CSMachine1.Spec.DiskOffering.Name, gomock.Any()).Return(diskOfferingFakeID, 1, nil)
 			dos.EXPECT().GetDiskOfferingByID(diskOfferingFakeID).Return(&cloudstack.DiskOffering{Iscustomized: false}, 1, nil)
 			Ω(client.GetOrCreateVMInstance(
-				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 				ShouldNot(Succeed())
 		})
 
@@ -224,10 +231,62 @@ var _ = Describe("Instance", func() {
 			dos.EXPECT().GetDiskOfferingID(dummies.CSMachine1.Spec.DiskOffering.Name, gomock.Any()).Return(diskOfferingFakeID, 1, nil)
 			dos.EXPECT().GetDiskOfferingByID(diskOfferingFakeID).Return(&cloudstack.DiskOffering{Iscustomized: true}, 1, nil)
 			Ω(client.GetOrCreateVMInstance(
-				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 				ShouldNot(Succeed())
 		})
 
+		It("returns a pending error while the deployment job is running", func() {
+			dummies.CSMachine1.Status.AsyncJobID = "deploy-job"
+			dummies.CSMachine1.Status.AsyncJobKind = infrav1.AsyncJobDeploy
+			qp := &cloudstack.QueryAsyncJobResultParams{}
+			ajs.EXPECT().NewQueryAsyncJobResultParams("deploy-job").Return(qp)
+			ajs.EXPECT().QueryAsyncJobResult(qp).Return(&cloudstack.QueryAsyncJobResultResponse{Jobstatus: 0}, nil)
+			Ω(client.GetOrCreateVMInstance(
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				Should(MatchError(cloud.ErrAsyncJobPending))
+			Ω(dummies.CSMachine1.Status.AsyncJobID).Should(Equal("deploy-job"))
+			Ω(dummies.CSMachine1.Status.Status).Should(BeNil())
+		})
+
+		It("reports the deployment successful once its job completes", func() {
+			dummies.CSMachine1.Status.AsyncJobID = "deploy-job"
+			dummies.CSMachine1.Status.AsyncJobKind = infrav1.AsyncJobDeploy
+			qp := &cloudstack.QueryAsyncJobResultParams{}
+			ajs.EXPECT().NewQueryAsyncJobResultParams("deploy-job").Return(qp)
+			ajs.EXPECT().QueryAsyncJobResult(qp).Return(&cloudstack.QueryAsyncJobResultResponse{Jobstatus: 1}, nil)
+			vms.EXPECT().GetVirtualMachinesMetricByID(*dummies.CSMachine1.Spec.InstanceID).Return(vmMetricResp, -1, nil)
+			Ω(client.GetOrCreateVMInstance(
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				Should(Succeed())
+			Ω(dummies.CSMachine1.Status.Status).Should(Equal(pointer.String(metav1.StatusSuccess)))
+		})
+
+		It("leaves the jobs of other operations on the instance to them", func() {
+			dummies.CSMachine1.Status.AsyncJobID = "scale-job"
+			dummies.CSMachine1.Status.AsyncJobKind = infrav1.AsyncJobScale
+			vms.EXPECT().GetVirtualMachinesMetricByID(*dummies.CSMachine1.Spec.InstanceID).Return(vmMetricResp, -1, nil)
+			Ω(client.GetOrCreateVMInstance(
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				Should(Succeed())
+			Ω(dummies.CSMachine1.Status.AsyncJobID).Should(Equal("scale-job"))
+			Ω(dummies.CSMachine1.Status.Status).Should(BeNil())
+		})
+
+		It("returns the error of a failed deployment job and forgets the job", func() {
+			dummies.CSMachine1.Status.AsyncJobID = "deploy-job"
+			dummies.CSMachine1.Status.AsyncJobKind = infrav1.AsyncJobDeploy
+			qp := &cloudstack.QueryAsyncJobResultParams{}
+			ajs.EXPECT().NewQueryAsyncJobResultParams("deploy-job").Return(qp)
+			ajs.EXPECT().QueryAsyncJobResult(qp).Return(&cloudstack.QueryAsyncJobResultResponse{
+				Jobstatus: 2,
+				Jobresult: []byte(`{"errorcode":533,"cserrorcode":4250,"errortext":"Unable to create a deployment for VM"}`),
+			}, nil)
+			Ω(client.GetOrCreateVMInstance(
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				Should(MatchError("CloudStack API error 533 (CSExceptionErrorCode: 4250): Unable to create a deployment for VM"))
+			Ω(dummies.CSMachine1.Status.AsyncJobID).Should(BeEmpty())
+		})
+
 		It("handles deployment errors", func() {
 			expectVMNotFound()
 			sos.EXPECT().GetServiceOfferingID(dummies.CSMachine1.Spec.Offering.Name, gomock.Any()).
@@ -244,7 +303,7 @@ var _ = Describe("Instance", func() {
 			vms.EXPECT().NewListVirtualMachinesParams().Return(&cloudstack.ListVirtualMachinesParams{})
 			vms.EXPECT().ListVirtualMachines(gomock.Any()).Return(&cloudstack.ListVirtualMachinesResponse{}, nil)
 			Ω(client.GetOrCreateVMInstance(
-				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 				Should(MatchError(unknownErrorMessage))
 		})
 
@@ -285,7 +344,7 @@ var _ = Describe("Instance", func() {
 					}).Return(deploymentResp, nil)
 
 				Ω(client.GetOrCreateVMInstance(
-					dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, expectUserData)).
+					ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, expectUserData)).
 					Should(Succeed())
 			}
 
@@ -401,7 +460,7 @@ var _ = Describe("Instance", func() {
 				sos.EXPECT().GetServiceOfferingByID(dummies.CSMachine1.Spec.Offering.ID).Return(&cloudstack.ServiceOffering{Name: "offering-not-match"}, 1, nil)
 				requiredRegexp := "offering name %s does not match name %s returned using UUID %s"
 				Ω(client.GetOrCreateVMInstance(
-					dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+					ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 					Should(MatchError(MatchRegexp(requiredRegexp, dummies.CSMachine1.Spec.Offering.Name, "offering-not-match", offeringFakeID)))
 			})
 
@@ -415,7 +474,7 @@ var _ = Describe("Instance", func() {
 				ts.EXPECT().GetTemplateByID(dummies.CSMachine1.Spec.Template.ID, executableFilter).Return(&cloudstack.Template{Name: "template-not-match"}, 1, nil)
 				requiredRegexp := "template name %s does not match name %s returned using UUID %s"
 				Ω(client.GetOrCreateVMInstance(
-					dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+					ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 					Should(MatchError(MatchRegexp(requiredRegexp, dummies.CSMachine1.Spec.Template.Name, "template-not-match", templateFakeID)))
 
 			})
@@ -433,7 +492,7 @@ var _ = Describe("Instance", func() {
 				dos.EXPECT().GetDiskOfferingID(dummies.CSMachine1.Spec.DiskOffering.Name, gomock.Any()).Return(diskOfferingFakeID+"-not-match", 1, nil)
 				requiredRegexp := "diskOffering ID %s does not match ID %s returned using name %s"
 				Ω(client.GetOrCreateVMInstance(
-					dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+					ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
 					Should(MatchError(MatchRegexp(requiredRegexp, dummies.CSMachine1.Spec.DiskOffering.ID, diskOfferingFakeID+"-not-match", dummies.CSMachine1.Spec.DiskOffering.Name)))
 
 			})
@@ -492,7 +551,7 @@ var _ = Describe("Instance", func() {
 				}).Return(deploymentResp, nil)
 
 			err := client.GetOrCreateVMInstance(
-				dummies.CSMachine1,
+				ctx, dummies.CSMachine1,
 				dummies.CAPIMachine,
 				dummies.CSCluster,
 				dummies.CSFailureDomain1,
@@ -518,15 +577,54 @@ var _ = Describe("Instance", func() {
 			},
 		}
 
+		It("reports deletion in progress while the destroy job is running", func() {
+			dummies.CSMachine1.Status.AsyncJobID = "destroy-job"
+			dummies.CSMachine1.Status.AsyncJobKind = infrav1.AsyncJobDestroy
+			qp := &cloudstack.QueryAsyncJobResultParams{}
+			ajs.EXPECT().NewQueryAsyncJobResultParams("destroy-job").Return(qp)
+			ajs.EXPECT().QueryAsyncJobResult(qp).Return(&cloudstack.QueryAsyncJobResultResponse{Jobstatus: 0}, nil)
+			Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).Should(MatchError("VM deletion in progress"))
+		})
+
+		It("returns nil once the destroy job has expunged the VM", func() {
+			dummies.CSMachine1.Status.AsyncJobID = "destroy-job"
+			dummies.CSMachine1.Status.AsyncJobKind = infrav1.AsyncJobDestroy
+			qp := &cloudstack.QueryAsyncJobResultParams{}
+			ajs.EXPECT().NewQueryAsyncJobResultParams("destroy-job").Return(qp)
+			ajs.EXPECT().QueryAsyncJobResult(qp).Return(&cloudstack.QueryAsyncJobResultResponse{Jobstatus: 1}, nil)
+			vms.EXPECT().GetVirtualMachinesMetricByID(*dummies.CSMachine1.Spec.InstanceID).Return(nil, -1, notFoundError)
+			vms.EXPECT().GetVirtualMachinesMetricByName(dummies.CSMachine1.Name).Return(nil, -1, notFoundError)
+			Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(dummies.CSMachine1.Status.AsyncJobID).Should(BeEmpty())
+		})
+
+		It("waits for the job of another operation on the VM, ignoring its failure", func() {
+			dummies.CSMachine1.Status.AsyncJobID = "scale-job"
+			dummies.CSMachine1.Status.AsyncJobKind = infrav1.AsyncJobScale
+			qp := &cloudstack.QueryAsyncJobResultParams{}
+			ajs.EXPECT().NewQueryAsyncJobResultParams("scale-job").Return(qp)
+			ajs.EXPECT().QueryAsyncJobResult(qp).Return(&cloudstack.QueryAsyncJobResultResponse{
+				Jobstatus: 2,
+				Jobresult: []byte(`{"errorcode":431,"cserrorcode":4350,"errortext":"Unable to scale VM"}`),
+			}, nil)
+			vms.EXPECT().GetVirtualMachinesMetricByID(*dummies.CSMachine1.Spec.InstanceID).Return(nil, -1, notFoundError)
+			vms.EXPECT().GetVirtualMachinesMetricByName(dummies.CSMachine1.Name).Return(nil, -1, notFoundError)
+			Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(dummies.CSMachine1.Status.AsyncJobID).Should(BeEmpty())
+		})
+
 		It("calls destroy and finds VM doesn't exist, then returns nil", func() {
 			listVolumesParams.SetVirtualmachineid(*dummies.CSMachine1.Spec.InstanceID)
 			listVolumesParams.SetType("DATADISK")
 			vms.EXPECT().NewDestroyVirtualMachineParams(*dummies.CSMachine1.Spec.InstanceID).
 				Return(expungeDestroyParams)
-			vms.EXPECT().DestroyVirtualMachine(expungeDestroyParams).Return(nil, fmt.Errorf("unable to find uuid for id"))
+			vms.EXPECT().DestroyVirtualMachine(expungeDestroyParams).Return(nil,
+				fmt.Errorf("CloudStack API error 431 (CSExceptionErrorCode: 4350): Unable to find UUID for id"))
 			vs.EXPECT().NewListVolumesParams().Return(listVolumesParams)
 			vs.EXPECT().ListVolumes(listVolumesParams).Return(listVolumesResponse, nil)
-			Ω(client.DestroyVMInstance(dummies.CSMachine1)).
+			vms.EXPECT().GetVirtualMachinesMetricByID(*dummies.CSMachine1.Spec.InstanceID).Return(nil, -1, notFoundError)
+			vms.EXPECT().GetVirtualMachinesMetricByName(dummies.CSMachine1.Name).Return(nil, -1, notFoundError)
+			Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).
 				Should(Succeed())
 		})
 
@@ -538,7 +636,7 @@ var _ = Describe("Instance", func() {
 			vms.EXPECT().DestroyVirtualMachine(expungeDestroyParams).Return(nil, fmt.Errorf("new error"))
 			vs.EXPECT().NewListVolumesParams().Return(listVolumesParams)
 			vs.EXPECT().ListVolumes(listVolumesParams).Return(listVolumesResponse, nil)
-			Ω(client.DestroyVMInstance(dummies.CSMachine1)).Should(MatchError("new error"))
+			Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).Should(MatchError("new error"))
 		})
 
 		It("calls destroy without error but cannot resolve VM after", func() {
@@ -551,7 +649,7 @@ var _ = Describe("Instance", func() {
 			vs.EXPECT().ListVolumes(listVolumesParams).Return(listVolumesResponse, nil)
 			vms.EXPECT().GetVirtualMachinesMetricByID(*dummies.CSMachine1.Spec.InstanceID).Return(nil, -1, notFoundError)
 			vms.EXPECT().GetVirtualMachinesMetricByName(dummies.CSMachine1.Name).Return(nil, -1, notFoundError)
-			Ω(client.DestroyVMInstance(dummies.CSMachine1)).
+			Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).
 				Should(Succeed())
 		})
 
@@ -567,7 +665,7 @@ var _ = Describe("Instance", func() {
 				Return(&cloudstack.VirtualMachinesMetric{
 					State: "Expunging",
 				}, 1, nil)
-			Ω(client.DestroyVMInstance(dummies.CSMachine1)).
+			Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).
 				Should(Succeed())
 		})
 
@@ -583,7 +681,7 @@ var _ = Describe("Instance", func() {
 				Return(&cloudstack.VirtualMachinesMetric{
 					State: "Expunged",
 				}, 1, nil)
-			Ω(client.DestroyVMInstance(dummies.CSMachine1)).
+			Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).
 				Should(Succeed())
 		})
 
@@ -599,7 +697,830 @@ var _ = Describe("Instance", func() {
 				Return(&cloudstack.VirtualMachinesMetric{
 					State: "Stopping",
 				}, 1, nil)
-			Ω(client.DestroyVMInstance(dummies.CSMachine1)).Should(MatchError("VM deletion in progress"))
+			Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).Should(MatchError("VM deletion in progress"))
 		})
 	})
 })
+
+// newFakeACSClient resets the dummies and starts a fake CloudStack with the zone and network of
+// dummies.CSFailureDomain1 and the offerings and template of dummies.CSMachine1, the template being 8 GB. It returns
+// the server and a client of it, with the zone and network of the failure domain resolved.
+func newFakeACSClient() (*fakeacs.Server, cloud.Client) {
+	dummies.SetDummyVars()
+	server := fakeacs.NewServer()
+	DeferCleanup(server.Close)
+
+	zoneID := server.AddZone(dummies.Zone1.Name)
+	server.AddNetwork(zoneID, dummies.Zone1.Network.Name, cloud.NetworkTypeShared)
+	server.AddServiceOffering(dummies.CSMachine1.Spec.Offering.Name, 2, 2048)
+	server.AddTemplate(zoneID, dummies.CSMachine1.Spec.Template.Name)
+	server.AddDiskOffering(dummies.CSMachine1.Spec.DiskOffering.Name, 10, false)
+
+	client, err := cloud.NewClientFromConf(cloud.Config{
+		APIUrl:    server.APIURL(),
+		APIKey:    server.APIKey,
+		SecretKey: server.SecretKey,
+	}, &corev1.ConfigMap{Data: map[string]string{cloud.ClientCacheTTLKey: "100ms"}})
+	Ω(err).ShouldNot(HaveOccurred())
+	Ω(client.ResolveZone(ctx, &dummies.CSFailureDomain1.Spec.Zone)).Should(Succeed())
+	Ω(client.ResolveNetworkForZone(ctx, &dummies.CSFailureDomain1.Spec.Zone)).Should(Succeed())
+	return server, client
+}
+
+var _ = Describe("Instance networks", func() {
+	var (
+		server          *fakeacs.Server
+		client          cloud.Client
+		storageID       string
+		backendID       string
+		backendStaticIP = "10.1.2.50"
+	)
+
+	BeforeEach(func() {
+		server, client = newFakeACSClient()
+		zoneID := dummies.CSFailureDomain1.Spec.Zone.ID
+		storageID = server.AddNetwork(zoneID, "storage-network", cloud.NetworkTypeShared)
+		backendID = server.AddNetwork(zoneID, "backend-network", cloud.NetworkTypeShared)
+		dummies.CSMachine1.Spec.InstanceID = nil
+	})
+
+	It("Attaches the machine to its additional networks after the zone network", func() {
+		dummies.CSMachine1.Spec.Networks = []infrav1.CloudStackMachineNetwork{
+			{CloudStackResourceIdentifier: infrav1.CloudStackResourceIdentifier{Name: "storage-network"}},
+			{CloudStackResourceIdentifier: infrav1.CloudStackResourceIdentifier{ID: backendID}, IP: backendStaticIP},
+		}
+
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+
+		cs := cloudstack.NewClient(server.APIURL(), server.APIKey, server.SecretKey, false)
+		vm, _, err := cs.VirtualMachine.GetVirtualMachineByID(*dummies.CSMachine1.Spec.InstanceID)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(vm.Nic).Should(HaveLen(3))
+		Ω(vm.Nic[0].Networkid).Should(Equal(dummies.CSFailureDomain1.Spec.Zone.Network.ID))
+		Ω(vm.Nic[0].Isdefault).Should(BeTrue())
+		Ω(vm.Nic[1].Networkid).Should(Equal(storageID))
+		Ω(vm.Nic[2].Networkid).Should(Equal(backendID))
+		Ω(vm.Nic[2].Ipaddress).Should(Equal(backendStaticIP))
+
+		Ω(dummies.CSMachine1.Status.Addresses).Should(Equal([]corev1.NodeAddress{
+			{Type: corev1.NodeInternalIP, Address: vm.Nic[0].Ipaddress},
+			{Type: corev1.NodeInternalIP, Address: vm.Nic[1].Ipaddress},
+			{Type: corev1.NodeInternalIP, Address: backendStaticIP},
+		}))
+	})
+
+	It("Deploys the machine with its static IP address on the zone network", func() {
+		dummies.CSMachine1.Spec.IPAddress = "10.1.1.20"
+
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+
+		cs := cloudstack.NewClient(server.APIURL(), server.APIKey, server.SecretKey, false)
+		vm, _, err := cs.VirtualMachine.GetVirtualMachineByID(*dummies.CSMachine1.Spec.InstanceID)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(vm.Nic).Should(HaveLen(1))
+		Ω(vm.Nic[0].Networkid).Should(Equal(dummies.CSFailureDomain1.Spec.Zone.Network.ID))
+		Ω(vm.Nic[0].Ipaddress).Should(Equal("10.1.1.20"))
+	})
+
+	It("Deploys the machine with its static IP address on the zone network alongside additional networks", func() {
+		dummies.CSMachine1.Spec.IPAddress = "10.1.1.20"
+		dummies.CSMachine1.Spec.Networks = []infrav1.CloudStackMachineNetwork{
+			{CloudStackResourceIdentifier: infrav1.CloudStackResourceIdentifier{ID: storageID}},
+		}
+
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+
+		cs := cloudstack.NewClient(server.APIURL(), server.APIKey, server.SecretKey, false)
+		vm, _, err := cs.VirtualMachine.GetVirtualMachineByID(*dummies.CSMachine1.Spec.InstanceID)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(vm.Nic).Should(HaveLen(2))
+		Ω(vm.Nic[0].Ipaddress).Should(Equal("10.1.1.20"))
+		Ω(vm.Nic[1].Networkid).Should(Equal(storageID))
+	})
+})
+
+var _ = Describe("Instance data disks", func() {
+	var (
+		server *fakeacs.Server
+		client cloud.Client
+		cs     *cloudstack.CloudStackClient
+	)
+
+	BeforeEach(func() {
+		server, client = newFakeACSClient()
+		server.AddDiskOffering("custom", 0, true)
+		cs = cloudstack.NewClient(server.APIURL(), server.APIKey, server.SecretKey, false)
+
+		dummies.CSMachine1.Spec.InstanceID = nil
+		dummies.CSMachine1.Spec.DataDisks = []infrav1.CloudStackResourceDiskOffering{
+			{CloudStackResourceIdentifier: infrav1.CloudStackResourceIdentifier{Name: "custom"}, CustomSize: 20,
+				MountPath: "/var/lib/etcd", Device: "/dev/vdc", Filesystem: "ext4", Label: "etcd_disk"},
+			{CloudStackResourceIdentifier: infrav1.CloudStackResourceIdentifier{Name: dummies.CSMachine1.Spec.DiskOffering.Name},
+				MountPath: "/var/lib/containerd", Device: "/dev/vdd", Filesystem: "xfs", Label: "containerd_disk"},
+		}
+	})
+
+	dataDisks := func() []*cloudstack.Volume {
+		p := cs.Volume.NewListVolumesParams()
+		p.SetVirtualmachineid(*dummies.CSMachine1.Spec.InstanceID)
+		p.SetType("DATADISK")
+		resp, err := cs.Volume.ListVolumes(p)
+		Ω(err).ShouldNot(HaveOccurred())
+		return resp.Volumes
+	}
+
+	It("Attaches the data disks in order before the machine first starts", func() {
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+		Ω(dummies.CSMachine1.Status.InstanceState).Should(Equal("Stopped"))
+
+		Ω(client.ReconcileDataDisks(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)).Should(Succeed())
+		Ω(dummies.CSMachine1.Status.InstanceState).Should(Equal("Running"))
+
+		volumes := dataDisks()
+		Ω(volumes).Should(HaveLen(3)) // The disk of the disk offering and the two data disks.
+		deviceIDs := map[int64]int64{}
+		for _, volume := range volumes {
+			deviceIDs[volume.Deviceid] = volume.Size >> 30
+		}
+		Ω(deviceIDs).Should(Equal(map[int64]int64{1: 10, 2: 20, 3: 10}))
+
+		Ω(client.ReconcileDataDisks(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)).Should(Succeed())
+		Ω(server.Calls("createVolume")).Should(Equal(2))
+		Ω(server.Calls("attachVolume")).Should(Equal(2))
+		Ω(server.Calls("startVirtualMachine")).Should(Equal(1))
+
+		Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).Should(Succeed())
+		Ω(server.Count(fakeacs.KindVolume)).Should(BeZero())
+	})
+
+	It("Returns while the data disk jobs are pending and resumes on the next call", func() {
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+
+		server.SetJobPolls(1)
+		for i := 0; i < 5; i++ {
+			Ω(client.ReconcileDataDisks(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)).
+				Should(MatchError(cloud.ErrAsyncJobPending))
+		}
+		Ω(client.ReconcileDataDisks(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)).Should(Succeed())
+		Ω(dummies.CSMachine1.Status.InstanceState).Should(Equal("Running"))
+		Ω(dataDisks()).Should(HaveLen(3))
+		Ω(server.Calls("createVolume")).Should(Equal(2))
+	})
+
+	It("Reports the failure of its jobs as data disk failures rather than deployment failures", func() {
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+
+		server.SetJobPolls(1)
+		for i := 0; i < 5 && server.Calls("attachVolume") == 0; i++ {
+			Ω(client.ReconcileDataDisks(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)).
+				Should(MatchError(cloud.ErrAsyncJobPending))
+		}
+		Ω(server.Calls("attachVolume")).Should(Equal(1))
+		jobID := dummies.CSMachine1.Status.AsyncJobID
+		Ω(dummies.CSMachine1.Status.AsyncJobKind).Should(Equal(infrav1.AsyncJobDataDisks))
+		Ω(server.Set(fakeacs.KindVirtualMachine, *dummies.CSMachine1.Spec.InstanceID, "state", "Starting")).Should(BeTrue())
+
+		for i := 0; i < 2; i++ {
+			Ω(client.GetOrCreateVMInstance(
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+				dummies.CSAffinityGroup, "")).Should(Succeed())
+			Ω(dummies.CSMachine1.Status.AsyncJobID).Should(Equal(jobID))
+		}
+		Ω(client.ReconcileDataDisks(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)).
+			Should(MatchError(ContainSubstring("can't be attached to VM")))
+		Ω(dummies.CSMachine1.Status.AsyncJobID).Should(BeEmpty())
+	})
+
+	It("Deletes the data disks created but not attached yet when the machine is destroyed", func() {
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+
+		server.SetJobPolls(1)
+		Ω(client.ReconcileDataDisks(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)).
+			Should(MatchError(cloud.ErrAsyncJobPending))
+		Ω(server.Calls("createVolume")).Should(Equal(1))
+		Ω(server.Calls("attachVolume")).Should(BeZero())
+
+		err := client.DestroyVMInstance(ctx, dummies.CSMachine1)
+		for i := 0; i < 5 && err != nil; i++ {
+			Ω(err).Should(MatchError("VM deletion in progress"))
+			err = client.DestroyVMInstance(ctx, dummies.CSMachine1)
+		}
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(server.Calls("deleteVolume")).Should(Equal(1))
+		Ω(server.Count(fakeacs.KindVolume)).Should(BeZero())
+	})
+
+	It("Doesn't start a machine that was ready", func() {
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+		dummies.CSMachine1.Status.Ready = true
+
+		Ω(client.ReconcileDataDisks(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)).Should(Succeed())
+		Ω(server.Calls("startVirtualMachine")).Should(BeZero())
+	})
+})
+
+var _ = Describe("Instance root disk size", func() {
+	var (
+		server *fakeacs.Server
+		client cloud.Client
+	)
+
+	BeforeEach(func() {
+		server, client = newFakeACSClient()
+		dummies.CSMachine1.Spec.InstanceID = nil
+	})
+
+	It("Deploys the machine with its root disk size and reports it in its status", func() {
+		dummies.CSMachine1.Spec.RootDiskSize = 20
+
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+		Ω(dummies.CSMachine1.Status.RootDiskSize).Should(Equal(int64(20)))
+		Ω(conditions.IsTrue(dummies.CSMachine1, infrav1.InstanceDeployedCondition)).Should(BeTrue())
+
+		cs := cloudstack.NewClient(server.APIURL(), server.APIKey, server.SecretKey, false)
+		p := cs.Volume.NewListVolumesParams()
+		p.SetVirtualmachineid(*dummies.CSMachine1.Spec.InstanceID)
+		p.SetType("ROOT")
+		resp, err := cs.Volume.ListVolumes(p)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(resp.Volumes).Should(HaveLen(1))
+		Ω(resp.Volumes[0].Size).Should(Equal(int64(20 << 30)))
+	})
+
+	It("Refuses a root disk size smaller than the template's size", func() {
+		dummies.CSMachine1.Spec.RootDiskSize = 4
+
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(MatchError(ContainSubstring("rootDiskSize 4 GB is smaller than the 8 GB")))
+		Ω(server.Calls("deployVirtualMachine")).Should(BeZero())
+		Ω(conditions.IsFalse(dummies.CSMachine1, infrav1.InstanceDeployedCondition)).Should(BeTrue())
+		Ω(conditions.GetReason(dummies.CSMachine1, infrav1.InstanceDeployedCondition)).
+			Should(Equal(infrav1.RootDiskTooSmallReason))
+	})
+
+	It("Checks the root disk size against the template's size without touching the machine", func() {
+		zoneID := dummies.CSFailureDomain1.Spec.Zone.ID
+		dummies.CSMachine1.Spec.Template = infrav1.CloudStackResourceIdentifier{}
+		dummies.CSMachine1.Spec.TemplateSelector = &infrav1.CloudStackTemplateSelector{NameRegex: "^ubuntu-"}
+		server.AddTemplate(zoneID, "ubuntu-2204-kube-v1.27.3")
+
+		dummies.CSMachine1.Spec.RootDiskSize = 4
+		Ω(client.CheckRootDiskSize(ctx, dummies.CSCluster, dummies.CSMachine1, zoneID)).
+			Should(MatchError(cloud.ErrRootDiskTooSmall))
+		dummies.CSMachine1.Spec.RootDiskSize = 8
+		Ω(client.CheckRootDiskSize(ctx, dummies.CSCluster, dummies.CSMachine1, zoneID)).Should(Succeed())
+		Ω(dummies.CSMachine1.Status.TemplateID).Should(BeEmpty())
+		Ω(conditions.Has(dummies.CSMachine1, infrav1.InstanceDeployedCondition)).Should(BeFalse())
+	})
+
+	It("Leaves the root disk size out of the status of machines using their template's size", func() {
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+		Ω(dummies.CSMachine1.Status.RootDiskSize).Should(BeZero())
+		Ω(server.Calls("listVolumes")).Should(BeZero())
+	})
+})
+
+var _ = Describe("Instance template selection", func() {
+	var (
+		server *fakeacs.Server
+		client cloud.Client
+		zoneID string
+	)
+
+	// addTemplate seeds a ready template created at the given time with the given tags.
+	addTemplate := func(name string, created string, tags map[string]string) string {
+		id := server.AddTemplate(zoneID, name)
+		server.Set(fakeacs.KindTemplate, id, "created", created)
+		if len(tags) > 0 {
+			Ω(client.AddTags(ctx, cloud.ResourceTypeTemplate, id, tags)).Should(Succeed())
+		}
+		return id
+	}
+
+	// deployedTemplateID returns the ID of the template the machine's instance was deployed from.
+	deployedTemplateID := func() string {
+		vm, found := server.Get(fakeacs.KindVirtualMachine, *dummies.CSMachine1.Spec.InstanceID)
+		Ω(found).Should(BeTrue())
+		return vm["templateid"].(string)
+	}
+
+	BeforeEach(func() {
+		server, client = newFakeACSClient()
+		zoneID = dummies.CSFailureDomain1.Spec.Zone.ID
+		dummies.CSMachine1.Spec.InstanceID = nil
+		dummies.CSMachine1.Spec.Template = infrav1.CloudStackResourceIdentifier{}
+	})
+
+	It("Deploys from the newest template with the tags, pinned across retries", func() {
+		addTemplate("ubuntu-2204-kube-v1.27.3-a", "2023-07-01T10:00:00+0000", map[string]string{"k8s-version": "v1.27.3"})
+		newest := addTemplate("ubuntu-2204-kube-v1.27.3-b", "2023-07-02T10:00:00+0000",
+			map[string]string{"k8s-version": "v1.27.3"})
+		addTemplate("ubuntu-2204-kube-v1.27.4", "2023-07-03T10:00:00+0000", map[string]string{"k8s-version": "v1.27.4"})
+		dummies.CSMachine1.Spec.TemplateSelector = &infrav1.CloudStackTemplateSelector{
+			MatchTags: map[string]string{"k8s-version": "v1.27.3"}}
+
+		server.FailNext("deployVirtualMachine", fakeacs.ErrorCodeInternal, fakeacs.CSExceptionCloudRuntime,
+			"Unable to create a deployment for VM")
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).ShouldNot(Succeed())
+		Ω(dummies.CSMachine1.Status.TemplateID).Should(Equal(newest))
+
+		// A newer match doesn't change the template of the machine.
+		addTemplate("ubuntu-2204-kube-v1.27.3-c", "2023-07-04T10:00:00+0000", map[string]string{"k8s-version": "v1.27.3"})
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+		Ω(deployedTemplateID()).Should(Equal(newest))
+	})
+
+	It("Deploys from the newest ready template whose name matches the regex", func() {
+		addTemplate("ubuntu-2204-kube-v1.27.3", "2023-07-01T10:00:00+0000", nil)
+		newest := addTemplate("ubuntu-2204-kube-v1.27.4", "2023-07-02T10:00:00+0000", nil)
+		downloading := addTemplate("ubuntu-2204-kube-v1.27.5", "2023-07-03T10:00:00+0000", nil)
+		server.Set(fakeacs.KindTemplate, downloading, "isready", false)
+		addTemplate("ubuntu-2204-kube-v1.28.0", "2023-07-04T10:00:00+0000", nil)
+		dummies.CSMachine1.Spec.TemplateSelector = &infrav1.CloudStackTemplateSelector{
+			NameRegex: `^ubuntu-2204-kube-v1\.27\.`}
+
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+		Ω(deployedTemplateID()).Should(Equal(newest))
+		Ω(dummies.CSMachine1.Status.TemplateID).Should(Equal(newest))
+	})
+
+	It("Refuses to deploy when no template matches", func() {
+		addTemplate("ubuntu-2204-kube-v1.27.3", "2023-07-01T10:00:00+0000", map[string]string{"k8s-version": "v1.27.3"})
+		dummies.CSMachine1.Spec.TemplateSelector = &infrav1.CloudStackTemplateSelector{
+			MatchTags: map[string]string{"k8s-version": "v1.27.3"}, NameRegex: "^flatcar-"}
+
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(MatchError(ContainSubstring("no ready template in zone")))
+		Ω(dummies.CSMachine1.Status.TemplateID).Should(BeEmpty())
+		Ω(server.Calls("deployVirtualMachine")).Should(BeZero())
+	})
+})
+
+var _ = Describe("Instance custom compute", func() {
+	var (
+		server *fakeacs.Server
+		client cloud.Client
+	)
+
+	BeforeEach(func() {
+		server, client = newFakeACSClient()
+		server.AddServiceOffering("fixed", 2, 2048)
+		server.AddCustomServiceOffering("custom", 2000, 1, 8, 1024, 16384)
+		dummies.CSMachine1.Spec.InstanceID = nil
+		dummies.CSMachine1.Spec.Offering = infrav1.CloudStackResourceIdentifier{Name: "custom"}
+	})
+
+	It("Deploys the machine with its CPUs and memory on a customized offering", func() {
+		dummies.CSMachine1.Spec.CPU = 4
+		dummies.CSMachine1.Spec.MemoryMiB = 8192
+
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+
+		cs := cloudstack.NewClient(server.APIURL(), server.APIKey, server.SecretKey, false)
+		vm, _, err := cs.VirtualMachine.GetVirtualMachineByID(*dummies.CSMachine1.Spec.InstanceID)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(vm.Cpunumber).Should(Equal(4))
+		Ω(vm.Memory).Should(Equal(8192))
+		Ω(vm.Cpuspeed).Should(Equal(2000))
+	})
+
+	DescribeTable("Refuses compute the offering doesn't allow",
+		func(offering string, cpu, memoryMiB, cpuSpeedMHz int64, message string) {
+			dummies.CSMachine1.Spec.Offering = infrav1.CloudStackResourceIdentifier{Name: offering}
+			dummies.CSMachine1.Spec.CPU = cpu
+			dummies.CSMachine1.Spec.MemoryMiB = memoryMiB
+			dummies.CSMachine1.Spec.CPUSpeedMHz = cpuSpeedMHz
+
+			Ω(client.GetOrCreateVMInstance(
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+				dummies.CSAffinityGroup, "")).Should(MatchError(ContainSubstring(message)))
+			Ω(server.Calls("deployVirtualMachine")).Should(BeZero())
+		},
+		Entry("on an offering that isn't customized", "fixed", int64(4), int64(8192), int64(0), "is not customized"),
+		Entry("without CPUs", "custom", int64(0), int64(8192), int64(0), "cpu can not be 0"),
+		Entry("without memory", "custom", int64(4), int64(0), int64(0), "memoryMiB can not be 0"),
+		Entry("above the maximum CPUs", "custom", int64(16), int64(8192), int64(0), "cpu 16 is above the maximum 8"),
+		Entry("below the minimum memory", "custom", int64(4), int64(512), int64(0), "memoryMiB 512 is below the minimum 1024"),
+		Entry("with another CPU speed", "custom", int64(4), int64(8192), int64(3000), "fixes cpuSpeedMHz to 2000"),
+	)
+})
+
+var _ = Describe("Instance vertical scaling", func() {
+	var (
+		server     *fakeacs.Server
+		client     cloud.Client
+		templateID string
+	)
+
+	BeforeEach(func() {
+		server, client = newFakeACSClient()
+		server.AddServiceOffering("large", 4, 4096)
+		server.AddServiceOffering("tiny", 1, 1024)
+		templateID, _ = server.Find(fakeacs.KindTemplate, dummies.CSMachine1.Spec.Template.Name)
+		dummies.CSMachine1.Spec.InstanceID = nil
+		dummies.CSMachine1.Spec.VerticalScaling = true
+	})
+
+	// deploy deploys the machine and changes its offering to the named one.
+	deploy := func(offering string) {
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+		dummies.CSMachine1.Spec.Offering = infrav1.CloudStackResourceIdentifier{Name: offering}
+	}
+
+	// expectScaledTo checks the VM of the machine runs with the named offering.
+	expectScaledTo := func(offering string, cpuNumber, memory int) {
+		cs := cloudstack.NewClient(server.APIURL(), server.APIKey, server.SecretKey, false)
+		vm, _, err := cs.VirtualMachine.GetVirtualMachineByID(*dummies.CSMachine1.Spec.InstanceID)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(vm.State).Should(Equal("Running"))
+		Ω(vm.Serviceofferingname).Should(Equal(offering))
+		Ω(vm.Cpunumber).Should(Equal(cpuNumber))
+		Ω(vm.Memory).Should(Equal(memory))
+		Ω(conditions.IsTrue(dummies.CSMachine1, infrav1.InstanceScaledCondition)).Should(BeTrue())
+		Ω(dummies.CSMachine1.Status.InstanceState).Should(Equal("Running"))
+	}
+
+	It("Leaves a machine running with the offering of its spec alone", func() {
+		deploy(dummies.CSMachine1.Spec.Offering.Name)
+
+		Ω(client.ScaleVMInstance(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)).Should(Succeed())
+		Ω(server.Calls("scaleVirtualMachine")).Should(BeZero())
+		Ω(conditions.Has(dummies.CSMachine1, infrav1.InstanceScaledCondition)).Should(BeFalse())
+	})
+
+	It("Scales a dynamically scalable instance live", func() {
+		server.Set(fakeacs.KindTemplate, templateID, "isdynamicallyscalable", true)
+		deploy("large")
+
+		Ω(client.ScaleVMInstance(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)).Should(Succeed())
+		expectScaledTo("large", 4, 4096)
+		Ω(server.Calls("stopVirtualMachine")).Should(BeZero())
+	})
+
+	It("Stops, scales and starts an instance that isn't dynamically scalable", func() {
+		deploy("large")
+
+		Ω(client.ScaleVMInstance(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)).Should(Succeed())
+		expectScaledTo("large", 4, 4096)
+		Ω(server.Calls("stopVirtualMachine")).Should(Equal(1))
+		Ω(server.Calls("scaleVirtualMachine")).Should(Equal(1))
+		Ω(server.Calls("startVirtualMachine")).Should(Equal(1))
+	})
+
+	It("Scales the instance stopped when CloudStack refuses to scale it live", func() {
+		server.Set(fakeacs.KindTemplate, templateID, "isdynamicallyscalable", true)
+		deploy("tiny")
+
+		Ω(client.ScaleVMInstance(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)).Should(Succeed())
+		expectScaledTo("tiny", 1, 1024)
+		Ω(server.Calls("scaleVirtualMachine")).Should(Equal(2))
+		Ω(server.Calls("stopVirtualMachine")).Should(Equal(1))
+	})
+
+	It("Reports the progress of the scaling while its jobs are pending", func() {
+		deploy("large")
+		server.SetJobPolls(1)
+
+		var reasons []string
+		Eventually(func() error {
+			err := client.ScaleVMInstance(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)
+			if errors.Is(err, cloud.ErrAsyncJobPending) {
+				reasons = append(reasons, conditions.GetReason(dummies.CSMachine1, infrav1.InstanceScaledCondition))
+			}
+			return err
+		}).Should(Succeed())
+		Ω(reasons).Should(Equal([]string{
+			infrav1.InstanceStoppingForScalingReason,
+			infrav1.InstanceScalingReason,
+			infrav1.InstanceStartingAfterScalingReason,
+		}))
+		expectScaledTo("large", 4, 4096)
+	})
+
+	It("Returns ErrScalingUnsupported when CloudStack refuses to scale the stopped instance", func() {
+		deploy("large")
+		server.FailNext("scaleVirtualMachine", fakeacs.ErrorCodeParam, fakeacs.CSExceptionInvalidParameter,
+			"Unable to scale VM as the new service offering uses another storage type")
+
+		Ω(client.ScaleVMInstance(ctx, dummies.CSMachine1, dummies.CSFailureDomain1)).Should(
+			MatchError(cloud.ErrScalingUnsupported))
+		Ω(conditions.GetReason(dummies.CSMachine1, infrav1.InstanceScaledCondition)).Should(
+			Equal(infrav1.InstanceScalingUnsupportedReason))
+		Ω(server.Calls("startVirtualMachine")).Should(BeZero())
+	})
+})
+
+var _ = Describe("Instance placement", func() {
+	var (
+		server                   *fakeacs.Server
+		client                   cloud.Client
+		host1, host2, host3      string
+		pod1, cluster2, cluster3 string
+	)
+
+	BeforeEach(func() {
+		server, client = newFakeACSClient()
+		zoneID := dummies.CSFailureDomain1.Spec.Zone.ID
+		host1 = server.AddHost(zoneID, "pod1", "cluster1", "host1")
+		host2 = server.AddHost(zoneID, "pod1", "cluster2", "host2")
+		host3 = server.AddHost(zoneID, "pod2", "cluster3", "host3")
+		host, _ := server.Get(fakeacs.KindHost, host2)
+		pod1, cluster2 = host["podid"].(string), host["clusterid"].(string)
+		host, _ = server.Get(fakeacs.KindHost, host3)
+		cluster3 = host["clusterid"].(string)
+		dummies.CSMachine1.Spec.InstanceID = nil
+	})
+
+	deploy := func() error {
+		return client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")
+	}
+
+	It("Records the host, cluster and pod the instance landed on", func() {
+		Ω(deploy()).Should(Succeed())
+
+		Ω(dummies.CSMachine1.Status.Placement).ShouldNot(BeNil())
+		Ω(dummies.CSMachine1.Status.Placement.Host).Should(Equal(infrav1.CloudStackResourceIdentifier{ID: host1, Name: "host1"}))
+		Ω(dummies.CSMachine1.Status.Placement.Pod).Should(Equal(infrav1.CloudStackResourceIdentifier{ID: pod1, Name: "pod1"}))
+		Ω(dummies.CSMachine1.Status.Placement.Cluster.Name).Should(Equal("cluster1"))
+	})
+
+	It("Deploys the instance on the host of the machine", func() {
+		dummies.CSMachine1.Spec.HostID = host2
+		dummies.CSMachine1.Spec.DeploymentPlanner = "UserDispersingPlanner"
+		Ω(deploy()).Should(Succeed())
+
+		Ω(dummies.CSMachine1.Status.Placement.Host.ID).Should(Equal(host2))
+		Ω(dummies.CSMachine1.Status.Placement.Cluster).Should(Equal(infrav1.CloudStackResourceIdentifier{ID: cluster2, Name: "cluster2"}))
+		Ω(dummies.CSMachine1.Status.Placement.Pod.ID).Should(Equal(pod1))
+	})
+
+	It("Falls back to the placement hints of the failure domain's zone", func() {
+		dummies.CSFailureDomain1.Spec.Zone.ClusterID = cluster3
+		Ω(deploy()).Should(Succeed())
+		Ω(dummies.CSMachine1.Status.Placement.Host.ID).Should(Equal(host3))
+	})
+
+	It("Combines the placement hints of the machine with those of the zone", func() {
+		dummies.CSFailureDomain1.Spec.Zone.PodID = pod1
+		dummies.CSFailureDomain1.Spec.Zone.ClusterID = cluster3
+		dummies.CSMachine1.Spec.ClusterID = cluster2
+		Ω(deploy()).Should(Succeed())
+		Ω(dummies.CSMachine1.Status.Placement.Host.ID).Should(Equal(host2))
+	})
+
+	It("Fails the deployment when no host matches the placement hints", func() {
+		dummies.CSMachine1.Spec.HostID = host1
+		dummies.CSMachine1.Spec.ClusterID = cluster3
+		Ω(deploy()).Should(MatchError(ContainSubstring("Unable to create a deployment")))
+		Ω(server.Count(fakeacs.KindVirtualMachine)).Should(BeZero())
+	})
+})
+
+var _ = Describe("Instance tags", func() {
+	var (
+		server *fakeacs.Server
+		client cloud.Client
+		cs     *cloudstack.CloudStackClient
+	)
+
+	BeforeEach(func() {
+		server, client = newFakeACSClient()
+		cs = cloudstack.NewClient(server.APIURL(), server.APIKey, server.SecretKey, false)
+
+		dummies.CSMachine1.Spec.InstanceID = nil
+		dummies.CSCluster.Spec.AdditionalTags = map[string]string{"team": "platform", "cost-center": "1234"}
+		dummies.CSMachine1.Spec.AdditionalTags = map[string]string{"team": "storage", "role": "worker"}
+		Ω(client.GetOrCreateVMInstance(
+			ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "")).Should(Succeed())
+	})
+
+	volumeIDs := func() []string {
+		p := cs.Volume.NewListVolumesParams()
+		p.SetVirtualmachineid(*dummies.CSMachine1.Spec.InstanceID)
+		resp, err := cs.Volume.ListVolumes(p)
+		Ω(err).ShouldNot(HaveOccurred())
+		ids := []string{}
+		for _, volume := range resp.Volumes {
+			ids = append(ids, volume.Id)
+		}
+		return ids
+	}
+
+	It("Tags the instance and its volumes with the tags of the cluster and machine", func() {
+		Ω(client.ReconcileVMInstanceTags(ctx, dummies.CSMachine1, dummies.CSCluster)).Should(Succeed())
+
+		expected := map[string]string{"team": "storage", "cost-center": "1234", "role": "worker"}
+		Ω(client.GetTags(ctx, cloud.ResourceTypeVM, *dummies.CSMachine1.Spec.InstanceID)).Should(Equal(expected))
+		Ω(volumeIDs()).ShouldNot(BeEmpty())
+		for _, id := range volumeIDs() {
+			Ω(client.GetTags(ctx, cloud.ResourceTypeVolume, id)).Should(Equal(expected))
+		}
+		Ω(dummies.CSMachine1.Status.AppliedTags).Should(Equal(expected))
+	})
+
+	It("Updates the tags when those of the cluster or machine change, leaving other tags alone", func() {
+		Ω(client.ReconcileVMInstanceTags(ctx, dummies.CSMachine1, dummies.CSCluster)).Should(Succeed())
+		instanceID := *dummies.CSMachine1.Spec.InstanceID
+		Ω(client.AddTags(ctx, cloud.ResourceTypeVM, instanceID, map[string]string{"backup": "daily"})).Should(Succeed())
+
+		dummies.CSCluster.Spec.AdditionalTags = map[string]string{"team": "platform"}
+		dummies.CSMachine1.Spec.AdditionalTags = nil
+		Ω(client.ReconcileVMInstanceTags(ctx, dummies.CSMachine1, dummies.CSCluster)).Should(Succeed())
+
+		Ω(client.GetTags(ctx, cloud.ResourceTypeVM, instanceID)).
+			Should(Equal(map[string]string{"team": "platform", "backup": "daily"}))
+		for _, id := range volumeIDs() {
+			Ω(client.GetTags(ctx, cloud.ResourceTypeVolume, id)).Should(Equal(map[string]string{"team": "platform"}))
+		}
+		Ω(dummies.CSMachine1.Status.AppliedTags).Should(Equal(map[string]string{"team": "platform"}))
+	})
+
+	It("Doesn't call CloudStack when the applied tags are up to date", func() {
+		Ω(client.ReconcileVMInstanceTags(ctx, dummies.CSMachine1, dummies.CSCluster)).Should(Succeed())
+		listed := server.Calls("listTags")
+		Ω(client.ReconcileVMInstanceTags(ctx, dummies.CSMachine1, dummies.CSCluster)).Should(Succeed())
+		Ω(server.Calls("listTags")).Should(Equal(listed))
+	})
+})
+
+var _ = Describe("Instance registered user data", func() {
+	const userData = "#cloud-config\nruncmd:\n- kubeadm init\n"
+
+	var (
+		server *fakeacs.Server
+		client cloud.Client
+	)
+
+	BeforeEach(func() {
+		server, client = newFakeACSClient()
+		dummies.CSMachine1.Spec.InstanceID = nil
+		dummies.CSMachine1.Spec.RegisterUserData = true
+		dummies.CSMachine1.UID = "machine-uid"
+	})
+
+	deploy := func() error {
+		return client.GetOrCreateVMInstance(ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster,
+			dummies.CSFailureDomain1, dummies.CSAffinityGroup, userData)
+	}
+
+	instance := func() map[string]interface{} {
+		vm, found := server.Get(fakeacs.KindVirtualMachine, *dummies.CSMachine1.Spec.InstanceID)
+		Ω(found).Should(BeTrue())
+		return vm
+	}
+
+	It("Registers the user data and deploys the instance with its ID", func() {
+		Ω(deploy()).Should(Succeed())
+
+		userDataID := dummies.CSMachine1.Status.UserDataID
+		Ω(userDataID).ShouldNot(BeEmpty())
+		registered, found := server.Get(fakeacs.KindUserData, userDataID)
+		Ω(found).Should(BeTrue())
+		Ω(registered["name"]).Should(Equal(dummies.CSMachine1.Name + "-machine-uid"))
+		vm := instance()
+		Ω(vm["userdataid"]).Should(Equal(userDataID))
+		Ω(vm["userdata"]).Should(Equal(registered["userdata"]))
+		Ω(vm["name"]).Should(Equal(dummies.CSMachine1.Name))
+		Ω(vm["nic"]).Should(HaveLen(1))
+		Ω(vm["diskofferingid"]).ShouldNot(BeEmpty())
+		Ω(vm["details"]).Should(HaveKeyWithValue("memoryOvercommitRatio", "1.2"))
+	})
+
+	It("Reuses the registered user data when deploying the instance again", func() {
+		server.FailNext("deployVirtualMachine", fakeacs.ErrorCodeInsufficientCapacity, 4325,
+			"Unable to create a deployment for VM")
+		Ω(deploy()).ShouldNot(Succeed())
+		userDataID := dummies.CSMachine1.Status.UserDataID
+		Ω(userDataID).ShouldNot(BeEmpty())
+
+		Ω(deploy()).Should(Succeed())
+		Ω(server.Calls("registerUserData")).Should(Equal(1))
+		Ω(instance()["userdataid"]).Should(Equal(userDataID))
+	})
+
+	It("Finds user data registered by an attempt that didn't record its ID", func() {
+		server.FailNext("deployVirtualMachine", fakeacs.ErrorCodeInsufficientCapacity, 4325,
+			"Unable to create a deployment for VM")
+		Ω(deploy()).ShouldNot(Succeed())
+		userDataID := dummies.CSMachine1.Status.UserDataID
+		dummies.CSMachine1.Status.UserDataID = ""
+
+		Ω(deploy()).Should(Succeed())
+		Ω(dummies.CSMachine1.Status.UserDataID).Should(Equal(userDataID))
+		Ω(server.Count(fakeacs.KindUserData)).Should(Equal(1))
+	})
+
+	It("Doesn't adopt the user data of a machine of the same name in another namespace", func() {
+		other := dummies.CSMachine1.DeepCopy()
+		other.Namespace = "other-namespace"
+		other.UID = "other-machine-uid"
+		other.Spec.IPAddress = "10.0.0.20"
+		server.FailNext("deployVirtualMachine", fakeacs.ErrorCodeInsufficientCapacity, 4325,
+			"Unable to create a deployment for VM")
+		Ω(client.GetOrCreateVMInstance(ctx, other, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+			dummies.CSAffinityGroup, "#cloud-config\n")).ShouldNot(Succeed())
+		Ω(other.Status.UserDataID).ShouldNot(BeEmpty())
+
+		Ω(deploy()).Should(Succeed())
+		Ω(dummies.CSMachine1.Status.UserDataID).ShouldNot(Equal(other.Status.UserDataID))
+		Ω(server.Count(fakeacs.KindUserData)).Should(Equal(2))
+		registered, found := server.Get(fakeacs.KindUserData, dummies.CSMachine1.Status.UserDataID)
+		Ω(found).Should(BeTrue())
+		Ω(instance()["userdata"]).Should(Equal(registered["userdata"]))
+	})
+
+	It("Deploys the instance with the same parameters as when passing the user data inline", func() {
+		dummies.CSMachine1.Spec.IPAddress = "10.0.0.10"
+		dummies.CSMachine1.Spec.SSHKey = "my-key"
+		dummies.CSMachine1.Spec.RootDiskSize = 16
+		dummies.CSMachine1.Spec.AffinityGroupIDs = []string{"affinity-group-1", "affinity-group-2"}
+		dummies.CSMachine1.Spec.CloudStackPlacementHints = infrav1.CloudStackPlacementHints{
+			HostID: "host-1", ClusterID: "cluster-1", PodID: "pod-1", DeploymentPlanner: "FirstFitPlanner"}
+		dummies.CSMachine1.Spec.DataDisks = []infrav1.CloudStackResourceDiskOffering{dummies.CSMachine1.Spec.DiskOffering}
+		// Fail both deployments, so neither finds the other's instance.
+		deployParams := func() url.Values {
+			server.FailNext("deployVirtualMachine", fakeacs.ErrorCodeInsufficientCapacity, 4325,
+				"Unable to create a deployment for VM")
+			Ω(deploy()).ShouldNot(Succeed())
+			params := server.LastParams("deployVirtualMachine")
+			Ω(params).ShouldNot(BeNil())
+			return params
+		}
+
+		registered := deployParams()
+		Ω(registered.Get("userdataid")).Should(Equal(dummies.CSMachine1.Status.UserDataID))
+		dummies.CSMachine1.Spec.RegisterUserData = false
+		dummies.CSMachine1.Status.UserDataID = ""
+		inline := deployParams()
+		Ω(inline.Get("userdata")).ShouldNot(BeEmpty())
+
+		for _, params := range []url.Values{registered, inline} {
+			for _, param := range []string{"userdata", "userdataid", "signature"} {
+				params.Del(param)
+			}
+		}
+		Ω(registered).Should(Equal(inline))
+	})
+
+	It("Passes the user data inline when CloudStack can't register it", func() {
+		server.RemoveCommand("registerUserData")
+		Ω(deploy()).Should(Succeed())
+
+		Ω(dummies.CSMachine1.Status.UserDataID).Should(BeEmpty())
+		vm := instance()
+		Ω(vm).ShouldNot(HaveKey("userdataid"))
+		Ω(vm["userdata"]).ShouldNot(BeEmpty())
+	})
+
+	It("Deletes the registered user data once the instance is destroyed", func() {
+		Ω(deploy()).Should(Succeed())
+		userDataID := dummies.CSMachine1.Status.UserDataID
+
+		Ω(client.DeleteVMInstanceUserData(ctx, dummies.CSMachine1)).ShouldNot(Succeed())
+		Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).Should(Succeed())
+		Ω(client.DeleteVMInstanceUserData(ctx, dummies.CSMachine1)).Should(Succeed())
+		Ω(dummies.CSMachine1.Status.UserDataID).Should(BeEmpty())
+		_, found := server.Get(fakeacs.KindUserData, userDataID)
+		Ω(found).Should(BeFalse())
+
+		// User data deleted by a previous attempt whose status update was lost.
+		dummies.CSMachine1.Status.UserDataID = userDataID
+		Ω(client.DeleteVMInstanceUserData(ctx, dummies.CSMachine1)).Should(Succeed())
+		Ω(dummies.CSMachine1.Status.UserDataID).Should(BeEmpty())
+	})
+})
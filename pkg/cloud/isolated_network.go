@@ -17,6 +17,7 @@ limitations under the License.
 package cloud
 
 import (
+	"context"
 	"strconv"
 	"strings"
 
@@ -27,17 +28,18 @@ import (
 )
 
 type IsoNetworkIface interface {
-	GetOrCreateIsolatedNetwork(*infrav1.CloudStackFailureDomain, *infrav1.CloudStackIsolatedNetwork, *infrav1.CloudStackCluster) error
-
-	AssociatePublicIPAddress(*infrav1.CloudStackFailureDomain, *infrav1.CloudStackIsolatedNetwork, *infrav1.CloudStackCluster) error
-	GetOrCreateLoadBalancerRule(*infrav1.CloudStackFailureDomain, *infrav1.CloudStackIsolatedNetwork, *infrav1.CloudStackCluster) error
-	OpenFirewallRules(*infrav1.CloudStackIsolatedNetwork) error
-	GetPublicIP(*infrav1.CloudStackFailureDomain, *infrav1.CloudStackIsolatedNetwork, *infrav1.CloudStackCluster) (*cloudstack.PublicIpAddress, error)
-	ResolveLoadBalancerRuleDetails(*infrav1.CloudStackFailureDomain, *infrav1.CloudStackIsolatedNetwork, *infrav1.CloudStackCluster) error
-
-	AssignVMToLoadBalancerRule(isoNet *infrav1.CloudStackIsolatedNetwork, instanceID string) error
-	DeleteNetwork(infrav1.Network) error
-	DisposeIsoNetResources(*infrav1.CloudStackFailureDomain, *infrav1.CloudStackIsolatedNetwork, *infrav1.CloudStackCluster) error
+	GetOrCreateIsolatedNetwork(context.Context, *infrav1.CloudStackFailureDomain, *infrav1.CloudStackIsolatedNetwork, *infrav1.CloudStackCluster) error
+
+	AssociatePublicIPAddress(context.Context, *infrav1.CloudStackFailureDomain, *infrav1.CloudStackIsolatedNetwork, *infrav1.CloudStackCluster) error
+	GetOrCreateLoadBalancerRule(context.Context, *infrav1.CloudStackFailureDomain, *infrav1.CloudStackIsolatedNetwork, *infrav1.CloudStackCluster) error
+	OpenFirewallRules(context.Context, *infrav1.CloudStackIsolatedNetwork) error
+	GetPublicIP(context.Context, *infrav1.CloudStackFailureDomain, *infrav1.CloudStackIsolatedNetwork, *infrav1.CloudStackCluster) (*cloudstack.PublicIpAddress, error)
+	ResolveLoadBalancerRuleDetails(context.Context, *infrav1.CloudStackFailureDomain, *infrav1.CloudStackIsolatedNetwork, *infrav1.CloudStackCluster) error
+
+	AssignVMToLoadBalancerRule(ctx context.Context, isoNet *infrav1.CloudStackIsolatedNetwork, instanceID string) error
+	DeleteNetwork(context.Context, infrav1.Network) error
+	DisposeIsoNetResources(context.Context, *infrav1.CloudStackFailureDomain, *infrav1.CloudStackIsolatedNetwork, *infrav1.CloudStackCluster) error
+	ReconcileIsoNetTags(context.Context, *infrav1.CloudStackIsolatedNetwork, *infrav1.CloudStackCluster) error
 }
 
 // getOfferingID fetches an offering id.
@@ -54,12 +56,14 @@ func (c *client) getOfferingID() (string, error) {
 
 // AssociatePublicIPAddress Gets a PublicIP and associates the public IP to passed isolated network.
 func (c *client) AssociatePublicIPAddress(
+	ctx context.Context,
 	fd *infrav1.CloudStackFailureDomain,
 	isoNet *infrav1.CloudStackIsolatedNetwork,
 	csCluster *infrav1.CloudStackCluster,
 ) (retErr error) {
+	c = c.withContext(ctx)
 	// Check specified IP address is available or get an unused one if not specified.
-	publicAddress, err := c.GetPublicIP(fd, isoNet, csCluster)
+	publicAddress, err := c.GetPublicIP(ctx, fd, isoNet, csCluster)
 	if err != nil {
 		return errors.Wrapf(err, "fetching a public IP address")
 	}
@@ -76,15 +80,16 @@ func (c *client) AssociatePublicIPAddress(
 	p := c.cs.Address.NewAssociateIpAddressParams()
 	p.SetIpaddress(isoNet.Spec.ControlPlaneEndpoint.Host)
 	p.SetNetworkid(isoNet.Spec.ID)
+	setIfNotEmpty(c.projectID, p.SetProjectid)
 	if _, err := c.cs.Address.AssociateIpAddress(p); err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 		return errors.Wrapf(err,
 			"associating public IP address with ID %s to network with ID %s",
 			publicAddress.Id, isoNet.Spec.ID)
-	} else if err := c.AddClusterTag(ResourceTypeIPAddress, publicAddress.Id, csCluster); err != nil {
+	} else if err := c.AddClusterTag(ctx, ResourceTypeIPAddress, publicAddress.Id, csCluster); err != nil {
 		return errors.Wrapf(err,
 			"adding tag to public IP address with ID %s", publicAddress.Id)
-	} else if err := c.AddCreatedByCAPCTag(ResourceTypeIPAddress, isoNet.Status.PublicIPID); err != nil {
+	} else if err := c.AddCreatedByCAPCTag(ctx, ResourceTypeIPAddress, isoNet.Status.PublicIPID); err != nil {
 		return errors.Wrapf(err,
 			"adding tag to public IP address with ID %s", publicAddress.Id)
 	}
@@ -92,7 +97,8 @@ func (c *client) AssociatePublicIPAddress(
 }
 
 // CreateIsolatedNetwork creates an isolated network in the relevant FailureDomain per passed network specification.
-func (c *client) CreateIsolatedNetwork(fd *infrav1.CloudStackFailureDomain, isoNet *infrav1.CloudStackIsolatedNetwork) (retErr error) {
+func (c *client) CreateIsolatedNetwork(ctx context.Context, fd *infrav1.CloudStackFailureDomain, isoNet *infrav1.CloudStackIsolatedNetwork) (retErr error) {
+	c = c.withContext(ctx)
 	// Get network offering ID.
 	offeringID, err := c.getOfferingID()
 	if err != nil {
@@ -101,20 +107,52 @@ func (c *client) CreateIsolatedNetwork(fd *infrav1.CloudStackFailureDomain, isoN
 
 	// Do isolated network creation.
 	p := c.cs.Network.NewCreateNetworkParams(isoNet.Spec.Name, isoNet.Spec.Name, offeringID, fd.Spec.Zone.ID)
+	setIfNotEmpty(c.projectID, p.SetProjectid)
 	resp, err := c.cs.Network.CreateNetwork(p)
 	if err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 		return errors.Wrapf(err, "creating network with name %s", isoNet.Spec.Name)
 	}
 	isoNet.Spec.ID = resp.Id
-	return c.AddCreatedByCAPCTag(ResourceTypeNetwork, isoNet.Spec.ID)
+	return c.AddCreatedByCAPCTag(ctx, ResourceTypeNetwork, isoNet.Spec.ID)
+}
+
+// ReconcileIsoNetTags applies the additional tags of the cluster to the isolated network and its public IP address when
+// CAPC created or associated them, removing the ones applied before that were since removed from the cluster.
+func (c *client) ReconcileIsoNetTags(
+	ctx context.Context,
+	isoNet *infrav1.CloudStackIsolatedNetwork,
+	csCluster *infrav1.CloudStackCluster,
+) error {
+	tags := mergeTags(csCluster.Spec.AdditionalTags)
+	if tagsEqual(tags, isoNet.Status.AppliedTags) {
+		return nil
+	}
+
+	resources := map[ResourceType]string{ResourceTypeNetwork: isoNet.Spec.ID, ResourceTypeIPAddress: isoNet.Status.PublicIPID}
+	for rType, rID := range resources {
+		if rID == "" {
+			continue
+		}
+		if managedByCAPC, err := c.IsCapcManaged(ctx, rType, rID); err != nil {
+			return err
+		} else if !managedByCAPC {
+			continue
+		}
+		if err := c.ReconcileTags(ctx, rType, rID, tags, isoNet.Status.AppliedTags); err != nil {
+			return err
+		}
+	}
+	isoNet.Status.AppliedTags = tags
+	return nil
 }
 
 // OpenFirewallRules opens a CloudStack firewall for an isolated network.
-func (c *client) OpenFirewallRules(isoNet *infrav1.CloudStackIsolatedNetwork) (retErr error) {
+func (c *client) OpenFirewallRules(ctx context.Context, isoNet *infrav1.CloudStackIsolatedNetwork) (retErr error) {
+	c = c.withContext(ctx)
 	p := c.cs.Firewall.NewCreateEgressFirewallRuleParams(isoNet.Spec.ID, NetworkProtocolTCP)
 	_, retErr = c.cs.Firewall.CreateEgressFirewallRule(p)
-	if retErr != nil && strings.Contains(strings.ToLower(retErr.Error()), "there is already") { // Already a firewall rule here.
+	if retErr = NewAPIError(retErr); IsAlreadyExists(retErr) { // Already a firewall rule here.
 		retErr = nil
 	}
 	c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(retErr)
@@ -123,16 +161,19 @@ func (c *client) OpenFirewallRules(isoNet *infrav1.CloudStackIsolatedNetwork) (r
 
 // GetPublicIP gets a public IP with ID for cluster endpoint.
 func (c *client) GetPublicIP(
+	ctx context.Context,
 	fd *infrav1.CloudStackFailureDomain,
 	isoNet *infrav1.CloudStackIsolatedNetwork,
 	csCluster *infrav1.CloudStackCluster,
 ) (*cloudstack.PublicIpAddress, error) {
+	c = c.withContext(ctx)
 	ip := csCluster.Spec.ControlPlaneEndpoint.Host
 
 	p := c.cs.Address.NewListPublicIpAddressesParams()
 	p.SetAllocatedonly(false)
 	p.SetZoneid(fd.Spec.Zone.ID)
 	setIfNotEmpty(ip, p.SetIpaddress)
+	setIfNotEmpty(c.projectID, p.SetProjectid)
 	publicAddresses, err := c.cs.Address.ListPublicIpAddresses(p)
 	if err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
@@ -152,8 +193,9 @@ func (c *client) GetPublicIP(
 }
 
 // GetIsolatedNetwork gets an isolated network in the relevant Zone.
-func (c *client) GetIsolatedNetwork(isoNet *infrav1.CloudStackIsolatedNetwork) (retErr error) {
-	netDetails, count, err := c.cs.Network.GetNetworkByName(isoNet.Spec.Name)
+func (c *client) GetIsolatedNetwork(ctx context.Context, isoNet *infrav1.CloudStackIsolatedNetwork) (retErr error) {
+	c = c.withContext(ctx)
+	netDetails, count, err := c.cs.Network.GetNetworkByName(isoNet.Spec.Name, c.projectOpts()...)
 	if err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 		retErr = multierror.Append(retErr, errors.Wrapf(err, "could not get Network ID from %s", isoNet.Spec.Name))
@@ -165,7 +207,7 @@ func (c *client) GetIsolatedNetwork(isoNet *infrav1.CloudStackIsolatedNetwork) (
 		return nil
 	}
 
-	netDetails, count, err = c.cs.Network.GetNetworkByID(isoNet.Spec.ID)
+	netDetails, count, err = c.cs.Network.GetNetworkByID(isoNet.Spec.ID, c.projectOpts()...)
 	if err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 		return multierror.Append(retErr, errors.Wrapf(err, "could not get Network by ID %s", isoNet.Spec.ID))
@@ -178,12 +220,15 @@ func (c *client) GetIsolatedNetwork(isoNet *infrav1.CloudStackIsolatedNetwork) (
 
 // ResolveLoadBalancerRuleDetails resolves the details of a load balancer rule by PublicIPID and Port.
 func (c *client) ResolveLoadBalancerRuleDetails(
+	ctx context.Context,
 	fd *infrav1.CloudStackFailureDomain,
 	isoNet *infrav1.CloudStackIsolatedNetwork,
 	csCluster *infrav1.CloudStackCluster,
 ) error {
+	c = c.withContext(ctx)
 	p := c.cs.LoadBalancer.NewListLoadBalancerRulesParams()
 	p.SetPublicipid(isoNet.Status.PublicIPID)
+	setIfNotEmpty(c.projectID, p.SetProjectid)
 	loadBalancerRules, err := c.cs.LoadBalancer.ListLoadBalancerRules(p)
 	if err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
@@ -196,15 +241,17 @@ func (c *client) ResolveLoadBalancerRuleDetails(
 			return nil
 		}
 	}
-	return errors.New("no load balancer rule found")
+	return newNotFoundError(errors.New("no load balancer rule found"))
 }
 
 // GetOrCreateLoadBalancerRule Create a load balancer rule that can be assigned to instances.
 func (c *client) GetOrCreateLoadBalancerRule(
+	ctx context.Context,
 	fd *infrav1.CloudStackFailureDomain,
 	isoNet *infrav1.CloudStackIsolatedNetwork,
 	csCluster *infrav1.CloudStackCluster,
 ) (retErr error) {
+	c = c.withContext(ctx)
 	// Check/set ports.
 	// Prefer control plane endpoint. Take iso net port if CP missing. Set to default if both missing.
 	if csCluster.Spec.ControlPlaneEndpoint.Port != 0 {
@@ -217,8 +264,7 @@ func (c *client) GetOrCreateLoadBalancerRule(
 	}
 
 	// Check if rule exists.
-	if err := c.ResolveLoadBalancerRuleDetails(fd, isoNet, csCluster); err == nil ||
-		!strings.Contains(strings.ToLower(err.Error()), "no load balancer rule found") {
+	if err := c.ResolveLoadBalancerRuleDetails(ctx, fd, isoNet, csCluster); err == nil || !IsNotFound(err) {
 		return errors.Wrap(err, "resolving load balancer rule details")
 	}
 
@@ -240,14 +286,15 @@ func (c *client) GetOrCreateLoadBalancerRule(
 
 // GetOrCreateIsolatedNetwork fetches or builds out the necessary structures for isolated network use.
 func (c *client) GetOrCreateIsolatedNetwork(
+	ctx context.Context,
 	fd *infrav1.CloudStackFailureDomain,
 	isoNet *infrav1.CloudStackIsolatedNetwork,
 	csCluster *infrav1.CloudStackCluster,
 ) error {
 	// Get or create the isolated network itself and resolve details into passed custom resources.
 	net := isoNet.Network()
-	if err := c.ResolveNetwork(net); err != nil { // Doesn't exist, create isolated network.
-		if err = c.CreateIsolatedNetwork(fd, isoNet); err != nil {
+	if err := c.ResolveNetwork(ctx, net); err != nil { // Doesn't exist, create isolated network.
+		if err = c.CreateIsolatedNetwork(ctx, fd, isoNet); err != nil {
 			return errors.Wrap(err, "creating a new isolated network")
 		}
 	} else { // Network existed and was resolved. Set ID on isoNet CloudStackIsolatedNetwork in case it only had name set.
@@ -256,26 +303,27 @@ func (c *client) GetOrCreateIsolatedNetwork(
 
 	// Tag the created network.
 	networkID := isoNet.Spec.ID
-	if err := c.AddClusterTag(ResourceTypeNetwork, networkID, csCluster); err != nil {
+	if err := c.AddClusterTag(ctx, ResourceTypeNetwork, networkID, csCluster); err != nil {
 		return errors.Wrapf(err, "tagging network with id %s", networkID)
 	}
 
 	// Associate Public IP with CloudStackIsolatedNetwork
-	if err := c.AssociatePublicIPAddress(fd, isoNet, csCluster); err != nil {
+	if err := c.AssociatePublicIPAddress(ctx, fd, isoNet, csCluster); err != nil {
 		return errors.Wrapf(err, "associating public IP address to csCluster")
 	}
 
 	// Setup a load balancing rule to map VMs to Public IP.
-	if err := c.GetOrCreateLoadBalancerRule(fd, isoNet, csCluster); err != nil {
+	if err := c.GetOrCreateLoadBalancerRule(ctx, fd, isoNet, csCluster); err != nil {
 		return errors.Wrap(err, "getting or creating load balancing rule")
 	}
 
 	//  Open the Isolated Network on endopint port.
-	return errors.Wrap(c.OpenFirewallRules(isoNet), "opening the isolated network's firewall")
+	return errors.Wrap(c.OpenFirewallRules(ctx, isoNet), "opening the isolated network's firewall")
 }
 
 // AssignVMToLoadBalancerRule assigns a VM instance to a load balancing rule (specifying lb membership).
-func (c *client) AssignVMToLoadBalancerRule(isoNet *infrav1.CloudStackIsolatedNetwork, instanceID string) (retErr error) {
+func (c *client) AssignVMToLoadBalancerRule(ctx context.Context, isoNet *infrav1.CloudStackIsolatedNetwork, instanceID string) (retErr error) {
+	c = c.withContext(ctx)
 
 	// Check that the instance isn't already in LB rotation.
 	lbRuleInstances, retErr := c.cs.LoadBalancer.ListLoadBalancerRuleInstances(
@@ -299,30 +347,32 @@ func (c *client) AssignVMToLoadBalancerRule(isoNet *infrav1.CloudStackIsolatedNe
 }
 
 // DeleteNetwork deletes an isolated network.
-func (c *client) DeleteNetwork(net infrav1.Network) error {
+func (c *client) DeleteNetwork(ctx context.Context, net infrav1.Network) error {
+	c = c.withContext(ctx)
 	_, err := c.cs.Network.DeleteNetwork(c.cs.Network.NewDeleteNetworkParams(net.ID))
 	c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
-	return errors.Wrapf(err, "deleting network with id %s", net.ID)
+	return errors.Wrapf(NewAPIError(err), "deleting network with id %s", net.ID)
 }
 
 // DisposeIsoNetResources cleans up isolated network resources.
 func (c *client) DisposeIsoNetResources(
+	ctx context.Context,
 	zone *infrav1.CloudStackFailureDomain,
 	isoNet *infrav1.CloudStackIsolatedNetwork,
 	csCluster *infrav1.CloudStackCluster,
 ) (retError error) {
 	if isoNet.Status.PublicIPID != "" {
-		if err := c.DeleteClusterTag(ResourceTypeIPAddress, isoNet.Status.PublicIPID, csCluster); err != nil {
+		if err := c.DeleteClusterTag(ctx, ResourceTypeIPAddress, isoNet.Status.PublicIPID, csCluster); err != nil {
 			return err
 		}
-		if err := c.DisassociatePublicIPAddressIfNotInUse(isoNet); err != nil {
+		if err := c.DisassociatePublicIPAddressIfNotInUse(ctx, isoNet); err != nil {
 			return err
 		}
 	}
-	if err := c.RemoveClusterTagFromNetwork(csCluster, *isoNet.Network()); err != nil {
+	if err := c.RemoveClusterTagFromNetwork(ctx, csCluster, *isoNet.Network()); err != nil {
 		return err
 	}
-	if err := c.DeleteNetworkIfNotInUse(csCluster, *isoNet.Network()); err != nil {
+	if err := c.DeleteNetworkIfNotInUse(ctx, csCluster, *isoNet.Network()); err != nil {
 		return err
 	}
 
@@ -330,8 +380,8 @@ func (c *client) DisposeIsoNetResources(
 }
 
 // DeleteNetworkIfNotInUse deletes an isolated network if the network is no longer in use (indicated by in use tags).
-func (c *client) DeleteNetworkIfNotInUse(csCluster *infrav1.CloudStackCluster, net infrav1.Network) (retError error) {
-	tags, err := c.GetTags(ResourceTypeNetwork, net.ID)
+func (c *client) DeleteNetworkIfNotInUse(ctx context.Context, csCluster *infrav1.CloudStackCluster, net infrav1.Network) (retError error) {
+	tags, err := c.GetTags(ctx, ResourceTypeNetwork, net.ID)
 	if err != nil {
 		return err
 	}
@@ -344,7 +394,7 @@ func (c *client) DeleteNetworkIfNotInUse(csCluster *infrav1.CloudStackCluster, n
 	}
 
 	if clusterTagCount == 0 && tags[CreatedByCAPCTagName] != "" {
-		return c.DeleteNetwork(net)
+		return c.DeleteNetwork(ctx, net)
 	}
 
 	return nil
@@ -352,30 +402,38 @@ func (c *client) DeleteNetworkIfNotInUse(csCluster *infrav1.CloudStackCluster, n
 
 // DisassociatePublicIPAddressIfNotInUse removes a CloudStack public IP association from passed isolated network
 // if it is no longer in use (indicated by in use tags).
-func (c *client) DisassociatePublicIPAddressIfNotInUse(isoNet *infrav1.CloudStackIsolatedNetwork) (retError error) {
-	if tagsAllowDisposal, err := c.DoClusterTagsAllowDisposal(ResourceTypeIPAddress, isoNet.Status.PublicIPID); err != nil {
+func (c *client) DisassociatePublicIPAddressIfNotInUse(ctx context.Context, isoNet *infrav1.CloudStackIsolatedNetwork) (retError error) {
+	c = c.withContext(ctx)
+	if tagsAllowDisposal, err := c.DoClusterTagsAllowDisposal(ctx, ResourceTypeIPAddress, isoNet.Status.PublicIPID); err != nil {
 		return err
-	} else if publicIP, _, err := c.cs.Address.GetPublicIpAddressByID(isoNet.Status.PublicIPID); err != nil {
+	} else if publicIP, _, err := c.cs.Address.GetPublicIpAddressByID(isoNet.Status.PublicIPID, c.projectOpts()...); err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
-		return err
+		return NewAPIError(err)
 	} else if publicIP == nil || publicIP.Issourcenat { // Can't disassociate an address if it's the source NAT address.
 		return nil
 	} else if tagsAllowDisposal {
-		return c.DisassociatePublicIPAddress(isoNet)
+		return c.DisassociatePublicIPAddress(ctx, isoNet)
 	}
 	return nil
 }
 
 // DisassociatePublicIPAddress removes a CloudStack public IP association from passed isolated network.
-func (c *client) DisassociatePublicIPAddress(isoNet *infrav1.CloudStackIsolatedNetwork) (retErr error) {
-	// Remove the CAPC creation tag, so it won't be there the next time this address is associated.
-	retErr = c.DeleteCreatedByCAPCTag(ResourceTypeIPAddress, isoNet.Status.PublicIPID)
+func (c *client) DisassociatePublicIPAddress(ctx context.Context, isoNet *infrav1.CloudStackIsolatedNetwork) (retErr error) {
+	c = c.withContext(ctx)
+	// Remove the CAPC creation tag and the cluster's additional tags, so they won't be there the next time this address
+	// is associated.
+	retErr = c.DeleteCreatedByCAPCTag(ctx, ResourceTypeIPAddress, isoNet.Status.PublicIPID)
 	if retErr != nil {
 		return retErr
 	}
+	if len(isoNet.Status.AppliedTags) > 0 {
+		if retErr = c.DeleteTags(ctx, ResourceTypeIPAddress, isoNet.Status.PublicIPID, isoNet.Status.AppliedTags); retErr != nil {
+			return retErr
+		}
+	}
 
 	p := c.cs.Address.NewDisassociateIpAddressParams(isoNet.Status.PublicIPID)
 	_, retErr = c.cs.Address.DisassociateIpAddress(p)
 	c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(retErr)
-	return retErr
+	return NewAPIError(retErr)
 }
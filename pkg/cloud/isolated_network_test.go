@@ -107,7 +107,7 @@ var _ = Describe("Network", func() {
 				&csapi.ListLoadBalancerRulesResponse{LoadBalancerRules: []*csapi.LoadBalancerRule{
 					{Publicport: strconv.Itoa(int(dummies.EndPointPort)), Id: dummies.LBRuleID}}}, nil)
 
-			Ω(client.GetOrCreateIsolatedNetwork(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+			Ω(client.GetOrCreateIsolatedNetwork(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
 		})
 
 		It("fails to get network offering from CloudStack", func() {
@@ -115,7 +115,7 @@ var _ = Describe("Network", func() {
 			ns.EXPECT().GetNetworkByID(dummies.ISONet1.ID).Return(nil, 0, nil)
 			nos.EXPECT().GetNetworkOfferingID(gomock.Any()).Return("", -1, fakeError)
 
-			err := client.GetOrCreateIsolatedNetwork(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)
+			err := client.GetOrCreateIsolatedNetwork(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)
 			Ω(err).ShouldNot(Succeed())
 			Ω(err.Error()).Should(ContainSubstring("creating a new isolated network"))
 		})
@@ -129,7 +129,7 @@ var _ = Describe("Network", func() {
 			fs.EXPECT().CreateEgressFirewallRule(&csapi.CreateEgressFirewallRuleParams{}).
 				Return(&csapi.CreateEgressFirewallRuleResponse{}, nil)
 
-			Ω(client.OpenFirewallRules(dummies.CSISONet1)).Should(Succeed())
+			Ω(client.OpenFirewallRules(ctx, dummies.CSISONet1)).Should(Succeed())
 		})
 	})
 
@@ -142,7 +142,7 @@ var _ = Describe("Network", func() {
 			fs.EXPECT().CreateEgressFirewallRule(&csapi.CreateEgressFirewallRuleParams{}).
 				Return(&csapi.CreateEgressFirewallRuleResponse{}, errors.New("there is already a rule like this"))
 
-			Ω(client.OpenFirewallRules(dummies.CSISONet1)).Should(Succeed())
+			Ω(client.OpenFirewallRules(ctx, dummies.CSISONet1)).Should(Succeed())
 		})
 	})
 
@@ -154,7 +154,7 @@ var _ = Describe("Network", func() {
 					Count:             1,
 					PublicIpAddresses: []*csapi.PublicIpAddress{{Id: "PublicIPID", Ipaddress: ipAddress}},
 				}, nil)
-			publicIPAddress, err := client.GetPublicIP(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)
+			publicIPAddress, err := client.GetPublicIP(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)
 			Ω(err).Should(Succeed())
 			Ω(publicIPAddress).ShouldNot(BeNil())
 			Ω(publicIPAddress.Ipaddress).Should(Equal(ipAddress))
@@ -169,7 +169,7 @@ var _ = Describe("Network", func() {
 					Count:             0,
 					PublicIpAddresses: []*csapi.PublicIpAddress{},
 				}, nil)
-			publicIPAddress, err := client.GetPublicIP(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)
+			publicIPAddress, err := client.GetPublicIP(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)
 			Ω(publicIPAddress).Should(BeNil())
 			Ω(err.Error()).Should(ContainSubstring("no public addresses found in available networks"))
 		})
@@ -190,7 +190,7 @@ var _ = Describe("Network", func() {
 							Associatednetworkid: "1",
 						}},
 				}, nil)
-			publicIPAddress, err := client.GetPublicIP(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)
+			publicIPAddress, err := client.GetPublicIP(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)
 			Ω(publicIPAddress).Should(BeNil())
 			Ω(err.Error()).Should(ContainSubstring("all Public IP Address(es) found were already allocated"))
 		})
@@ -218,7 +218,7 @@ var _ = Describe("Network", func() {
 				Return(&csapi.CreateTagsParams{}).Times(2)
 			rs.EXPECT().CreateTags(gomock.Any()).Return(&csapi.CreateTagsResponse{}, nil).Times(2)
 
-			Ω(client.AssociatePublicIPAddress(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+			Ω(client.AssociatePublicIPAddress(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
 		})
 
 		It("Failure Associating Public IP to Isolated network", func() {
@@ -231,7 +231,7 @@ var _ = Describe("Network", func() {
 			aip := &csapi.AssociateIpAddressParams{}
 			as.EXPECT().NewAssociateIpAddressParams().Return(aip)
 			as.EXPECT().AssociateIpAddress(aip).Return(nil, errors.New("Failed to allocate IP address"))
-			Ω(client.AssociatePublicIPAddress(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster).Error()).Should(ContainSubstring("associating public IP address with ID"))
+			Ω(client.AssociatePublicIPAddress(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster).Error()).Should(ContainSubstring("associating public IP address with ID"))
 		})
 	})
 
@@ -243,7 +243,7 @@ var _ = Describe("Network", func() {
 					{Publicport: strconv.Itoa(int(dummies.EndPointPort)), Id: dummies.LBRuleID}}}, nil)
 
 			dummies.CSISONet1.Status.LBRuleID = ""
-			Ω(client.ResolveLoadBalancerRuleDetails(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+			Ω(client.ResolveLoadBalancerRuleDetails(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
 			Ω(dummies.CSISONet1.Status.LBRuleID).Should(Equal(dummies.LBRuleID))
 		})
 
@@ -254,7 +254,7 @@ var _ = Describe("Network", func() {
 					{Publicport: "differentPublicPort", Id: dummies.LBRuleID}}}, nil)
 
 			dummies.CSISONet1.Status.LBRuleID = ""
-			Ω(client.ResolveLoadBalancerRuleDetails(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster).Error()).
+			Ω(client.ResolveLoadBalancerRuleDetails(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster).Error()).
 				Should(Equal("no load balancer rule found"))
 		})
 
@@ -264,7 +264,7 @@ var _ = Describe("Network", func() {
 				nil, fakeError)
 
 			dummies.CSISONet1.Status.LBRuleID = ""
-			Ω(client.ResolveLoadBalancerRuleDetails(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster).Error()).
+			Ω(client.ResolveLoadBalancerRuleDetails(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster).Error()).
 				Should(ContainSubstring("listing load balancer rules"))
 		})
 
@@ -275,7 +275,7 @@ var _ = Describe("Network", func() {
 					LoadBalancerRules: []*csapi.LoadBalancerRule{
 						{Publicport: strconv.Itoa(int(dummies.EndPointPort)), Id: dummies.LBRuleID}}}, nil)
 
-			Ω(client.GetOrCreateLoadBalancerRule(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+			Ω(client.GetOrCreateLoadBalancerRule(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
 			Ω(dummies.CSISONet1.Status.LBRuleID).Should(Equal(dummies.LBRuleID))
 		})
 	})
@@ -291,7 +291,7 @@ var _ = Describe("Network", func() {
 			lbs.EXPECT().NewAssignToLoadBalancerRuleParams(dummies.CSISONet1.Status.LBRuleID).Return(albp)
 			lbs.EXPECT().AssignToLoadBalancerRule(albp).Return(&csapi.AssignToLoadBalancerRuleResponse{}, nil)
 
-			Ω(client.AssignVMToLoadBalancerRule(dummies.CSISONet1, *dummies.CSMachine1.Spec.InstanceID)).Should(Succeed())
+			Ω(client.AssignVMToLoadBalancerRule(ctx, dummies.CSISONet1, *dummies.CSMachine1.Spec.InstanceID)).Should(Succeed())
 		})
 
 		It("Associating VM to LB rule fails", func() {
@@ -304,7 +304,7 @@ var _ = Describe("Network", func() {
 			lbs.EXPECT().NewAssignToLoadBalancerRuleParams(dummies.CSISONet1.Status.LBRuleID).Return(albp)
 			lbs.EXPECT().AssignToLoadBalancerRule(albp).Return(nil, fakeError)
 
-			Ω(client.AssignVMToLoadBalancerRule(dummies.CSISONet1, *dummies.CSMachine1.Spec.InstanceID)).ShouldNot(Succeed())
+			Ω(client.AssignVMToLoadBalancerRule(ctx, dummies.CSISONet1, *dummies.CSMachine1.Spec.InstanceID)).ShouldNot(Succeed())
 		})
 
 		It("LB Rule already assigned to VM", func() {
@@ -319,7 +319,7 @@ var _ = Describe("Network", func() {
 				}},
 			}, nil)
 
-			Ω(client.AssignVMToLoadBalancerRule(dummies.CSISONet1, *dummies.CSMachine1.Spec.InstanceID)).Should(Succeed())
+			Ω(client.AssignVMToLoadBalancerRule(ctx, dummies.CSISONet1, *dummies.CSMachine1.Spec.InstanceID)).Should(Succeed())
 		})
 	})
 
@@ -334,7 +334,7 @@ var _ = Describe("Network", func() {
 			lbs.EXPECT().CreateLoadBalancerRule(gomock.Any()).
 				Return(&csapi.CreateLoadBalancerRuleResponse{Id: "2ndLBRuleID"}, nil)
 
-			Ω(client.GetOrCreateLoadBalancerRule(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+			Ω(client.GetOrCreateLoadBalancerRule(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
 			Ω(dummies.CSISONet1.Status.LBRuleID).Should(Equal("2ndLBRuleID"))
 		})
 
@@ -342,7 +342,7 @@ var _ = Describe("Network", func() {
 			lbs.EXPECT().NewListLoadBalancerRulesParams().Return(&csapi.ListLoadBalancerRulesParams{})
 			lbs.EXPECT().ListLoadBalancerRules(gomock.Any()).
 				Return(nil, fakeError)
-			err := client.GetOrCreateLoadBalancerRule(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)
+			err := client.GetOrCreateLoadBalancerRule(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)
 			Ω(err).ShouldNot(Succeed())
 			Ω(err.Error()).Should(ContainSubstring(errorMessage))
 		})
@@ -356,7 +356,7 @@ var _ = Describe("Network", func() {
 				Return(&csapi.CreateLoadBalancerRuleParams{})
 			lbs.EXPECT().CreateLoadBalancerRule(gomock.Any()).
 				Return(nil, fakeError)
-			err := client.GetOrCreateLoadBalancerRule(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)
+			err := client.GetOrCreateLoadBalancerRule(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)
 			Ω(err).ShouldNot(Succeed())
 			Ω(err.Error()).Should(Equal(errorMessage))
 
@@ -369,14 +369,14 @@ var _ = Describe("Network", func() {
 			ns.EXPECT().NewDeleteNetworkParams(dummies.ISONet1.ID).Return(dnp)
 			ns.EXPECT().DeleteNetwork(dnp).Return(&csapi.DeleteNetworkResponse{}, nil)
 
-			Ω(client.DeleteNetwork(dummies.ISONet1)).Should(Succeed())
+			Ω(client.DeleteNetwork(ctx, dummies.ISONet1)).Should(Succeed())
 		})
 
 		It("Network deletion failure", func() {
 			dnp := &csapi.DeleteNetworkParams{}
 			ns.EXPECT().NewDeleteNetworkParams(dummies.ISONet1.ID).Return(dnp)
 			ns.EXPECT().DeleteNetwork(dnp).Return(nil, fakeError)
-			err := client.DeleteNetwork(dummies.ISONet1)
+			err := client.DeleteNetwork(ctx, dummies.ISONet1)
 			Ω(err).ShouldNot(Succeed())
 			Ω(err.Error()).Should(ContainSubstring("deleting network with id " + dummies.ISONet1.ID))
 		})
@@ -390,7 +390,7 @@ var _ = Describe("Network", func() {
 			rs.EXPECT().ListTags(rtlp).Return(&csapi.ListTagsResponse{}, nil).Times(4)
 			as.EXPECT().GetPublicIpAddressByID(dummies.CSISONet1.Status.PublicIPID).Return(&csapi.PublicIpAddress{}, 1, nil)
 
-			Ω(client.DisposeIsoNetResources(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+			Ω(client.DisposeIsoNetResources(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
 		})
 
 		It("delete all isolated network resources when managed by CAPC", func() {
@@ -408,7 +408,7 @@ var _ = Describe("Network", func() {
 			as.EXPECT().NewDisassociateIpAddressParams(dummies.CSISONet1.Status.PublicIPID).Return(dap)
 			as.EXPECT().DisassociateIpAddress(dap).Return(&csapi.DisassociateIpAddressResponse{}, nil)
 
-			Ω(client.DisposeIsoNetResources(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+			Ω(client.DisposeIsoNetResources(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
 		})
 
 		It("disassociate IP address fails due to failure in deleting a resource i.e., disassociate Public IP", func() {
@@ -425,7 +425,7 @@ var _ = Describe("Network", func() {
 			as.EXPECT().NewDisassociateIpAddressParams(dummies.CSISONet1.Status.PublicIPID).Return(dap)
 			as.EXPECT().DisassociateIpAddress(dap).Return(nil, fakeError)
 
-			Ω(client.DisposeIsoNetResources(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).ShouldNot(Succeed())
+			Ω(client.DisposeIsoNetResources(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).ShouldNot(Succeed())
 		})
 
 	})
@@ -434,12 +434,12 @@ var _ = Describe("Network", func() {
 		BeforeEach(func() {
 			client = realCloudClient
 			// Delete any existing tags
-			existingTags, err := client.GetTags(cloud.ResourceTypeNetwork, dummies.Net1.ID)
+			existingTags, err := client.GetTags(ctx, cloud.ResourceTypeNetwork, dummies.Net1.ID)
 			if err != nil {
 				Fail("Failed to get existing tags. Error: " + err.Error())
 			}
 			if len(existingTags) != 0 {
-				err = client.DeleteTags(cloud.ResourceTypeNetwork, dummies.Net1.ID, existingTags)
+				err = client.DeleteTags(ctx, cloud.ResourceTypeNetwork, dummies.Net1.ID, existingTags)
 				if err != nil {
 					Fail("Failed to delete existing tags. Error: " + err.Error())
 				}
@@ -458,7 +458,7 @@ var _ = Describe("Network", func() {
 			dummies.SetDummyIsoNetToNameOnly()
 			dummies.SetClusterSpecToNet(&dummies.ISONet1)
 
-			Ω(client.ResolveNetwork(&dummies.ISONet1)).Should(Succeed())
+			Ω(client.ResolveNetwork(ctx, &dummies.ISONet1)).Should(Succeed())
 			Ω(dummies.ISONet1.ID).ShouldNot(BeEmpty())
 			Ω(dummies.ISONet1.Type).Should(Equal(cloud.NetworkTypeIsolated))
 		})
@@ -468,18 +468,18 @@ var _ = Describe("Network", func() {
 			dummies.SetDummyIsoNetToNameOnly()
 			dummies.SetClusterSpecToNet(&dummies.ISONet1)
 			dummies.CSCluster.Spec.ControlPlaneEndpoint.Host = ""
-			Ω(client.ResolveNetwork(&dummies.ISONet1)).Should(Succeed())
+			Ω(client.ResolveNetwork(ctx, &dummies.ISONet1)).Should(Succeed())
 		})
 
 		It("adds an isolated network and doesn't fail when asked to GetOrCreateIsolatedNetwork multiple times", func() {
-			Ω(client.GetOrCreateIsolatedNetwork(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
-			Ω(client.GetOrCreateIsolatedNetwork(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+			Ω(client.GetOrCreateIsolatedNetwork(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+			Ω(client.GetOrCreateIsolatedNetwork(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
 
 			// Network should now exist if it didn't at the start.
-			Ω(client.ResolveNetwork(&dummies.ISONet1)).Should(Succeed())
+			Ω(client.ResolveNetwork(ctx, &dummies.ISONet1)).Should(Succeed())
 
 			// Do once more.
-			Ω(client.GetOrCreateIsolatedNetwork(dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+			Ω(client.GetOrCreateIsolatedNetwork(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
 		})
 	})
 })
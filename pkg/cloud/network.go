@@ -17,14 +17,16 @@ limitations under the License.
 package cloud
 
 import (
+	"context"
+
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
 )
 
 type NetworkIface interface {
-	ResolveNetwork(*infrav1.Network) error
-	RemoveClusterTagFromNetwork(*infrav1.CloudStackCluster, infrav1.Network) error
+	ResolveNetwork(context.Context, *infrav1.Network) error
+	RemoveClusterTagFromNetwork(context.Context, *infrav1.CloudStackCluster, infrav1.Network) error
 }
 
 const (
@@ -45,11 +47,12 @@ func NetworkExists(net infrav1.Network) bool {
 }
 
 // ResolveNetwork fetches networks' ID, Name, and Type.
-func (c *client) ResolveNetwork(net *infrav1.Network) (retErr error) {
+func (c *client) ResolveNetwork(ctx context.Context, net *infrav1.Network) (retErr error) {
+	c = c.withContext(ctx)
 	// TODO rebuild this to consider cases with networks in many zones.
 	// Use ListNetworks instead.
 	netName := net.Name
-	netDetails, count, err := c.cs.Network.GetNetworkByName(netName)
+	netDetails, count, err := c.cs.Network.GetNetworkByName(netName, c.projectOpts()...)
 	if err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 		retErr = multierror.Append(retErr, errors.Wrapf(err, "could not get Network ID from %s", netName))
@@ -63,7 +66,7 @@ func (c *client) ResolveNetwork(net *infrav1.Network) (retErr error) {
 	}
 
 	// Now get network details.
-	netDetails, count, err = c.cs.Network.GetNetworkByID(net.ID)
+	netDetails, count, err = c.cs.Network.GetNetworkByID(net.ID, c.projectOpts()...)
 	if err != nil {
 		return multierror.Append(retErr, errors.Wrapf(err, "could not get Network by ID %s", net.ID))
 	} else if count != 1 {
@@ -81,15 +84,15 @@ func generateNetworkTagName(csCluster *infrav1.CloudStackCluster) string {
 }
 
 // RemoveClusterTagFromNetwork the cluster in use tag from a network.
-func (c *client) RemoveClusterTagFromNetwork(csCluster *infrav1.CloudStackCluster, net infrav1.Network) (retError error) {
-	tags, err := c.GetTags(ResourceTypeNetwork, net.ID)
+func (c *client) RemoveClusterTagFromNetwork(ctx context.Context, csCluster *infrav1.CloudStackCluster, net infrav1.Network) (retError error) {
+	tags, err := c.GetTags(ctx, ResourceTypeNetwork, net.ID)
 	if err != nil {
 		return err
 	}
 
 	ClusterTagName := generateNetworkTagName(csCluster)
 	if tagValue := tags[ClusterTagName]; tagValue != "" {
-		if err = c.DeleteTags(ResourceTypeNetwork, net.ID, map[string]string{ClusterTagName: tagValue}); err != nil {
+		if err = c.DeleteTags(ctx, ResourceTypeNetwork, net.ID, map[string]string{ClusterTagName: tagValue}); err != nil {
 			return err
 		}
 	}
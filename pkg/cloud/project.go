@@ -0,0 +1,92 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	"github.com/pkg/errors"
+)
+
+type ProjectIface interface {
+	ResolveProject(context.Context, *Project) error
+	NewClientInProject(context.Context, string) (Client, error)
+}
+
+// Project contains specifications that identify a project.
+type Project struct {
+	Name string
+	ID   string
+}
+
+// ResolveProject resolves a project's information. A project can be specified by ID or Name.
+func (c *client) ResolveProject(ctx context.Context, project *Project) error {
+	c = c.withContext(ctx)
+	p := c.cs.Project.NewListProjectsParams()
+	p.SetListall(true)
+	setIfNotEmpty(project.ID, p.SetId)
+	if project.ID == "" {
+		setIfNotEmpty(project.Name, p.SetName)
+	}
+
+	resp, err := c.cs.Project.ListProjects(p)
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return errors.Wrapf(NewAPIError(err), "listing project %s%s", project.Name, project.ID)
+	} else if resp.Count != 1 {
+		return errors.Errorf("expected 1 Project with name %s or ID %s, but got %d", project.Name, project.ID, resp.Count)
+	}
+	project.ID = resp.Projects[0].Id
+	project.Name = resp.Projects[0].Name
+	return nil
+}
+
+// NewClientInProject returns a client whose resources are created and looked up in the passed project, given by name
+// or ID. Like the clients of domains and accounts, the client is kept with c.
+func (c *client) NewClientInProject(ctx context.Context, project string) (Client, error) {
+	projectKey := "project:" + project
+	c.accounts.mu.Lock()
+	defer c.accounts.mu.Unlock()
+	if projectClient, exists := c.accounts.clients[projectKey]; exists {
+		return projectClient, nil
+	}
+
+	resolved := &Project{Name: project}
+	if cloudstack.IsID(project) {
+		resolved = &Project{ID: project}
+	}
+	if err := c.ResolveProject(ctx, resolved); err != nil {
+		return nil, err
+	}
+
+	projectClient := *c
+	projectClient.projectID = resolved.ID
+	if c.accounts.clients == nil {
+		c.accounts.clients = map[string]*client{}
+	}
+	c.accounts.clients[projectKey] = &projectClient
+	return &projectClient, nil
+}
+
+// projectOpts returns the options scoping CloudStack-Go lookups to the client's project, if any.
+func (c *client) projectOpts() []cloudstack.OptionFunc {
+	if c.projectID == "" {
+		return nil
+	}
+	return []cloudstack.OptionFunc{cloudstack.WithProject(c.projectID)}
+}
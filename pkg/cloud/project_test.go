@@ -0,0 +1,144 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
+	dummies "sigs.k8s.io/cluster-api-provider-cloudstack/test/dummies/v1beta2"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/test/fakeacs"
+)
+
+var _ = Describe("Project", func() {
+	var (
+		server    *fakeacs.Server
+		client    cloud.Client
+		projectID string
+	)
+
+	BeforeEach(func() {
+		dummies.SetDummyVars()
+		server = fakeacs.NewServer()
+		DeferCleanup(server.Close)
+
+		zoneID := server.AddZone(dummies.Zone1.Name)
+		server.AddNetwork(zoneID, dummies.Zone1.Network.Name, cloud.NetworkTypeShared)
+		server.AddServiceOffering(dummies.CSMachine1.Spec.Offering.Name, 2, 2048)
+		server.AddTemplate(zoneID, dummies.CSMachine1.Spec.Template.Name)
+		server.AddDiskOffering(dummies.CSMachine1.Spec.DiskOffering.Name, 10, false)
+		server.AddPublicIPAddress(zoneID, "192.168.1.10")
+		projectID = server.AddProject("tenant-project")
+
+		// The client cache is created with the TTL of the first client, which the cache expiration specs rely on.
+		var err error
+		client, err = cloud.NewClientFromConf(cloud.Config{
+			APIUrl:    server.APIURL(),
+			APIKey:    server.APIKey,
+			SecretKey: server.SecretKey,
+		}, &corev1.ConfigMap{Data: map[string]string{cloud.ClientCacheTTLKey: "100ms"}})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(client.ResolveZone(ctx, &dummies.CSFailureDomain1.Spec.Zone)).Should(Succeed())
+		Ω(client.ResolveNetworkForZone(ctx, &dummies.CSFailureDomain1.Spec.Zone)).Should(Succeed())
+		dummies.CSMachine1.Spec.InstanceID = nil
+		dummies.CSCluster.Spec.ControlPlaneEndpoint.Host = ""
+	})
+
+	Context("ResolveProject", func() {
+		It("Resolves a project by name or ID", func() {
+			project := &cloud.Project{Name: "tenant-project"}
+			Ω(client.ResolveProject(ctx, project)).Should(Succeed())
+			Ω(project.ID).Should(Equal(projectID))
+
+			project = &cloud.Project{ID: projectID}
+			Ω(client.ResolveProject(ctx, project)).Should(Succeed())
+			Ω(project.Name).Should(Equal("tenant-project"))
+		})
+
+		It("Returns an error for an unknown project", func() {
+			Ω(client.ResolveProject(ctx, &cloud.Project{Name: "unknown-project"})).
+				Should(MatchError(ContainSubstring("expected 1 Project")))
+			_, err := client.NewClientInProject(ctx, "unknown-project")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("NewClientInProject", func() {
+		It("Returns the same client for a project", func() {
+			byName, err := client.NewClientInProject(ctx, "tenant-project")
+			Ω(err).ShouldNot(HaveOccurred())
+			again, err := client.NewClientInProject(ctx, "tenant-project")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(again).Should(BeIdenticalTo(byName))
+		})
+
+		It("Deploys VMs in the project and finds them there", func() {
+			projectClient, err := client.NewClientInProject(ctx, projectID)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(projectClient.GetOrCreateVMInstance(
+				ctx, dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1,
+				dummies.CSAffinityGroup, "")).Should(Succeed())
+			vm, found := server.Get(fakeacs.KindVirtualMachine, *dummies.CSMachine1.Spec.InstanceID)
+			Ω(found).Should(BeTrue())
+			Ω(vm["projectid"]).Should(Equal(projectID))
+
+			Ω(projectClient.ResolveVMInstanceDetails(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(client.ResolveVMInstanceDetails(ctx, dummies.CSMachine1)).ShouldNot(Succeed())
+			Ω(projectClient.DestroyVMInstance(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(server.Count(fakeacs.KindVirtualMachine)).Should(BeZero())
+		})
+
+		It("Creates isolated networks and their public IP in the project", func() {
+			projectClient, err := client.NewClientInProject(ctx, "tenant-project")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(projectClient.GetOrCreateIsolatedNetwork(
+				ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+			network, found := server.Get(fakeacs.KindNetwork, dummies.CSISONet1.Spec.ID)
+			Ω(found).Should(BeTrue())
+			Ω(network["projectid"]).Should(Equal(projectID))
+			ip, found := server.Get(fakeacs.KindPublicIPAddress, dummies.CSISONet1.Status.PublicIPID)
+			Ω(found).Should(BeTrue())
+			Ω(ip["projectid"]).Should(Equal(projectID))
+
+			// The network is only found by name within the project.
+			Ω(projectClient.ResolveNetwork(ctx, dummies.CSISONet1.Network())).Should(Succeed())
+			Ω(client.ResolveNetwork(ctx, dummies.CSISONet1.Network())).ShouldNot(Succeed())
+			tags, err := projectClient.GetTags(ctx, cloud.ResourceTypeNetwork, dummies.CSISONet1.Spec.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(tags).Should(HaveKey(cloud.CreatedByCAPCTagName))
+		})
+
+		It("Creates affinity groups in the project", func() {
+			projectClient, err := client.NewClientInProject(ctx, "tenant-project")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			group := &cloud.AffinityGroup{Name: "project-affinity-group", Type: cloud.AffinityGroupType}
+			Ω(projectClient.GetOrCreateAffinityGroup(ctx, group)).Should(Succeed())
+			created, found := server.Get(fakeacs.KindAffinityGroup, group.ID)
+			Ω(found).Should(BeTrue())
+			Ω(created["projectid"]).Should(Equal(projectID))
+
+			Ω(projectClient.FetchAffinityGroup(ctx, &cloud.AffinityGroup{Name: group.Name})).Should(Succeed())
+			Ω(client.FetchAffinityGroup(ctx, &cloud.AffinityGroup{Name: group.Name})).ShouldNot(Succeed())
+			Ω(projectClient.DeleteAffinityGroup(ctx, group)).Should(Succeed())
+		})
+	})
+})
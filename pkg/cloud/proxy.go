@@ -0,0 +1,46 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyFunc returns the function choosing the proxy of the requests sent to the endpoint. Requests go through the
+// http-proxy of the config unless their host matches its no-proxy list. Without an http-proxy, the proxy is taken from
+// the environment as in the CloudStack-Go default transport.
+func (conf Config) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if conf.HTTPProxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	if proxyURL, err := url.Parse(conf.HTTPProxy); err != nil || proxyURL.Host == "" {
+		return nil, errors.Errorf("invalid http-proxy %q", conf.HTTPProxy)
+	}
+
+	proxyForURL := (&httpproxy.Config{
+		HTTPProxy:  conf.HTTPProxy,
+		HTTPSProxy: conf.HTTPProxy,
+		NoProxy:    conf.NoProxy,
+	}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyForURL(req.URL)
+	}, nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	corev1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/metrics"
+)
+
+// APIRetryConfig holds how ACS API requests failing for a transient reason are retried. A request is retried at most
+// MaxRetries times, waiting a jittered backoff starting at InitialBackoff and doubling up to MaxBackoff in between.
+type APIRetryConfig struct {
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// GetAPIRetryConfig returns the API retry settings from the passed config map. Missing or invalid values fall back to
+// their defaults. A MaxRetries of 0 disables retries.
+func GetAPIRetryConfig(clientConfig *corev1.ConfigMap) APIRetryConfig {
+	config := APIRetryConfig{
+		MaxRetries:     DefaultAPIRetryMaxRetries,
+		InitialBackoff: DefaultAPIRetryInitialBackoff,
+		MaxBackoff:     DefaultAPIRetryMaxBackoff,
+	}
+	if clientConfig == nil {
+		return config
+	}
+	if retries, err := strconv.Atoi(clientConfig.Data[APIRetryMaxRetriesKey]); err == nil && retries >= 0 {
+		config.MaxRetries = retries
+	}
+	if d, err := time.ParseDuration(clientConfig.Data[APIRetryInitialBackoffKey]); err == nil && d > 0 {
+		config.InitialBackoff = d
+	}
+	if d, err := time.ParseDuration(clientConfig.Data[APIRetryMaxBackoffKey]); err == nil && d > 0 {
+		config.MaxBackoff = d
+	}
+	if config.MaxBackoff < config.InitialBackoff {
+		config.MaxBackoff = config.InitialBackoff
+	}
+	return config
+}
+
+// backoff returns how long to wait before the passed retry, counting from 0. Half of the delay is random so requests
+// that failed together don't all come back at once.
+func (c APIRetryConfig) backoff(retry int) time.Duration {
+	delay := c.MaxBackoff
+	if retry < 32 && c.InitialBackoff<<retry < c.MaxBackoff {
+		delay = c.InitialBackoff << retry
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1)) // #nosec G404 -- weak crypt rand doesn't matter here.
+}
+
+// retryableWriteCommands are the commands changing state that can safely be sent again when unsure whether an earlier
+// attempt went through. All other commands besides reads are left to the next reconciliation.
+var retryableWriteCommands = map[string]bool{
+	"createTags":            true,
+	"deleteTags":            true,
+	"updateVMAffinityGroup": true,
+}
+
+// isRetryableCommand returns true for the ACS API commands a request can be retried for.
+func isRetryableCommand(command string) bool {
+	return isReadCommand(command) || retryableWriteCommands[command]
+}
+
+// retryTransport is an http.RoundTripper that retries requests of retryable commands that fail for a transient reason.
+// Retries stop after the configured number, or once the next one would start past the request's deadline.
+type retryTransport struct {
+	endpoint      string
+	config        APIRetryConfig
+	customMetrics metrics.ACSCustomMetrics
+	next          http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	command := apiCommand(req)
+	if t.config.MaxRetries == 0 || !isRetryableCommand(command) || (req.Body != nil && req.GetBody == nil) {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	for retry := 0; ; retry++ {
+		resp, err := t.next.RoundTrip(req)
+		resp, transient := isTransientResponse(resp, err)
+		if !transient || retry >= t.config.MaxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+		delay := t.config.backoff(retry)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if req, err = rewindRequest(req); err != nil {
+			return nil, err
+		}
+		t.customMetrics.IncrementAcsAPIRequestRetries(command, t.endpoint)
+	}
+}
+
+// rewindRequest returns a copy of req with a fresh body, so it can be sent again.
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.GetBody == nil {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	rewound := req.Clone(req.Context())
+	rewound.Body = body
+	return rewound, nil
+}
+
+// isTransientResponse returns true if a request failed with a connection error, or with an API error classified as
+// transient. The body of a failed response is read to get its error codes, and the response is returned with its body
+// restored.
+func isTransientResponse(resp *http.Response, err error) (*http.Response, bool) {
+	if err != nil {
+		return resp, classify(0, 0, err.Error(), err) == ErrorReasonTransient
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, false
+	}
+
+	body, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if readErr != nil {
+		return resp, false
+	}
+	// ACS API errors come as {"<command>response": {"errorcode": ..., "cserrorcode": ..., "errortext": ...}}.
+	var wrapped map[string]json.RawMessage
+	var csErr cloudstack.CSError
+	if json.Unmarshal(body, &wrapped) == nil {
+		for _, content := range wrapped {
+			_ = json.Unmarshal(content, &csErr)
+		}
+	}
+	return resp, classify(resp.StatusCode, csErr.CSErrorCode, csErr.ErrorText, nil) == ErrorReasonTransient
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	"github.com/pkg/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+)
+
+// ErrScalingUnsupported is returned when CloudStack refused to scale a machine's instance even while stopped. The
+// machine has to be replaced to change its compute offering.
+var ErrScalingUnsupported = errors.New("CloudStack can't scale the VM")
+
+// maxScalingSteps bounds the steps taken in a single call, as each of them is followed by the next one when its job
+// completes right away. Those are live scaling, then stopping, scaling and starting the instance when live scaling is
+// refused, and finally marking the instance scaled.
+const maxScalingSteps = 5
+
+// ScaleVMInstance scales the machine's instance to the compute offering, CPU, memory and CPU speed of its spec. Running
+// instances are scaled live when they're dynamically scalable, and otherwise stopped, scaled and started again. Each
+// step is submitted as an async job tracked on the machine, so ErrAsyncJobPending is returned until all of them
+// complete. Progress is reported by the InstanceScaled condition of the machine, and ErrScalingUnsupported is
+// returned when CloudStack refuses to scale the stopped instance.
+func (c *client) ScaleVMInstance(
+	ctx context.Context,
+	csMachine *infrav1.CloudStackMachine,
+	fd *infrav1.CloudStackFailureDomain,
+) error {
+	c = c.withContext(ctx)
+	jobErr := c.pollMachineJob(csMachine, infrav1.AsyncJobScale)
+	if errors.Is(jobErr, ErrAsyncJobPending) {
+		return jobErr
+	}
+
+	for step := 0; step < maxScalingSteps; step++ {
+		vm, count, err := c.cs.VirtualMachine.GetVirtualMachinesMetricByID(*csMachine.Spec.InstanceID, c.projectOpts()...)
+		if err != nil {
+			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+			return errors.Wrapf(err, "getting VM %s", *csMachine.Spec.InstanceID)
+		} else if count != 1 {
+			return errors.Errorf("expected 1 VM with ID %s, but got %d", *csMachine.Spec.InstanceID, count)
+		}
+		setMachineDataFromVMMetrics(vm, csMachine)
+
+		jobID, err := c.nextScalingStep(csMachine, vm, fd.Spec.Zone.ID, jobErr)
+		if err != nil || jobID == "" {
+			return err
+		}
+		if jobErr = c.trackMachineJob(csMachine, infrav1.AsyncJobScale, jobID); errors.Is(jobErr, ErrAsyncJobPending) {
+			return jobErr
+		}
+	}
+	return jobErr
+}
+
+// nextScalingStep submits the next step scaling the machine's instance, given the error of the previous one, and
+// returns the ID of its job. No job ID is returned once the instance is scaled and running.
+func (c *client) nextScalingStep(
+	csMachine *infrav1.CloudStackMachine,
+	vm *cloudstack.VirtualMachinesMetric,
+	zoneID string,
+	jobErr error,
+) (string, error) {
+	reason := conditions.GetReason(csMachine, infrav1.InstanceScaledCondition)
+	if jobErr != nil {
+		if reason != infrav1.InstanceScalingReason {
+			return "", jobErr
+		}
+		return c.scalingRefused(csMachine, vm, jobErr)
+	}
+
+	if !needsScaling(csMachine, vm) {
+		if !conditions.IsFalse(csMachine, infrav1.InstanceScaledCondition) || reason == infrav1.InstanceScalingUnsupportedReason {
+			return "", nil
+		}
+		switch vm.State {
+		case "Running":
+			conditions.MarkTrue(csMachine, infrav1.InstanceScaledCondition)
+		case "Stopped":
+			conditions.MarkFalse(csMachine, infrav1.InstanceScaledCondition, infrav1.InstanceStartingAfterScalingReason,
+				clusterv1.ConditionSeverityInfo, "Starting instance after scaling it")
+			resp, err := c.csAsync.VirtualMachine.StartVirtualMachine(c.csAsync.VirtualMachine.NewStartVirtualMachineParams(vm.Id))
+			if err != nil {
+				c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+				return "", errors.Wrapf(err, "starting VM %s", vm.Id)
+			}
+			return resp.JobID, nil
+		}
+		return "", nil
+	}
+
+	switch {
+	case vm.State == "Running" && vm.Isdynamicallyscalable && reason != infrav1.InstanceStoppingForScalingReason:
+		return c.scaleVM(csMachine, vm, zoneID)
+	case vm.State == "Running":
+		return c.stopVMForScaling(csMachine, vm)
+	case vm.State == "Stopped":
+		return c.scaleVM(csMachine, vm, zoneID)
+	}
+	// Wait for the instance to settle in another state.
+	return "", nil
+}
+
+// needsScaling returns true if the VM doesn't run with the compute offering, CPU, memory and CPU speed of the machine.
+func needsScaling(csMachine *infrav1.CloudStackMachine, vm *cloudstack.VirtualMachinesMetric) bool {
+	spec := csMachine.Spec
+	if spec.Offering.ID != "" && spec.Offering.ID != vm.Serviceofferingid ||
+		spec.Offering.ID == "" && spec.Offering.Name != vm.Serviceofferingname {
+		return true
+	}
+	return spec.CPU > 0 && spec.CPU != int64(vm.Cpunumber) ||
+		spec.MemoryMiB > 0 && spec.MemoryMiB != int64(vm.Memory) ||
+		spec.CPUSpeedMHz > 0 && spec.CPUSpeedMHz != int64(vm.Cpuspeed)
+}
+
+// scaleVM submits the scaling of the VM to the compute offering of the machine.
+func (c *client) scaleVM(csMachine *infrav1.CloudStackMachine, vm *cloudstack.VirtualMachinesMetric, zoneID string) (string, error) {
+	offeringID, err := c.ResolveServiceOffering(c.ctx, csMachine, zoneID)
+	if err != nil {
+		return "", err
+	}
+	conditions.MarkFalse(csMachine, infrav1.InstanceScaledCondition, infrav1.InstanceScalingReason,
+		clusterv1.ConditionSeverityInfo, "Scaling %s instance to service offering %s", vm.State, offeringID)
+
+	p := c.csAsync.VirtualMachine.NewScaleVirtualMachineParams(vm.Id, offeringID)
+	if details := computeDetails(csMachine); len(details) > 0 {
+		p.SetDetails(details)
+	}
+	resp, err := c.csAsync.VirtualMachine.ScaleVirtualMachine(p)
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return c.scalingRefused(csMachine, vm, NewAPIError(err))
+	}
+	return resp.JobID, nil
+}
+
+// scalingRefused handles CloudStack refusing to scale the VM, either when the scaling is submitted or by failing its
+// job. Running VMs are stopped to be scaled instead, while stopped ones can't be scaled at all.
+func (c *client) scalingRefused(csMachine *infrav1.CloudStackMachine, vm *cloudstack.VirtualMachinesMetric, err error) (string, error) {
+	if IsTransient(err) {
+		return "", errors.Wrapf(err, "scaling VM %s", vm.Id)
+	}
+	if vm.State != "Running" {
+		conditions.MarkFalse(csMachine, infrav1.InstanceScaledCondition, infrav1.InstanceScalingUnsupportedReason,
+			clusterv1.ConditionSeverityError, "%s", err.Error())
+		return "", fmt.Errorf("%w: %v", ErrScalingUnsupported, err)
+	}
+	return c.stopVMForScaling(csMachine, vm)
+}
+
+// stopVMForScaling submits the stop of a VM that can't be scaled while running.
+func (c *client) stopVMForScaling(csMachine *infrav1.CloudStackMachine, vm *cloudstack.VirtualMachinesMetric) (string, error) {
+	conditions.MarkFalse(csMachine, infrav1.InstanceScaledCondition, infrav1.InstanceStoppingForScalingReason,
+		clusterv1.ConditionSeverityInfo, "Stopping instance to scale it")
+	resp, err := c.csAsync.VirtualMachine.StopVirtualMachine(c.csAsync.VirtualMachine.NewStopVirtualMachineParams(vm.Id))
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return "", errors.Wrapf(err, "stopping VM %s", vm.Id)
+	}
+	return resp.JobID, nil
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package cloud
 
 import (
+	"context"
 	"strings"
 
 	"github.com/hashicorp/go-multierror"
@@ -26,36 +27,33 @@ import (
 )
 
 type TagIface interface {
-	AddClusterTag(ResourceType, string, *infrav1.CloudStackCluster) error
-	DeleteClusterTag(ResourceType, string, *infrav1.CloudStackCluster) error
-	AddCreatedByCAPCTag(ResourceType, string) error
-	DeleteCreatedByCAPCTag(ResourceType, string) error
-	DoClusterTagsAllowDisposal(ResourceType, string) (bool, error)
-	AddTags(ResourceType, string, map[string]string) error
-	GetTags(ResourceType, string) (map[string]string, error)
-	DeleteTags(ResourceType, string, map[string]string) error
+	AddClusterTag(context.Context, ResourceType, string, *infrav1.CloudStackCluster) error
+	DeleteClusterTag(context.Context, ResourceType, string, *infrav1.CloudStackCluster) error
+	AddCreatedByCAPCTag(context.Context, ResourceType, string) error
+	DeleteCreatedByCAPCTag(context.Context, ResourceType, string) error
+	DoClusterTagsAllowDisposal(context.Context, ResourceType, string) (bool, error)
+	AddTags(context.Context, ResourceType, string, map[string]string) error
+	GetTags(context.Context, ResourceType, string) (map[string]string, error)
+	DeleteTags(context.Context, ResourceType, string, map[string]string) error
+	ReconcileTags(context.Context, ResourceType, string, map[string]string, map[string]string) error
 }
 
 type ResourceType string
 
 const (
-	ClusterTagNamePrefix               = "CAPC_cluster_"
-	CreatedByCAPCTagName               = "created_by_CAPC"
-	ResourceTypeNetwork   ResourceType = "Network"
-	ResourceTypeIPAddress ResourceType = "PublicIpAddress"
+	ClusterTagNamePrefix                   = "CAPC_cluster_"
+	CreatedByCAPCTagName                   = "created_by_CAPC"
+	TemplateUIDTagName                     = "CAPC_template_uid"
+	ResourceTypeNetwork       ResourceType = "Network"
+	ResourceTypeIPAddress     ResourceType = "PublicIpAddress"
+	ResourceTypeVM            ResourceType = "UserVm"
+	ResourceTypeVolume        ResourceType = "Volume"
+	ResourceTypeAffinityGroup ResourceType = "AffinityGroup"
+	ResourceTypeTemplate      ResourceType = "Template"
 )
 
-// ignoreAlreadyPresentErrors returns nil if the error is an already present tag error.
-func ignoreAlreadyPresentErrors(err error, rType ResourceType, rID string) error {
-	matchSubString := strings.ToLower("already on " + string(rType) + " with id " + rID)
-	if err != nil && !strings.Contains(strings.ToLower(err.Error()), matchSubString) {
-		return err
-	}
-	return nil
-}
-
-func (c *client) IsCapcManaged(resourceType ResourceType, resourceID string) (bool, error) {
-	tags, err := c.GetTags(resourceType, resourceID)
+func (c *client) IsCapcManaged(ctx context.Context, resourceType ResourceType, resourceID string) (bool, error) {
+	tags, err := c.GetTags(ctx, resourceType, resourceID)
 	if err != nil {
 		return false, errors.Wrapf(err,
 			"checking if %s with ID: %s is tagged as CAPC managed", resourceType, resourceID)
@@ -65,42 +63,42 @@ func (c *client) IsCapcManaged(resourceType ResourceType, resourceID string) (bo
 }
 
 // AddClusterTag adds cluster tag to a resource. This tag indicates the resource is used by a given the cluster.
-func (c *client) AddClusterTag(rType ResourceType, rID string, csCluster *infrav1.CloudStackCluster) error {
-	if managedByCAPC, err := c.IsCapcManaged(rType, rID); err != nil {
+func (c *client) AddClusterTag(ctx context.Context, rType ResourceType, rID string, csCluster *infrav1.CloudStackCluster) error {
+	if managedByCAPC, err := c.IsCapcManaged(ctx, rType, rID); err != nil {
 		return err
 	} else if managedByCAPC {
 		ClusterTagName := generateClusterTagName(csCluster)
-		return c.AddTags(rType, rID, map[string]string{ClusterTagName: "1"})
+		return c.AddTags(ctx, rType, rID, map[string]string{ClusterTagName: "1"})
 	}
 	return nil
 }
 
 // DeleteClusterTag deletes the tag that associates the resource with a given cluster.
-func (c *client) DeleteClusterTag(rType ResourceType, rID string, csCluster *infrav1.CloudStackCluster) error {
-	if managedByCAPC, err := c.IsCapcManaged(rType, rID); err != nil {
+func (c *client) DeleteClusterTag(ctx context.Context, rType ResourceType, rID string, csCluster *infrav1.CloudStackCluster) error {
+	if managedByCAPC, err := c.IsCapcManaged(ctx, rType, rID); err != nil {
 		return err
 	} else if managedByCAPC {
 		ClusterTagName := generateClusterTagName(csCluster)
-		return c.DeleteTags(rType, rID, map[string]string{ClusterTagName: "1"})
+		return c.DeleteTags(ctx, rType, rID, map[string]string{ClusterTagName: "1"})
 	}
 	return nil
 }
 
 // AddCreatedByCAPCTag adds the tag that indicates that the resource was created by CAPC.
 // This is useful when a resource is disassociated but not deleted.
-func (c *client) AddCreatedByCAPCTag(rType ResourceType, rID string) error {
-	return c.AddTags(rType, rID, map[string]string{CreatedByCAPCTagName: "1"})
+func (c *client) AddCreatedByCAPCTag(ctx context.Context, rType ResourceType, rID string) error {
+	return c.AddTags(ctx, rType, rID, map[string]string{CreatedByCAPCTagName: "1"})
 }
 
 // DeleteCreatedByCAPCTag deletes the tag that indicates that the resource was created by CAPC.
-func (c *client) DeleteCreatedByCAPCTag(rType ResourceType, rID string) error {
-	return c.DeleteTags(rType, rID, map[string]string{CreatedByCAPCTagName: "1"})
+func (c *client) DeleteCreatedByCAPCTag(ctx context.Context, rType ResourceType, rID string) error {
+	return c.DeleteTags(ctx, rType, rID, map[string]string{CreatedByCAPCTagName: "1"})
 }
 
 // DoClusterTagsAllowDisposal checks to see if the resource is in a state that makes it eligible for disposal.  CAPC can
 // dispose of a resource if the tags show it was created by CAPC and isn't being used by any clusters.
-func (c *client) DoClusterTagsAllowDisposal(resourceType ResourceType, resourceID string) (bool, error) {
-	tags, err := c.GetTags(resourceType, resourceID)
+func (c *client) DoClusterTagsAllowDisposal(ctx context.Context, resourceType ResourceType, resourceID string) (bool, error) {
+	tags, err := c.GetTags(ctx, resourceType, resourceID)
 	if err != nil {
 		return false, err
 	}
@@ -116,23 +114,29 @@ func (c *client) DoClusterTagsAllowDisposal(resourceType ResourceType, resourceI
 }
 
 // AddTags adds arbitrary tags to a resource.
-func (c *client) AddTags(resourceType ResourceType, resourceID string, tags map[string]string) error {
+func (c *client) AddTags(ctx context.Context, resourceType ResourceType, resourceID string, tags map[string]string) error {
+	c = c.withContext(ctx)
 	p := c.cs.Resourcetags.NewCreateTagsParams([]string{resourceID}, string(resourceType), tags)
 	_, err := c.cs.Resourcetags.CreateTags(p)
+	if err = NewAPIError(err); IsAlreadyExists(err) { // The tags are already present.
+		return nil
+	}
 	c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
-	return ignoreAlreadyPresentErrors(err, resourceType, resourceID)
+	return err
 }
 
 // GetTags gets all of a resource's tags.
-func (c *client) GetTags(resourceType ResourceType, resourceID string) (map[string]string, error) {
+func (c *client) GetTags(ctx context.Context, resourceType ResourceType, resourceID string) (map[string]string, error) {
+	c = c.withContext(ctx)
 	p := c.cs.Resourcetags.NewListTagsParams()
 	p.SetResourceid(resourceID)
 	p.SetResourcetype(string(resourceType))
 	p.SetListall(true)
+	setIfNotEmpty(c.projectID, p.SetProjectid)
 	listTagResponse, err := c.cs.Resourcetags.ListTags(p)
 	if err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
-		return nil, err
+		return nil, NewAPIError(err)
 	}
 	tags := make(map[string]string, listTagResponse.Count)
 	for _, t := range listTagResponse.Tags {
@@ -143,14 +147,15 @@ func (c *client) GetTags(resourceType ResourceType, resourceID string) (map[stri
 
 // DeleteTags deletes the given tags from a resource.
 // Ignores errors if the tag is not present.
-func (c *client) DeleteTags(resourceType ResourceType, resourceID string, tagsToDelete map[string]string) error {
+func (c *client) DeleteTags(ctx context.Context, resourceType ResourceType, resourceID string, tagsToDelete map[string]string) error {
+	c = c.withContext(ctx)
 	for tagkey, tagval := range tagsToDelete {
 		p := c.cs.Resourcetags.NewDeleteTagsParams([]string{resourceID}, string(resourceType))
 		p.SetTags(tagsToDelete)
 		if _, err1 := c.cs.Resourcetags.DeleteTags(p); err1 != nil { // Error in deletion attempt. Check for tag.
 			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err1)
 			currTag := map[string]string{tagkey: tagval}
-			if tags, err2 := c.GetTags(resourceType, resourceID); len(tags) != 0 {
+			if tags, err2 := c.GetTags(ctx, resourceType, resourceID); len(tags) != 0 {
 				c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err2)
 				if _, foundTag := tags[tagkey]; foundTag {
 					return errors.Wrapf(multierror.Append(err1, err2),
@@ -162,6 +167,76 @@ func (c *client) DeleteTags(resourceType ResourceType, resourceID string, tagsTo
 	return nil
 }
 
+// ReconcileTags brings the additional tags of a resource to the desired ones, given the ones applied before. Applied
+// tags that aren't desired anymore are deleted, and tags whose value changed are replaced, as CloudStack doesn't
+// update the value of existing tags.
+func (c *client) ReconcileTags(
+	ctx context.Context,
+	resourceType ResourceType,
+	resourceID string,
+	desired map[string]string,
+	applied map[string]string,
+) error {
+	current, err := c.GetTags(ctx, resourceType, resourceID)
+	if err != nil {
+		return errors.Wrapf(err, "getting tags of %s with ID %s", resourceType, resourceID)
+	}
+
+	stale, missing := map[string]string{}, map[string]string{}
+	for key, value := range applied {
+		if _, ok := desired[key]; !ok && current[key] == value {
+			stale[key] = value
+		}
+	}
+	for key, value := range desired {
+		if currentValue, ok := current[key]; !ok {
+			missing[key] = value
+		} else if currentValue != value {
+			stale[key] = currentValue
+			missing[key] = value
+		}
+	}
+
+	if len(stale) > 0 {
+		if err := c.DeleteTags(ctx, resourceType, resourceID, stale); err != nil {
+			return err
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Wrapf(c.AddTags(ctx, resourceType, resourceID, missing),
+			"tagging %s with ID %s", resourceType, resourceID)
+	}
+	return nil
+}
+
+// mergeTags returns the union of the given tags, where later tags override the values of earlier ones. It returns nil
+// when there are none.
+func mergeTags(tagMaps ...map[string]string) map[string]string {
+	var merged map[string]string
+	for _, tags := range tagMaps {
+		for key, value := range tags {
+			if merged == nil {
+				merged = map[string]string{}
+			}
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// tagsEqual reports whether two sets of tags have the same keys and values.
+func tagsEqual(tags1, tags2 map[string]string) bool {
+	if len(tags1) != len(tags2) {
+		return false
+	}
+	for key, value := range tags1 {
+		if value2, ok := tags2[key]; !ok || value2 != value {
+			return false
+		}
+	}
+	return true
+}
+
 func generateClusterTagName(csCluster *infrav1.CloudStackCluster) string {
 	return ClusterTagNamePrefix + string(csCluster.UID)
 }
@@ -0,0 +1,189 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+)
+
+type TemplateIface interface {
+	GetOrRegisterTemplate(context.Context, *infrav1.CloudStackTemplate, *infrav1.CloudStackTemplateFailureDomainStatus) error
+	DeleteTemplate(context.Context, *infrav1.CloudStackTemplateFailureDomainStatus) error
+}
+
+// ErrTemplateConflict is returned when a template of the name of a CloudStackTemplate was registered in a zone by
+// something else than the CloudStackTemplate, which would otherwise adopt it, and delete it once deleted itself.
+var ErrTemplateConflict = errors.New("template registered by another owner")
+
+// GetOrRegisterTemplate registers the template in the zone of the failure domain status unless it already has a
+// template ID, then updates the status with the download progress of the template. Registered templates are tagged
+// with the UID of the CloudStackTemplate, and a template so tagged is adopted rather than registered again, in case
+// recording its ID failed.
+func (c *client) GetOrRegisterTemplate(
+	ctx context.Context,
+	csTemplate *infrav1.CloudStackTemplate,
+	fdStatus *infrav1.CloudStackTemplateFailureDomainStatus,
+) error {
+	c = c.withContext(ctx)
+	if fdStatus.TemplateID == "" {
+		templateID, err := c.findTemplate(csTemplate, fdStatus.ZoneID)
+		if err != nil {
+			return err
+		}
+		if templateID == "" {
+			if templateID, err = c.registerTemplate(csTemplate, fdStatus.ZoneID); err != nil {
+				return err
+			}
+			if err := c.AddTags(ctx, ResourceTypeTemplate, templateID,
+				map[string]string{TemplateUIDTagName: string(csTemplate.UID)}); err != nil {
+				// Untagged, the template would never be adopted, so it's deleted for the next attempt to register.
+				if deleteErr := c.DeleteTemplate(ctx, &infrav1.CloudStackTemplateFailureDomainStatus{
+					TemplateID: templateID, ZoneID: fdStatus.ZoneID}); deleteErr != nil {
+					return fmt.Errorf("tagging template %s: %v; delete template: %v", templateID, err, deleteErr)
+				}
+				return errors.Wrapf(err, "tagging template %s", templateID)
+			}
+		}
+		fdStatus.TemplateID = templateID
+	}
+
+	// The "self" filter lists the templates owned by the caller, or by the caller's project.
+	template, count, err := c.cs.Template.GetTemplateByID(fdStatus.TemplateID, "self", c.projectOpts()...)
+	if err = NewAPIError(err); IsNotFound(err) {
+		// The template was deleted from CloudStack, so it's registered again.
+		fdStatus.TemplateID, fdStatus.Status, fdStatus.Ready = "", "", false
+		return errors.Errorf("template %s not found in zone %s", csTemplate.TemplateName(), fdStatus.ZoneID)
+	} else if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return errors.Wrapf(err, "getting template %s", fdStatus.TemplateID)
+	} else if count != 1 {
+		return errors.Errorf("expected 1 template with UUID %s, but got %d", fdStatus.TemplateID, count)
+	}
+	fdStatus.Status = template.Status
+	fdStatus.Ready = template.Isready
+	return nil
+}
+
+// findTemplate returns the ID of the template of the CloudStackTemplate's name it registered in the zone, if any. A
+// template of that name the CloudStackTemplate didn't register is a conflict.
+func (c *client) findTemplate(csTemplate *infrav1.CloudStackTemplate, zoneID string) (string, error) {
+	name := csTemplate.TemplateName()
+	p := c.cs.Template.NewListTemplatesParams("self")
+	p.SetName(name)
+	p.SetZoneid(zoneID)
+	setIfNotEmpty(c.projectID, p.SetProjectid)
+	resp, err := c.cs.Template.ListTemplates(p)
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return "", errors.Wrapf(err, "listing templates named %s", name)
+	}
+	conflicting := ""
+	for _, template := range resp.Templates {
+		if template.Name != name {
+			continue
+		}
+		for _, tag := range template.Tags {
+			if tag.Key == TemplateUIDTagName && tag.Value == string(csTemplate.UID) {
+				return template.Id, nil
+			}
+		}
+		conflicting = template.Id
+	}
+	if conflicting != "" {
+		return "", fmt.Errorf("%w: template %s named %s in zone %s isn't tagged with %s=%s", ErrTemplateConflict,
+			conflicting, name, zoneID, TemplateUIDTagName, csTemplate.UID)
+	}
+	return "", nil
+}
+
+// registerTemplate registers the template in the zone and returns its ID. CloudStack downloads it asynchronously.
+func (c *client) registerTemplate(csTemplate *infrav1.CloudStackTemplate, zoneID string) (string, error) {
+	osTypeID, err := c.resolveOSType(csTemplate.Spec.OSType)
+	if err != nil {
+		return "", err
+	}
+	name := csTemplate.TemplateName()
+	displayText := csTemplate.Spec.DisplayText
+	if displayText == "" {
+		displayText = name
+	}
+	p := c.cs.Template.NewRegisterTemplateParams(
+		displayText, csTemplate.Spec.Format, csTemplate.Spec.Hypervisor, name, csTemplate.Spec.URL)
+	p.SetZoneid(zoneID)
+	p.SetOstypeid(osTypeID)
+	setIfNotEmpty(csTemplate.Spec.Checksum, p.SetChecksum)
+	setIfNotEmpty(c.projectID, p.SetProjectid)
+	resp, err := c.cs.Template.RegisterTemplate(p)
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return "", errors.Wrapf(err, "registering template %s", name)
+	} else if len(resp.RegisterTemplate) != 1 {
+		return "", errors.Errorf("expected 1 template registered as %s, but got %d", name, len(resp.RegisterTemplate))
+	}
+	return resp.RegisterTemplate[0].Id, nil
+}
+
+// resolveOSType returns the ID of the OS type given by ID or by name, which CloudStack calls its description.
+func (c *client) resolveOSType(osType infrav1.CloudStackResourceIdentifier) (string, error) {
+	if osType.ID != "" {
+		return osType.ID, nil
+	}
+	p := c.cs.GuestOS.NewListOsTypesParams()
+	p.SetDescription(osType.Name)
+	resp, err := c.cs.GuestOS.ListOsTypes(p)
+	if err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return "", errors.Wrapf(err, "listing OS types named %s", osType.Name)
+	}
+	for _, candidate := range resp.OsTypes {
+		if candidate.Description == osType.Name {
+			return candidate.Id, nil
+		}
+	}
+	return "", errors.Errorf("OS type %s not found", osType.Name)
+}
+
+// DeleteTemplate deletes the template of the failure domain status from its zone, if it was registered.
+func (c *client) DeleteTemplate(ctx context.Context, fdStatus *infrav1.CloudStackTemplateFailureDomainStatus) error {
+	if fdStatus.TemplateID == "" {
+		return nil
+	}
+	c = c.withContext(ctx)
+
+	p := c.cs.Template.NewDeleteTemplateParams(fdStatus.TemplateID)
+	setIfNotEmpty(fdStatus.ZoneID, p.SetZoneid)
+	if _, err := c.cs.Template.DeleteTemplate(p); err != nil {
+		// CloudStack rejects the IDs of templates deleted meanwhile as invalid.
+		if err = NewAPIError(err); !isParamError(err) || !c.isTemplateDeleted(fdStatus.TemplateID) {
+			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+			return errors.Wrapf(err, "deleting template %s", fdStatus.TemplateID)
+		}
+	}
+	fdStatus.TemplateID = ""
+	return nil
+}
+
+// isTemplateDeleted reports whether the template of the given ID no longer exists.
+func (c *client) isTemplateDeleted(templateID string) bool {
+	_, _, err := c.cs.Template.GetTemplateByID(templateID, "self", c.projectOpts()...)
+	return IsNotFound(NewAPIError(err))
+}
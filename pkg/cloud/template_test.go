@@ -0,0 +1,161 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
+	dummies "sigs.k8s.io/cluster-api-provider-cloudstack/test/dummies/v1beta2"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/test/fakeacs"
+)
+
+var _ = Describe("Template", func() {
+	var (
+		server   *fakeacs.Server
+		client   cloud.Client
+		zoneID   string
+		osTypeID string
+		fdStatus *infrav1.CloudStackTemplateFailureDomainStatus
+	)
+
+	BeforeEach(func() {
+		dummies.SetDummyVars()
+		server = fakeacs.NewServer()
+		DeferCleanup(server.Close)
+
+		zoneID = server.AddZone(dummies.Zone1.Name)
+		osTypeID = server.AddOsType(dummies.CSTemplate1.Spec.OSType.Name)
+		fdStatus = &infrav1.CloudStackTemplateFailureDomainStatus{
+			FailureDomainName: dummies.CSFailureDomain1.Spec.Name, ZoneID: zoneID}
+
+		var err error
+		client, err = cloud.NewClientFromConf(cloud.Config{
+			APIUrl:    server.APIURL(),
+			APIKey:    server.APIKey,
+			SecretKey: server.SecretKey,
+		}, &corev1.ConfigMap{Data: map[string]string{cloud.ClientCacheTTLKey: "100ms"}})
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("Registers the template in the zone and tracks its download", func() {
+		dummies.CSTemplate1.Spec.Checksum = "{SHA-256}abc"
+		Ω(client.GetOrRegisterTemplate(ctx, dummies.CSTemplate1, fdStatus)).Should(Succeed())
+		Ω(fdStatus.TemplateID).ShouldNot(BeEmpty())
+		Ω(fdStatus.Ready).Should(BeFalse())
+
+		template, found := server.Get(fakeacs.KindTemplate, fdStatus.TemplateID)
+		Ω(found).Should(BeTrue())
+		Ω(template["name"]).Should(Equal(dummies.CSTemplate1.Spec.Name))
+		Ω(template["displaytext"]).Should(Equal(dummies.CSTemplate1.Spec.Name))
+		Ω(template["zoneid"]).Should(Equal(zoneID))
+		Ω(template["ostypeid"]).Should(Equal(osTypeID))
+		Ω(template["checksum"]).Should(Equal("{SHA-256}abc"))
+
+		server.Set(fakeacs.KindTemplate, fdStatus.TemplateID, "status", "35% Downloaded")
+		Ω(client.GetOrRegisterTemplate(ctx, dummies.CSTemplate1, fdStatus)).Should(Succeed())
+		Ω(fdStatus.Status).Should(Equal("35% Downloaded"))
+		Ω(fdStatus.Ready).Should(BeFalse())
+
+		server.Set(fakeacs.KindTemplate, fdStatus.TemplateID, "status", "Download Complete")
+		server.Set(fakeacs.KindTemplate, fdStatus.TemplateID, "isready", true)
+		Ω(client.GetOrRegisterTemplate(ctx, dummies.CSTemplate1, fdStatus)).Should(Succeed())
+		Ω(fdStatus.Status).Should(Equal("Download Complete"))
+		Ω(fdStatus.Ready).Should(BeTrue())
+		Ω(server.Calls("registerTemplate")).Should(Equal(1))
+	})
+
+	It("Adopts a template it already registered in the zone", func() {
+		templateID := server.AddTemplate(zoneID, dummies.CSTemplate1.Spec.Name)
+		Ω(client.AddTags(ctx, cloud.ResourceTypeTemplate, templateID,
+			map[string]string{cloud.TemplateUIDTagName: string(dummies.CSTemplate1.UID)})).Should(Succeed())
+
+		Ω(client.GetOrRegisterTemplate(ctx, dummies.CSTemplate1, fdStatus)).Should(Succeed())
+		Ω(fdStatus.TemplateID).Should(Equal(templateID))
+		Ω(fdStatus.Ready).Should(BeTrue())
+		Ω(server.Calls("registerTemplate")).Should(BeZero())
+	})
+
+	It("Refuses to adopt a template of the same name it didn't register", func() {
+		templateID := server.AddTemplate(zoneID, dummies.CSTemplate1.Spec.Name)
+		Ω(client.AddTags(ctx, cloud.ResourceTypeTemplate, templateID,
+			map[string]string{cloud.TemplateUIDTagName: "another-uid"})).Should(Succeed())
+
+		err := client.GetOrRegisterTemplate(ctx, dummies.CSTemplate1, fdStatus)
+		Ω(errors.Is(err, cloud.ErrTemplateConflict)).Should(BeTrue())
+		Ω(fdStatus.TemplateID).Should(BeEmpty())
+		Ω(server.Calls("registerTemplate")).Should(BeZero())
+	})
+
+	It("Deletes the template it registered but couldn't tag, so it's registered again", func() {
+		server.FailNext("createTags", fakeacs.ErrorCodeInternal, 4250, "Failed to create tags")
+		Ω(client.GetOrRegisterTemplate(ctx, dummies.CSTemplate1, fdStatus)).ShouldNot(Succeed())
+		Ω(fdStatus.TemplateID).Should(BeEmpty())
+		Ω(server.Count(fakeacs.KindTemplate)).Should(BeZero())
+
+		Ω(client.GetOrRegisterTemplate(ctx, dummies.CSTemplate1, fdStatus)).Should(Succeed())
+		template, found := server.Get(fakeacs.KindTemplate, fdStatus.TemplateID)
+		Ω(found).Should(BeTrue())
+		Ω(template["tags"]).Should(ContainElement(HaveKeyWithValue("value", string(dummies.CSTemplate1.UID))))
+	})
+
+	It("Defaults the name of the template to the name of the CloudStackTemplate", func() {
+		dummies.CSTemplate1.Spec.Name = ""
+		dummies.CSTemplate1.Spec.OSType = infrav1.CloudStackResourceIdentifier{ID: osTypeID}
+
+		Ω(client.GetOrRegisterTemplate(ctx, dummies.CSTemplate1, fdStatus)).Should(Succeed())
+		_, found := server.Find(fakeacs.KindTemplate, dummies.CSTemplate1.Name)
+		Ω(found).Should(BeTrue())
+		Ω(server.Calls("listOsTypes")).Should(BeZero())
+	})
+
+	It("Refuses an unknown OS type", func() {
+		dummies.CSTemplate1.Spec.OSType = infrav1.CloudStackResourceIdentifier{Name: "Plan 9"}
+
+		Ω(client.GetOrRegisterTemplate(ctx, dummies.CSTemplate1, fdStatus)).
+			Should(MatchError(ContainSubstring("OS type Plan 9 not found")))
+		Ω(fdStatus.TemplateID).Should(BeEmpty())
+	})
+
+	It("Forgets a template deleted from CloudStack, so it's registered again", func() {
+		Ω(client.GetOrRegisterTemplate(ctx, dummies.CSTemplate1, fdStatus)).Should(Succeed())
+		Ω(client.DeleteTemplate(ctx, &infrav1.CloudStackTemplateFailureDomainStatus{
+			TemplateID: fdStatus.TemplateID, ZoneID: zoneID})).Should(Succeed())
+
+		Ω(client.GetOrRegisterTemplate(ctx, dummies.CSTemplate1, fdStatus)).ShouldNot(Succeed())
+		Ω(fdStatus.TemplateID).Should(BeEmpty())
+		Ω(client.GetOrRegisterTemplate(ctx, dummies.CSTemplate1, fdStatus)).Should(Succeed())
+		Ω(server.Calls("registerTemplate")).Should(Equal(2))
+	})
+
+	It("Deletes the template, ignoring templates already gone", func() {
+		Ω(client.GetOrRegisterTemplate(ctx, dummies.CSTemplate1, fdStatus)).Should(Succeed())
+		templateID := fdStatus.TemplateID
+
+		Ω(client.DeleteTemplate(ctx, fdStatus)).Should(Succeed())
+		Ω(fdStatus.TemplateID).Should(BeEmpty())
+		Ω(server.Count(fakeacs.KindTemplate)).Should(BeZero())
+
+		fdStatus.TemplateID = templateID
+		Ω(client.DeleteTemplate(ctx, fdStatus)).Should(Succeed())
+		Ω(fdStatus.TemplateID).Should(BeEmpty())
+	})
+})
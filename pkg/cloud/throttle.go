@@ -0,0 +1,188 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/metrics"
+)
+
+// APIThrottleConfig holds the rate and concurrency limits applied to the requests sent to a single ACS endpoint.
+// A QPS or MaxConcurrentRequests of zero disables the respective limit.
+type APIThrottleConfig struct {
+	QPS                   float64
+	Burst                 int
+	MaxConcurrentRequests int
+}
+
+// GetAPIThrottleConfig returns the API throttling configuration from the passed config map. Missing or unparsable
+// values fall back to their defaults.
+func GetAPIThrottleConfig(clientConfig *corev1.ConfigMap) APIThrottleConfig {
+	config := APIThrottleConfig{
+		QPS:                   DefaultAPIRateLimitQPS,
+		Burst:                 DefaultAPIRateLimitBurst,
+		MaxConcurrentRequests: DefaultAPIMaxConcurrentRequests,
+	}
+	if clientConfig == nil {
+		return config
+	}
+	if qps, err := strconv.ParseFloat(clientConfig.Data[APIRateLimitQPSKey], 64); err == nil && qps >= 0 {
+		config.QPS = qps
+	}
+	if burst, err := strconv.Atoi(clientConfig.Data[APIRateLimitBurstKey]); err == nil && burst > 0 {
+		config.Burst = burst
+	}
+	if maxConcurrent, err := strconv.Atoi(clientConfig.Data[APIMaxConcurrentRequestsKey]); err == nil && maxConcurrent >= 0 {
+		config.MaxConcurrentRequests = maxConcurrent
+	}
+	return config
+}
+
+// endpointThrottle limits the requests sent to one ACS endpoint with a token bucket and a cap on in-flight requests.
+// It is shared by every client talking to that endpoint regardless of the credentials they use.
+type endpointThrottle struct {
+	endpoint      string
+	limiter       *rate.Limiter
+	customMetrics metrics.ACSCustomMetrics
+
+	mu    sync.Mutex
+	slots chan struct{}
+}
+
+var endpointThrottles = map[string]*endpointThrottle{}
+var endpointThrottlesMutex sync.Mutex
+
+// getEndpointThrottle returns the throttle shared by all clients of the endpoint serving apiURL. The throttle's limits
+// are updated from clientConfig when it is passed, so changes to the client config map apply to existing clients.
+func getEndpointThrottle(apiURL string, clientConfig *corev1.ConfigMap) *endpointThrottle {
+	endpointThrottlesMutex.Lock()
+	defer endpointThrottlesMutex.Unlock()
+
+	endpoint := endpointName(apiURL)
+	config := GetAPIThrottleConfig(clientConfig)
+
+	t, exists := endpointThrottles[endpoint]
+	if !exists {
+		t = &endpointThrottle{
+			endpoint:      endpoint,
+			limiter:       rate.NewLimiter(rate.Inf, config.Burst),
+			customMetrics: metrics.NewCustomMetrics(),
+		}
+		t.setConfig(config)
+		endpointThrottles[endpoint] = t
+	} else if clientConfig != nil {
+		t.setConfig(config)
+	}
+	return t
+}
+
+// endpointName returns the name an ACS endpoint is known by in the metrics and per endpoint state: the host of its API
+// URL.
+func endpointName(apiURL string) string {
+	if u, err := url.Parse(apiURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return apiURL
+}
+
+// setConfig applies new limits. Requests already holding a concurrency slot release it to the previous pool.
+func (t *endpointThrottle) setConfig(config APIThrottleConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	limit := rate.Inf
+	if config.QPS > 0 {
+		limit = rate.Limit(config.QPS)
+	}
+	t.limiter.SetLimit(limit)
+	t.limiter.SetBurst(config.Burst)
+
+	if cap(t.slots) != config.MaxConcurrentRequests {
+		t.slots = nil
+		if config.MaxConcurrentRequests > 0 {
+			t.slots = make(chan struct{}, config.MaxConcurrentRequests)
+		}
+	}
+}
+
+// wait blocks until the request may be sent, recording the time spent queueing. The returned function must be called
+// once the request is done to free its concurrency slot.
+func (t *endpointThrottle) wait(ctx context.Context) (release func(), err error) {
+	start := time.Now()
+	t.mu.Lock()
+	slots := t.slots
+	t.mu.Unlock()
+
+	release = func() {}
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+			release = func() { <-slots }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err := t.limiter.Wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	t.customMetrics.ObserveAcsAPIRequestQueueWait(t.endpoint, time.Since(start))
+	return release, nil
+}
+
+// throttledTransport is an http.RoundTripper that applies an endpoint's throttle to every request.
+type throttledTransport struct {
+	throttle *endpointThrottle
+	next     http.RoundTripper
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.throttle.wait(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// The response body is read after RoundTrip returns, so the request holds its slot until the body is closed.
+	resp.Body = &releaseOnCloseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releaseOnCloseBody is a response body that frees the concurrency slot of its request when first closed.
+type releaseOnCloseBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releaseOnCloseBody) Close() error {
+	defer b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
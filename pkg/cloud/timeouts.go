@@ -0,0 +1,108 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// APITimeoutConfig holds the timeouts of the requests sent to ACS, by operation type. Read applies to the list, get
+// and query commands, and Write to all other commands. AsyncJob bounds how long an async job is waited for when the
+// client waits for its result.
+type APITimeoutConfig struct {
+	Read     time.Duration
+	Write    time.Duration
+	AsyncJob time.Duration
+}
+
+// GetAPITimeoutConfig returns the API timeouts from the passed config map. Missing or unparsable values fall back to
+// their defaults.
+func GetAPITimeoutConfig(clientConfig *corev1.ConfigMap) APITimeoutConfig {
+	config := APITimeoutConfig{
+		Read:     DefaultAPITimeoutRead,
+		Write:    DefaultAPITimeoutWrite,
+		AsyncJob: DefaultAPITimeoutAsyncJob,
+	}
+	if clientConfig == nil {
+		return config
+	}
+	for key, timeout := range map[string]*time.Duration{
+		APITimeoutReadKey:     &config.Read,
+		APITimeoutWriteKey:    &config.Write,
+		APITimeoutAsyncJobKey: &config.AsyncJob,
+	} {
+		if d, err := time.ParseDuration(clientConfig.Data[key]); err == nil && d > 0 {
+			*timeout = d
+		}
+	}
+	return config
+}
+
+// forCommand returns the timeout of a request for the passed ACS API command.
+func (t APITimeoutConfig) forCommand(command string) time.Duration {
+	if isReadCommand(command) {
+		return t.Read
+	}
+	return t.Write
+}
+
+// isReadCommand returns true for the ACS API commands that only read state.
+func isReadCommand(command string) bool {
+	for _, prefix := range []string{"list", "get", "query"} {
+		if strings.HasPrefix(command, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// contextTransport is an http.RoundTripper that sends requests with the context of the cloud.Client call issuing
+// them, bounded by the timeout of the request's operation type. The timeout covers all attempts of a retried request.
+type contextTransport struct {
+	ctx      context.Context
+	timeouts APITimeoutConfig
+	next     http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(t.ctx, t.timeouts.forCommand(apiCommand(req)))
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The response body is read after RoundTrip returns, so the context may only be released once it is closed.
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnCloseBody is a response body that cancels the request's context when closed.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	"github.com/pkg/errors"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
+)
+
+// customRequester sends API commands CloudStack-Go has no typed method for. CloudStack-Go only exposes its custom
+// service through an empty interface.
+type customRequester interface {
+	CustomRequest(api string, p *cloudstack.CustomServiceParams, result interface{}) error
+}
+
+// customRequest sends command through the custom service of cs. CloudStack-Go predates registered user data, so its
+// commands are sent this way.
+func customRequest(
+	cs *cloudstack.CloudStackClient,
+	command string,
+	p *cloudstack.CustomServiceParams,
+	result interface{},
+) error {
+	custom, ok := cs.Custom.(customRequester)
+	if !ok {
+		return errors.Errorf("CloudStack client can't send custom %s requests", command)
+	}
+	return custom.CustomRequest(command, p, result)
+}
+
+// userDataResponse is the user data object of registerUserData and listUserData responses.
+type userDataResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// userDataName returns the name the machine's user data is registered under. Machine names are only unique to their
+// namespace, and several clusters may share a CloudStack account, so the name includes the machine's UID.
+func userDataName(csMachine *infrav1.CloudStackMachine) string {
+	return fmt.Sprintf("%s-%s", csMachine.Name, csMachine.UID)
+}
+
+// registerUserData registers the machine's base64-encoded user data with CloudStack under the machine's
+// userDataName, and returns its ID. The ID is kept in the machine's status, so later attempts at deploying the instance reuse it. No ID
+// is returned when the machine passes its user data inline, or when CloudStack predates registered user data, in
+// which case it's passed inline too.
+func (c *client) registerUserData(csMachine *infrav1.CloudStackMachine, userData string) (string, error) {
+	if !csMachine.Spec.RegisterUserData || userData == "" {
+		return "", nil
+	}
+	if csMachine.Status.UserDataID != "" {
+		return csMachine.Status.UserDataID, nil
+	}
+
+	name := userDataName(csMachine)
+	p := &cloudstack.CustomServiceParams{}
+	p.SetParam("name", name)
+	p.SetParam("userdata", userData)
+	setIfNotEmpty(c.projectID, func(id string) { p.SetParam("projectid", id) })
+	resp := struct {
+		UserData userDataResponse `json:"userdata"`
+	}{}
+	err := NewAPIError(customRequest(c.cs, "registerUserData", p, &resp))
+	switch {
+	case IsUnsupported(err):
+		return "", nil
+	case IsAlreadyExists(err):
+		// A previous registration succeeded, but its ID wasn't recorded.
+		if resp.UserData.ID, err = c.findUserData(name); err != nil {
+			return "", err
+		}
+	case err != nil:
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return "", errors.Wrapf(err, "registering user data %s", name)
+	}
+	csMachine.Status.UserDataID = resp.UserData.ID
+	return resp.UserData.ID, nil
+}
+
+// findUserData returns the ID of the registered user data of exactly the given name.
+func (c *client) findUserData(name string) (string, error) {
+	p := &cloudstack.CustomServiceParams{}
+	p.SetParam("name", name)
+	setIfNotEmpty(c.projectID, func(id string) { p.SetParam("projectid", id) })
+	resp := struct {
+		UserData []userDataResponse `json:"userdata"`
+	}{}
+	if err := customRequest(c.cs, "listUserData", p, &resp); err != nil {
+		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+		return "", errors.Wrapf(err, "listing user data %s", name)
+	}
+	for _, userData := range resp.UserData {
+		if userData.Name == name {
+			return userData.ID, nil
+		}
+	}
+	return "", newNotFoundError(errors.Errorf("user data %s not found", name))
+}
+
+// deployVirtualMachineWithUserDataID submits the deployment of p with the registered user data of the given ID.
+// CloudStack-Go doesn't know the userdataid parameter, so the parameters GetOrCreateVMInstance sets on p are copied to
+// a custom request.
+func (c *client) deployVirtualMachineWithUserDataID(
+	p *cloudstack.DeployVirtualMachineParams,
+	userDataID string,
+) (*cloudstack.DeployVirtualMachineResponse, error) {
+	cp := &cloudstack.CustomServiceParams{}
+	cp.SetParam("userdataid", userDataID)
+	for name, get := range map[string]func() (string, bool){
+		"serviceofferingid": p.GetServiceofferingid,
+		"templateid":        p.GetTemplateid,
+		"zoneid":            p.GetZoneid,
+		"ipaddress":         p.GetIpaddress,
+		"projectid":         p.GetProjectid,
+		"name":              p.GetName,
+		"displayname":       p.GetDisplayname,
+		"diskofferingid":    p.GetDiskofferingid,
+		"keypair":           p.GetKeypair,
+		"hostid":            p.GetHostid,
+		"clusterid":         p.GetClusterid,
+		"podid":             p.GetPodid,
+		"deploymentplanner": p.GetDeploymentplanner,
+	} {
+		if v, found := get(); found {
+			cp.SetParam(name, v)
+		}
+	}
+	for name, get := range map[string]func() (int64, bool){
+		"size":         p.GetSize,
+		"rootdisksize": p.GetRootdisksize,
+	} {
+		if v, found := get(); found {
+			cp.SetParam(name, v)
+		}
+	}
+	if startVM, found := p.GetStartvm(); found {
+		cp.SetParam("startvm", startVM)
+	}
+	for name, get := range map[string]func() ([]string, bool){
+		"networkids":       p.GetNetworkids,
+		"affinitygroupids": p.GetAffinitygroupids,
+	} {
+		// Join lists like DeployVirtualMachineParams does, rather than with the ", " of custom requests.
+		if v, found := get(); found {
+			cp.SetParam(name, strings.Join(v, ","))
+		}
+	}
+	if ipToNetworkList, found := p.GetIptonetworklist(); found {
+		for i, entry := range ipToNetworkList {
+			for k, v := range entry {
+				cp.SetParam(fmt.Sprintf("iptonetworklist[%d].%s", i, k), v)
+			}
+		}
+	}
+	if details, found := p.GetDetails(); found {
+		cp.SetParam("details", details)
+	}
+
+	resp := &cloudstack.DeployVirtualMachineResponse{}
+	if err := customRequest(c.csAsync, "deployVirtualMachine", cp, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// DeleteVMInstanceUserData deletes the user data registered for the machine's instance, which must have been
+// destroyed already.
+func (c *client) DeleteVMInstanceUserData(ctx context.Context, csMachine *infrav1.CloudStackMachine) error {
+	if csMachine.Status.UserDataID == "" {
+		return nil
+	}
+	c = c.withContext(ctx)
+
+	p := &cloudstack.CustomServiceParams{}
+	p.SetParam("id", csMachine.Status.UserDataID)
+	setIfNotEmpty(c.projectID, func(id string) { p.SetParam("projectid", id) })
+	resp := map[string]interface{}{}
+	if err := NewAPIError(customRequest(c.cs, "deleteUserData", p, &resp)); err != nil {
+		// CloudStack rejects the IDs of user data deleted meanwhile as invalid.
+		if !isParamError(err) || !c.isUserDataDeleted(csMachine) {
+			c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
+			return errors.Wrapf(err, "deleting user data %s", csMachine.Status.UserDataID)
+		}
+	}
+	csMachine.Status.UserDataID = ""
+	return nil
+}
+
+// isUserDataDeleted reports whether the machine's user data is no longer registered.
+func (c *client) isUserDataDeleted(csMachine *infrav1.CloudStackMachine) bool {
+	_, err := c.findUserData(userDataName(csMachine))
+	return IsNotFound(err)
+}
@@ -17,17 +17,20 @@ limitations under the License.
 package cloud
 
 import (
+	"context"
+
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	infrav1 "sigs.k8s.io/cluster-api-provider-cloudstack/api/v1beta2"
 )
 
 type ZoneIFace interface {
-	ResolveZone(*infrav1.CloudStackZoneSpec) error
-	ResolveNetworkForZone(*infrav1.CloudStackZoneSpec) error
+	ResolveZone(context.Context, *infrav1.CloudStackZoneSpec) error
+	ResolveNetworkForZone(context.Context, *infrav1.CloudStackZoneSpec) error
 }
 
-func (c *client) ResolveZone(zSpec *infrav1.CloudStackZoneSpec) (retErr error) {
+func (c *client) ResolveZone(ctx context.Context, zSpec *infrav1.CloudStackZoneSpec) (retErr error) {
+	c = c.withContext(ctx)
 	if zoneID, count, err := c.cs.Zone.GetZoneID(zSpec.Name); err != nil {
 		retErr = multierror.Append(retErr, errors.Wrapf(err, "could not get Zone ID from %v", zSpec.Name))
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
@@ -53,12 +56,13 @@ func (c *client) ResolveZone(zSpec *infrav1.CloudStackZoneSpec) (retErr error) {
 }
 
 // ResolveNetworkForZone fetches details on Zone's specified network.
-func (c *client) ResolveNetworkForZone(zSpec *infrav1.CloudStackZoneSpec) (retErr error) {
+func (c *client) ResolveNetworkForZone(ctx context.Context, zSpec *infrav1.CloudStackZoneSpec) (retErr error) {
+	c = c.withContext(ctx)
 	netName := zSpec.Network.Name
-	netDetails, count, err := c.cs.Network.GetNetworkByName(netName)
+	netDetails, count, err := c.cs.Network.GetNetworkByName(netName, c.projectOpts()...)
 	if err != nil {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
-		retErr = multierror.Append(retErr, errors.Wrapf(err, "could not get Network ID from %v", netName))
+		retErr = multierror.Append(retErr, errors.Wrapf(NewAPIError(err), "could not get Network ID from %v", netName))
 	} else if count != 1 {
 		retErr = multierror.Append(retErr, errors.Errorf(
 			"expected 1 Network with name %s, but got %d", netName, count))
@@ -69,9 +73,9 @@ func (c *client) ResolveNetworkForZone(zSpec *infrav1.CloudStackZoneSpec) (retEr
 	}
 
 	// Now get network details.
-	netDetails, count, err = c.cs.Network.GetNetworkByID(zSpec.Network.ID)
+	netDetails, count, err = c.cs.Network.GetNetworkByID(zSpec.Network.ID, c.projectOpts()...)
 	if err != nil {
-		return multierror.Append(retErr, errors.Wrapf(err, "could not get Network by ID %s", zSpec.Network.ID))
+		return multierror.Append(retErr, errors.Wrapf(NewAPIError(err), "could not get Network by ID %s", zSpec.Network.ID))
 	} else if count != 1 {
 		c.customMetrics.EvaluateErrorAndIncrementAcsReconciliationErrorCounter(err)
 		return multierror.Append(retErr, errors.Errorf("expected 1 Network with UUID %v, but got %d", zSpec.Network.ID, count))
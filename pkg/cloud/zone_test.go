@@ -61,7 +61,7 @@ var _ = Describe("Zone", func() {
 			zs.EXPECT().GetZoneID(dummies.Zone1.Name).Return("", -1, expectedErr)
 			zs.EXPECT().GetZoneByID(dummies.Zone1.ID).Return(nil, -1, expectedErr)
 
-			err := client.ResolveZone(&dummies.CSFailureDomain1.Spec.Zone)
+			err := client.ResolveZone(ctx, &dummies.CSFailureDomain1.Spec.Zone)
 			Expect(errors.Cause(err)).To(MatchError(expectedErr))
 		})
 
@@ -69,7 +69,7 @@ var _ = Describe("Zone", func() {
 			zs.EXPECT().GetZoneID(dummies.Zone1.Name).Return(dummies.Zone1.ID, 2, nil)
 			zs.EXPECT().GetZoneByID(dummies.Zone1.ID).Return(nil, -1, fmt.Errorf("Not found"))
 
-			Ω(client.ResolveZone(&dummies.CSFailureDomain1.Spec.Zone)).Should(MatchError(And(
+			Ω(client.ResolveZone(ctx, &dummies.CSFailureDomain1.Spec.Zone)).Should(MatchError(And(
 				ContainSubstring("expected 1 Zone with name "+dummies.Zone1.Name+", but got 2"),
 				ContainSubstring("could not get Zone by ID "+dummies.Zone1.ID+": Not found"))))
 		})
@@ -78,7 +78,7 @@ var _ = Describe("Zone", func() {
 			zs.EXPECT().GetZoneID(dummies.Zone1.Name).Return(dummies.Zone1.ID, 2, nil)
 			zs.EXPECT().GetZoneByID(dummies.Zone1.ID).Return(&csapi.Zone{}, 2, nil)
 
-			Ω(client.ResolveZone(&dummies.CSFailureDomain1.Spec.Zone).Error()).
+			Ω(client.ResolveZone(ctx, &dummies.CSFailureDomain1.Spec.Zone).Error()).
 				Should(ContainSubstring("expected 1 Zone with name " + dummies.Zone1.Name + ", but got 2"))
 		})
 	})
@@ -87,14 +87,14 @@ var _ = Describe("Zone", func() {
 		It("get network by name specfied in zone spec", func() {
 			ns.EXPECT().GetNetworkByName(dummies.Zone1.Network.Name).Return(&csapi.Network{}, 1, nil)
 
-			Ω(client.ResolveNetworkForZone(&dummies.CSFailureDomain1.Spec.Zone)).Should(Succeed())
+			Ω(client.ResolveNetworkForZone(ctx, &dummies.CSFailureDomain1.Spec.Zone)).Should(Succeed())
 		})
 
 		It("get network by name specfied in zone spec returns > 1 network", func() {
 			ns.EXPECT().GetNetworkByName(dummies.Zone2.Network.Name).Return(&csapi.Network{}, 2, nil)
 			ns.EXPECT().GetNetworkByID(dummies.Zone2.Network.ID).Return(&csapi.Network{}, 2, nil)
 
-			Ω(client.ResolveNetworkForZone(&dummies.CSFailureDomain2.Spec.Zone)).Should(MatchError(And(
+			Ω(client.ResolveNetworkForZone(ctx, &dummies.CSFailureDomain2.Spec.Zone)).Should(MatchError(And(
 				ContainSubstring(fmt.Sprintf("expected 1 Network with name %s, but got %d", dummies.Zone2.Network.Name, 2)),
 				ContainSubstring(fmt.Sprintf("expected 1 Network with UUID %v, but got %d", dummies.Zone2.Network.ID, 2)))))
 		})
@@ -102,14 +102,14 @@ var _ = Describe("Zone", func() {
 		It("get network by id specfied in zone spec", func() {
 			ns.EXPECT().GetNetworkByName(dummies.Zone2.Network.Name).Return(nil, -1, fakeError)
 			ns.EXPECT().GetNetworkByID(dummies.Zone2.Network.ID).Return(&csapi.Network{}, 1, nil)
-			Ω(client.ResolveNetworkForZone(&dummies.CSFailureDomain2.Spec.Zone)).Should(Succeed())
+			Ω(client.ResolveNetworkForZone(ctx, &dummies.CSFailureDomain2.Spec.Zone)).Should(Succeed())
 		})
 
 		It("get network by id fails", func() {
 			ns.EXPECT().GetNetworkByName(dummies.Zone2.Network.Name).Return(nil, -1, fakeError)
 			ns.EXPECT().GetNetworkByID(dummies.Zone2.Network.ID).Return(nil, -1, fakeError)
 
-			Ω(client.ResolveNetworkForZone(&dummies.CSFailureDomain2.Spec.Zone).Error()).Should(ContainSubstring(fmt.Sprintf("could not get Network by ID %s", dummies.Zone2.Network.ID)))
+			Ω(client.ResolveNetworkForZone(ctx, &dummies.CSFailureDomain2.Spec.Zone).Error()).Should(ContainSubstring(fmt.Sprintf("could not get Network by ID %s", dummies.Zone2.Network.ID)))
 		})
 	})
 })
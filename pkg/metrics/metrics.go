@@ -21,11 +21,16 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"regexp"
 	crtlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"time"
 )
 
 // AcsCustomMetrics encapsulates all CloudStack custom metrics defined for the controller.
 type ACSCustomMetrics struct {
 	acsReconciliationErrorCount *prometheus.CounterVec
+	acsAPIRequestQueueWait      *prometheus.HistogramVec
+	acsAPIRequestDuration       *prometheus.HistogramVec
+	acsAPIRequestCount          *prometheus.CounterVec
+	acsAPIRequestRetryCount     *prometheus.CounterVec
 	errorCodeRegexp             *regexp.Regexp
 }
 
@@ -48,6 +53,72 @@ func NewCustomMetrics() ACSCustomMetrics {
 		}
 	}
 
+	customMetrics.acsAPIRequestQueueWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "acs_api_request_queue_wait_seconds",
+			Help:    "Time ACS API requests spent waiting for the endpoint's rate limiter and concurrency cap",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		},
+		[]string{"endpoint"},
+	)
+	if err := crtlmetrics.Registry.Register(customMetrics.acsAPIRequestQueueWait); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			customMetrics.acsAPIRequestQueueWait = are.ExistingCollector.(*prometheus.HistogramVec)
+		} else {
+			// Something else went wrong!
+			panic(err)
+		}
+	}
+
+	customMetrics.acsAPIRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "acs_api_request_duration_seconds",
+			Help:    "Latency of ACS API requests, bucketed by API command, endpoint and outcome",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+		},
+		[]string{"command", "endpoint", "outcome"},
+	)
+	if err := crtlmetrics.Registry.Register(customMetrics.acsAPIRequestDuration); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			customMetrics.acsAPIRequestDuration = are.ExistingCollector.(*prometheus.HistogramVec)
+		} else {
+			// Something else went wrong!
+			panic(err)
+		}
+	}
+
+	customMetrics.acsAPIRequestCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "acs_api_requests_total",
+			Help: "Count of ACS API requests, bucketed by API command, endpoint and outcome",
+		},
+		[]string{"command", "endpoint", "outcome"},
+	)
+	if err := crtlmetrics.Registry.Register(customMetrics.acsAPIRequestCount); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			customMetrics.acsAPIRequestCount = are.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			// Something else went wrong!
+			panic(err)
+		}
+	}
+
+	customMetrics.acsAPIRequestRetryCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "acs_api_request_retries_total",
+			Help: "Count of ACS API requests retried after a transient failure, bucketed by API command and endpoint",
+		},
+		[]string{"command", "endpoint"},
+	)
+	if err := crtlmetrics.Registry.Register(customMetrics.acsAPIRequestRetryCount); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			customMetrics.acsAPIRequestRetryCount = are.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			// Something else went wrong!
+			panic(err)
+		}
+	}
+
 	// ACS standard error messages of the form "CloudStack API error 431 (CSExceptionErrorCode: 9999):..."
 	//  This regexp is used to extract CSExceptionCodes from the message.
 	customMetrics.errorCodeRegexp, _ = regexp.Compile(".+CSExceptionErrorCode: ([0-9]+).+")
@@ -67,3 +138,19 @@ func (m *ACSCustomMetrics) EvaluateErrorAndIncrementAcsReconciliationErrorCounte
 		}
 	}
 }
+
+// ObserveAcsAPIRequestQueueWait records the time an ACS API request waited before being sent to endpoint.
+func (m *ACSCustomMetrics) ObserveAcsAPIRequestQueueWait(endpoint string, wait time.Duration) {
+	m.acsAPIRequestQueueWait.WithLabelValues(endpoint).Observe(wait.Seconds())
+}
+
+// ObserveAcsAPIRequest records the outcome and latency of an ACS API request for command sent to endpoint.
+func (m *ACSCustomMetrics) ObserveAcsAPIRequest(command, endpoint, outcome string, duration time.Duration) {
+	m.acsAPIRequestDuration.WithLabelValues(command, endpoint, outcome).Observe(duration.Seconds())
+	m.acsAPIRequestCount.WithLabelValues(command, endpoint, outcome).Inc()
+}
+
+// IncrementAcsAPIRequestRetries records a retry of an ACS API request for command sent to endpoint.
+func (m *ACSCustomMetrics) IncrementAcsAPIRequestRetries(command, endpoint string) {
+	m.acsAPIRequestRetryCount.WithLabelValues(command, endpoint).Inc()
+}
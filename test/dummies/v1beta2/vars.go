@@ -13,6 +13,7 @@ import (
 	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
 	"sigs.k8s.io/cluster-api-provider-cloudstack/test/fakes"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
 )
 
 // GetYamlVal fetches the values in test/e2e/config/cloudstack.yaml by yaml node. A common config file.
@@ -28,6 +29,9 @@ var ( // Declare exported dummy vars.
 	CSCluster               *infrav1.CloudStackCluster
 	CAPIMachine             *clusterv1.Machine
 	CSMachine1              *infrav1.CloudStackMachine
+	CAPIMachinePool         *expv1.MachinePool
+	CSMachinePool1          *infrav1.CloudStackMachinePool
+	CSTemplate1             *infrav1.CloudStackTemplate
 	CAPICluster             *clusterv1.Cluster
 	ClusterLabel            map[string]string
 	ClusterName             string
@@ -110,6 +114,8 @@ func SetDummyVars() {
 	SetDummyCAPIMachineVars()
 	SetDummyCSMachineTemplateVars()
 	SetDummyCSMachineVars()
+	SetDummyCSMachinePoolVars()
+	SetDummyCSTemplateVars()
 	SetDummyTagVars()
 	SetDummyBootstrapSecretVar()
 	SetCSMachineOwner()
@@ -252,6 +258,69 @@ func SetDummyCSMachineVars() {
 	}
 }
 
+// SetDummyCSMachinePoolVars resets the values of the CloudStackMachinePool dummy variable and its MachinePool.
+func SetDummyCSMachinePoolVars() {
+	CAPIMachinePool = &expv1.MachinePool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "capi-test-machinepool",
+			Namespace: "default",
+			Labels:    ClusterLabel,
+		},
+		Spec: expv1.MachinePoolSpec{
+			ClusterName: ClusterName,
+			Replicas:    pointer.Int32(1),
+			Template: clusterv1.MachineTemplateSpec{
+				Spec: clusterv1.MachineSpec{ClusterName: ClusterName},
+			},
+		},
+	}
+	CSMachinePool1 = &infrav1.CloudStackMachinePool{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: CSApiVersion,
+			Kind:       "CloudStackMachinePool",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-machinepool-1",
+			Namespace: "default",
+			Labels:    ClusterLabel,
+		},
+		Spec: infrav1.CloudStackMachinePoolSpec{
+			Template: infrav1.CloudStackMachineTemplateResource{
+				Spec: infrav1.CloudStackMachineSpec{
+					Template: CSMachine1.Spec.Template,
+					Offering: CSMachine1.Spec.Offering,
+					Details: map[string]string{
+						"memoryOvercommitRatio": "1.2",
+					},
+				},
+			},
+		},
+	}
+}
+
+// SetDummyCSTemplateVars resets the values in each of the exported CloudStackTemplate dummy variables.
+func SetDummyCSTemplateVars() {
+	CSTemplate1 = &infrav1.CloudStackTemplate{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: CSApiVersion,
+			Kind:       "CloudStackTemplate",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-template-1",
+			Namespace: "default",
+			UID:       "0",
+			Labels:    ClusterLabel,
+		},
+		Spec: infrav1.CloudStackTemplateSpec{
+			Name:       "ubuntu-2204-kube-v1.27.3",
+			URL:        "https://images.example.com/ubuntu-2204-kube-v1.27.3.qcow2",
+			Format:     "QCOW2",
+			Hypervisor: "KVM",
+			OSType:     infrav1.CloudStackResourceIdentifier{Name: "Ubuntu 22.04 LTS"},
+		},
+	}
+}
+
 func SetDummyZoneVars() {
 	Zone1 = infrav1.CloudStackZoneSpec{Network: Net1}
 	Zone1.Name = GetYamlVal("CLOUDSTACK_ZONE_NAME")
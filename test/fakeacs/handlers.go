@@ -0,0 +1,1266 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakeacs
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// KindRole is the type of CloudStack roles. The server seeds the default roles so account creation can use them.
+const KindRole Kind = "role"
+
+// registerHandlers wires every supported command to its handler. Command names are matched case-insensitively as
+// CloudStack does.
+func (s *Server) registerHandlers() {
+	sync := map[string]syncHandler{
+		"queryAsyncJobResult":           s.queryAsyncJobResult,
+		"listZones":                     s.listOf(KindZone),
+		"listNetworkOfferings":          s.listOf(KindNetworkOffering),
+		"listServiceOfferings":          s.listOf(KindServiceOffering),
+		"listDiskOfferings":             s.listOf(KindDiskOffering),
+		"listTemplates":                 s.listOf(KindTemplate),
+		"listNetworks":                  s.listOf(KindNetwork),
+		"createNetwork":                 s.createNetwork,
+		"listVirtualMachines":           s.listVirtualMachines,
+		"listVirtualMachinesMetrics":    s.listVirtualMachines,
+		"listVolumes":                   s.listOf(KindVolume),
+		"deleteVolume":                  s.deleteVolume,
+		"listPublicIpAddresses":         s.listPublicIPAddresses,
+		"listLoadBalancerRules":         s.listOf(KindLBRule),
+		"listLoadBalancerRuleInstances": s.listLoadBalancerRuleInstances,
+		"listFirewallRules":             s.listOf(KindFirewallRule),
+		"listEgressFirewallRules":       s.listOf(KindEgressRule),
+		"listAffinityGroups":            s.listOf(KindAffinityGroup),
+		"listTags":                      s.listOf(KindTag),
+		"listDomains":                   s.listOf(KindDomain),
+		"createDomain":                  s.createDomainCmd,
+		"listAccounts":                  s.listOf(KindAccount),
+		"createAccount":                 s.createAccount,
+		"listUsers":                     s.listOf(KindUser),
+		"createUser":                    s.createUser,
+		"getUserKeys":                   s.getUserKeys,
+		"registerUserKeys":              s.registerUserKeysCmd,
+		"listRoles":                     s.listOf(KindRole),
+		"listProjects":                  s.listOf(KindProject),
+		"listHosts":                     s.listOf(KindHost),
+		"registerUserData":              s.registerUserData,
+		"listUserData":                  s.listOf(KindUserData),
+		"deleteUserData":                s.deleteUserData,
+		"listOsTypes":                   s.listOf(KindOsType),
+		"registerTemplate":              s.registerTemplate,
+	}
+	async := map[string]asyncHandler{
+		"deleteNetwork":            s.deleteNetwork,
+		"deployVirtualMachine":     s.deployVirtualMachine,
+		"destroyVirtualMachine":    s.destroyVirtualMachine,
+		"startVirtualMachine":      s.setVirtualMachineState("Running"),
+		"stopVirtualMachine":       s.setVirtualMachineState("Stopped"),
+		"scaleVirtualMachine":      s.scaleVirtualMachine,
+		"associateIpAddress":       s.associateIPAddress,
+		"disassociateIpAddress":    s.disassociateIPAddress,
+		"createLoadBalancerRule":   s.createLoadBalancerRule,
+		"assignToLoadBalancerRule": s.assignToLoadBalancerRule,
+		"createFirewallRule":       s.createFirewallRule(KindFirewallRule),
+		"createEgressFirewallRule": s.createFirewallRule(KindEgressRule),
+		"createAffinityGroup":      s.createAffinityGroup,
+		"deleteAffinityGroup":      s.deleteAffinityGroup,
+		"updateVMAffinityGroup":    s.updateVMAffinityGroup,
+		"createVolume":             s.createVolume,
+		"attachVolume":             s.attachVolume,
+		"createTags":               s.createTags,
+		"deleteTags":               s.deleteTags,
+		"deleteDomain":             s.deleteDomain,
+		"deleteTemplate":           s.deleteTemplate,
+	}
+
+	s.syncHandlers = make(map[string]syncHandler, len(sync))
+	for command, h := range sync {
+		s.syncHandlers[strings.ToLower(command)] = h
+	}
+	s.asyncHandler = make(map[string]asyncHandler, len(async))
+	for command, h := range async {
+		s.asyncHandler[strings.ToLower(command)] = h
+	}
+
+	for _, role := range []string{"Root Admin", "Domain Admin", "User"} {
+		s.insert(KindRole, resource{"name": role, "type": strings.ReplaceAll(role, " ", ""), "isdefault": true})
+	}
+}
+
+func (s *Server) listOf(kind Kind) syncHandler {
+	return func(command string, p url.Values) (interface{}, *apiError) {
+		if err := s.checkListID(kind, command, p); err != nil {
+			return nil, err
+		}
+		return s.list(kind, p), nil
+	}
+}
+
+// checkListID rejects list calls filtering on an ID that doesn't exist. CloudStack fails these calls while translating
+// the UUID rather than returning an empty list.
+func (s *Server) checkListID(kind Kind, command string, p url.Values) *apiError {
+	if id := p.Get("id"); id != "" {
+		if _, found := s.table(kind).byID[id]; !found {
+			return invalidParam(command, "id", id)
+		}
+	}
+	return nil
+}
+
+// listVirtualMachines supports filtering by the networks a VM has NICs on in addition to the generic filters.
+func (s *Server) listVirtualMachines(command string, p url.Values) (interface{}, *apiError) {
+	if err := s.checkListID(KindVirtualMachine, command, p); err != nil {
+		return nil, err
+	}
+	networkID := p.Get("networkid")
+	return s.list(KindVirtualMachine, p, func(vm resource) bool {
+		if networkID == "" {
+			return true
+		}
+		nics, _ := vm["nic"].([]resource)
+		for _, nic := range nics {
+			if nic.str("networkid") == networkID {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// listPublicIPAddresses only returns allocated addresses unless allocatedonly=false is passed, as CloudStack does.
+func (s *Server) listPublicIPAddresses(command string, p url.Values) (interface{}, *apiError) {
+	if err := s.checkListID(KindPublicIPAddress, command, p); err != nil {
+		return nil, err
+	}
+	allocatedOnly := p.Get("allocatedonly") != "false"
+	return s.list(KindPublicIPAddress, p, func(ip resource) bool {
+		return !allocatedOnly || ip.str("allocated") != ""
+	}), nil
+}
+
+func (s *Server) listLoadBalancerRuleInstances(command string, p url.Values) (interface{}, *apiError) {
+	rule, err := s.lookup(KindLBRule, command, p, "id")
+	if err != nil {
+		return nil, err
+	}
+	members := s.lbMembers[rule.str("id")]
+	if len(members) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	vms := make([]resource, 0, len(members))
+	for _, id := range members {
+		if vm, found := s.table(KindVirtualMachine).byID[id]; found {
+			vms = append(vms, vm)
+		}
+	}
+	return map[string]interface{}{"count": len(vms), "loadbalancerruleinstance": vms}, nil
+}
+
+func (s *Server) newNetwork(zoneID, name, networkType, offeringID string) resource {
+	zone := s.table(KindZone).byID[zoneID]
+	s.nextIP++
+	return resource{
+		"name": name, "displaytext": name, "zoneid": zoneID, "zonename": zone.str("name"), "type": networkType,
+		"networkofferingid": offeringID, "state": "Implemented", "traffictype": "Guest",
+		"cidr": fmt.Sprintf("10.%d.0.0/24", s.nextIP), "gateway": fmt.Sprintf("10.%d.0.1", s.nextIP),
+		"netmask": "255.255.255.0", "tags": []resource{},
+	}
+}
+
+func (s *Server) createNetwork(command string, p url.Values) (interface{}, *apiError) {
+	zone, err := s.lookup(KindZone, command, p, "zoneid")
+	if err != nil {
+		return nil, err
+	}
+	offering, err := s.lookup(KindNetworkOffering, command, p, "networkofferingid")
+	if err != nil {
+		return nil, err
+	}
+	if p.Get("name") == "" {
+		return nil, missingParam(command, "name")
+	}
+	network := s.newNetwork(zone.str("id"), p.Get("name"), offering.str("guestiptype"), offering.str("id"))
+	if displayText := p.Get("displaytext"); displayText != "" {
+		network["displaytext"] = displayText
+	}
+	network["state"] = "Allocated"
+	if err := s.setProject(command, p, network); err != nil {
+		return nil, err
+	}
+	s.insert(KindNetwork, network)
+	return map[string]interface{}{"network": network}, nil
+}
+
+func (s *Server) deleteNetwork(command string, p url.Values) (*job, *apiError) {
+	network, err := s.lookup(KindNetwork, command, p, "id")
+	if err != nil {
+		return nil, err
+	}
+	id := network.str("id")
+	return &job{instanceType: "Network", instanceID: id, complete: func() (interface{}, *apiError) {
+		for _, vm := range s.table(KindVirtualMachine).byID {
+			for _, nic := range vm["nic"].([]resource) {
+				if nic.str("networkid") == id {
+					return nil, newError(ErrorCodeResourceInUse, CSExceptionCloudRuntime,
+						"Failed to delete network %s: network has virtual machines", id)
+				}
+			}
+		}
+		s.remove(KindNetwork, id)
+		s.removeTagsOf(id)
+		return success(), nil
+	}}, nil
+}
+
+// registerUserData stores base64-encoded user data under a name that must be unique to its owner.
+func (s *Server) registerUserData(command string, p url.Values) (interface{}, *apiError) {
+	for _, param := range []string{"name", "userdata"} {
+		if p.Get(param) == "" {
+			return nil, missingParam(command, param)
+		}
+	}
+	if _, err := base64.StdEncoding.DecodeString(p.Get("userdata")); err != nil {
+		return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter, "User data is not base64 encoded")
+	}
+	userData := resource{
+		"name": p.Get("name"), "userdata": p.Get("userdata"), "account": "admin", "domainid": s.RootDomainID,
+		"domain": "ROOT",
+	}
+	if err := s.setProject(command, p, userData); err != nil {
+		return nil, err
+	}
+	for _, other := range s.table(KindUserData).byID {
+		if other.str("name") == userData.str("name") && other.str("projectid") == userData.str("projectid") {
+			return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+				"A userdata with name %s already exists for this account.", userData.str("name"))
+		}
+	}
+	s.insert(KindUserData, userData)
+	return map[string]interface{}{"userdata": userData}, nil
+}
+
+// deleteUserData refuses to delete user data VMs were deployed with, until they're expunged.
+func (s *Server) deleteUserData(command string, p url.Values) (interface{}, *apiError) {
+	userData, err := s.lookup(KindUserData, command, p, "id")
+	if err != nil {
+		return nil, err
+	}
+	id := userData.str("id")
+	for _, vm := range s.table(KindVirtualMachine).byID {
+		if vm.str("userdataid") == id {
+			return nil, newError(ErrorCodeInternal, CSExceptionCloudRuntime,
+				"Userdata is already linked to a VM, cannot be deleted")
+		}
+	}
+	s.remove(KindUserData, id)
+	return success(), nil
+}
+
+// registerTemplate registers a template in a zone. Its download doesn't progress on its own: tests set its status and
+// isready fields to simulate it.
+func (s *Server) registerTemplate(command string, p url.Values) (interface{}, *apiError) {
+	for _, param := range []string{"name", "displaytext", "format", "hypervisor", "url"} {
+		if p.Get(param) == "" {
+			return nil, missingParam(command, param)
+		}
+	}
+	zone, err := s.lookup(KindZone, command, p, "zoneid")
+	if err != nil {
+		return nil, err
+	}
+	osType, err := s.lookup(KindOsType, command, p, "ostypeid")
+	if err != nil {
+		return nil, err
+	}
+	template := resource{
+		"name": p.Get("name"), "displaytext": p.Get("displaytext"), "zoneid": zone.str("id"),
+		"zonename": zone.str("name"), "isready": false, "status": "", "format": strings.ToUpper(p.Get("format")),
+		"hypervisor": p.Get("hypervisor"), "ostypeid": osType.str("id"), "ostypename": osType.str("description"),
+		"checksum": p.Get("checksum"), "templatetype": "USER", "created": s.now(), "tags": []resource{},
+		"account": "admin", "domainid": s.RootDomainID, "domain": "ROOT",
+	}
+	if err := s.setProject(command, p, template); err != nil {
+		return nil, err
+	}
+	s.insert(KindTemplate, template)
+	return map[string]interface{}{"count": 1, "template": []resource{template}}, nil
+}
+
+// deleteTemplate deletes a template. VMs deployed from it are left as they are, as in CloudStack.
+func (s *Server) deleteTemplate(command string, p url.Values) (*job, *apiError) {
+	template, err := s.lookup(KindTemplate, command, p, "id")
+	if err != nil {
+		return nil, err
+	}
+	id := template.str("id")
+	return &job{instanceType: "Template", instanceID: id, complete: func() (interface{}, *apiError) {
+		s.remove(KindTemplate, id)
+		s.removeTagsOf(id)
+		return success(), nil
+	}}, nil
+}
+
+// deployVirtualMachine validates the request synchronously like CloudStack's create phase does, then creates the VM,
+// its NICs and volumes when the job completes.
+func (s *Server) deployVirtualMachine(command string, p url.Values) (*job, *apiError) {
+	zone, err := s.lookup(KindZone, command, p, "zoneid")
+	if err != nil {
+		return nil, err
+	}
+	offering, err := s.lookup(KindServiceOffering, command, p, "serviceofferingid")
+	if err != nil {
+		return nil, err
+	}
+	template, err := s.lookup(KindTemplate, command, p, "templateid")
+	if err != nil {
+		return nil, err
+	}
+	if template["isready"] == false {
+		return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+			"Template %s has not been completely downloaded to zone %s", template.str("id"), zone.str("id"))
+	}
+	var diskOffering resource
+	if p.Get("diskofferingid") != "" {
+		if diskOffering, err = s.lookup(KindDiskOffering, command, p, "diskofferingid"); err != nil {
+			return nil, err
+		}
+		if diskOffering["iscustomized"] == true && p.Get("size") == "" {
+			return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+				"Disk offering %s requires size parameter.", diskOffering.str("id"))
+		}
+	}
+
+	rootDiskSize, _ := strconv.ParseInt(p.Get("rootdisksize"), 10, 64)
+	if templateSize, _ := template["size"].(int64); rootDiskSize > 0 && rootDiskSize<<30 < templateSize {
+		return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+			"Root disk size %d GB can't be less than the template size %d GB", rootDiskSize, templateSize>>30)
+	}
+
+	// CloudStack takes the VM's networks either as networkids, with the optional ipaddress of the first one, or as an
+	// iptonetworklist giving each network's optional IP.
+	ipToNetworkList := indexedMaps(p, "iptonetworklist")
+	if len(ipToNetworkList) > 0 && p.Get("networkids") != "" {
+		return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+			"ipToNetworkMap can't be specified along with networkIds or ipAddress")
+	}
+	for i, networkID := range splitList(p.Get("networkids")) {
+		entry := map[string]string{"networkid": networkID}
+		if i == 0 {
+			entry["ip"] = p.Get("ipaddress")
+		}
+		ipToNetworkList = append(ipToNetworkList, entry)
+	}
+	nics := make([]resource, 0, len(ipToNetworkList))
+	for i, entry := range ipToNetworkList {
+		networkID := entry["networkid"]
+		network, found := s.table(KindNetwork).byID[networkID]
+		if !found {
+			return nil, invalidParam(command, "networkids", networkID)
+		}
+		ip := entry["ip"]
+		if ip == "" {
+			s.nextIP++
+			ip = fmt.Sprintf("%s.%d", strings.TrimSuffix(network.str("gateway"), ".1"), 10+s.nextIP%240)
+		}
+		nics = append(nics, resource{
+			"id": s.newID(), "networkid": networkID, "networkname": network.str("name"), "ipaddress": ip,
+			"gateway": network.str("gateway"), "netmask": network.str("netmask"), "isdefault": i == 0,
+			"type": network.str("type"), "traffictype": "Guest",
+		})
+	}
+
+	host, err := s.placeVirtualMachine(command, p, zone.str("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []resource{}
+	for _, groupID := range splitList(p.Get("affinitygroupids")) {
+		group, found := s.table(KindAffinityGroup).byID[groupID]
+		if !found {
+			return nil, invalidParam(command, "affinitygroupids", groupID)
+		}
+		groups = append(groups, resource{"id": groupID, "name": group.str("name"), "type": group.str("type")})
+	}
+
+	details := map[string]string{}
+	for _, detail := range indexedMaps(p, "details") {
+		for k, v := range detail {
+			details[k] = v
+		}
+	}
+	compute, err := offeringCompute(offering, details)
+	if err != nil {
+		return nil, err
+	}
+
+	// Registered user data, supported since CloudStack 4.18, replaces the inline one.
+	userData := p.Get("userdata")
+	var registered resource
+	if p.Get("userdataid") != "" {
+		if userData != "" {
+			return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+				"Both userdata and userdata ID inputs are not allowed, please provide only one")
+		}
+		if registered, err = s.lookup(KindUserData, command, p, "userdataid"); err != nil {
+			return nil, err
+		}
+		userData = registered.str("userdata")
+	}
+
+	vmID := s.newID()
+	name := p.Get("name")
+	if name == "" {
+		name = "VM-" + vmID
+	}
+	displayName := p.Get("displayname")
+	if displayName == "" {
+		displayName = name
+	}
+	vm := resource{
+		"id": vmID, "name": name, "displayname": displayName, "state": "Starting", "zoneid": zone.str("id"),
+		"zonename": zone.str("name"), "templateid": template.str("id"), "templatename": template.str("name"),
+		"serviceofferingid": offering.str("id"), "serviceofferingname": offering.str("name"),
+		"cpunumber": compute["cpunumber"], "memory": compute["memory"], "cpuspeed": compute["cpuspeed"],
+		"keypair": p.Get("keypair"), "userdata": userData, "nic": nics, "affinitygroup": groups,
+		"details": details, "hypervisor": template.str("hypervisor"), "created": s.now(), "tags": []resource{},
+		"account": "admin", "domainid": s.RootDomainID, "domain": "ROOT",
+		"isdynamicallyscalable": template["isdynamicallyscalable"] == true,
+	}
+	if len(nics) > 0 {
+		vm["ipaddress"] = nics[0].str("ipaddress")
+	}
+	if host != nil {
+		vm["hostid"] = host.str("id")
+		vm["hostname"] = host.str("name")
+	}
+	if registered != nil {
+		vm["userdataid"] = registered.str("id")
+		vm["userdataname"] = registered.str("name")
+	}
+	if diskOffering != nil {
+		vm["diskofferingid"] = diskOffering.str("id")
+		vm["diskofferingname"] = diskOffering.str("name")
+	}
+	if err := s.setProject(command, p, vm); err != nil {
+		return nil, err
+	}
+	s.insert(KindVirtualMachine, vm)
+
+	return &job{instanceType: "VirtualMachine", instanceID: vmID, complete: func() (interface{}, *apiError) {
+		if _, found := s.table(KindVirtualMachine).byID[vmID]; !found {
+			return nil, newError(ErrorCodeInternal, CSExceptionCloudRuntime, "VM %s was removed before it started", vmID)
+		}
+		rootSize := template["size"]
+		if rootDiskSize > 0 {
+			rootSize = rootDiskSize << 30
+		}
+		s.insert(KindVolume, inProjectOf(vm, resource{
+			"name": "ROOT-" + vmID, "type": "ROOT", "virtualmachineid": vmID, "zoneid": zone.str("id"),
+			"size": rootSize, "state": "Ready", "deviceid": 0, "tags": []resource{},
+		}))
+		if diskOffering != nil {
+			size, _ := strconv.ParseInt(p.Get("size"), 10, 64)
+			if size == 0 {
+				size, _ = diskOffering["disksize"].(int64)
+			}
+			s.insert(KindVolume, inProjectOf(vm, resource{
+				"name": "DATA-" + vmID, "type": "DATADISK", "virtualmachineid": vmID, "zoneid": zone.str("id"),
+				"diskofferingid": diskOffering.str("id"), "size": size << 30, "state": "Ready", "deviceid": 1,
+				"tags": []resource{},
+			}))
+		}
+		vm["state"] = "Running"
+		if p.Get("startvm") == "false" {
+			vm["state"] = "Stopped"
+		}
+		return map[string]interface{}{"virtualmachine": vm}, nil
+	}}, nil
+}
+
+// deploymentPlanners are the deployment planners CloudStack ships with.
+var deploymentPlanners = map[string]bool{
+	"FirstFitPlanner": true, "UserDispersingPlanner": true, "UserConcentratedPodPlanner": true,
+	"ImplicitDedicationPlanner": true, "SkipHeuresticsPlanner": true,
+}
+
+// placeVirtualMachine picks the host a VM is deployed on, honoring the host, cluster and pod it's deployed with. VMs
+// get no host when no host is seeded and they have no placement hints.
+func (s *Server) placeVirtualMachine(command string, p url.Values, zoneID string) (resource, *apiError) {
+	if planner := p.Get("deploymentplanner"); planner != "" && !deploymentPlanners[planner] {
+		return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter, "Can't find deployment planner %s", planner)
+	}
+	hostID, clusterID, podID := p.Get("hostid"), p.Get("clusterid"), p.Get("podid")
+	if hostID != "" {
+		if _, err := s.lookup(KindHost, command, p, "hostid"); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range s.table(KindHost).order {
+		host := s.table(KindHost).byID[id]
+		if host.str("zoneid") == zoneID && (hostID == "" || hostID == id) &&
+			(clusterID == "" || clusterID == host.str("clusterid")) && (podID == "" || podID == host.str("podid")) {
+			return host, nil
+		}
+	}
+	if hostID == "" && clusterID == "" && podID == "" {
+		return nil, nil
+	}
+	return nil, newError(ErrorCodeInsufficientCapacity, CSExceptionInsufficientCapacity,
+		"Unable to create a deployment for VM in zone %s with host %q, cluster %q and pod %q", zoneID, hostID, clusterID,
+		podID)
+}
+
+// offeringCompute returns the CPU number, memory and CPU speed of a VM with a service offering. Customized offerings take
+// the values they don't fix from the details, within their limits.
+func offeringCompute(offering resource, details map[string]string) (map[string]interface{}, *apiError) {
+	compute := map[string]interface{}{
+		"cpunumber": offering["cpunumber"], "memory": offering["memory"], "cpuspeed": offering["cpuspeed"]}
+	if offering["iscustomized"] != true {
+		return compute, nil
+	}
+	for key, detail := range map[string]string{"cpunumber": "cpuNumber", "memory": "memory", "cpuspeed": "cpuSpeed"} {
+		if fixed, _ := compute[key].(int); fixed > 0 {
+			continue
+		}
+		value, err := strconv.Atoi(details[detail])
+		if err != nil || value <= 0 {
+			return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+				"Need to specify custom parameter values cpu, cpu speed and memory when using custom offering")
+		}
+		limits, _ := offering["serviceofferingdetails"].(map[string]string)
+		min, minErr := strconv.Atoi(limits["min"+key])
+		max, maxErr := strconv.Atoi(limits["max"+key])
+		if (minErr == nil && value < min) || (maxErr == nil && value > max) {
+			return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+				"Invalid %s value %d, it must be within [%s, %s]", key, value, limits["min"+key], limits["max"+key])
+		}
+		compute[key] = value
+	}
+	return compute, nil
+}
+
+// scaleVirtualMachine changes the service offering of a VM. Like CloudStack, running VMs can only be scaled up, and
+// only when they're dynamically scalable.
+func (s *Server) scaleVirtualMachine(command string, p url.Values) (*job, *apiError) {
+	vm, err := s.lookup(KindVirtualMachine, command, p, "id")
+	if err != nil {
+		return nil, err
+	}
+	offering, err := s.lookup(KindServiceOffering, command, p, "serviceofferingid")
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]string{}
+	for _, detail := range indexedMaps(p, "details") {
+		for k, v := range detail {
+			details[k] = v
+		}
+	}
+	compute, err := offeringCompute(offering, details)
+	if err != nil {
+		return nil, err
+	}
+	return &job{instanceType: "VirtualMachine", instanceID: vm.str("id"), complete: func() (interface{}, *apiError) {
+		switch vm.str("state") {
+		case "Stopped":
+		case "Running":
+			if vm["isdynamicallyscalable"] != true {
+				return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+					"Unable to scale VM %s as it is not dynamically scalable", vm.str("name"))
+			}
+			for _, key := range []string{"cpunumber", "memory", "cpuspeed"} {
+				current, _ := vm[key].(int)
+				if next, _ := compute[key].(int); next < current {
+					return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+						"Only scaling up the vm is supported, new service offering should have at least the %s of the old one", key)
+				}
+			}
+		default:
+			return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+				"Unable to scale VM %s in state %s", vm.str("name"), vm.str("state"))
+		}
+		vm["serviceofferingid"] = offering.str("id")
+		vm["serviceofferingname"] = offering.str("name")
+		for key, value := range compute {
+			vm[key] = value
+		}
+		return map[string]interface{}{"virtualmachine": vm}, nil
+	}}, nil
+}
+
+// destroyVirtualMachine destroys a VM. Expunged VMs are removed along with their volumes, others are kept in the
+// Destroyed state.
+func (s *Server) destroyVirtualMachine(command string, p url.Values) (*job, *apiError) {
+	id := p.Get("id")
+	vm, found := s.table(KindVirtualMachine).byID[id]
+	if !found {
+		// This mirrors the message CloudStack returns for IDs of VMs that have already been expunged.
+		return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter, "Unable to find UUID for id %s", id)
+	}
+	volumeIDs := splitList(p.Get("volumeids"))
+	for _, volumeID := range volumeIDs {
+		if _, found := s.table(KindVolume).byID[volumeID]; !found {
+			return nil, invalidParam(command, "volumeids", volumeID)
+		}
+	}
+	expunge := p.Get("expunge") == "true"
+	return &job{instanceType: "VirtualMachine", instanceID: id, complete: func() (interface{}, *apiError) {
+		for _, volumeID := range volumeIDs {
+			s.remove(KindVolume, volumeID)
+		}
+		if !expunge {
+			vm["state"] = "Destroyed"
+			return map[string]interface{}{"virtualmachine": vm}, nil
+		}
+		for _, volumeID := range append([]string{}, s.table(KindVolume).order...) {
+			volume := s.table(KindVolume).byID[volumeID]
+			if volume.str("virtualmachineid") != id {
+				continue
+			}
+			if volume.str("type") == "ROOT" {
+				s.remove(KindVolume, volumeID)
+			} else {
+				delete(volume, "virtualmachineid")
+			}
+		}
+		for ruleID, members := range s.lbMembers {
+			s.lbMembers[ruleID] = removeString(members, id)
+		}
+		s.remove(KindVirtualMachine, id)
+		s.removeTagsOf(id)
+		vm["state"] = "Expunging"
+		return map[string]interface{}{"virtualmachine": vm}, nil
+	}}, nil
+}
+
+func (s *Server) setVirtualMachineState(state string) asyncHandler {
+	return func(command string, p url.Values) (*job, *apiError) {
+		vm, err := s.lookup(KindVirtualMachine, command, p, "id")
+		if err != nil {
+			return nil, err
+		}
+		return &job{instanceType: "VirtualMachine", instanceID: vm.str("id"), complete: func() (interface{}, *apiError) {
+			vm["state"] = state
+			return map[string]interface{}{"virtualmachine": vm}, nil
+		}}, nil
+	}
+}
+
+// createVolume creates a data disk volume. Like CloudStack, the volume stays Allocated until it's attached to a VM.
+func (s *Server) createVolume(command string, p url.Values) (*job, *apiError) {
+	zone, err := s.lookup(KindZone, command, p, "zoneid")
+	if err != nil {
+		return nil, err
+	}
+	diskOffering, err := s.lookup(KindDiskOffering, command, p, "diskofferingid")
+	if err != nil {
+		return nil, err
+	}
+	size, _ := strconv.ParseInt(p.Get("size"), 10, 64)
+	if diskOffering["iscustomized"] == true && size == 0 {
+		return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+			"Disk offering %s requires size parameter.", diskOffering.str("id"))
+	}
+	if size == 0 {
+		size, _ = diskOffering["disksize"].(int64)
+	}
+	volume := resource{
+		"name": p.Get("name"), "type": "DATADISK", "zoneid": zone.str("id"), "diskofferingid": diskOffering.str("id"),
+		"size": size << 30, "state": "Allocated", "tags": []resource{}, "account": "admin",
+		"domainid": s.RootDomainID, "domain": "ROOT",
+	}
+	if err := s.setProject(command, p, volume); err != nil {
+		return nil, err
+	}
+	id := s.insert(KindVolume, volume)
+	if volume.str("name") == "" {
+		volume["name"] = "DATA-" + id
+	}
+	return &job{instanceType: "Volume", instanceID: id, complete: func() (interface{}, *apiError) {
+		return map[string]interface{}{"volume": volume}, nil
+	}}, nil
+}
+
+// attachVolume attaches a data disk volume to a VM at the VM's next free device ID. The job fails when the VM is
+// neither running nor stopped by then.
+func (s *Server) attachVolume(command string, p url.Values) (*job, *apiError) {
+	volume, err := s.lookup(KindVolume, command, p, "id")
+	if err != nil {
+		return nil, err
+	}
+	vm, err := s.lookup(KindVirtualMachine, command, p, "virtualmachineid")
+	if err != nil {
+		return nil, err
+	}
+	if attachedTo := volume.str("virtualmachineid"); attachedTo != "" {
+		return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+			"Volume %s is already attached to VM %s", volume.str("id"), attachedTo)
+	}
+	vmID := vm.str("id")
+	return &job{instanceType: "Volume", instanceID: volume.str("id"), complete: func() (interface{}, *apiError) {
+		if state := vm.str("state"); state != "Running" && state != "Stopped" {
+			return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+				"Volume %s can't be attached to VM %s in state %s", volume.str("id"), vmID, state)
+		}
+		deviceID := 0
+		for _, other := range s.table(KindVolume).byID {
+			if id, _ := other["deviceid"].(int); other.str("virtualmachineid") == vmID && id >= deviceID {
+				deviceID = id + 1
+			}
+		}
+		volume["virtualmachineid"] = vmID
+		volume["deviceid"] = deviceID
+		volume["state"] = "Ready"
+		return map[string]interface{}{"volume": volume}, nil
+	}}, nil
+}
+
+// deleteVolume deletes a data disk volume that isn't attached to a VM.
+func (s *Server) deleteVolume(command string, p url.Values) (interface{}, *apiError) {
+	volume, err := s.lookup(KindVolume, command, p, "id")
+	if err != nil {
+		return nil, err
+	}
+	if attachedTo := volume.str("virtualmachineid"); attachedTo != "" {
+		return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+			"Please specify a volume that is not attached to any VM. Volume %s is attached to VM %s",
+			volume.str("id"), attachedTo)
+	}
+	s.remove(KindVolume, volume.str("id"))
+	return success(), nil
+}
+
+func (s *Server) associateIPAddress(command string, p url.Values) (*job, *apiError) {
+	network, err := s.lookup(KindNetwork, command, p, "networkid")
+	if err != nil {
+		return nil, err
+	}
+	var ip resource
+	addresses := s.table(KindPublicIPAddress)
+	for _, id := range addresses.order {
+		candidate := addresses.byID[id]
+		if candidate.str("zoneid") != network.str("zoneid") {
+			continue
+		}
+		if want := p.Get("ipaddress"); want != "" && candidate.str("ipaddress") != want {
+			continue
+		}
+		if candidate.str("allocated") == "" {
+			ip = candidate
+			break
+		}
+	}
+	if ip == nil {
+		return nil, newError(ErrorCodeInsufficientCapacity, CSExceptionResourceAllocation,
+			"Insufficient address capacity: no free public IP address in zone %s", network.str("zoneid"))
+	}
+	if err := s.setProject(command, p, ip); err != nil {
+		return nil, err
+	}
+	ip["allocated"] = s.now()
+	ip["state"] = "Allocating"
+	return &job{instanceType: "IpAddress", instanceID: ip.str("id"), complete: func() (interface{}, *apiError) {
+		ip["associatednetworkid"] = network.str("id")
+		ip["associatednetworkname"] = network.str("name")
+		ip["state"] = "Allocated"
+		return map[string]interface{}{"ipaddress": ip}, nil
+	}}, nil
+}
+
+func (s *Server) disassociateIPAddress(command string, p url.Values) (*job, *apiError) {
+	ip, err := s.lookup(KindPublicIPAddress, command, p, "id")
+	if err != nil {
+		return nil, err
+	}
+	return &job{instanceType: "IpAddress", instanceID: ip.str("id"), complete: func() (interface{}, *apiError) {
+		for _, key := range []string{"allocated", "associatednetworkid", "associatednetworkname"} {
+			delete(ip, key)
+		}
+		ip["state"] = "Free"
+		s.removeTagsOf(ip.str("id"))
+		return success(), nil
+	}}, nil
+}
+
+func (s *Server) createLoadBalancerRule(command string, p url.Values) (*job, *apiError) {
+	ip, err := s.lookup(KindPublicIPAddress, command, p, "publicipid")
+	if err != nil {
+		return nil, err
+	}
+	rules := s.table(KindLBRule)
+	for _, id := range rules.order {
+		if r := rules.byID[id]; r.str("publicipid") == ip.str("id") && r.str("publicport") == p.Get("publicport") {
+			return nil, newError(ErrorCodeNetworkRuleConflict, CSExceptionNetworkRuleConflict,
+				"The range specified, %s-%s, conflicts with rule %s which has %s-%s", p.Get("publicport"),
+				p.Get("publicport"), id, r.str("publicport"), r.str("publicport"))
+		}
+	}
+	rule := resource{
+		"name": p.Get("name"), "algorithm": p.Get("algorithm"), "publicipid": ip.str("id"),
+		"publicip": ip.str("ipaddress"), "publicport": p.Get("publicport"), "privateport": p.Get("privateport"),
+		"networkid": p.Get("networkid"), "protocol": p.Get("protocol"), "zoneid": ip.str("zoneid"), "state": "Add",
+		"tags": []resource{},
+	}
+	id := s.insert(KindLBRule, rule)
+	return &job{instanceType: "FirewallRule", instanceID: id, complete: func() (interface{}, *apiError) {
+		rule["state"] = "Active"
+		return map[string]interface{}{"loadbalancer": rule}, nil
+	}}, nil
+}
+
+func (s *Server) assignToLoadBalancerRule(command string, p url.Values) (*job, *apiError) {
+	rule, err := s.lookup(KindLBRule, command, p, "id")
+	if err != nil {
+		return nil, err
+	}
+	vmIDs := splitList(p.Get("virtualmachineids"))
+	for _, vmID := range vmIDs {
+		if _, found := s.table(KindVirtualMachine).byID[vmID]; !found {
+			return nil, invalidParam(command, "virtualmachineids", vmID)
+		}
+	}
+	ruleID := rule.str("id")
+	return &job{instanceType: "FirewallRule", instanceID: ruleID, complete: func() (interface{}, *apiError) {
+		for _, vmID := range vmIDs {
+			if !containsFold(s.lbMembers[ruleID], vmID) {
+				s.lbMembers[ruleID] = append(s.lbMembers[ruleID], vmID)
+			}
+		}
+		return success(), nil
+	}}, nil
+}
+
+func (s *Server) createFirewallRule(kind Kind) asyncHandler {
+	return func(command string, p url.Values) (*job, *apiError) {
+		parentParam, parentKind := "ipaddressid", KindPublicIPAddress
+		if kind == KindEgressRule {
+			parentParam, parentKind = "networkid", KindNetwork
+		}
+		parent, err := s.lookup(parentKind, command, p, parentParam)
+		if err != nil {
+			return nil, err
+		}
+		rules := s.table(kind)
+		for _, id := range rules.order {
+			r := rules.byID[id]
+			if r.str(parentParam) == parent.str("id") && strings.EqualFold(r.str("protocol"), p.Get("protocol")) &&
+				r.str("startport") == p.Get("startport") && r.str("endport") == p.Get("endport") {
+				return nil, newError(ErrorCodeNetworkRuleConflict, CSExceptionNetworkRuleConflict,
+					"There is already a firewall rule specified with protocol %s and ports %s-%s",
+					p.Get("protocol"), p.Get("startport"), p.Get("endport"))
+			}
+		}
+		rule := resource{
+			parentParam: parent.str("id"), "protocol": p.Get("protocol"), "cidrlist": p.Get("cidrlist"), "state": "Add",
+			"tags": []resource{},
+		}
+		// ACS leaves the ports out of rules that don't have any.
+		for _, port := range []string{"startport", "endport"} {
+			if p.Get(port) != "" {
+				rule[port] = p.Get(port)
+			}
+		}
+		id := s.insert(kind, rule)
+		return &job{instanceType: "FirewallRule", instanceID: id, complete: func() (interface{}, *apiError) {
+			rule["state"] = "Active"
+			return map[string]interface{}{"firewallrule": rule}, nil
+		}}, nil
+	}
+}
+
+func (s *Server) createAffinityGroup(command string, p url.Values) (*job, *apiError) {
+	name := p.Get("name")
+	if name == "" {
+		return nil, missingParam(command, "name")
+	}
+	if p.Get("type") == "" {
+		return nil, missingParam(command, "type")
+	}
+	if _, found := s.findUnlocked(KindAffinityGroup, name); found {
+		return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+			"Unable to create affinity group, a group with name %s already exists.", name)
+	}
+	group := resource{
+		"name": name, "type": p.Get("type"), "description": p.Get("description"), "virtualmachineIds": []string{},
+		"account": "admin", "domainid": s.RootDomainID, "domain": "ROOT",
+	}
+	if err := s.setProject(command, p, group); err != nil {
+		return nil, err
+	}
+	id := s.insert(KindAffinityGroup, group)
+	return &job{instanceType: "AffinityGroup", instanceID: id, complete: func() (interface{}, *apiError) {
+		return map[string]interface{}{"affinitygroup": group}, nil
+	}}, nil
+}
+
+func (s *Server) deleteAffinityGroup(command string, p url.Values) (*job, *apiError) {
+	id := p.Get("id")
+	if id == "" {
+		if name := p.Get("name"); name != "" {
+			found := false
+			if id, found = s.findUnlocked(KindAffinityGroup, name); !found {
+				return nil, invalidParam(command, "name", name)
+			}
+		}
+	}
+	if _, found := s.table(KindAffinityGroup).byID[id]; !found {
+		return nil, invalidParam(command, "id", id)
+	}
+	return &job{instanceType: "AffinityGroup", instanceID: id, complete: func() (interface{}, *apiError) {
+		for _, vm := range s.table(KindVirtualMachine).byID {
+			vm["affinitygroup"] = withoutGroup(vm["affinitygroup"].([]resource), id)
+		}
+		s.remove(KindAffinityGroup, id)
+		return success(), nil
+	}}, nil
+}
+
+func (s *Server) updateVMAffinityGroup(command string, p url.Values) (*job, *apiError) {
+	vm, err := s.lookup(KindVirtualMachine, command, p, "id")
+	if err != nil {
+		return nil, err
+	}
+	groupIDs := splitList(p.Get("affinitygroupids"))
+	for _, groupID := range groupIDs {
+		if _, found := s.table(KindAffinityGroup).byID[groupID]; !found {
+			return nil, invalidParam(command, "affinitygroupids", groupID)
+		}
+	}
+	return &job{instanceType: "VirtualMachine", instanceID: vm.str("id"), complete: func() (interface{}, *apiError) {
+		if vm.str("state") != "Stopped" {
+			return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+				"Unable to update affinity groups of the virtual machine %s in state %s; make sure the virtual "+
+					"machine is stopped and not in an error state before updating.", vm.str("id"), vm.str("state"))
+		}
+		for _, group := range vm["affinitygroup"].([]resource) {
+			if g, found := s.table(KindAffinityGroup).byID[group.str("id")]; found {
+				g["virtualmachineIds"] = removeString(g["virtualmachineIds"].([]string), vm.str("id"))
+			}
+		}
+		groups := make([]resource, 0, len(groupIDs))
+		for _, groupID := range groupIDs {
+			g := s.table(KindAffinityGroup).byID[groupID]
+			g["virtualmachineIds"] = append(g["virtualmachineIds"].([]string), vm.str("id"))
+			groups = append(groups, resource{"id": groupID, "name": g.str("name"), "type": g.str("type")})
+		}
+		vm["affinitygroup"] = groups
+		return map[string]interface{}{"virtualmachine": vm}, nil
+	}}, nil
+}
+
+func withoutGroup(groups []resource, id string) []resource {
+	out := make([]resource, 0, len(groups))
+	for _, g := range groups {
+		if g.str("id") != id {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// taggableKinds maps CloudStack resource types to the stored kind, so tags are also rendered on the resource itself.
+var taggableKinds = map[string]Kind{
+	"userVm":          KindVirtualMachine,
+	"Volume":          KindVolume,
+	"Network":         KindNetwork,
+	"PublicIpAddress": KindPublicIPAddress,
+	"LoadBalancer":    KindLBRule,
+	"AffinityGroup":   KindAffinityGroup,
+	"Template":        KindTemplate,
+}
+
+// setProject assigns a resource to the project passed in the projectid parameter, if any.
+func (s *Server) setProject(command string, p url.Values, r resource) *apiError {
+	if p.Get("projectid") == "" {
+		return nil
+	}
+	project, err := s.lookup(KindProject, command, p, "projectid")
+	if err != nil {
+		return err
+	}
+	r["projectid"] = project.str("id")
+	r["project"] = project.str("name")
+	return nil
+}
+
+// inProjectOf assigns r to the project of owner, if any, and returns it.
+func inProjectOf(owner, r resource) resource {
+	if projectID := owner.str("projectid"); projectID != "" {
+		r["projectid"] = projectID
+		r["project"] = owner.str("project")
+	}
+	return r
+}
+
+func (s *Server) taggedResource(resourceType, id string) resource {
+	for rType, kind := range taggableKinds {
+		if strings.EqualFold(rType, resourceType) {
+			return s.table(kind).byID[id]
+		}
+	}
+	return nil
+}
+
+func (s *Server) createTags(command string, p url.Values) (*job, *apiError) {
+	resourceType := p.Get("resourcetype")
+	if resourceType == "" {
+		return nil, missingParam(command, "resourcetype")
+	}
+	resourceIDs := splitList(p.Get("resourceids"))
+	tags := indexedMaps(p, "tags")
+	return &job{instanceType: "None", complete: func() (interface{}, *apiError) {
+		for _, id := range resourceIDs {
+			for _, tag := range tags {
+				if s.findTag(resourceType, id, tag["key"]) != "" {
+					return nil, newError(ErrorCodeInternal, CSExceptionCloudRuntime,
+						"tag %s already on %s with id %s", tag["key"], resourceType, id)
+				}
+			}
+		}
+		for _, id := range resourceIDs {
+			for _, tag := range tags {
+				t := resource{
+					"key": tag["key"], "value": tag["value"], "resourcetype": resourceType, "resourceid": id,
+					"account": "admin", "domainid": s.RootDomainID, "domain": "ROOT",
+				}
+				r := s.taggedResource(resourceType, id)
+				if r != nil {
+					inProjectOf(r, t)
+				}
+				s.insert(KindTag, t)
+				if r != nil {
+					existing, _ := r["tags"].([]resource)
+					r["tags"] = append(existing, t)
+				}
+			}
+		}
+		return success(), nil
+	}}, nil
+}
+
+func (s *Server) deleteTags(command string, p url.Values) (*job, *apiError) {
+	resourceType := p.Get("resourcetype")
+	if resourceType == "" {
+		return nil, missingParam(command, "resourcetype")
+	}
+	resourceIDs := splitList(p.Get("resourceids"))
+	keys := map[string]bool{}
+	for _, tag := range indexedMaps(p, "tags") {
+		keys[tag["key"]] = true
+	}
+	return &job{instanceType: "None", complete: func() (interface{}, *apiError) {
+		for _, id := range resourceIDs {
+			for _, tagID := range append([]string{}, s.table(KindTag).order...) {
+				t := s.table(KindTag).byID[tagID]
+				if t.str("resourceid") == id && strings.EqualFold(t.str("resourcetype"), resourceType) &&
+					(len(keys) == 0 || keys[t.str("key")]) {
+					s.removeTag(tagID)
+				}
+			}
+		}
+		return success(), nil
+	}}, nil
+}
+
+func (s *Server) findTag(resourceType, resourceID, key string) string {
+	tags := s.table(KindTag)
+	for _, id := range tags.order {
+		t := tags.byID[id]
+		if t.str("resourceid") == resourceID && strings.EqualFold(t.str("resourcetype"), resourceType) &&
+			t.str("key") == key {
+			return id
+		}
+	}
+	return ""
+}
+
+func (s *Server) removeTag(tagID string) {
+	t := s.table(KindTag).byID[tagID]
+	if r := s.taggedResource(t.str("resourcetype"), t.str("resourceid")); r != nil {
+		existing, _ := r["tags"].([]resource)
+		kept := make([]resource, 0, len(existing))
+		for _, tag := range existing {
+			if tag.str("id") != tagID {
+				kept = append(kept, tag)
+			}
+		}
+		r["tags"] = kept
+	}
+	s.remove(KindTag, tagID)
+}
+
+// removeTagsOf drops the tags of a resource that has been removed.
+func (s *Server) removeTagsOf(resourceID string) {
+	for _, tagID := range append([]string{}, s.table(KindTag).order...) {
+		if s.table(KindTag).byID[tagID].str("resourceid") == resourceID {
+			s.remove(KindTag, tagID)
+		}
+	}
+}
+
+func (s *Server) findUnlocked(kind Kind, name string) (string, bool) {
+	t := s.table(kind)
+	for _, id := range t.order {
+		if t.byID[id].str("name") == name || t.byID[id].str("username") == name {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+func (s *Server) createDomain(parentID, name string) (string, *apiError) {
+	parent, found := s.table(KindDomain).byID[parentID]
+	if !found {
+		return "", invalidParam("createDomain", "parentdomainid", parentID)
+	}
+	domains := s.table(KindDomain)
+	for _, id := range domains.order {
+		if d := domains.byID[id]; d.str("parentdomainid") == parentID && strings.EqualFold(d.str("name"), name) {
+			return "", newError(ErrorCodeParam, CSExceptionInvalidParameter,
+				"Domain with name %s already exists for the parent id=%s", name, parentID)
+		}
+	}
+	parent["haschild"] = true
+	return s.insert(KindDomain, resource{
+		"name": name, "path": parent.str("path") + "/" + name, "level": parent["level"].(int) + 1,
+		"parentdomainid": parentID, "parentdomainname": parent.str("name"), "haschild": false,
+	}), nil
+}
+
+func (s *Server) createDomainCmd(command string, p url.Values) (interface{}, *apiError) {
+	if p.Get("name") == "" {
+		return nil, missingParam(command, "name")
+	}
+	parentID := p.Get("parentdomainid")
+	if parentID == "" {
+		parentID = s.RootDomainID
+	}
+	id, err := s.createDomain(parentID, p.Get("name"))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"domain": s.table(KindDomain).byID[id]}, nil
+}
+
+func (s *Server) deleteDomain(command string, p url.Values) (*job, *apiError) {
+	domain, err := s.lookup(KindDomain, command, p, "id")
+	if err != nil {
+		return nil, err
+	}
+	if domain.str("id") == s.RootDomainID {
+		return nil, newError(ErrorCodeParam, CSExceptionPermissionDenied, "Can't delete ROOT domain")
+	}
+	return &job{instanceType: "Domain", instanceID: domain.str("id"), complete: func() (interface{}, *apiError) {
+		s.removeDomain(domain.str("id"))
+		return success(), nil
+	}}, nil
+}
+
+// removeDomain removes a domain together with its sub-domains, accounts and users.
+func (s *Server) removeDomain(domainID string) {
+	for _, id := range append([]string{}, s.table(KindDomain).order...) {
+		if s.table(KindDomain).byID[id].str("parentdomainid") == domainID {
+			s.removeDomain(id)
+		}
+	}
+	for _, kind := range []Kind{KindUser, KindAccount} {
+		for _, id := range append([]string{}, s.table(kind).order...) {
+			if s.table(kind).byID[id].str("domainid") == domainID {
+				s.remove(kind, id)
+			}
+		}
+	}
+	s.remove(KindDomain, domainID)
+}
+
+func (s *Server) createAccount(command string, p url.Values) (interface{}, *apiError) {
+	for _, required := range []string{"email", "firstname", "lastname", "password", "username"} {
+		if p.Get(required) == "" {
+			return nil, missingParam(command, required)
+		}
+	}
+	domainID := p.Get("domainid")
+	if domainID == "" {
+		domainID = s.RootDomainID
+	}
+	if _, found := s.table(KindDomain).byID[domainID]; !found {
+		return nil, invalidParam(command, "domainid", domainID)
+	}
+	name := p.Get("account")
+	if name == "" {
+		name = p.Get("username")
+	}
+	accounts := s.table(KindAccount)
+	for _, id := range accounts.order {
+		if a := accounts.byID[id]; a.str("domainid") == domainID && a.str("name") == name {
+			return nil, newError(ErrorCodeParam, CSExceptionInvalidParameter,
+				"The specified account: %s already exists", name)
+		}
+	}
+	accountID := s.addAccount(domainID, name)
+	userID := s.addUser(accountID, p.Get("username"))
+	account := s.table(KindAccount).byID[accountID]
+	account["user"] = []resource{s.table(KindUser).byID[userID]}
+	return map[string]interface{}{"account": account}, nil
+}
+
+func (s *Server) createUser(command string, p url.Values) (interface{}, *apiError) {
+	for _, required := range []string{"account", "email", "firstname", "lastname", "password", "username"} {
+		if p.Get(required) == "" {
+			return nil, missingParam(command, required)
+		}
+	}
+	domainID := p.Get("domainid")
+	if domainID == "" {
+		domainID = s.RootDomainID
+	}
+	accounts := s.table(KindAccount)
+	for _, id := range accounts.order {
+		if a := accounts.byID[id]; a.str("domainid") == domainID && a.str("name") == p.Get("account") {
+			userID := s.addUser(id, p.Get("username"))
+			return map[string]interface{}{"user": s.table(KindUser).byID[userID]}, nil
+		}
+	}
+	return nil, invalidParam(command, "account", p.Get("account"))
+}
+
+func (s *Server) getUserKeys(command string, p url.Values) (interface{}, *apiError) {
+	user, err := s.lookup(KindUser, command, p, "id")
+	if err != nil {
+		return nil, err
+	}
+	if user.str("apikey") == "" {
+		return map[string]interface{}{}, nil
+	}
+	return map[string]interface{}{
+		"userkeys": map[string]interface{}{"apikey": user.str("apikey"), "secretkey": user.str("secretkey")},
+	}, nil
+}
+
+func (s *Server) registerUserKeysCmd(command string, p url.Values) (interface{}, *apiError) {
+	user, err := s.lookup(KindUser, command, p, "id")
+	if err != nil {
+		return nil, err
+	}
+	apiKey, secretKey := s.registerUserKeys(user.str("id"))
+	return map[string]interface{}{"userkeys": map[string]interface{}{"apikey": apiKey, "secretkey": secretKey}}, nil
+}
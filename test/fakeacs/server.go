@@ -0,0 +1,862 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fakeacs implements a stateful, in-memory Apache CloudStack API server for tests.
+//
+// The server speaks the same wire protocol as a CloudStack management server: requests are signed with the caller's
+// API and secret keys, list APIs honour page and pagesize, and asynchronous commands return a job ID that is polled
+// through queryAsyncJobResult. This lets the cloud package and the controllers run their real code paths end to end
+// without a live ACS instance.
+package fakeacs
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" // #nosec G505 -- CloudStack request signing is defined in terms of HMAC-SHA1.
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind is the type of a resource stored by the server. Each kind doubles as the JSON key CloudStack uses to return a
+// list of resources of that kind.
+type Kind string
+
+const (
+	KindZone            Kind = "zone"
+	KindNetwork         Kind = "network"
+	KindNetworkOffering Kind = "networkoffering"
+	KindServiceOffering Kind = "serviceoffering"
+	KindDiskOffering    Kind = "diskoffering"
+	KindTemplate        Kind = "template"
+	KindVirtualMachine  Kind = "virtualmachine"
+	KindVolume          Kind = "volume"
+	KindPublicIPAddress Kind = "publicipaddress"
+	KindLBRule          Kind = "loadbalancerrule"
+	KindFirewallRule    Kind = "firewallrule"
+	KindEgressRule      Kind = "egressfirewallrule"
+	KindAffinityGroup   Kind = "affinitygroup"
+	KindTag             Kind = "tag"
+	KindDomain          Kind = "domain"
+	KindAccount         Kind = "account"
+	KindUser            Kind = "user"
+	KindProject         Kind = "project"
+	KindHost            Kind = "host"
+	KindUserData        Kind = "userdata"
+	KindOsType          Kind = "ostype"
+)
+
+// CloudStack API error codes as returned in the errorcode field of a failed response.
+const (
+	ErrorCodeUnauthorized           = 401
+	ErrorCodeParam                  = 431
+	ErrorCodeUnsupportedAction      = 432
+	ErrorCodeInternal               = 530
+	ErrorCodeAccountResourceLimit   = 532
+	ErrorCodeInsufficientCapacity   = 533
+	ErrorCodeResourceUnavailable    = 534
+	ErrorCodeResourceInUse          = 536
+	ErrorCodeNetworkRuleConflict    = 537
+	CSExceptionCloudRuntime         = 4250
+	CSExceptionConcurrentOperation  = 4300
+	CSExceptionInsufficientCapacity = 4320
+	CSExceptionInvalidParameter     = 4350
+	CSExceptionNetworkRuleConflict  = 4360
+	CSExceptionPermissionDenied     = 4365
+	CSExceptionResourceAllocation   = 4370
+	CSExceptionUnknown              = 9999
+)
+
+const (
+	// DefaultIsolatedNetworkOffering is the network offering seeded on every server.
+	DefaultIsolatedNetworkOffering = "DefaultIsolatedNetworkOfferingWithSourceNatService"
+	// APIPath is the path the server serves the API on.
+	APIPath = "/client/api"
+)
+
+// apiError is a CloudStack API error.
+type apiError struct {
+	ErrorCode   int    `json:"errorcode"`
+	CSErrorCode int    `json:"cserrorcode"`
+	ErrorText   string `json:"errortext"`
+}
+
+func newError(code, csCode int, format string, args ...interface{}) *apiError {
+	return &apiError{ErrorCode: code, CSErrorCode: csCode, ErrorText: fmt.Sprintf(format, args...)}
+}
+
+// invalidParam builds the error CloudStack returns when a parameter references an entity that does not exist.
+func invalidParam(command, param, value string) *apiError {
+	return newError(ErrorCodeParam, CSExceptionInvalidParameter,
+		"Unable to execute API command %s due to invalid value. Invalid parameter %s value=%s due to incorrect long "+
+			"value format, or entity does not exist or due to incorrect parameter annotation for the field in api cmd class.",
+		strings.ToLower(command), param, value)
+}
+
+// missingParam builds the error CloudStack returns when a required parameter is absent.
+func missingParam(command, param string) *apiError {
+	return newError(ErrorCodeParam, CSExceptionInvalidParameter,
+		"Unable to execute API command %s due to missing parameter %s", strings.ToLower(command), param)
+}
+
+// resource is a single CloudStack object as it is rendered in API responses.
+type resource map[string]interface{}
+
+func (r resource) str(key string) string {
+	s, _ := r[key].(string)
+	return s
+}
+
+// table holds the resources of a kind in creation order so that list results and pagination are deterministic.
+type table struct {
+	order []string
+	byID  map[string]resource
+}
+
+// job is an asynchronous job as tracked by queryAsyncJobResult.
+type job struct {
+	id           string
+	cmd          string
+	instanceType string
+	instanceID   string
+	pendingPolls int
+	complete     func() (interface{}, *apiError)
+	done         bool
+	result       interface{}
+	err          *apiError
+}
+
+type syncHandler func(command string, p url.Values) (interface{}, *apiError)
+type asyncHandler func(command string, p url.Values) (*job, *apiError)
+
+// Server is an in-memory CloudStack API server. The embedded httptest.Server must be closed by the caller.
+type Server struct {
+	*httptest.Server
+
+	// APIKey and SecretKey are the credentials of the seeded admin user.
+	APIKey    string
+	SecretKey string
+
+	// RootDomainID, AdminAccountID and AdminUserID identify the seeded ROOT domain, admin account and admin user.
+	RootDomainID   string
+	AdminAccountID string
+	AdminUserID    string
+
+	mu           sync.Mutex
+	seq          int
+	tables       map[Kind]*table
+	jobs         map[string]*job
+	jobPolls     int
+	injected     map[string][]*apiError
+	calls        map[string]int
+	lastParams   map[string]url.Values
+	lbMembers    map[string][]string
+	nextIP       int
+	syncHandlers map[string]syncHandler
+	asyncHandler map[string]asyncHandler
+}
+
+// NewServer starts a new server seeded with a ROOT domain, an admin account and user with API keys, and the
+// default isolated network offering.
+func NewServer() *Server {
+	return newServer(httptest.NewServer)
+}
+
+// NewTLSServer starts a new server like NewServer, serving the API over HTTPS. Clients must trust the server's
+// self-signed certificate, returned by its Certificate method.
+func NewTLSServer() *Server {
+	return newServer(httptest.NewTLSServer)
+}
+
+func newServer(start func(http.Handler) *httptest.Server) *Server {
+	s := &Server{
+		tables:     map[Kind]*table{},
+		jobs:       map[string]*job{},
+		injected:   map[string][]*apiError{},
+		calls:      map[string]int{},
+		lastParams: map[string]url.Values{},
+		lbMembers:  map[string][]string{},
+	}
+	s.registerHandlers()
+
+	s.RootDomainID = s.insert(KindDomain, resource{"name": "ROOT", "path": "ROOT", "level": 0, "haschild": false})
+	s.AdminAccountID = s.addAccount(s.RootDomainID, "admin")
+	s.AdminUserID = s.addUser(s.AdminAccountID, "admin")
+	s.APIKey, s.SecretKey = s.registerUserKeys(s.AdminUserID)
+	s.insert(KindNetworkOffering, resource{
+		"name":          DefaultIsolatedNetworkOffering,
+		"displaytext":   "Offering for Isolated networks with Source Nat service enabled",
+		"guestiptype":   "Isolated",
+		"state":         "Enabled",
+		"isdefault":     true,
+		"traffictype":   "Guest",
+		"specifyvlan":   false,
+		"conservemode":  true,
+		"availability":  "Required",
+		"networkrate":   200,
+		"forvpc":        false,
+		"egressdefault": false,
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(APIPath, s.serveAPI)
+	s.Server = start(mux)
+	return s
+}
+
+// APIURL returns the URL clients should use as their api-url.
+func (s *Server) APIURL() string {
+	return s.URL + APIPath
+}
+
+// SetJobPolls sets how many times a newly submitted asynchronous job reports itself as pending before completing.
+// Zero, the default, completes jobs as soon as they are submitted.
+func (s *Server) SetJobPolls(polls int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobPolls = polls
+}
+
+// CompleteJobs completes every pending asynchronous job as if the management server had finished them in the
+// background.
+func (s *Server) CompleteJobs() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		s.finishJob(j)
+	}
+}
+
+// FailNext makes the next call of command fail with the passed error codes and text. Calls can be queued.
+func (s *Server) FailNext(command string, errorCode, csErrorCode int, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.injected[strings.ToLower(command)] = append(s.injected[strings.ToLower(command)],
+		&apiError{ErrorCode: errorCode, CSErrorCode: csErrorCode, ErrorText: text})
+}
+
+// RemoveCommand makes command unknown to the server, like it is to the CloudStack versions predating it.
+func (s *Server) RemoveCommand(command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.syncHandlers, strings.ToLower(command))
+	delete(s.asyncHandler, strings.ToLower(command))
+}
+
+// Calls returns the number of times command was called, including failed calls.
+func (s *Server) Calls(command string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[strings.ToLower(command)]
+}
+
+// LastParams returns the parameters of the last call of command, including a failed one, or nil if it wasn't called.
+func (s *Server) LastParams(command string) url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastParams[strings.ToLower(command)]
+}
+
+// Count returns the number of stored resources of kind.
+func (s *Server) Count(kind Kind) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.table(kind).order)
+}
+
+// Get returns a copy of the fields of the resource of kind with ID id.
+func (s *Server) Get(kind Kind, id string) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, found := s.table(kind).byID[id]
+	if !found {
+		return nil, false
+	}
+	out := make(map[string]interface{}, len(r))
+	for k, v := range r {
+		out[k] = v
+	}
+	return out, true
+}
+
+// Find returns the ID of the first resource of kind whose name (or username for users) equals name.
+func (s *Server) Find(kind Kind, name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.findUnlocked(kind, name)
+}
+
+// Set overwrites a single field of a stored resource. It is meant for tests that need to simulate out-of-band
+// changes, such as a VM entering the Error state.
+func (s *Server) Set(kind Kind, id, field string, value interface{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, found := s.table(kind).byID[id]
+	if found {
+		r[field] = value
+	}
+	return found
+}
+
+// AddZone seeds an enabled advanced zone.
+func (s *Server) AddZone(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(KindZone, resource{
+		"name": name, "allocationstate": "Enabled", "networktype": "Advanced", "securitygroupsenabled": false})
+}
+
+// AddNetwork seeds a network of networkType (Shared or Isolated) in a zone.
+func (s *Server) AddNetwork(zoneID, name, networkType string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(KindNetwork, s.newNetwork(zoneID, name, networkType, ""))
+}
+
+// AddServiceOffering seeds a fixed compute offering.
+func (s *Server) AddServiceOffering(name string, cpuNumber, memoryMiB int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(KindServiceOffering, resource{
+		"name": name, "displaytext": name, "cpunumber": cpuNumber, "memory": memoryMiB, "cpuspeed": 1000,
+		"iscustomized": false, "storagetype": "shared"})
+}
+
+// AddCustomServiceOffering seeds a customized compute offering with a fixed CPU speed, taking its number of CPUs and
+// memory at deploy time within the given limits.
+func (s *Server) AddCustomServiceOffering(name string, cpuSpeed, minCPUNumber, maxCPUNumber, minMemoryMiB, maxMemoryMiB int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(KindServiceOffering, resource{
+		"name": name, "displaytext": name, "cpuspeed": cpuSpeed, "iscustomized": true, "storagetype": "shared",
+		"serviceofferingdetails": map[string]string{
+			"mincpunumber": strconv.Itoa(minCPUNumber), "maxcpunumber": strconv.Itoa(maxCPUNumber),
+			"minmemory": strconv.Itoa(minMemoryMiB), "maxmemory": strconv.Itoa(maxMemoryMiB),
+		}})
+}
+
+// AddDiskOffering seeds a disk offering. Customized offerings accept a size at deploy time.
+func (s *Server) AddDiskOffering(name string, sizeGB int64, customized bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(KindDiskOffering, resource{
+		"name": name, "displaytext": name, "disksize": sizeGB, "iscustomized": customized, "storagetype": "shared"})
+}
+
+// AddTemplate seeds a ready template in a zone.
+func (s *Server) AddTemplate(zoneID, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(KindTemplate, resource{
+		"name": name, "displaytext": name, "zoneid": zoneID, "isready": true, "status": "Download Complete",
+		"format": "QCOW2", "hypervisor": "KVM", "templatetype": "USER", "size": int64(8 << 30),
+		"created": s.now()})
+}
+
+// AddOsType seeds an OS type templates can be registered with.
+func (s *Server) AddOsType(description string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(KindOsType, resource{"description": description, "isuserdefined": false})
+}
+
+// AddHost seeds an enabled routing host in a zone, in the named pod and cluster, which are created along with their
+// first host.
+func (s *Server) AddHost(zoneID, podName, clusterName, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	podID, clusterID := s.newID(), s.newID()
+	for _, id := range s.table(KindHost).order {
+		host := s.table(KindHost).byID[id]
+		if host.str("podname") == podName {
+			podID = host.str("podid")
+		}
+		if host.str("clustername") == clusterName {
+			clusterID = host.str("clusterid")
+		}
+	}
+	return s.insert(KindHost, resource{
+		"name": name, "zoneid": zoneID, "podid": podID, "podname": podName, "clusterid": clusterID,
+		"clustername": clusterName, "type": "Routing", "state": "Up", "resourcestate": "Enabled",
+		"hypervisor": "KVM"})
+}
+
+// AddPublicIPAddress seeds an unallocated public IP address in a zone.
+func (s *Server) AddPublicIPAddress(zoneID, ip string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(KindPublicIPAddress, resource{
+		"ipaddress": ip, "zoneid": zoneID, "state": "Free", "issourcenat": false, "isstaticnat": false,
+		"forvirtualnetwork": true})
+}
+
+// AddDomain seeds a domain under parentID.
+func (s *Server) AddDomain(parentID, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, _ := s.createDomain(parentID, name)
+	return id
+}
+
+// AddAccount seeds an account in a domain.
+func (s *Server) AddAccount(domainID, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addAccount(domainID, name)
+}
+
+func (s *Server) addAccount(domainID, name string) string {
+	domain := s.table(KindDomain).byID[domainID]
+	return s.insert(KindAccount, resource{
+		"name": name, "domainid": domainID, "domain": domain.str("name"), "accounttype": 2, "state": "enabled"})
+}
+
+// AddProject seeds a project owned by the admin account.
+func (s *Server) AddProject(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(KindProject, resource{
+		"name": name, "displaytext": name, "state": "Active", "account": "admin", "domainid": s.RootDomainID,
+		"domain": "ROOT", "tags": []resource{}})
+}
+
+// AddUser seeds a user without API keys in an account.
+func (s *Server) AddUser(accountID, username string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addUser(accountID, username)
+}
+
+func (s *Server) addUser(accountID, username string) string {
+	account := s.table(KindAccount).byID[accountID]
+	return s.insert(KindUser, resource{
+		"username": username, "account": account.str("name"), "accountid": accountID,
+		"domainid": account.str("domainid"), "domain": account.str("domain"), "state": "enabled"})
+}
+
+// RegisterUserKeys generates API keys for a user and returns them.
+func (s *Server) RegisterUserKeys(userID string) (apiKey, secretKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.registerUserKeys(userID)
+}
+
+func (s *Server) registerUserKeys(userID string) (string, string) {
+	user := s.table(KindUser).byID[userID]
+	s.seq++
+	user["apikey"] = fmt.Sprintf("fake-api-key-%d", s.seq)
+	user["secretkey"] = fmt.Sprintf("fake-secret-key-%d", s.seq)
+	return user.str("apikey"), user.str("secretkey")
+}
+
+func (s *Server) table(kind Kind) *table {
+	t, found := s.tables[kind]
+	if !found {
+		t = &table{byID: map[string]resource{}}
+		s.tables[kind] = t
+	}
+	return t
+}
+
+// newID returns a UUID-shaped identifier that is unique to this server.
+func (s *Server) newID() string {
+	s.seq++
+	return fmt.Sprintf("%08x-0000-4000-8000-%012x", s.seq, s.seq)
+}
+
+func (s *Server) now() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05-0700")
+}
+
+func (s *Server) insert(kind Kind, r resource) string {
+	if r.str("id") == "" {
+		r["id"] = s.newID()
+	}
+	t := s.table(kind)
+	t.order = append(t.order, r.str("id"))
+	t.byID[r.str("id")] = r
+	return r.str("id")
+}
+
+func (s *Server) remove(kind Kind, id string) {
+	t := s.table(kind)
+	delete(t.byID, id)
+	for i, v := range t.order {
+		if v == id {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// lookup fetches a resource referenced by a parameter and returns the appropriate CloudStack error if it's missing.
+func (s *Server) lookup(kind Kind, command string, p url.Values, param string) (resource, *apiError) {
+	value := p.Get(param)
+	if value == "" {
+		return nil, missingParam(command, param)
+	}
+	r, found := s.table(kind).byID[value]
+	if !found {
+		return nil, invalidParam(command, param, value)
+	}
+	return r, nil
+}
+
+// serveAPI is the HTTP entry point. It authenticates the request and dispatches it to the handler for the command.
+func (s *Server) serveAPI(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p := req.Form
+	command := p.Get("command")
+	lowerCommand := strings.ToLower(command)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[lowerCommand]++
+	s.lastParams[lowerCommand] = p
+
+	if err := s.authenticate(p); err != nil {
+		s.writeResponse(w, lowerCommand, err.ErrorCode, err)
+		return
+	}
+	if queued := s.injected[lowerCommand]; len(queued) > 0 {
+		s.injected[lowerCommand] = queued[1:]
+		s.writeResponse(w, lowerCommand, queued[0].ErrorCode, queued[0])
+		return
+	}
+
+	if h, found := s.syncHandlers[lowerCommand]; found {
+		result, err := h(command, p)
+		if err != nil {
+			s.writeResponse(w, lowerCommand, err.ErrorCode, err)
+			return
+		}
+		s.writeResponse(w, lowerCommand, http.StatusOK, result)
+		return
+	}
+	if h, found := s.asyncHandler[lowerCommand]; found {
+		j, err := h(command, p)
+		if err != nil {
+			s.writeResponse(w, lowerCommand, err.ErrorCode, err)
+			return
+		}
+		j.id = s.newID()
+		j.cmd = command
+		j.pendingPolls = s.jobPolls
+		s.jobs[j.id] = j
+		if j.pendingPolls == 0 {
+			s.finishJob(j)
+		}
+		submitted := map[string]interface{}{"jobid": j.id}
+		if j.instanceID != "" {
+			submitted["id"] = j.instanceID
+		}
+		s.writeResponse(w, lowerCommand, http.StatusOK, submitted)
+		return
+	}
+
+	err := newError(ErrorCodeUnsupportedAction, CSExceptionUnknown,
+		"The given command:%s does not exist or it is not available for user", command)
+	s.writeResponse(w, lowerCommand, err.ErrorCode, err)
+}
+
+// authenticate verifies the request signature against the secret key of the user owning the API key.
+func (s *Server) authenticate(p url.Values) *apiError {
+	unauthorized := newError(ErrorCodeUnauthorized, CSExceptionUnknown,
+		"unable to verify user credentials and/or request signature")
+	apiKey := p.Get("apiKey")
+	if apiKey == "" {
+		return unauthorized
+	}
+	var secretKey string
+	users := s.table(KindUser)
+	for _, id := range users.order {
+		if u := users.byID[id]; u.str("apikey") == apiKey {
+			secretKey = u.str("secretkey")
+			break
+		}
+	}
+	if secretKey == "" || !hmac.Equal([]byte(Sign(p, secretKey)), []byte(p.Get("signature"))) {
+		return unauthorized
+	}
+	return nil
+}
+
+// Sign computes the CloudStack signature of a set of request parameters. Parameters are sorted by key, their values
+// URL encoded, and the whole query string is lower cased and then signed with HMAC-SHA1.
+func Sign(p url.Values, secretKey string) string {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		if k != "signature" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var buf strings.Builder
+	for _, k := range keys {
+		for _, v := range p[k] {
+			if buf.Len() > 0 {
+				buf.WriteByte('&')
+			}
+			buf.WriteString(k)
+			buf.WriteByte('=')
+			buf.WriteString(strings.ReplaceAll(url.QueryEscape(v), "+", "%20"))
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(secretKey))
+	mac.Write([]byte(strings.ToLower(buf.String())))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// writeResponse wraps body in the <command>response envelope CloudStack uses for all responses.
+func (s *Server) writeResponse(w http.ResponseWriter, lowerCommand string, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{lowerCommand + "response": body})
+}
+
+// finishJob runs a job's completion function once.
+func (s *Server) finishJob(j *job) {
+	if j.done {
+		return
+	}
+	j.done = true
+	j.pendingPolls = 0
+	if j.complete != nil {
+		j.result, j.err = j.complete()
+	}
+}
+
+// queryAsyncJobResult reports a job's status. Pending jobs count down their polls and complete once they reach zero.
+func (s *Server) queryAsyncJobResult(command string, p url.Values) (interface{}, *apiError) {
+	jobID := p.Get("jobid")
+	j, found := s.jobs[jobID]
+	if !found {
+		return nil, invalidParam(command, "jobid", jobID)
+	}
+	resp := map[string]interface{}{
+		"jobid":           j.id,
+		"cmd":             j.cmd,
+		"jobinstancetype": j.instanceType,
+		"jobinstanceid":   j.instanceID,
+		"jobprocstatus":   0,
+		"created":         s.now(),
+	}
+	if !j.done && j.pendingPolls > 0 {
+		j.pendingPolls--
+		resp["jobstatus"] = 0
+		resp["jobresultcode"] = 0
+		return resp, nil
+	}
+	s.finishJob(j)
+	resp["jobresulttype"] = "object"
+	if j.err != nil {
+		resp["jobstatus"] = 2
+		resp["jobresultcode"] = j.err.ErrorCode
+		resp["jobresult"] = j.err
+	} else {
+		resp["jobstatus"] = 1
+		resp["jobresultcode"] = 0
+		resp["jobresult"] = j.result
+	}
+	return resp, nil
+}
+
+// paramsToSkip are request parameters that never act as list filters.
+var paramsToSkip = map[string]bool{
+	"command": true, "apikey": true, "signature": true, "response": true, "listall": true, "page": true,
+	"pagesize": true, "templatefilter": true, "isrecursive": true, "keyword": true, "allocatedonly": true,
+	"details": true, "expires": true, "signatureversion": true,
+}
+
+// list returns the resources of kind matching every filter parameter present on the request, paginated when
+// page and pagesize are set. Filter parameters are matched against the resource field of the same name.
+func (s *Server) list(kind Kind, p url.Values, extraFilters ...func(resource) bool) interface{} {
+	t := s.table(kind)
+	matches := []resource{}
+	for _, id := range t.order {
+		r := t.byID[id]
+		if s.matches(r, p) && allOf(r, extraFilters) {
+			matches = append(matches, r)
+		}
+	}
+	total := len(matches)
+	if pageSize, _ := strconv.Atoi(p.Get("pagesize")); pageSize > 0 {
+		page, _ := strconv.Atoi(p.Get("page"))
+		if page < 1 {
+			page = 1
+		}
+		start := (page - 1) * pageSize
+		if start > total {
+			start = total
+		}
+		end := start + pageSize
+		if end > total {
+			end = total
+		}
+		matches = matches[start:end]
+	}
+	if total == 0 {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{"count": total, string(kind): matches}
+}
+
+func allOf(r resource, filters []func(resource) bool) bool {
+	for _, f := range filters {
+		if !f(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) matches(r resource, p url.Values) bool {
+	// Resources owned by a project are only listed along with their project, as CloudStack does.
+	if projectID := r.str("projectid"); projectID != "" && projectID != p.Get("projectid") {
+		return false
+	}
+	for key, values := range p {
+		lowerKey := strings.ToLower(key)
+		if paramsToSkip[lowerKey] || strings.Contains(key, "[") || len(values) == 0 || values[0] == "" {
+			continue
+		}
+		want := values[0]
+		switch field := r[lowerKey].(type) {
+		case string:
+			if !strings.EqualFold(field, want) {
+				return false
+			}
+		case int:
+			if strconv.Itoa(field) != want {
+				return false
+			}
+		case bool:
+			if strconv.FormatBool(field) != strings.ToLower(want) {
+				return false
+			}
+		case []string:
+			if !containsFold(field, want) {
+				return false
+			}
+		}
+	}
+	if keyword := strings.ToLower(p.Get("keyword")); keyword != "" {
+		if !strings.Contains(strings.ToLower(r.str("name")), keyword) {
+			return false
+		}
+	}
+	return matchesTags(r, p)
+}
+
+// matchesTags applies tags[n].key/tags[n].value filters against a resource's tags.
+func matchesTags(r resource, p url.Values) bool {
+	tags, _ := r["tags"].([]resource)
+	for _, want := range indexedMaps(p, "tags") {
+		found := false
+		for _, tag := range tags {
+			if tag.str("key") == want["key"] && tag.str("value") == want["value"] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// indexedMaps parses map parameters such as details[0].key=value or tags[0].key=k&tags[0].value=v.
+func indexedMaps(p url.Values, name string) []map[string]string {
+	byIndex := map[int]map[string]string{}
+	prefix := name + "["
+	for key, values := range p {
+		if !strings.HasPrefix(key, prefix) || len(values) == 0 {
+			continue
+		}
+		rest := strings.TrimPrefix(key, prefix)
+		closing := strings.Index(rest, "].")
+		if closing < 0 {
+			continue
+		}
+		index, err := strconv.Atoi(rest[:closing])
+		if err != nil {
+			continue
+		}
+		if byIndex[index] == nil {
+			byIndex[index] = map[string]string{}
+		}
+		byIndex[index][rest[closing+2:]] = values[0]
+	}
+	indexes := make([]int, 0, len(byIndex))
+	for i := range byIndex {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	out := make([]map[string]string, 0, len(indexes))
+	for _, i := range indexes {
+		out = append(out, byIndex[i])
+	}
+	return out
+}
+
+// splitList splits a CloudStack list parameter, which the Go SDK joins with ", ".
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	parts := strings.Split(value, ",")
+	out := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(list []string, value string) []string {
+	out := make([]string, 0, len(list))
+	for _, v := range list {
+		if v != value {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func success() interface{} {
+	return map[string]interface{}{"success": true}
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakeacs_test
+
+import (
+	"context"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"sigs.k8s.io/cluster-api-provider-cloudstack/pkg/cloud"
+	dummies "sigs.k8s.io/cluster-api-provider-cloudstack/test/dummies/v1beta2"
+	"sigs.k8s.io/cluster-api-provider-cloudstack/test/fakeacs"
+)
+
+var _ = Describe("Fake ACS Server", func() {
+	var (
+		server    *fakeacs.Server
+		client    cloud.Client
+		zoneID    string
+		networkID string
+		ctx       = context.TODO()
+	)
+
+	BeforeEach(func() {
+		dummies.SetDummyVars()
+		server = fakeacs.NewServer()
+		DeferCleanup(server.Close)
+
+		zoneID = server.AddZone(dummies.Zone1.Name)
+		networkID = server.AddNetwork(zoneID, dummies.Zone1.Network.Name, cloud.NetworkTypeShared)
+		server.AddServiceOffering(dummies.CSMachine1.Spec.Offering.Name, 2, 2048)
+		server.AddTemplate(zoneID, dummies.CSMachine1.Spec.Template.Name)
+		server.AddDiskOffering(dummies.CSMachine1.Spec.DiskOffering.Name, 10, false)
+
+		var err error
+		client, err = cloud.NewClientFromConf(cloud.Config{
+			APIUrl:    server.APIURL(),
+			APIKey:    server.APIKey,
+			SecretKey: server.SecretKey,
+			VerifySSL: "false",
+		}, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(client.ResolveZone(ctx, &dummies.CSFailureDomain1.Spec.Zone)).Should(Succeed())
+		Ω(client.ResolveNetworkForZone(ctx, &dummies.CSFailureDomain1.Spec.Zone)).Should(Succeed())
+		dummies.CSMachine1.Spec.InstanceID = nil
+	})
+
+	Context("When authenticating requests", func() {
+		It("Resolves the zone and its network by name.", func() {
+			Ω(dummies.CSFailureDomain1.Spec.Zone.ID).Should(Equal(zoneID))
+			Ω(dummies.CSFailureDomain1.Spec.Zone.Network.ID).Should(Equal(networkID))
+		})
+
+		It("Rejects requests with an invalid signature.", func() {
+			cs := cloudstack.NewClient(server.APIURL(), server.APIKey, "not-the-secret-key", false)
+			_, err := cs.Zone.ListZones(cs.Zone.NewListZonesParams())
+			Ω(err).Should(MatchError(ContainSubstring("CloudStack API error 401")))
+		})
+
+		It("Accepts requests signed by a domain account user.", func() {
+			domainID := server.AddDomain(server.RootDomainID, "FakeDomain")
+			accountID := server.AddAccount(domainID, "FakeAccount")
+			server.RegisterUserKeys(server.AddUser(accountID, "FakeUser"))
+
+			userClient, err := client.NewClientInDomainAndAccount(ctx, "FakeDomain", "FakeAccount")
+			Ω(err).ShouldNot(HaveOccurred())
+			zone := dummies.Zone1
+			Ω(userClient.ResolveZone(ctx, &zone)).Should(Succeed())
+		})
+	})
+
+	Context("When listing resources", func() {
+		It("Paginates the results and reports the total count.", func() {
+			for _, name := range []string{"zone2", "zone3", "zone4"} {
+				server.AddZone(name)
+			}
+			cs := cloudstack.NewClient(server.APIURL(), server.APIKey, server.SecretKey, false)
+			p := cs.Zone.NewListZonesParams()
+			p.SetPage(2)
+			p.SetPagesize(3)
+			resp, err := cs.Zone.ListZones(p)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(resp.Count).Should(Equal(4))
+			Ω(resp.Zones).Should(HaveLen(1))
+			Ω(resp.Zones[0].Name).Should(Equal("zone4"))
+		})
+	})
+
+	Context("When deploying and destroying VM instances", func() {
+		It("Creates the VM with its volumes and expunges them on destroy.", func() {
+			Ω(client.GetOrCreateVMInstance(
+				ctx,
+				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				Should(Succeed())
+			Ω(dummies.CSMachine1.Spec.InstanceID).ShouldNot(BeNil())
+			Ω(dummies.CSMachine1.Status.InstanceState).Should(Equal("Running"))
+			Ω(dummies.CSMachine1.Status.Addresses).Should(HaveLen(1))
+			Ω(server.Count(fakeacs.KindVolume)).Should(Equal(2))
+
+			Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).Should(Succeed())
+			Ω(server.Count(fakeacs.KindVirtualMachine)).Should(BeZero())
+			Ω(server.Count(fakeacs.KindVolume)).Should(BeZero())
+		})
+
+		It("Returns while the deployment job is pending and polls it on the next call.", func() {
+			server.SetJobPolls(1)
+			Ω(client.GetOrCreateVMInstance(
+				ctx,
+				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				Should(MatchError(cloud.ErrAsyncJobPending))
+			Ω(dummies.CSMachine1.Spec.InstanceID).ShouldNot(BeNil())
+			Ω(dummies.CSMachine1.Status.AsyncJobID).ShouldNot(BeEmpty())
+
+			Ω(client.GetOrCreateVMInstance(
+				ctx,
+				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				Should(Succeed())
+			Ω(server.Calls("queryAsyncJobResult")).Should(Equal(2))
+			Ω(server.Calls("deployVirtualMachine")).Should(Equal(1))
+			Ω(dummies.CSMachine1.Status.AsyncJobID).Should(BeEmpty())
+			Ω(dummies.CSMachine1.Status.InstanceState).Should(Equal("Running"))
+		})
+
+		It("Reports deletion in progress while the destroy job is pending.", func() {
+			Ω(client.GetOrCreateVMInstance(
+				ctx,
+				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				Should(Succeed())
+
+			server.SetJobPolls(1)
+			Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).Should(MatchError("VM deletion in progress"))
+			server.CompleteJobs()
+			Ω(client.DestroyVMInstance(ctx, dummies.CSMachine1)).Should(Succeed())
+		})
+
+		It("Returns injected API errors.", func() {
+			server.FailNext("deployVirtualMachine", fakeacs.ErrorCodeInsufficientCapacity, 4325,
+				"Unable to create a deployment for VM")
+			Ω(client.GetOrCreateVMInstance(
+				ctx,
+				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				Should(MatchError(ContainSubstring("Unable to create a deployment for VM")))
+			Ω(server.Count(fakeacs.KindVirtualMachine)).Should(BeZero())
+		})
+	})
+
+	Context("When setting up an isolated network", func() {
+		It("Creates the network, public IP, load balancer and firewall rules idempotently.", func() {
+			server.AddPublicIPAddress(zoneID, "192.168.1.10")
+			dummies.CSCluster.Spec.ControlPlaneEndpoint.Host = ""
+
+			Ω(client.GetOrCreateIsolatedNetwork(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+			Ω(client.GetOrCreateIsolatedNetwork(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+
+			Ω(server.Count(fakeacs.KindNetwork)).Should(Equal(2))
+			Ω(server.Count(fakeacs.KindLBRule)).Should(Equal(1))
+			Ω(server.Count(fakeacs.KindEgressRule)).Should(Equal(1))
+			Ω(dummies.CSCluster.Spec.ControlPlaneEndpoint.Host).Should(Equal("192.168.1.10"))
+			ip, found := server.Get(fakeacs.KindPublicIPAddress, dummies.CSISONet1.Status.PublicIPID)
+			Ω(found).Should(BeTrue())
+			Ω(ip["associatednetworkid"]).Should(Equal(dummies.CSISONet1.Spec.ID))
+
+			tags, err := client.GetTags(ctx, cloud.ResourceTypeNetwork, dummies.CSISONet1.Spec.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(tags).Should(HaveKey(cloud.CreatedByCAPCTagName))
+		})
+
+		It("Tags the network and public IP with the additional tags of the cluster.", func() {
+			server.AddPublicIPAddress(zoneID, "192.168.1.10")
+			dummies.CSCluster.Spec.ControlPlaneEndpoint.Host = ""
+			dummies.CSCluster.Spec.AdditionalTags = map[string]string{"team": "platform", "cost-center": "1234"}
+			Ω(client.GetOrCreateIsolatedNetwork(ctx, dummies.CSFailureDomain1, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+
+			Ω(client.ReconcileIsoNetTags(ctx, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+			dummies.CSCluster.Spec.AdditionalTags = map[string]string{"team": "storage"}
+			Ω(client.ReconcileIsoNetTags(ctx, dummies.CSISONet1, dummies.CSCluster)).Should(Succeed())
+
+			for rType, rID := range map[cloud.ResourceType]string{
+				cloud.ResourceTypeNetwork:   dummies.CSISONet1.Spec.ID,
+				cloud.ResourceTypeIPAddress: dummies.CSISONet1.Status.PublicIPID,
+			} {
+				tags, err := client.GetTags(ctx, rType, rID)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(tags).Should(HaveKeyWithValue("team", "storage"))
+				Ω(tags).ShouldNot(HaveKey("cost-center"))
+				Ω(tags).Should(HaveKey(cloud.CreatedByCAPCTagName))
+			}
+		})
+	})
+
+	Context("When managing affinity groups", func() {
+		It("Creates a group and moves a VM into it.", func() {
+			group := &cloud.AffinityGroup{Name: "fake-affinity-group", Type: cloud.AffinityGroupType}
+			Ω(client.GetOrCreateAffinityGroup(ctx, group)).Should(Succeed())
+			Ω(group.ID).ShouldNot(BeEmpty())
+
+			Ω(client.GetOrCreateVMInstance(
+				ctx,
+				dummies.CSMachine1, dummies.CAPIMachine, dummies.CSCluster, dummies.CSFailureDomain1, dummies.CSAffinityGroup, "")).
+				Should(Succeed())
+			Ω(client.AssociateAffinityGroup(ctx, dummies.CSMachine1, *group)).Should(Succeed())
+
+			vm, found := server.Get(fakeacs.KindVirtualMachine, *dummies.CSMachine1.Spec.InstanceID)
+			Ω(found).Should(BeTrue())
+			Ω(vm["state"]).Should(Equal("Running"))
+			Ω(vm["affinitygroup"]).Should(HaveLen(1))
+
+			Ω(client.DisassociateAffinityGroup(ctx, dummies.CSMachine1, *group)).Should(Succeed())
+			Ω(client.DeleteAffinityGroup(ctx, group)).Should(Succeed())
+			Ω(server.Count(fakeacs.KindAffinityGroup)).Should(BeZero())
+		})
+
+		It("Tags a group with the additional tags of the cluster.", func() {
+			group := &cloud.AffinityGroup{Name: dummies.CSAffinityGroup.Spec.Name, Type: cloud.AffinityGroupType}
+			Ω(client.GetOrCreateAffinityGroup(ctx, group)).Should(Succeed())
+			dummies.CSAffinityGroup.Spec.ID = group.ID
+			dummies.CSCluster.Spec.AdditionalTags = map[string]string{"team": "platform"}
+
+			Ω(client.ReconcileAffinityGroupTags(ctx, dummies.CSAffinityGroup, dummies.CSCluster)).Should(Succeed())
+			Ω(client.GetTags(ctx, cloud.ResourceTypeAffinityGroup, group.ID)).
+				Should(Equal(map[string]string{"team": "platform"}))
+			Ω(dummies.CSAffinityGroup.Status.AppliedTags).Should(Equal(map[string]string{"team": "platform"}))
+		})
+	})
+})